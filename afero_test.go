@@ -22,7 +22,9 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"reflect"
 	"runtime"
+	"sort"
 	"strings"
 	"syscall"
 	"testing"
@@ -120,6 +122,35 @@ func TestOpenFile(t *testing.T) {
 	}
 }
 
+func TestOpenFileAppendAfterSeek(t *testing.T) {
+	defer removeAllTestFiles(t)
+	for _, fs := range Fss {
+		path := filepath.Join(testDir(fs), testName)
+		if err := WriteFile(fs, path, []byte("initial"), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		f, err := fs.OpenFile(path, os.O_RDWR|os.O_APPEND, 0600)
+		if err != nil {
+			t.Fatal(fs.Name(), err)
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			t.Fatal(fs.Name(), err)
+		}
+		io.WriteString(f, "|one")
+		f.Seek(2, io.SeekStart)
+		f.Write([]byte("|two"))
+		if _, err := f.WriteAt([]byte("x"), 0); err == nil {
+			t.Errorf("%v: WriteAt succeeded in append mode", fs.Name())
+		}
+		f.Close()
+
+		if data, err := ReadFile(fs, path); err != nil || string(data) != "initial|one|two" {
+			t.Errorf("%v: expected %q, got %q, %v", fs.Name(), "initial|one|two", data, err)
+		}
+	}
+}
+
 func TestCreate(t *testing.T) {
 	defer removeAllTestFiles(t)
 	for _, fs := range Fss {
@@ -297,6 +328,50 @@ func TestRemove(t *testing.T) {
 	}
 }
 
+func TestRemoveNonEmptyDir(t *testing.T) {
+	defer removeAllTestFiles(t)
+	for _, fs := range Fss {
+		dir := testDir(fs)
+		sub := filepath.Join(dir, "sub")
+		fs.MkdirAll(filepath.Join(sub, "nested"), 0777)
+		WriteFile(fs, filepath.Join(dir, "file"), []byte("x"), 0644)
+		fs.Rename(filepath.Join(dir, "file"), filepath.Join(sub, "file"))
+
+		err := fs.Remove(sub)
+		if perr, ok := err.(*os.PathError); !ok || perr.Err != syscall.ENOTEMPTY {
+			t.Errorf("%s: Remove of a non-empty directory: got %v, want ENOTEMPTY", fs.Name(), err)
+		}
+		if _, err := fs.Stat(filepath.Join(sub, "file")); err != nil {
+			t.Errorf("%s: child gone after a failed Remove: %v", fs.Name(), err)
+		}
+
+		if err := fs.Remove(filepath.Join(sub, "file")); err != nil {
+			t.Fatalf("%s: %v", fs.Name(), err)
+		}
+		if err := fs.Remove(filepath.Join(sub, "nested")); err != nil {
+			t.Fatalf("%s: %v", fs.Name(), err)
+		}
+		if err := fs.Remove(sub); err != nil {
+			t.Errorf("%s: Remove of an emptied directory: %v", fs.Name(), err)
+		}
+
+		fs.MkdirAll(filepath.Join(sub, "nested"), 0777)
+		// a sibling sharing the name as a prefix is left alone
+		sibling := sub + "ling"
+		fs.MkdirAll(sibling, 0777)
+		WriteFile(fs, filepath.Join(sibling, "file"), []byte("x"), 0644)
+		if err := fs.RemoveAll(sub); err != nil {
+			t.Errorf("%s: RemoveAll: %v", fs.Name(), err)
+		}
+		if _, err := fs.Stat(sub); !os.IsNotExist(err) {
+			t.Errorf("%s: RemoveAll left %s: %v", fs.Name(), sub, err)
+		}
+		if _, err := fs.Stat(filepath.Join(sibling, "file")); err != nil {
+			t.Errorf("%s: RemoveAll of %s removed %s: %v", fs.Name(), sub, sibling, err)
+		}
+	}
+}
+
 func TestTruncate(t *testing.T) {
 	defer removeAllTestFiles(t)
 	for _, fs := range Fss {
@@ -573,6 +648,56 @@ func TestReaddir(t *testing.T) {
 	}
 }
 
+func TestReaddirPaging(t *testing.T) {
+	defer removeAllTestFiles(t)
+	for _, fs := range Fss {
+		dir := testDir(fs)
+		for i := 0; i < 5; i++ {
+			WriteFile(fs, filepath.Join(dir, fmt.Sprint(i)), nil, 0644)
+		}
+		f, err := fs.Open(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+
+		var got []int
+		for calls := 0; ; calls++ {
+			if calls > 10 {
+				t.Fatalf("%s: Readdir(2) never returned io.EOF", fs.Name())
+			}
+			names, err := f.Readdirnames(2)
+			if err == io.EOF {
+				if len(names) != 0 {
+					t.Errorf("%s: entries returned with io.EOF: %v", fs.Name(), names)
+				}
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, len(names))
+		}
+		if fmt.Sprint(got) != "[2 2 1]" {
+			t.Errorf("%s: Readdir(2) returned %v entries, want [2 2 1]", fs.Name(), got)
+		}
+		if rest, err := f.Readdir(-1); len(rest) != 0 || err != nil {
+			t.Errorf("%s: Readdir(-1) at the end: %v, %v", fs.Name(), rest, err)
+		}
+		if _, err := f.Readdir(1); err != io.EOF {
+			t.Errorf("%s: Readdir(1) at the end: got %v, want io.EOF", fs.Name(), err)
+		}
+
+		// seeking to the start reads the directory again
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		if all, err := f.Readdir(-1); len(all) != 5 || err != nil {
+			t.Errorf("%s: Readdir(-1) after Seek: %d entries, %v", fs.Name(), len(all), err)
+		}
+	}
+}
+
 type myFileInfo []os.FileInfo
 
 func (m myFileInfo) String() string {
@@ -733,3 +858,60 @@ func checkSize(t *testing.T, f File, size int64) {
 		t.Errorf("Stat %q: size %d want %d", f.Name(), dir.Size(), size)
 	}
 }
+
+func TestOpenCurrentDir(t *testing.T) {
+	newBase := func() Fs {
+		fs := NewMemMapFs()
+		fs.MkdirAll("/sub/dir", 0755)
+		WriteFile(fs, "/file", nil, 0644)
+		WriteFile(fs, "/sub/dir/file", nil, 0644)
+		return fs
+	}
+	newLayer := func() Fs {
+		fs := NewMemMapFs()
+		WriteFile(fs, "/layer", nil, 0644)
+		return fs
+	}
+	for _, test := range []struct {
+		fs   Fs
+		want []string
+	}{
+		{newBase(), []string{"file", "sub"}},
+		{NewBasePathFs(newBase(), "/sub"), []string{"dir"}},
+		{NewReadOnlyFs(newBase()), []string{"file", "sub"}},
+		{NewCopyOnWriteFs(newBase(), newLayer()), []string{"file", "layer", "sub"}},
+		{NewCacheOnReadFs(newBase(), newLayer(), 0), []string{"file", "layer", "sub"}},
+	} {
+		for _, name := range []string{".", "", "./"} {
+			fi, err := test.fs.Stat(name)
+			if err != nil || !fi.IsDir() {
+				t.Errorf("%s: Stat %q: %v, %v", test.fs.Name(), name, fi, err)
+				continue
+			}
+			f, err := test.fs.Open(name)
+			if err != nil {
+				t.Errorf("%s: Open %q: %v", test.fs.Name(), name, err)
+				continue
+			}
+			names, err := f.Readdirnames(-1)
+			f.Close()
+			sort.Strings(names)
+			if err != nil || !reflect.DeepEqual(names, test.want) {
+				t.Errorf("%s: Readdirnames %q: %v, %v, want %v", test.fs.Name(), name, names, err, test.want)
+			}
+		}
+
+		// relative names are below the root, so a walk from "." works
+		var walked int
+		err := Walk(test.fs, ".", func(path string, info os.FileInfo, err error) error {
+			walked++
+			return err
+		})
+		if err != nil {
+			t.Errorf("%s: Walk: %v", test.fs.Name(), err)
+		}
+		if walked < len(test.want)+1 {
+			t.Errorf("%s: Walk visited %d names", test.fs.Name(), walked)
+		}
+	}
+}
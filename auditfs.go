@@ -0,0 +1,208 @@
+package afero
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// AuditRecord is a line of the log of an AuditFs, encoded as JSON.
+type AuditRecord struct {
+	Time time.Time `json:"time"`
+	Op   string    `json:"op"`
+	Path string    `json:"path"`
+	// To is the new name of a rename.
+	To string `json:"to,omitempty"`
+	// Bytes is the number of bytes of a write, to be written for the
+	// attempt and written for the result, or the size of a truncate.
+	Bytes int64 `json:"bytes"`
+	// Status is "attempt" before the operation, "ok" or "error" after it.
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// The AuditFs passes all calls to the base Fs, and records every change,
+// including the writes to the files it returns, in a log of JSON lines, one
+// AuditRecord per line. A change is logged as an attempt before it is made
+// and with its result after, so it is recorded even if it fails or never
+// returns. If the attempt can't be logged, the change is not made and the
+// error of the log writer is returned in an *os.PathError with Op "audit".
+// Reads, and opening files for reading only, are not logged.
+//
+// The operations use the Op names of SpyFs. AuditFs is safe for concurrent
+// use, the records are written one at a time.
+type AuditFs struct {
+	base Fs
+	mu   sync.Mutex
+	enc  *json.Encoder
+}
+
+func NewAuditFs(base Fs, logWriter io.Writer) *AuditFs {
+	return &AuditFs{base: base, enc: json.NewEncoder(logWriter)}
+}
+
+func (a *AuditFs) log(r AuditRecord) error {
+	r.Time = time.Now()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.enc.Encode(r)
+}
+
+// audit logs the attempt of op, does it by calling fn, and logs the result.
+// fn returns the number of bytes written, if any. An error of logging the
+// result is returned only if fn succeeded.
+func (a *AuditFs) audit(op, path, to string, bytes int64, fn func() (int64, error)) error {
+	if err := a.log(AuditRecord{Op: op, Path: path, To: to, Bytes: bytes, Status: "attempt"}); err != nil {
+		return &os.PathError{Op: "audit", Path: path, Err: err}
+	}
+	n, err := fn()
+	r := AuditRecord{Op: op, Path: path, To: to, Bytes: n, Status: "ok"}
+	if op == "truncate" {
+		r.Bytes = bytes
+	}
+	if err != nil {
+		r.Status, r.Error = "error", err.Error()
+	}
+	if lerr := a.log(r); lerr != nil && err == nil {
+		return &os.PathError{Op: "audit", Path: path, Err: lerr}
+	}
+	return err
+}
+
+// do audits an operation without bytes.
+func (a *AuditFs) do(op, path, to string, fn func() error) error {
+	return a.audit(op, path, to, 0, func() (int64, error) {
+		return 0, fn()
+	})
+}
+
+func (a *AuditFs) Name() string {
+	return "AuditFs"
+}
+
+func (a *AuditFs) Create(name string) (File, error) {
+	var f File
+	err := a.do("create", name, "", func() (err error) {
+		f, err = a.base.Create(name)
+		return err
+	})
+	if err != nil {
+		if f != nil {
+			// opened, but the result could not be logged
+			f.Close()
+		}
+		return nil, err
+	}
+	return &auditFile{File: f, fs: a}, nil
+}
+
+func (a *AuditFs) Open(name string) (File, error) {
+	return a.base.Open(name)
+}
+
+func (a *AuditFs) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) == 0 {
+		return a.base.OpenFile(name, flag, perm)
+	}
+	var f File
+	err := a.do("openfile", name, "", func() (err error) {
+		f, err = a.base.OpenFile(name, flag, perm)
+		return err
+	})
+	if err != nil {
+		if f != nil {
+			// opened, but the result could not be logged
+			f.Close()
+		}
+		return nil, err
+	}
+	return &auditFile{File: f, fs: a}, nil
+}
+
+func (a *AuditFs) Mkdir(name string, perm os.FileMode) error {
+	return a.do("mkdir", name, "", func() error {
+		return a.base.Mkdir(name, perm)
+	})
+}
+
+func (a *AuditFs) MkdirAll(path string, perm os.FileMode) error {
+	return a.do("mkdirall", path, "", func() error {
+		return a.base.MkdirAll(path, perm)
+	})
+}
+
+func (a *AuditFs) Remove(name string) error {
+	return a.do("remove", name, "", func() error {
+		return a.base.Remove(name)
+	})
+}
+
+func (a *AuditFs) RemoveAll(path string) error {
+	return a.do("removeall", path, "", func() error {
+		return a.base.RemoveAll(path)
+	})
+}
+
+func (a *AuditFs) Rename(oldname, newname string) error {
+	return a.do("rename", oldname, newname, func() error {
+		return a.base.Rename(oldname, newname)
+	})
+}
+
+func (a *AuditFs) Stat(name string) (os.FileInfo, error) {
+	return a.base.Stat(name)
+}
+
+func (a *AuditFs) Chmod(name string, mode os.FileMode) error {
+	return a.do("chmod", name, "", func() error {
+		return a.base.Chmod(name, mode)
+	})
+}
+
+func (a *AuditFs) Chtimes(name string, atime, mtime time.Time) error {
+	return a.do("chtimes", name, "", func() error {
+		return a.base.Chtimes(name, atime, mtime)
+	})
+}
+
+// auditFile is a file opened for writing by an AuditFs.
+type auditFile struct {
+	File
+	fs *AuditFs
+}
+
+func (f *auditFile) write(op string, size int, fn func() (int, error)) (int, error) {
+	var n int
+	err := f.fs.audit(op, f.Name(), "", int64(size), func() (int64, error) {
+		var err error
+		n, err = fn()
+		return int64(n), err
+	})
+	return n, err
+}
+
+func (f *auditFile) Write(p []byte) (int, error) {
+	return f.write("write", len(p), func() (int, error) {
+		return f.File.Write(p)
+	})
+}
+
+func (f *auditFile) WriteAt(p []byte, off int64) (int, error) {
+	return f.write("writeat", len(p), func() (int, error) {
+		return f.File.WriteAt(p, off)
+	})
+}
+
+func (f *auditFile) WriteString(s string) (int, error) {
+	return f.write("writestring", len(s), func() (int, error) {
+		return f.File.WriteString(s)
+	})
+}
+
+func (f *auditFile) Truncate(size int64) error {
+	return f.fs.audit("truncate", f.Name(), "", size, func() (int64, error) {
+		return 0, f.File.Truncate(size)
+	})
+}
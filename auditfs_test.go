@@ -0,0 +1,137 @@
+package afero
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestAuditFs(t *testing.T) {
+	var log bytes.Buffer
+	fs := NewAuditFs(NewMemMapFs(), &log)
+
+	fs.MkdirAll("/data", 0755)
+	f, err := fs.Create("/data/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("hello")
+	f.Close()
+	ReadFile(fs, "/data/file")
+	fs.Rename("/data/file", "/data/moved")
+	if err := fs.Remove("/data/missing"); err == nil {
+		t.Error("remove of a missing file: expected an error")
+	}
+
+	var got []string
+	scanner := bufio.NewScanner(&log)
+	for scanner.Scan() {
+		var r AuditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			t.Fatalf("line %q: %v", scanner.Text(), err)
+		}
+		if r.Time.IsZero() {
+			t.Errorf("line %q: no time", scanner.Text())
+		}
+		s := fmt.Sprintf("%s %s %s %d %s", r.Status, r.Op, r.Path, r.Bytes, r.To)
+		if r.Error != "" {
+			s += " failed"
+		}
+		got = append(got, s)
+	}
+	want := []string{
+		"attempt mkdirall /data 0 ",
+		"ok mkdirall /data 0 ",
+		"attempt create /data/file 0 ",
+		"ok create /data/file 0 ",
+		"attempt writestring /data/file 5 ",
+		"ok writestring /data/file 5 ",
+		"attempt rename /data/file 0 /data/moved",
+		"ok rename /data/file 0 /data/moved",
+		"attempt remove /data/missing 0 ",
+		"error remove /data/missing 0  failed",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("log:\ngot  %q\nwant %q", got, want)
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("log is full")
+}
+
+func TestAuditFsLogFailure(t *testing.T) {
+	base := NewMemMapFs()
+	fs := NewAuditFs(base, failingWriter{})
+
+	err := fs.Mkdir("/dir", 0755)
+	if perr, ok := err.(*os.PathError); !ok || perr.Op != "audit" {
+		t.Errorf("mkdir with a failing log: got %v", err)
+	}
+	if ok, _ := Exists(base, "/dir"); ok {
+		t.Error("change made although it could not be logged")
+	}
+}
+
+// resultFailingWriter fails every write after the first one, the attempt of
+// an operation is logged but its result is not.
+type resultFailingWriter struct{ n int }
+
+func (w *resultFailingWriter) Write(p []byte) (int, error) {
+	if w.n++; w.n > 1 {
+		return 0, errors.New("log is full")
+	}
+	return len(p), nil
+}
+
+// openCountingFs counts the files opened through it and not closed yet.
+type openCountingFs struct {
+	Fs
+	open int
+}
+
+type countedFile struct {
+	File
+	fs *openCountingFs
+}
+
+func (f *countedFile) Close() error {
+	f.fs.open--
+	return f.File.Close()
+}
+
+func (c *openCountingFs) Create(name string) (File, error) {
+	return c.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+func (c *openCountingFs) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	f, err := c.Fs.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	c.open++
+	return &countedFile{File: f, fs: c}, nil
+}
+
+func TestAuditFsLogFailureClosesFile(t *testing.T) {
+	base := &openCountingFs{Fs: NewMemMapFs()}
+
+	fs := NewAuditFs(base, &resultFailingWriter{})
+	if _, err := fs.Create("/f"); err == nil {
+		t.Error("create with a failing log: expected an error")
+	}
+	fs = NewAuditFs(base, &resultFailingWriter{})
+	if _, err := fs.OpenFile("/f", os.O_WRONLY, 0); err == nil {
+		t.Error("openfile with a failing log: expected an error")
+	}
+	if base.open != 0 {
+		t.Errorf("%d files left open", base.open)
+	}
+}
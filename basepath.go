@@ -10,8 +10,8 @@ import (
 // The BasePathFs restricts all operations to a given path within an Fs.
 // The given file name to the operations on this Fs will be prepended with
 // the base path before calling the base Fs.
-// Any file name (after filepath.Clean()) outside this base path will be
-// treated as non existing file.
+// Any file name (after NormalizePath()) outside this base path is rejected
+// with an *os.PathError wrapping os.ErrPermission.
 //
 // Note that it does not clean the error messages on return, so you may
 // reveal the real path on errors.
@@ -24,27 +24,46 @@ func NewBasePathFs(source Fs, path string) Fs {
 	return &BasePathFs{source: source, path: path}
 }
 
-// on a file outside the base path it returns the given file name and an error,
-// else the given file with the base path prepended
+// on a file outside the base path it returns the given file name and an
+// *os.PathError with op "realpath" wrapping os.ErrPermission, else the given
+// file with the base path prepended
 func (b *BasePathFs) RealPath(name string) (path string, err error) {
-	bpath := filepath.Clean(b.path)
-	path = filepath.Clean(filepath.Join(bpath, name))
-	if !strings.HasPrefix(path, bpath) {
-		return name, os.ErrNotExist
+	// a volume name (C:, \\host\share) can't be joined below the base
+	if filepath.VolumeName(name) != "" {
+		return name, &os.PathError{Op: "realpath", Path: name, Err: os.ErrPermission}
+	}
+	bpath := NormalizePath(b.path)
+	path = filepath.Join(bpath, NormalizePath(name))
+	rel, err := filepath.Rel(bpath, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return name, &os.PathError{Op: "realpath", Path: name, Err: os.ErrPermission}
 	}
 	return path, nil
 }
 
+// LogicalPath is the inverse of RealPath: it returns realPath, a name in the
+// source Fs, as a name of the BasePathFs, i.e. with the base path stripped
+// and rooted at the separator. On a name outside the base path it returns
+// the given name and an *os.PathError with op "logicalpath" wrapping
+// os.ErrPermission.
+func (b *BasePathFs) LogicalPath(realPath string) (path string, err error) {
+	rel, err := filepath.Rel(NormalizePath(b.path), NormalizePath(realPath))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return realPath, &os.PathError{Op: "logicalpath", Path: realPath, Err: os.ErrPermission}
+	}
+	return filepath.Join(string(filepath.Separator), rel), nil
+}
+
 func (b *BasePathFs) Chtimes(name string, atime, mtime time.Time) (err error) {
 	if name, err = b.RealPath(name); err != nil {
-		return &os.PathError{"chtimes", name, err}
+		return err
 	}
 	return b.source.Chtimes(name, atime, mtime)
 }
 
 func (b *BasePathFs) Chmod(name string, mode os.FileMode) (err error) {
 	if name, err = b.RealPath(name); err != nil {
-		return &os.PathError{"chmod", name, err}
+		return err
 	}
 	return b.source.Chmod(name, mode)
 }
@@ -55,66 +74,66 @@ func (b *BasePathFs) Name() string {
 
 func (b *BasePathFs) Stat(name string) (fi os.FileInfo, err error) {
 	if name, err = b.RealPath(name); err != nil {
-		return nil, &os.PathError{"stat", name, err}
+		return nil, err
 	}
 	return b.source.Stat(name)
 }
 
 func (b *BasePathFs) Rename(oldname, newname string) (err error) {
 	if oldname, err = b.RealPath(oldname); err != nil {
-		return &os.PathError{"rename", oldname, err}
+		return err
 	}
 	if newname, err = b.RealPath(newname); err != nil {
-		return &os.PathError{"rename", newname, err}
+		return err
 	}
 	return b.source.Rename(oldname, newname)
 }
 
 func (b *BasePathFs) RemoveAll(name string) (err error) {
 	if name, err = b.RealPath(name); err != nil {
-		return &os.PathError{"remove_all", name, err}
+		return err
 	}
 	return b.source.RemoveAll(name)
 }
 
 func (b *BasePathFs) Remove(name string) (err error) {
 	if name, err = b.RealPath(name); err != nil {
-		return &os.PathError{"remove", name, err}
+		return err
 	}
 	return b.source.Remove(name)
 }
 
 func (b *BasePathFs) OpenFile(name string, flag int, mode os.FileMode) (f File, err error) {
 	if name, err = b.RealPath(name); err != nil {
-		return nil, &os.PathError{"openfile", name, err}
+		return nil, err
 	}
 	return b.source.OpenFile(name, flag, mode)
 }
 
 func (b *BasePathFs) Open(name string) (f File, err error) {
 	if name, err = b.RealPath(name); err != nil {
-		return nil, &os.PathError{"open", name, err}
+		return nil, err
 	}
 	return b.source.Open(name)
 }
 
 func (b *BasePathFs) Mkdir(name string, mode os.FileMode) (err error) {
 	if name, err = b.RealPath(name); err != nil {
-		return &os.PathError{"mkdir", name, err}
+		return err
 	}
 	return b.source.Mkdir(name, mode)
 }
 
 func (b *BasePathFs) MkdirAll(name string, mode os.FileMode) (err error) {
 	if name, err = b.RealPath(name); err != nil {
-		return &os.PathError{"mkdir", name, err}
+		return err
 	}
 	return b.source.MkdirAll(name, mode)
 }
 
 func (b *BasePathFs) Create(name string) (f File, err error) {
 	if name, err = b.RealPath(name); err != nil {
-		return nil, &os.PathError{"create", name, err}
+		return nil, err
 	}
 	return b.source.Create(name)
 }
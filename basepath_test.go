@@ -2,6 +2,7 @@ package afero
 
 import (
 	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -35,3 +36,76 @@ func TestBasePathRoot(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestBasePathTraversal(t *testing.T) {
+	baseFs := &MemMapFs{}
+	baseFs.MkdirAll("/base/path/a", 0777)
+	baseFs.MkdirAll("/base/pathological", 0777)
+	bp := NewBasePathFs(baseFs, "/base/path").(*BasePathFs)
+
+	for _, name := range []string{"../", "../../etc/passwd", "./a/../../b", "a/../../pathological", ".."} {
+		if p, err := bp.RealPath(name); err == nil {
+			t.Errorf("%q: escaped the base path to %q", name, p)
+		} else if perr, ok := err.(*os.PathError); !ok || perr.Op != "realpath" || perr.Err != os.ErrPermission {
+			t.Errorf("%q: expected a realpath permission error, got %#v", name, err)
+		}
+		if _, err := bp.Stat(name); !os.IsPermission(err) {
+			t.Errorf("%q: expected a permission error from Stat, got %v", name, err)
+		}
+	}
+
+	for name, want := range map[string]string{
+		"/abs":           "/base/path/abs",
+		"./a/../b":       "/base/path/b",
+		"/":              "/base/path",
+		"a/../../path/x": "/base/path/x",
+	} {
+		p, err := bp.RealPath(name)
+		if err != nil {
+			t.Errorf("%q: %v", name, err)
+		} else if p != filepath.Clean(want) {
+			t.Errorf("%q: got %q, want %q", name, p, want)
+		}
+	}
+}
+
+func TestBasePathLogicalPath(t *testing.T) {
+	baseFs := &MemMapFs{}
+	baseFs.MkdirAll("/base/path/a/b", 0777)
+	WriteFile(baseFs, "/base/path/a/b/file", nil, 0644)
+	bp := NewBasePathFs(baseFs, "/base/path").(*BasePathFs)
+
+	for real, want := range map[string]string{
+		"/base/path":             "/",
+		"/base/path/":            "/",
+		"/base/path/a/b/file":    "/a/b/file",
+		"/base/path/a/../a/file": "/a/file",
+	} {
+		p, err := bp.LogicalPath(filepath.FromSlash(real))
+		if err != nil {
+			t.Errorf("%q: %v", real, err)
+		} else if p != filepath.FromSlash(want) {
+			t.Errorf("%q: got %q, want %q", real, p, want)
+		}
+	}
+
+	for _, real := range []string{"/base", "/base/pathological", "/etc/passwd", "base/path/a", "/base/path/../x"} {
+		if p, err := bp.LogicalPath(filepath.FromSlash(real)); err == nil {
+			t.Errorf("%q: outside the base path, got %q", real, p)
+		} else if perr, ok := err.(*os.PathError); !ok || perr.Op != "logicalpath" || perr.Err != os.ErrPermission {
+			t.Errorf("%q: expected a logicalpath permission error, got %#v", real, err)
+		}
+	}
+
+	// round trip of the paths found walking the source
+	Walk(baseFs, "/base/path", func(path string, info os.FileInfo, err error) error {
+		logical, err := bp.LogicalPath(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if real, err := bp.RealPath(logical); err != nil || real != path {
+			t.Errorf("%q: round trip through %q gave %q, %v", path, logical, real, err)
+		}
+		return nil
+	})
+}
@@ -1,7 +1,14 @@
 package afero
 
 import (
+	"container/list"
+	"context"
+	"errors"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 )
@@ -18,15 +25,78 @@ import (
 // This caching union will forward all write calls also to the base file
 // system first. To prevent writing to the base Fs, wrap it in a read-only
 // filter - Note: this will also make the overlay read-only, for writing files
-// in the overlay, use the overlay Fs directly, not via the union Fs.
+// in the overlay, use the overlay Fs directly, not via the union Fs, e.g.
+// through Layer().
 type CacheOnReadFs struct {
+	// atomic requires 64-bit alignment for struct field access
+	stats     CacheStats
 	base      Fs
 	layer     Fs
 	cacheTime time.Duration
+	lru       *cacheLRU     // nil if the layer is unbounded
+	observer  CacheObserver // may be nil
+	progress  ProgressFunc  // may be nil
 }
 
-func NewCacheOnReadFs(base Fs, layer Fs, cacheTime time.Duration) Fs {
-	return &CacheOnReadFs{base: base, layer: layer, cacheTime: cacheTime}
+func NewCacheOnReadFs(base Fs, layer Fs, cacheTime time.Duration, opts ...CacheOption) Fs {
+	u := &CacheOnReadFs{base: base, layer: layer, cacheTime: cacheTime}
+	for _, opt := range opts {
+		opt(u)
+	}
+	return u
+}
+
+// NewCacheOnReadFsWithEviction returns a CacheOnReadFs whose copies of base
+// files in the layer take at most maxBytes. When copying a file would
+// exceed it, the least recently opened copies are removed from the layer.
+// Only copies made by the CacheOnReadFs are counted and evicted, files
+// written to the layer otherwise are left alone. A single file larger than
+// maxBytes is still cached, until the next copy evicts it.
+func NewCacheOnReadFsWithEviction(base Fs, layer Fs, cacheTime time.Duration, maxBytes int64, opts ...CacheOption) Fs {
+	u := NewCacheOnReadFs(base, layer, cacheTime, opts...).(*CacheOnReadFs)
+	u.lru = newCacheLRU(maxBytes)
+	return u
+}
+
+// Base returns the file system files are read from.
+func (u *CacheOnReadFs) Base() Fs {
+	return u.base
+}
+
+// Layer returns the file system files are cached in.
+func (u *CacheOnReadFs) Layer() Fs {
+	return u.layer
+}
+
+// A CacheOption configures a CacheOnReadFs when passed to its constructor.
+type CacheOption func(*CacheOnReadFs)
+
+// A CacheObserver is notified of the state of the files looked up in a
+// CacheOnReadFs, e.g. to export metrics. Files present in the layer only
+// are not reported. The methods are called without holding any lock of the
+// CacheOnReadFs, so they may call back into it, but they delay the
+// operation, and must be safe for concurrent use.
+type CacheObserver interface {
+	OnHit(name string)   // served from the layer
+	OnMiss(name string)  // not present in the layer
+	OnStale(name string) // present in the layer, but the base is newer
+	OnEvict(name string) // removed from the layer to make room
+}
+
+// WithCacheObserver sets the CacheObserver of a CacheOnReadFs.
+func WithCacheObserver(o CacheObserver) CacheOption {
+	return func(u *CacheOnReadFs) {
+		u.observer = o
+	}
+}
+
+// WithCopyProgress makes a CacheOnReadFs report the progress of copying
+// files from the base to the layer to fn, e.g. to show the warming of a
+// cold layer from a slow base. fn must be safe for concurrent use.
+func WithCopyProgress(fn ProgressFunc) CacheOption {
+	return func(u *CacheOnReadFs) {
+		u.progress = fn
+	}
 }
 
 type cacheState int
@@ -46,7 +116,82 @@ const (
 	cacheLocal
 )
 
+// CacheStats holds the counters of a CacheOnReadFs, see Stats().
+type CacheStats struct {
+	Hits        int64 // file served from the layer
+	Misses      int64 // file not present in the layer
+	Stale       int64 // file present in the layer, but the base is newer
+	Local       int64 // file present in the layer only
+	BytesCopied int64 // bytes copied from the base to the layer
+}
+
+// Stats returns a snapshot of the cache counters. It is safe to call
+// concurrently with any other operation on the Fs.
+func (u *CacheOnReadFs) Stats() CacheStats {
+	return CacheStats{
+		Hits:        atomic.LoadInt64(&u.stats.Hits),
+		Misses:      atomic.LoadInt64(&u.stats.Misses),
+		Stale:       atomic.LoadInt64(&u.stats.Stale),
+		Local:       atomic.LoadInt64(&u.stats.Local),
+		BytesCopied: atomic.LoadInt64(&u.stats.BytesCopied),
+	}
+}
+
+// ResetStats sets all cache counters back to zero.
+func (u *CacheOnReadFs) ResetStats() {
+	atomic.StoreInt64(&u.stats.Hits, 0)
+	atomic.StoreInt64(&u.stats.Misses, 0)
+	atomic.StoreInt64(&u.stats.Stale, 0)
+	atomic.StoreInt64(&u.stats.Local, 0)
+	atomic.StoreInt64(&u.stats.BytesCopied, 0)
+}
+
+// CachedFiles walks the layer and returns the names of the regular files in
+// it, in lexical order. These are the copies of base files and the files
+// written through the CacheOnReadFs. Whiteouts, which a layer shared with a
+// CopyOnWriteFs may hold, are skipped.
+func (u *CacheOnReadFs) CachedFiles() ([]string, error) {
+	var names []string
+	err := Walk(u.layer, FilePathSeparator, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() && !strings.HasPrefix(info.Name(), whiteoutPrefix) {
+			names = append(names, path)
+		}
+		return nil
+	})
+	return names, err
+}
+
+func (u *CacheOnReadFs) countState(name string, state cacheState) {
+	switch state {
+	case cacheHit:
+		atomic.AddInt64(&u.stats.Hits, 1)
+		if u.observer != nil {
+			u.observer.OnHit(name)
+		}
+	case cacheMiss:
+		atomic.AddInt64(&u.stats.Misses, 1)
+		if u.observer != nil {
+			u.observer.OnMiss(name)
+		}
+	case cacheStale:
+		atomic.AddInt64(&u.stats.Stale, 1)
+		if u.observer != nil {
+			u.observer.OnStale(name)
+		}
+	case cacheLocal:
+		atomic.AddInt64(&u.stats.Local, 1)
+	}
+}
+
 func (u *CacheOnReadFs) cacheStatus(name string) (state cacheState, fi os.FileInfo, err error) {
+	defer func() {
+		if err == nil {
+			u.countState(name, state)
+		}
+	}()
 	var lfi, bfi os.FileInfo
 	lfi, err = u.layer.Stat(name)
 	if err == nil {
@@ -65,20 +210,34 @@ func (u *CacheOnReadFs) cacheStatus(name string) (state cacheState, fi os.FileIn
 		return cacheHit, lfi, nil
 	}
 
-	if err == syscall.ENOENT {
+	if errors.Is(err, os.ErrNotExist) || errors.Is(err, syscall.ENOENT) {
 		return cacheMiss, nil, nil
 	}
-	var ok bool
-	if err, ok = err.(*os.PathError); ok {
-		if err == os.ErrNotExist {
-			return cacheMiss, nil, nil
-		}
-	}
 	return cacheMiss, nil, err
 }
 
 func (u *CacheOnReadFs) copyToLayer(name string) error {
-	return copyToLayer(u.base, u.layer, name)
+	return u.copyToLayerContext(context.Background(), name)
+}
+
+func (u *CacheOnReadFs) copyToLayerContext(ctx context.Context, name string) error {
+	n, err := copyToLayerContext(ctx, u.base, u.layer, name, u.progress)
+	if err == nil {
+		atomic.AddInt64(&u.stats.BytesCopied, n)
+		u.evict(u.lru.add(name, n))
+	}
+	return err
+}
+
+// evict removes the given copies from the layer. Errors are ignored: a copy
+// which can't be removed is just no longer accounted for.
+func (u *CacheOnReadFs) evict(names []string) {
+	for _, name := range names {
+		u.layer.Remove(name)
+		if u.observer != nil {
+			u.observer.OnEvict(name)
+		}
+	}
 }
 
 func (u *CacheOnReadFs) Chtimes(name string, atime, mtime time.Time) error {
@@ -154,6 +313,7 @@ func (u *CacheOnReadFs) Rename(oldname, newname string) error {
 	if err != nil {
 		return err
 	}
+	u.lru.rename(oldname, newname)
 	return u.layer.Rename(oldname, newname)
 }
 
@@ -170,6 +330,7 @@ func (u *CacheOnReadFs) Remove(name string) error {
 	if err != nil {
 		return err
 	}
+	u.lru.remove(name, false)
 	return u.layer.Remove(name)
 }
 
@@ -186,37 +347,55 @@ func (u *CacheOnReadFs) RemoveAll(name string) error {
 	if err != nil {
 		return err
 	}
+	u.lru.remove(name, true)
 	return u.layer.RemoveAll(name)
 }
 
 func (u *CacheOnReadFs) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	if flag&(os.O_WRONLY|syscall.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) == 0 {
+		// read only, like Open: directories are merged from both layers
+		return u.Open(name)
+	}
 	st, _, err := u.cacheStatus(name)
 	if err != nil {
 		return nil, err
 	}
 	switch st {
-	case cacheLocal, cacheHit:
+	case cacheLocal:
+	case cacheHit:
+		u.lru.touch(name)
 	default:
 		if err := u.copyToLayer(name); err != nil {
 			return nil, err
 		}
 	}
-	if flag&(os.O_WRONLY|syscall.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) != 0 {
-		bfi, err := u.base.OpenFile(name, flag, perm)
-		if err != nil {
-			return nil, err
-		}
-		lfi, err := u.layer.OpenFile(name, flag, perm)
-		if err != nil {
-			bfi.Close() // oops, what if O_TRUNC was set and file opening in the layer failed...?
-			return nil, err
+	// Open the layer first: if that fails, the base has not been
+	// touched yet, i.e. not truncated with O_TRUNC.
+	lfi, err := u.layer.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	bfi, err := u.base.OpenFile(name, flag, perm)
+	if err != nil {
+		lfi.Close()
+		if flag&os.O_TRUNC != 0 && st != cacheLocal {
+			// the layer copy was truncated, but the base was not, drop
+			// it so the next access reads the base again
+			u.layer.Remove(name)
 		}
-		return &UnionFile{base: bfi, layer: lfi}, nil
+		return nil, err
 	}
-	return u.layer.OpenFile(name, flag, perm)
+	return &UnionFile{base: bfi, layer: lfi}, nil
 }
 
 func (u *CacheOnReadFs) Open(name string) (File, error) {
+	return u.OpenContext(context.Background(), name)
+}
+
+// OpenContext is like Open, but stops copying the file from the base to the
+// layer when ctx is done. The partial copy is removed from the layer and
+// the context's error is returned.
+func (u *CacheOnReadFs) OpenContext(ctx context.Context, name string) (File, error) {
 	st, fi, err := u.cacheStatus(name)
 	if err != nil {
 		return nil, err
@@ -234,20 +413,21 @@ func (u *CacheOnReadFs) Open(name string) (File, error) {
 		if bfi.IsDir() {
 			return u.base.Open(name)
 		}
-		if err := u.copyToLayer(name); err != nil {
+		if err := u.copyToLayerContext(ctx, name); err != nil {
 			return nil, err
 		}
 		return u.layer.Open(name)
 
 	case cacheStale:
 		if !fi.IsDir() {
-			if err := u.copyToLayer(name); err != nil {
+			if err := u.copyToLayerContext(ctx, name); err != nil {
 				return nil, err
 			}
 			return u.layer.Open(name)
 		}
 	case cacheHit:
 		if !fi.IsDir() {
+			u.lru.touch(name)
 			return u.layer.Open(name)
 		}
 	}
@@ -281,16 +461,123 @@ func (u *CacheOnReadFs) MkdirAll(name string, perm os.FileMode) error {
 }
 
 func (u *CacheOnReadFs) Create(name string) (File, error) {
-	bfh, err := u.base.Create(name)
+	_, lerr := u.layer.Stat(name)
+	_, berr := u.base.Stat(name)
+	local := lerr == nil && berr != nil
+	// Create in the layer first: if that fails, the base has not been
+	// created or truncated yet.
+	lfh, err := u.layer.Create(name)
 	if err != nil {
 		return nil, err
 	}
-	lfh, err := u.layer.Create(name)
+	bfh, err := u.base.Create(name)
 	if err != nil {
-		// oops, see comment about OS_TRUNC above, should we remove? then we have to
-		// remember if the file did not exist before
-		bfh.Close()
+		lfh.Close()
+		if !local {
+			// the layer was created or truncated, but the base was not,
+			// drop it so the next access reads the base again
+			u.layer.Remove(name)
+		}
 		return nil, err
 	}
 	return &UnionFile{base: bfh, layer: lfh}, nil
 }
+
+// cacheLRU tracks the copies in the layer of a CacheOnReadFs by the time
+// they were last used. All methods are no-ops on a nil cacheLRU.
+type cacheLRU struct {
+	mu      sync.Mutex
+	max     int64
+	size    int64
+	order   *list.List // of *cacheEntry, most recently used first
+	entries map[string]*list.Element
+}
+
+type cacheEntry struct {
+	name string
+	size int64
+}
+
+func newCacheLRU(max int64) *cacheLRU {
+	return &cacheLRU{max: max, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+// add records a new copy of name and returns the names of the least
+// recently used copies to evict to stay within the maximum size.
+func (c *cacheLRU) add(name string, size int64) (evict []string) {
+	if c == nil {
+		return nil
+	}
+	name = NormalizePath(name)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[name]; ok {
+		c.size -= e.Value.(*cacheEntry).size
+		c.order.Remove(e)
+	}
+	c.entries[name] = c.order.PushFront(&cacheEntry{name: name, size: size})
+	c.size += size
+	for c.size > c.max && c.order.Len() > 1 {
+		entry := c.order.Remove(c.order.Back()).(*cacheEntry)
+		delete(c.entries, entry.name)
+		c.size -= entry.size
+		evict = append(evict, entry.name)
+	}
+	return evict
+}
+
+// touch marks the copy of name as used.
+func (c *cacheLRU) touch(name string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[NormalizePath(name)]; ok {
+		c.order.MoveToFront(e)
+	}
+}
+
+// remove forgets the copy of name, with all stands for RemoveAll, i.e. the
+// copies below name are forgotten as well.
+func (c *cacheLRU) remove(name string, all bool) {
+	if c == nil {
+		return
+	}
+	name = NormalizePath(name)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for n, e := range c.entries {
+		if n == name || all && strings.HasPrefix(n, name+string(filepath.Separator)) {
+			c.size -= e.Value.(*cacheEntry).size
+			c.order.Remove(e)
+			delete(c.entries, n)
+		}
+	}
+}
+
+// rename moves the copy of oldname to newname, and the copies below it if
+// oldname is a directory.
+func (c *cacheLRU) rename(oldname, newname string) {
+	if c == nil {
+		return
+	}
+	oldname, newname = NormalizePath(oldname), NormalizePath(newname)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	moved := make(map[string]*list.Element)
+	for n, e := range c.entries {
+		if n == oldname || strings.HasPrefix(n, oldname+string(filepath.Separator)) {
+			moved[newname+strings.TrimPrefix(n, oldname)] = e
+			delete(c.entries, n)
+		}
+	}
+	for n, e := range moved {
+		if prev, ok := c.entries[n]; ok {
+			c.size -= prev.Value.(*cacheEntry).size
+			c.order.Remove(prev)
+		}
+		e.Value.(*cacheEntry).name = n
+		c.entries[n] = e
+	}
+}
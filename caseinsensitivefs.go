@@ -0,0 +1,210 @@
+package afero
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/text/cases"
+)
+
+// The CaseInsensitiveFs looks up names in the base Fs ignoring their case,
+// like the file systems of macOS and Windows do, so "Foo.TXT" and "foo.txt"
+// are the same file. It is meant to catch case sensitivity bugs in tests on
+// Linux. New files and directories are created with the case given, an
+// existing one matching in another case is used instead of creating a new
+// one. A rename changing only the case of a name renames the file.
+//
+// Names in the base differing only in case, which can't be created through
+// the CaseInsensitiveFs, are resolved sensibly: an exact match wins,
+// otherwise the first of them in lexical order is used. All of them are
+// listed in directories.
+//
+// The case folded names of a directory are indexed when it is first looked
+// up in. Changes made through the CaseInsensitiveFs update the index, names
+// added to the base otherwise are found by indexing the directory again if a
+// name is not found.
+type CaseInsensitiveFs struct {
+	base Fs
+
+	mu    sync.Mutex
+	index map[string]*caseDir // by the name of the directory in the base
+}
+
+// caseDir is the index of a directory.
+type caseDir struct {
+	names  map[string]bool
+	folded map[string]string // case folded name to name
+}
+
+func NewCaseInsensitiveFs(base Fs) Fs {
+	return &CaseInsensitiveFs{base: base, index: make(map[string]*caseDir)}
+}
+
+func foldCase(name string) string {
+	return cases.Fold().String(name)
+}
+
+// dirIndex returns the index of dir, reading it if it isn't indexed yet or
+// if reread is true, c.mu must be held.
+func (c *CaseInsensitiveFs) dirIndex(dir string, reread bool) (*caseDir, error) {
+	if d, ok := c.index[dir]; ok && !reread {
+		return d, nil
+	}
+	names, err := readDirNames(c.base, dir)
+	if err != nil {
+		delete(c.index, dir)
+		return nil, err
+	}
+	d := &caseDir{names: make(map[string]bool, len(names)), folded: make(map[string]string, len(names))}
+	// names are sorted, the first of colliding names is kept
+	for _, name := range names {
+		d.names[name] = true
+		if _, ok := d.folded[foldCase(name)]; !ok {
+			d.folded[foldCase(name)] = name
+		}
+	}
+	c.index[dir] = d
+	return d, nil
+}
+
+// lookup returns the name of the entry of dir matching name, and false if
+// there is none, c.mu must be held.
+func (c *CaseInsensitiveFs) lookup(dir, name string) (string, bool) {
+	for _, reread := range []bool{false, true} {
+		d, err := c.dirIndex(dir, reread)
+		if err != nil {
+			return "", false
+		}
+		if d.names[name] {
+			return name, true
+		}
+		if match, ok := d.folded[foldCase(name)]; ok {
+			return match, true
+		}
+	}
+	return "", false
+}
+
+// resolve returns name with every element replaced by the entry of the base
+// matching it. The elements from the first one not found on are kept.
+func (c *CaseInsensitiveFs) resolve(name string) string {
+	name = filepath.Clean(name)
+	dir, rest := ".", name
+	if filepath.IsAbs(name) {
+		dir = filepath.VolumeName(name) + FilePathSeparator
+		rest = name[len(dir):]
+	}
+	if rest == "" || rest == "." {
+		return name
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elems := strings.Split(rest, FilePathSeparator)
+	for i, elem := range elems {
+		if elem == ".." {
+			dir = filepath.Join(dir, elem)
+			continue
+		}
+		match, ok := c.lookup(dir, elem)
+		if !ok {
+			break
+		}
+		elems[i] = match
+		dir = filepath.Join(dir, match)
+	}
+	return filepath.Join(append([]string{name[:len(name)-len(rest)]}, elems...)...)
+}
+
+// forget drops the index of the directory of name, and of name and the
+// directories below it, after a change.
+func (c *CaseInsensitiveFs) forget(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.index, filepath.Dir(name))
+	for dir := range c.index {
+		if hasPathPrefix(dir, []string{name}) {
+			delete(c.index, dir)
+		}
+	}
+}
+
+func (c *CaseInsensitiveFs) Name() string {
+	return "CaseInsensitiveFs"
+}
+
+func (c *CaseInsensitiveFs) Create(name string) (File, error) {
+	name = c.resolve(name)
+	f, err := c.base.Create(name)
+	c.forget(name)
+	return f, err
+}
+
+func (c *CaseInsensitiveFs) Open(name string) (File, error) {
+	return c.base.Open(c.resolve(name))
+}
+
+func (c *CaseInsensitiveFs) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	name = c.resolve(name)
+	f, err := c.base.OpenFile(name, flag, perm)
+	if flag&os.O_CREATE != 0 {
+		c.forget(name)
+	}
+	return f, err
+}
+
+func (c *CaseInsensitiveFs) Mkdir(name string, perm os.FileMode) error {
+	name = c.resolve(name)
+	err := c.base.Mkdir(name, perm)
+	c.forget(name)
+	return err
+}
+
+func (c *CaseInsensitiveFs) MkdirAll(path string, perm os.FileMode) error {
+	path = c.resolve(path)
+	err := c.base.MkdirAll(path, perm)
+	c.forget(path)
+	return err
+}
+
+func (c *CaseInsensitiveFs) Remove(name string) error {
+	name = c.resolve(name)
+	err := c.base.Remove(name)
+	c.forget(name)
+	return err
+}
+
+func (c *CaseInsensitiveFs) RemoveAll(path string) error {
+	path = c.resolve(path)
+	err := c.base.RemoveAll(path)
+	c.forget(path)
+	return err
+}
+
+func (c *CaseInsensitiveFs) Rename(oldname, newname string) error {
+	oldname = c.resolve(oldname)
+	resolved := c.resolve(newname)
+	if resolved == oldname {
+		// only the case of the name changes
+		resolved = filepath.Join(filepath.Dir(resolved), filepath.Base(newname))
+	}
+	err := c.base.Rename(oldname, resolved)
+	c.forget(oldname)
+	c.forget(resolved)
+	return err
+}
+
+func (c *CaseInsensitiveFs) Stat(name string) (os.FileInfo, error) {
+	return c.base.Stat(c.resolve(name))
+}
+
+func (c *CaseInsensitiveFs) Chmod(name string, mode os.FileMode) error {
+	return c.base.Chmod(c.resolve(name), mode)
+}
+
+func (c *CaseInsensitiveFs) Chtimes(name string, atime, mtime time.Time) error {
+	return c.base.Chtimes(c.resolve(name), atime, mtime)
+}
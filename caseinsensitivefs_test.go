@@ -0,0 +1,82 @@
+package afero
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestCaseInsensitiveFs(t *testing.T) {
+	base := NewMemMapFs()
+	fs := NewCaseInsensitiveFs(base)
+
+	if err := fs.MkdirAll("/Data/Sub", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFile(fs, "/data/SUB/Foo.TXT", []byte("foo"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// the name of the base is kept, no second directory is created
+	if names, _ := ReadDirNames(base, "/"); !reflect.DeepEqual(names, []string{"Data"}) {
+		t.Errorf("base root: %v", names)
+	}
+	if names, _ := ReadDirNames(base, "/Data/Sub"); !reflect.DeepEqual(names, []string{"Foo.TXT"}) {
+		t.Errorf("base directory: %v", names)
+	}
+
+	for _, name := range []string{"/Data/Sub/Foo.TXT", "/data/sub/foo.txt", "/DATA/SUB/FOO.TXT"} {
+		if data, err := ReadFile(fs, name); err != nil || string(data) != "foo" {
+			t.Errorf("ReadFile(%q) = %q, %v", name, data, err)
+		}
+	}
+	if fi, err := fs.Stat("/data/sub/FOO.txt"); err != nil || fi.Name() != "Foo.TXT" {
+		t.Errorf("Stat: %v, %v", fi, err)
+	}
+
+	// writing in another case overwrites the file
+	WriteFile(fs, "/data/sub/foo.txt", []byte("bar"), 0644)
+	if data, _ := ReadFile(base, "/Data/Sub/Foo.TXT"); string(data) != "bar" {
+		t.Errorf("overwritten file: %q", data)
+	}
+
+	// a rename changing only the case renames the file
+	if err := fs.Rename("/data/sub/foo.txt", "/data/sub/foo.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if names, _ := ReadDirNames(fs, "/DATA/sub"); !reflect.DeepEqual(names, []string{"foo.txt"}) {
+		t.Errorf("after the rename: %v", names)
+	}
+
+	if err := fs.Remove("/DATA/SUB/FOO.TXT"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Stat("/data/sub/foo.txt"); !os.IsNotExist(err) {
+		t.Errorf("removed file: %v", err)
+	}
+}
+
+func TestCaseInsensitiveFsCollisions(t *testing.T) {
+	base := NewMemMapFs()
+	WriteFile(base, "/b", []byte("lower"), 0644)
+	WriteFile(base, "/B", []byte("upper"), 0644)
+	fs := NewCaseInsensitiveFs(base)
+
+	tests := []struct{ name, want string }{
+		{"/b", "lower"}, // exact matches win
+		{"/B", "upper"},
+	}
+	for _, tt := range tests {
+		if data, _ := ReadFile(fs, tt.name); string(data) != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, data, tt.want)
+		}
+	}
+	if names, _ := ReadDirNames(fs, "/"); !reflect.DeepEqual(names, []string{"B", "b"}) {
+		t.Errorf("colliding names listed as %v", names)
+	}
+
+	// files added to the base directly are found
+	WriteFile(base, "/New", []byte("new"), 0644)
+	if data, err := ReadFile(fs, "/new"); err != nil || string(data) != "new" {
+		t.Errorf("file added to the base: %q, %v", data, err)
+	}
+}
@@ -0,0 +1,404 @@
+package afero
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/afero/mem"
+)
+
+// casDir is the directory of a CASFs holding the blobs, in the root of the
+// base Fs.
+const casDir = ".cas"
+
+var errNotCASFile = errors.New("not a content-addressed file")
+
+// The CASFs stores the content of files by its SHA-256 hash, so identical
+// content is stored once, e.g. for caches and artifact stores. A file is a
+// small index file in the base Fs, holding the hex encoded hash of its
+// content, which is stored as a blob in the ".cas" directory of the base,
+// named after the hash. Directories, and the names, modes and times of the
+// files are those of the index files, the size is that of the blob.
+//
+// A file opened for writing is held in memory, its content is hashed and
+// stored when it is closed or synced. Blobs are not removed with the files
+// referencing them, Prune removes the blobs no longer referenced. The
+// ".cas" directory is hidden.
+type CASFs struct {
+	source Fs
+}
+
+func NewCASFs(source Fs) *CASFs {
+	return &CASFs{source: source}
+}
+
+func (c *CASFs) blobPath(hash string) string {
+	return filepath.Join(FilePathSeparator, casDir, hash[:2], hash)
+}
+
+// internal returns true for the names in the blob directory.
+func (c *CASFs) internal(name string) bool {
+	return hasPathPrefix(name, []string{filepath.Join(FilePathSeparator, casDir)})
+}
+
+func isRoot(name string) bool {
+	return NormalizePath(name) == FilePathSeparator
+}
+
+// Hash returns the hex encoded SHA-256 hash of the content of the file name,
+// under which its content is stored.
+func (c *CASFs) Hash(name string) (string, error) {
+	if c.internal(name) {
+		return "", &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	data, err := ReadFile(c.source, name)
+	if err != nil {
+		return "", err
+	}
+	hash := strings.TrimSpace(string(data))
+	if _, err := hex.DecodeString(hash); err != nil || len(hash) != 2*sha256.Size {
+		return "", &os.PathError{Op: "open", Path: name, Err: errNotCASFile}
+	}
+	return hash, nil
+}
+
+// store stores data as the content of name, the blob is written only if
+// there is none with the same content yet.
+func (c *CASFs) store(name string, data []byte, perm os.FileMode) error {
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	blob := c.blobPath(hash)
+	if _, err := c.source.Stat(blob); os.IsNotExist(err) {
+		if err := c.source.MkdirAll(filepath.Dir(blob), 0777); err != nil {
+			return err
+		}
+		// written aside first, so a blob is always complete
+		tmp, err := TempFile(c.source, filepath.Dir(blob), hash+".*")
+		if err != nil {
+			return err
+		}
+		_, err = tmp.Write(data)
+		if cerr := tmp.Close(); err == nil {
+			err = cerr
+		}
+		if err == nil {
+			err = c.source.Rename(tmp.Name(), blob)
+		}
+		if err != nil {
+			c.source.Remove(tmp.Name())
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+	return WriteFile(c.source, name, []byte(hash+"\n"), perm)
+}
+
+// Prune removes the blobs not referenced by any file.
+func (c *CASFs) Prune() error {
+	used := make(map[string]bool)
+	err := Walk(c.source, FilePathSeparator, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if c.internal(path) {
+			return filepath.SkipDir
+		}
+		if info.Mode().IsRegular() {
+			if hash, err := c.Hash(path); err == nil {
+				used[hash] = true
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return Walk(c.source, filepath.Join(FilePathSeparator, casDir), func(path string, info os.FileInfo, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() && !used[info.Name()] {
+			return c.source.Remove(path)
+		}
+		return nil
+	})
+}
+
+func (c *CASFs) Name() string {
+	return "CASFs"
+}
+
+func (c *CASFs) Create(name string) (File, error) {
+	return c.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+func (c *CASFs) Open(name string) (File, error) {
+	return c.OpenFile(name, os.O_RDONLY, 0)
+}
+
+func (c *CASFs) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	if c.internal(name) {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) == 0 {
+		return c.openRead(name, flag, perm)
+	}
+
+	fi, err := c.source.Stat(name)
+	exists := err == nil
+	switch {
+	case exists && fi.IsDir():
+		return nil, &os.PathError{Op: "open", Path: name, Err: syscall.EISDIR}
+	case exists && flag&os.O_CREATE != 0 && flag&os.O_EXCL != 0:
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrExist}
+	case !exists && (flag&os.O_CREATE == 0 || !os.IsNotExist(err)):
+		return nil, err
+	}
+	if !exists {
+		if _, err := c.source.Stat(filepath.Dir(name)); err != nil {
+			return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+		}
+	}
+
+	buf := mem.NewFileHandle(mem.CreateFile(name))
+	if flag&os.O_APPEND != 0 {
+		buf = mem.NewAppendFileHandle(mem.CreateFile(name))
+	}
+	f := &casFile{File: buf, fs: c, name: name, perm: perm}
+	if !exists || flag&os.O_TRUNC != 0 {
+		// the file exists, empty, from now on
+		if err := c.store(name, nil, perm); err != nil {
+			return nil, err
+		}
+		return f, nil
+	}
+	data, err := ReadFile(c, name)
+	if err != nil {
+		return nil, err
+	}
+	buf.Write(data)
+	buf.Seek(0, io.SeekStart)
+	return f, nil
+}
+
+// openRead opens name for reading, a file as its blob.
+func (c *CASFs) openRead(name string, flag int, perm os.FileMode) (File, error) {
+	f, err := c.source.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if fi.IsDir() {
+		return &casDirFile{File: f, fs: c, name: name}, nil
+	}
+	f.Close()
+	hash, err := c.Hash(name)
+	if err != nil {
+		return nil, err
+	}
+	blob, err := c.source.Open(c.blobPath(hash))
+	if err != nil {
+		return nil, err
+	}
+	return &casBlobFile{File: blob, name: name, fi: fi}, nil
+}
+
+func (c *CASFs) Mkdir(name string, perm os.FileMode) error {
+	return c.source.Mkdir(name, perm)
+}
+
+func (c *CASFs) MkdirAll(path string, perm os.FileMode) error {
+	return c.source.MkdirAll(path, perm)
+}
+
+func (c *CASFs) Remove(name string) error {
+	if c.internal(name) {
+		return &os.PathError{Op: "remove", Path: name, Err: os.ErrNotExist}
+	}
+	return c.source.Remove(name)
+}
+
+func (c *CASFs) RemoveAll(path string) error {
+	if c.internal(path) {
+		return nil
+	}
+	return c.source.RemoveAll(path)
+}
+
+func (c *CASFs) Rename(oldname, newname string) error {
+	if c.internal(oldname) || c.internal(newname) {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: os.ErrNotExist}
+	}
+	return c.source.Rename(oldname, newname)
+}
+
+func (c *CASFs) Stat(name string) (os.FileInfo, error) {
+	if c.internal(name) {
+		return nil, &os.PathError{Op: "stat", Path: name, Err: os.ErrNotExist}
+	}
+	fi, err := c.source.Stat(name)
+	if err != nil || !fi.Mode().IsRegular() {
+		return fi, err
+	}
+	return c.fileInfo(name, fi)
+}
+
+// fileInfo returns fi, of the index file name, with the size of its blob.
+func (c *CASFs) fileInfo(name string, fi os.FileInfo) (os.FileInfo, error) {
+	hash, err := c.Hash(name)
+	if err != nil {
+		return nil, err
+	}
+	bfi, err := c.source.Stat(c.blobPath(hash))
+	if err != nil {
+		return nil, err
+	}
+	return &casFileInfo{FileInfo: fi, size: bfi.Size()}, nil
+}
+
+func (c *CASFs) Chmod(name string, mode os.FileMode) error {
+	return c.source.Chmod(name, mode)
+}
+
+func (c *CASFs) Chtimes(name string, atime, mtime time.Time) error {
+	return c.source.Chtimes(name, atime, mtime)
+}
+
+type casFileInfo struct {
+	os.FileInfo
+	size int64
+}
+
+func (fi *casFileInfo) Size() int64 {
+	return fi.size
+}
+
+// casBlobFile is a file opened for reading, File is its blob.
+type casBlobFile struct {
+	File
+	name string
+	fi   os.FileInfo // of the index file
+}
+
+func (f *casBlobFile) Name() string {
+	return f.name
+}
+
+func (f *casBlobFile) Stat() (os.FileInfo, error) {
+	bfi, err := f.File.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return &casFileInfo{FileInfo: f.fi, size: bfi.Size()}, nil
+}
+
+// casFile is a file opened for writing, File holds its content in memory
+// until it is stored.
+type casFile struct {
+	File
+	fs    *CASFs
+	name  string
+	perm  os.FileMode
+	dirty bool
+}
+
+func (f *casFile) Write(p []byte) (int, error) {
+	f.dirty = true
+	return f.File.Write(p)
+}
+
+func (f *casFile) WriteAt(p []byte, off int64) (int, error) {
+	f.dirty = true
+	return f.File.WriteAt(p, off)
+}
+
+func (f *casFile) WriteString(s string) (int, error) {
+	return f.Write([]byte(s))
+}
+
+func (f *casFile) Truncate(size int64) error {
+	f.dirty = true
+	return f.File.Truncate(size)
+}
+
+// Sync stores the content written so far.
+func (f *casFile) Sync() error {
+	if !f.dirty {
+		return nil
+	}
+	fi, err := f.File.Stat()
+	if err != nil {
+		return err
+	}
+	data := make([]byte, fi.Size())
+	if _, err := f.File.ReadAt(data, 0); err != nil && err != io.EOF {
+		return err
+	}
+	if err := f.fs.store(f.name, data, f.perm); err != nil {
+		return err
+	}
+	f.dirty = false
+	return nil
+}
+
+func (f *casFile) Close() error {
+	err := f.Sync()
+	if cerr := f.File.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// casDirFile is a directory, reporting the sizes of the blobs and hiding the
+// blob directory in the root.
+type casDirFile struct {
+	File
+	fs   *CASFs
+	name string
+}
+
+func (d *casDirFile) Readdir(count int) ([]os.FileInfo, error) {
+	fis, err := d.File.Readdir(count)
+	list := fis[:0]
+	for _, fi := range fis {
+		if isRoot(d.name) && fi.Name() == casDir {
+			continue
+		}
+		if fi.Mode().IsRegular() {
+			if cfi, err := d.fs.fileInfo(filepath.Join(d.name, fi.Name()), fi); err == nil {
+				fi = cfi
+			}
+		}
+		list = append(list, fi)
+	}
+	return list, err
+}
+
+func (d *casDirFile) Readdirnames(n int) ([]string, error) {
+	names, err := d.File.Readdirnames(n)
+	if !isRoot(d.name) {
+		return names, err
+	}
+	list := names[:0]
+	for _, name := range names {
+		if name != casDir {
+			list = append(list, name)
+		}
+	}
+	return list, err
+}
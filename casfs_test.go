@@ -0,0 +1,125 @@
+package afero
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// countBlobs returns the number of blobs stored in base by a CASFs, not
+// counting the empty one.
+func countBlobs(t *testing.T, base Fs) int {
+	n := 0
+	err := Walk(base, "/"+casDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() && info.Size() > 0 {
+			n++
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestCASFsDeduplicates(t *testing.T) {
+	base := NewMemMapFs()
+	fs := NewCASFs(base)
+	content := strings.Repeat("artifact ", 1000)
+
+	fs.MkdirAll("/builds/1", 0755)
+	fs.MkdirAll("/builds/2", 0755)
+	for _, name := range []string{"/builds/1/app", "/builds/2/app", "/latest"} {
+		if err := WriteFile(fs, name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := countBlobs(t, base); n != 1 {
+		t.Errorf("identical content stored %d times", n)
+	}
+	h1, _ := fs.Hash("/builds/1/app")
+	h2, _ := fs.Hash("/latest")
+	if h1 == "" || h1 != h2 {
+		t.Errorf("hashes of identical files: %q, %q", h1, h2)
+	}
+
+	for _, name := range []string{"/builds/1/app", "/builds/2/app", "/latest"} {
+		if got, err := ReadFile(fs, name); err != nil || string(got) != content {
+			t.Errorf("%s: read %d bytes, %v", name, len(got), err)
+		}
+		if fi, err := fs.Stat(name); err != nil || fi.Size() != int64(len(content)) {
+			t.Errorf("%s: Stat: %v, %v", name, fi, err)
+		}
+	}
+
+	// changing one file leaves the others alone
+	if err := WriteFile(fs, "/latest", []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := ReadFile(fs, "/builds/2/app"); string(got) != content {
+		t.Errorf("other file changed: got %d bytes", len(got))
+	}
+	if n := countBlobs(t, base); n != 2 {
+		t.Errorf("%d blobs after changing a file, want 2", n)
+	}
+}
+
+func TestCASFsDirectories(t *testing.T) {
+	base := NewMemMapFs()
+	fs := NewCASFs(base)
+	WriteFile(fs, "/a", []byte("aaa"), 0644)
+	fs.Mkdir("/dir", 0755)
+
+	if names, err := ReadDirNames(fs, "/"); err != nil || !reflect.DeepEqual(names, []string{"a", "dir"}) {
+		t.Errorf("ReadDirNames: %v, %v", names, err)
+	}
+	fis, err := ReadDir(fs, "/")
+	if err != nil || len(fis) != 2 || fis[0].Size() != 3 {
+		t.Errorf("ReadDir: %v, %v", fis, err)
+	}
+	if _, err := fs.Open("/" + casDir); !os.IsNotExist(err) {
+		t.Errorf("blob directory visible: %v", err)
+	}
+	if _, err := fs.Open("/missing"); !os.IsNotExist(err) {
+		t.Errorf("missing file: %v", err)
+	}
+	if _, err := fs.Create("/missing/file"); !os.IsNotExist(err) {
+		t.Errorf("create in a missing directory: %v", err)
+	}
+}
+
+func TestCASFsAppendAndPrune(t *testing.T) {
+	base := NewMemMapFs()
+	fs := NewCASFs(base)
+	WriteFile(fs, "/log", []byte("one\n"), 0644)
+
+	f, err := fs.OpenFile("/log", os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("two\n")
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := ReadFile(fs, "/log"); string(got) != "one\ntwo\n" {
+		t.Errorf("after append: got %q", got)
+	}
+
+	// the first version is no longer used
+	if n := countBlobs(t, base); n != 2 {
+		t.Errorf("%d blobs before Prune, want 2", n)
+	}
+	if err := fs.Prune(); err != nil {
+		t.Fatal(err)
+	}
+	if n := countBlobs(t, base); n != 1 {
+		t.Errorf("%d blobs after Prune, want 1", n)
+	}
+	if got, _ := ReadFile(fs, "/log"); string(got) != "one\ntwo\n" {
+		t.Errorf("after Prune: got %q", got)
+	}
+}
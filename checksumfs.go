@@ -0,0 +1,305 @@
+package afero
+
+import (
+	"crypto"
+	_ "crypto/md5"
+	_ "crypto/sha1"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrChecksumMismatch is returned, wrapped in an *os.PathError, when opening
+// a file of a ChecksumFs whose content doesn't match its stored checksum.
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+var checksumAlgos = map[string]crypto.Hash{
+	"md5":    crypto.MD5,
+	"sha1":   crypto.SHA1,
+	"sha256": crypto.SHA256,
+	"sha512": crypto.SHA512,
+}
+
+// The ChecksumFs detects corrupted files. When a file written through it is
+// closed, the checksum of its content is stored in a sidecar file next to
+// it, named after the algorithm: "file.sha256". Opening the file for
+// reading verifies its content against the checksum first, a mismatch
+// fails with ErrChecksumMismatch. Files without a sidecar, e.g. written to
+// the base Fs directly, are not verified.
+//
+// The content is hashed while it is written, or read again after writing
+// to it other than sequentially, it is never buffered in memory. The
+// sidecar files are moved and removed with their files, and hidden in
+// directory listings.
+type ChecksumFs struct {
+	source Fs
+	algo   string
+	hash   crypto.Hash
+}
+
+// NewChecksumFs returns a ChecksumFs using the hash algorithm algo, one of
+// "md5", "sha1", "sha256" and "sha512".
+func NewChecksumFs(source Fs, algo string) (*ChecksumFs, error) {
+	h, ok := checksumAlgos[algo]
+	if !ok {
+		return nil, fmt.Errorf("unsupported checksum algorithm %q", algo)
+	}
+	return &ChecksumFs{source: source, algo: algo, hash: h}, nil
+}
+
+// sidecar returns the name of the file holding the checksum of name.
+func (c *ChecksumFs) sidecar(name string) string {
+	return name + "." + c.algo
+}
+
+func (c *ChecksumFs) sum(r io.Reader) (string, error) {
+	h := c.hash.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// verify checks the content of f against the checksum of name, and rewinds
+// f to the start.
+func (c *ChecksumFs) verify(name string, f File) error {
+	want, err := ReadFile(c.source, c.sidecar(name))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	got, err := c.sum(f)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(string(want)) != got {
+		return &os.PathError{Op: "open", Path: name, Err: ErrChecksumMismatch}
+	}
+	_, err = f.Seek(0, io.SeekStart)
+	return err
+}
+
+func (c *ChecksumFs) Name() string {
+	return "ChecksumFs"
+}
+
+func (c *ChecksumFs) Create(name string) (File, error) {
+	return c.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+func (c *ChecksumFs) Open(name string) (File, error) {
+	return c.OpenFile(name, os.O_RDONLY, 0)
+}
+
+func (c *ChecksumFs) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	f, err := c.source.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if fi.IsDir() {
+		return &checksumDir{File: f, fs: c, name: name}, nil
+	}
+	if flag&os.O_WRONLY == 0 && flag&os.O_TRUNC == 0 {
+		if err := c.verify(name, f); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	if flag&(os.O_WRONLY|os.O_RDWR) == 0 {
+		return f, nil
+	}
+	// a truncated file no longer matches its old checksum, even if it is
+	// closed without writing to it
+	cf := &checksumFile{File: f, fs: c, name: name, dirty: flag&os.O_TRUNC != 0}
+	if fi.Size() == 0 {
+		// hash on the fly as long as the writes are sequential
+		cf.h = c.hash.New()
+	}
+	return cf, nil
+}
+
+func (c *ChecksumFs) Mkdir(name string, perm os.FileMode) error {
+	return c.source.Mkdir(name, perm)
+}
+
+func (c *ChecksumFs) MkdirAll(path string, perm os.FileMode) error {
+	return c.source.MkdirAll(path, perm)
+}
+
+func (c *ChecksumFs) Remove(name string) error {
+	if err := c.source.Remove(name); err != nil {
+		return err
+	}
+	if err := c.source.Remove(c.sidecar(name)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (c *ChecksumFs) RemoveAll(path string) error {
+	if err := c.source.RemoveAll(path); err != nil {
+		return err
+	}
+	return c.source.RemoveAll(c.sidecar(path))
+}
+
+func (c *ChecksumFs) Rename(oldname, newname string) error {
+	if err := c.source.Rename(oldname, newname); err != nil {
+		return err
+	}
+	err := c.source.Rename(c.sidecar(oldname), c.sidecar(newname))
+	if os.IsNotExist(err) {
+		// no checksum to move, don't keep a stale one either
+		err = c.source.Remove(c.sidecar(newname))
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (c *ChecksumFs) Stat(name string) (os.FileInfo, error) {
+	return c.source.Stat(name)
+}
+
+func (c *ChecksumFs) Chmod(name string, mode os.FileMode) error {
+	return c.source.Chmod(name, mode)
+}
+
+func (c *ChecksumFs) Chtimes(name string, atime, mtime time.Time) error {
+	return c.source.Chtimes(name, atime, mtime)
+}
+
+// checksumFile is a file opened for writing, its checksum is stored on
+// Close if it was changed. h is the running hash of the content while it
+// is written sequentially, nil otherwise.
+type checksumFile struct {
+	File
+	fs    *ChecksumFs
+	name  string
+	h     hash.Hash
+	dirty bool
+}
+
+func (f *checksumFile) Read(p []byte) (int, error) {
+	f.h = nil
+	return f.File.Read(p)
+}
+
+func (f *checksumFile) Write(p []byte) (int, error) {
+	n, err := f.File.Write(p)
+	if f.h != nil {
+		f.h.Write(p[:n])
+	}
+	f.dirty = true
+	return n, err
+}
+
+func (f *checksumFile) WriteAt(p []byte, off int64) (int, error) {
+	f.h = nil
+	f.dirty = true
+	return f.File.WriteAt(p, off)
+}
+
+func (f *checksumFile) WriteString(s string) (int, error) {
+	return f.Write([]byte(s))
+}
+
+func (f *checksumFile) Seek(offset int64, whence int) (int64, error) {
+	f.h = nil
+	return f.File.Seek(offset, whence)
+}
+
+func (f *checksumFile) Truncate(size int64) error {
+	f.h = nil
+	f.dirty = true
+	return f.File.Truncate(size)
+}
+
+// Close closes the file and stores its checksum. Without a running hash, the
+// file is read again for it.
+func (f *checksumFile) Close() error {
+	if err := f.File.Close(); err != nil || !f.dirty {
+		return err
+	}
+	var sum string
+	if f.h != nil {
+		sum = hex.EncodeToString(f.h.Sum(nil))
+	} else {
+		r, err := f.fs.source.Open(f.name)
+		if err != nil {
+			return err
+		}
+		sum, err = f.fs.sum(r)
+		r.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return WriteFile(f.fs.source, f.fs.sidecar(f.name), []byte(sum+"\n"), 0644)
+}
+
+// checksumDir is a directory, hiding the sidecar files in its listings.
+type checksumDir struct {
+	File
+	fs   *ChecksumFs
+	name string
+}
+
+// isSidecar reports whether name is the sidecar of a file in the directory.
+// A name with the suffix of a sidecar but without a file is listed.
+func (d *checksumDir) isSidecar(name string) bool {
+	file := strings.TrimSuffix(name, "."+d.fs.algo)
+	if file == name || file == "" {
+		return false
+	}
+	fi, err := d.fs.source.Stat(filepath.Join(d.name, file))
+	return err == nil && !fi.IsDir()
+}
+
+// Readdir reads on as long as a page holds only sidecar files, so that
+// with count > 0 an empty list comes only with an error.
+func (d *checksumDir) Readdir(count int) ([]os.FileInfo, error) {
+	for {
+		fis, err := d.File.Readdir(count)
+		list := fis[:0]
+		for _, fi := range fis {
+			if !d.isSidecar(fi.Name()) {
+				list = append(list, fi)
+			}
+		}
+		if count <= 0 || len(list) > 0 || len(fis) == 0 || err != nil {
+			return list, err
+		}
+	}
+}
+
+func (d *checksumDir) Readdirnames(n int) ([]string, error) {
+	for {
+		names, err := d.File.Readdirnames(n)
+		list := names[:0]
+		for _, name := range names {
+			if !d.isSidecar(name) {
+				list = append(list, name)
+			}
+		}
+		if n <= 0 || len(list) > 0 || len(names) == 0 || err != nil {
+			return list, err
+		}
+	}
+}
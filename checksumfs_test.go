@@ -0,0 +1,194 @@
+package afero
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func newTestChecksumFs(t *testing.T, base Fs) *ChecksumFs {
+	t.Helper()
+	fs, err := NewChecksumFs(base, "sha256")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fs
+}
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestChecksumFs(t *testing.T) {
+	base := NewMemMapFs()
+	fs := newTestChecksumFs(t, base)
+
+	content := "cached artifact"
+	if err := WriteFile(fs, "/artifact", []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sidecar, err := ReadFile(base, "/artifact.sha256")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(string(sidecar)); got != sha256Hex(content) {
+		t.Errorf("sidecar: got %s, want %s", got, sha256Hex(content))
+	}
+	if got, err := ReadFile(fs, "/artifact"); err != nil || string(got) != content {
+		t.Errorf("read back: %q, %v", got, err)
+	}
+
+	// corrupt the file in the base
+	WriteFile(base, "/artifact", []byte("cached artifacT"), 0644)
+	_, err = fs.Open("/artifact")
+	if perr, ok := err.(*os.PathError); !ok || perr.Err != ErrChecksumMismatch {
+		t.Errorf("corrupted file: got %v, want %v", err, ErrChecksumMismatch)
+	}
+
+	// a file without a sidecar is not verified
+	WriteFile(base, "/plain", []byte("plain"), 0644)
+	if got, err := ReadFile(fs, "/plain"); err != nil || string(got) != "plain" {
+		t.Errorf("file without checksum: %q, %v", got, err)
+	}
+
+	if _, err := NewChecksumFs(base, "crc0"); err == nil {
+		t.Error("expected an error for an unknown algorithm")
+	}
+}
+
+func TestChecksumFsRandomWrites(t *testing.T) {
+	base := NewMemMapFs()
+	fs := newTestChecksumFs(t, base)
+
+	f, err := fs.Create("/f")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("hello world")
+	f.WriteAt([]byte("J"), 0)
+	f.Seek(0, io.SeekEnd)
+	f.WriteString("!")
+	f.Close()
+
+	f, _ = fs.OpenFile("/f", os.O_WRONLY|os.O_APPEND, 0)
+	f.WriteString("?")
+	f.Close()
+
+	sidecar, _ := ReadFile(base, "/f.sha256")
+	if got := strings.TrimSpace(string(sidecar)); got != sha256Hex("Jello world!?") {
+		t.Errorf("sidecar: got %s, want the checksum of %q", got, "Jello world!?")
+	}
+	if _, err := ReadFile(fs, "/f"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestChecksumFsTruncate(t *testing.T) {
+	base := NewMemMapFs()
+	fs := newTestChecksumFs(t, base)
+	WriteFile(fs, "/f", []byte("content"), 0644)
+
+	f, err := fs.Create("/f")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if got, err := ReadFile(fs, "/f"); err != nil || len(got) != 0 {
+		t.Errorf("file truncated by Create: %q, %v", got, err)
+	}
+
+	WriteFile(fs, "/f", []byte("content"), 0644)
+	f, err = fs.OpenFile("/f", os.O_WRONLY|os.O_TRUNC, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if got, err := ReadFile(fs, "/f"); err != nil || len(got) != 0 {
+		t.Errorf("file truncated by O_TRUNC: %q, %v", got, err)
+	}
+}
+
+func TestChecksumFsSidecars(t *testing.T) {
+	base := NewMemMapFs()
+	fs := newTestChecksumFs(t, base)
+	fs.MkdirAll("/dir", 0755)
+	WriteFile(fs, "/dir/a", []byte("a"), 0644)
+	WriteFile(fs, "/dir/b", []byte("b"), 0644)
+
+	names, err := ReadDirNames(fs, "/dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a", "b"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("listing: got %v, want %v", names, want)
+	}
+
+	if err := fs.Rename("/dir/a", "/dir/c"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Remove("/dir/b"); err != nil {
+		t.Fatal(err)
+	}
+	names, _ = ReadDirNames(base, "/dir")
+	if want := []string{"c", "c.sha256"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("base after Rename and Remove: got %v, want %v", names, want)
+	}
+	if got, err := ReadFile(fs, "/dir/c"); err != nil || string(got) != "a" {
+		t.Errorf("renamed file: %q, %v", got, err)
+	}
+}
+
+func TestChecksumFsListing(t *testing.T) {
+	base := NewMemMapFs()
+	fs := newTestChecksumFs(t, base)
+	fs.MkdirAll("/dir", 0755)
+	WriteFile(fs, "/dir/a", []byte("a"), 0644)
+	WriteFile(fs, "/dir/b", []byte("b"), 0644)
+	// a file named like a sidecar, without a data file
+	WriteFile(base, "/dir/x.sha256", []byte("x"), 0644)
+
+	names, err := ReadDirNames(fs, "/dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a", "b", "x.sha256"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("listing: got %v, want %v", names, want)
+	}
+
+	// pages holding only sidecars are skipped, not returned empty
+	var paged []string
+	err = ReadDirBatched(fs, "/dir", 1, func(fis []os.FileInfo) error {
+		for _, fi := range fis {
+			paged = append(paged, fi.Name())
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a", "b", "x.sha256"}; !reflect.DeepEqual(paged, want) {
+		t.Errorf("paged listing: got %v, want %v", paged, want)
+	}
+}
+
+func TestChecksumFsCacheLayer(t *testing.T) {
+	base := NewMemMapFs()
+	layer := NewMemMapFs()
+	checked := newTestChecksumFs(t, layer)
+	ufs := NewCacheOnReadFs(base, checked, 0)
+
+	WriteFile(base, "/file", []byte("original"), 0644)
+	if got, err := ReadFile(ufs, "/file"); err != nil || string(got) != "original" {
+		t.Fatalf("first read: %q, %v", got, err)
+	}
+	// the cached copy gets corrupted
+	WriteFile(layer, "/file", []byte("corrupt!"), 0644)
+	if _, err := ReadFile(ufs, "/file"); err == nil {
+		t.Error("corrupted layer copy served")
+	}
+}
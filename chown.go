@@ -0,0 +1,17 @@
+package afero
+
+// Chowner is an optional interface of an Fs. It is implemented by file
+// systems which can change the numeric user and group id of a file, see
+// os.Chown. A uid or gid of -1 leaves it unchanged.
+//
+//	if c, ok := fs.(afero.Chowner); ok {
+//		err = c.Chown("file", uid, gid)
+//	}
+type Chowner interface {
+	Chown(name string, uid, gid int) error
+}
+
+var (
+	_ Chowner = OsFs{}
+	_ Chowner = &MemMapFs{}
+)
@@ -0,0 +1,47 @@
+package afero
+
+import (
+	"os"
+	"testing"
+)
+
+func TestMemMapFsChown(t *testing.T) {
+	fs := &MemMapFs{}
+	if err := WriteFile(fs, "/file", nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	owner := func() (int, int) {
+		fi, err := fs.Stat("/file")
+		if err != nil {
+			t.Fatal(err)
+		}
+		o, ok := fi.(interface {
+			Uid() int
+			Gid() int
+		})
+		if !ok {
+			t.Fatalf("%T has no owner", fi)
+		}
+		return o.Uid(), o.Gid()
+	}
+
+	if uid, gid := owner(); uid != os.Getuid() || gid != os.Getgid() {
+		t.Errorf("New file owned by %d:%d, expected %d:%d", uid, gid, os.Getuid(), os.Getgid())
+	}
+	if err := fs.Chown("/file", 1000, 100); err != nil {
+		t.Fatal(err)
+	}
+	if uid, gid := owner(); uid != 1000 || gid != 100 {
+		t.Errorf("Got owner %d:%d, expected 1000:100", uid, gid)
+	}
+	if err := fs.Chown("/file", -1, 200); err != nil {
+		t.Fatal(err)
+	}
+	if uid, gid := owner(); uid != 1000 || gid != 200 {
+		t.Errorf("Got owner %d:%d, expected 1000:200", uid, gid)
+	}
+
+	if err := fs.Chown("/missing", 0, 0); !os.IsNotExist(err) {
+		t.Errorf("Expected a not exist error, got %v", err)
+	}
+}
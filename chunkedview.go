@@ -0,0 +1,535 @@
+package afero
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// The ChunkedViewFs presents every regular file of the base Fs as a
+// directory of chunks of a fixed size, named 000, 001 and so on, like the
+// parts of an upload to an object storage. It is meant to test code dealing
+// with such parts. Chunk i is the byte range of the file starting at
+// i*chunkSize, the last chunk may be shorter, an empty file has no chunks.
+// Directories of the base are directories of the view.
+//
+// Reading a chunk reads its range of the file, writing to it writes the
+// range, growing the file when written past its end, but not beyond the end
+// of the chunk. Opening a chunk with os.O_CREATE creates the file if it
+// doesn't exist. As a chunk can't be shortened without moving the chunks
+// after it, only the last chunk of a file can be truncated or removed,
+// which truncates the file; os.O_TRUNC is ignored for the other chunks.
+//
+// Only chunks can be opened for writing, a file of the base can't be
+// created as a file of the view.
+type ChunkedViewFs struct {
+	base      Fs
+	chunkSize int64
+}
+
+func NewChunkedView(base Fs, chunkSize int64) Fs {
+	if chunkSize <= 0 {
+		panic("afero: chunk size must be positive")
+	}
+	return &ChunkedViewFs{base: base, chunkSize: chunkSize}
+}
+
+// chunkName returns the name of chunk i.
+func chunkName(i int64) string {
+	return fmt.Sprintf("%03d", i)
+}
+
+// parseChunkName returns the index of the chunk named name, ok is false if
+// name isn't the name of a chunk.
+func parseChunkName(name string) (i int64, ok bool) {
+	i, err := strconv.ParseInt(name, 10, 64)
+	if err != nil || i < 0 || chunkName(i) != name {
+		return 0, false
+	}
+	return i, true
+}
+
+// chunkRef is a chunk of file, fi is nil if the file doesn't exist.
+type chunkRef struct {
+	file  string
+	index int64
+	fi    os.FileInfo
+}
+
+// chunk returns the chunk named name, ok is false if name isn't a chunk of
+// a file, existing or not, but a name of the base.
+func (c *ChunkedViewFs) chunk(name string) (ref *chunkRef, ok bool) {
+	name = filepath.Clean(name)
+	i, ok := parseChunkName(filepath.Base(name))
+	if !ok {
+		return nil, false
+	}
+	file := filepath.Dir(name)
+	fi, err := c.base.Stat(file)
+	switch {
+	case err == nil && fi.Mode().IsRegular():
+		return &chunkRef{file: file, index: i, fi: fi}, true
+	case err != nil && os.IsNotExist(err):
+		return &chunkRef{file: file, index: i}, true
+	}
+	return nil, false
+}
+
+func (r *chunkRef) exists(chunkSize int64) bool {
+	return r.fi != nil && r.index*chunkSize < r.fi.Size()
+}
+
+// isLast tells whether a chunk starting at start is the last chunk of a
+// file of the given size, or past its end.
+func (c *ChunkedViewFs) isLast(start, size int64) bool {
+	return start+c.chunkSize >= size
+}
+
+// chunkLen returns the length of the chunk starting at start in a file of
+// the given size.
+func (c *ChunkedViewFs) chunkLen(start, size int64) int64 {
+	n := size - start
+	if n > c.chunkSize {
+		n = c.chunkSize
+	}
+	if n < 0 {
+		n = 0
+	}
+	return n
+}
+
+// dirInfo returns the FileInfo of the regular file fi as a directory.
+func dirInfo(fi os.FileInfo) os.FileInfo {
+	perm := fi.Mode().Perm()
+	return &chunkedInfo{FileInfo: fi, name: fi.Name(), mode: os.ModeDir | perm | (perm&0444)>>2}
+}
+
+// chunkInfo returns the FileInfo of the chunk starting at start of the file
+// fi.
+func (c *ChunkedViewFs) chunkInfo(fi os.FileInfo, name string, start int64) os.FileInfo {
+	return &chunkedInfo{FileInfo: fi, name: name, size: c.chunkLen(start, fi.Size()), mode: fi.Mode()}
+}
+
+func (c *ChunkedViewFs) Name() string {
+	return "ChunkedViewFs"
+}
+
+func (c *ChunkedViewFs) Create(name string) (File, error) {
+	return c.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+func (c *ChunkedViewFs) Open(name string) (File, error) {
+	return c.OpenFile(name, os.O_RDONLY, 0)
+}
+
+func (c *ChunkedViewFs) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	if ref, ok := c.chunk(name); ok {
+		return c.openChunk(name, ref, flag, perm)
+	}
+	fi, err := c.base.Stat(name)
+	if err == nil && fi.IsDir() {
+		f, err := c.base.OpenFile(name, flag, perm)
+		if err != nil {
+			return nil, err
+		}
+		return &chunkedDirFile{File: f, fs: c, name: name}, nil
+	}
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) != 0 {
+		return nil, &os.PathError{Op: "open", Path: name, Err: syscall.EISDIR}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !fi.Mode().IsRegular() {
+		return c.base.OpenFile(name, flag, perm)
+	}
+	f := &chunkListFile{name: name, fi: dirInfo(fi)}
+	for i := int64(0); i*c.chunkSize < fi.Size(); i++ {
+		f.dir = append(f.dir, c.chunkInfo(fi, chunkName(i), i*c.chunkSize))
+	}
+	return f, nil
+}
+
+func (c *ChunkedViewFs) openChunk(name string, ref *chunkRef, flag int, perm os.FileMode) (File, error) {
+	exists := ref.exists(c.chunkSize)
+	if !exists && flag&os.O_CREATE == 0 {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	if exists && flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrExist}
+	}
+	f, err := c.base.OpenFile(ref.file, flag&^(os.O_TRUNC|os.O_EXCL|os.O_APPEND), perm)
+	if err != nil {
+		return nil, err
+	}
+	cf := &chunkFile{File: f, fs: c, name: name, start: ref.index * c.chunkSize}
+	if flag&(os.O_TRUNC|os.O_APPEND) != 0 {
+		fi, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		if flag&os.O_TRUNC != 0 && c.isLast(cf.start, fi.Size()) {
+			if err := f.Truncate(cf.start); err != nil {
+				f.Close()
+				return nil, err
+			}
+		} else if flag&os.O_APPEND != 0 {
+			cf.off = c.chunkLen(cf.start, fi.Size())
+		}
+	}
+	return cf, nil
+}
+
+func (c *ChunkedViewFs) Mkdir(name string, perm os.FileMode) error {
+	return c.base.Mkdir(name, perm)
+}
+
+func (c *ChunkedViewFs) MkdirAll(path string, perm os.FileMode) error {
+	return c.base.MkdirAll(path, perm)
+}
+
+// Remove removes a file of the base only if it has no chunks, like an empty
+// directory.
+func (c *ChunkedViewFs) Remove(name string) error {
+	if ref, ok := c.chunk(name); ok {
+		if !ref.exists(c.chunkSize) {
+			return &os.PathError{Op: "remove", Path: name, Err: os.ErrNotExist}
+		}
+		start := ref.index * c.chunkSize
+		if !c.isLast(start, ref.fi.Size()) {
+			return &os.PathError{Op: "remove", Path: name, Err: syscall.EINVAL}
+		}
+		f, err := c.base.OpenFile(ref.file, os.O_WRONLY, 0)
+		if err != nil {
+			return err
+		}
+		err = f.Truncate(start)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		return err
+	}
+	fi, err := c.base.Stat(name)
+	if err == nil && fi.Mode().IsRegular() && fi.Size() > 0 {
+		return &os.PathError{Op: "remove", Path: name, Err: syscall.ENOTEMPTY}
+	}
+	return c.base.Remove(name)
+}
+
+func (c *ChunkedViewFs) RemoveAll(path string) error {
+	if ref, ok := c.chunk(path); ok {
+		if !ref.exists(c.chunkSize) {
+			return nil
+		}
+		return c.Remove(path)
+	}
+	return c.base.RemoveAll(path)
+}
+
+// Rename renames files and directories of the base, chunks can't be
+// renamed.
+func (c *ChunkedViewFs) Rename(oldname, newname string) error {
+	for _, name := range []string{oldname, newname} {
+		if _, ok := c.chunk(name); ok {
+			return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: syscall.EINVAL}
+		}
+	}
+	return c.base.Rename(oldname, newname)
+}
+
+func (c *ChunkedViewFs) Stat(name string) (os.FileInfo, error) {
+	if ref, ok := c.chunk(name); ok {
+		if !ref.exists(c.chunkSize) {
+			return nil, &os.PathError{Op: "stat", Path: name, Err: os.ErrNotExist}
+		}
+		return c.chunkInfo(ref.fi, filepath.Base(name), ref.index*c.chunkSize), nil
+	}
+	fi, err := c.base.Stat(name)
+	if err != nil || !fi.Mode().IsRegular() {
+		return fi, err
+	}
+	return dirInfo(fi), nil
+}
+
+// Chmod changes the mode of the file of a chunk, and so of all its chunks.
+func (c *ChunkedViewFs) Chmod(name string, mode os.FileMode) error {
+	if ref, ok := c.chunk(name); ok {
+		if !ref.exists(c.chunkSize) {
+			return &os.PathError{Op: "chmod", Path: name, Err: os.ErrNotExist}
+		}
+		name = ref.file
+	}
+	return c.base.Chmod(name, mode)
+}
+
+// Chtimes changes the times of the file of a chunk, and so of all its
+// chunks.
+func (c *ChunkedViewFs) Chtimes(name string, atime, mtime time.Time) error {
+	if ref, ok := c.chunk(name); ok {
+		if !ref.exists(c.chunkSize) {
+			return &os.PathError{Op: "chtimes", Path: name, Err: os.ErrNotExist}
+		}
+		name = ref.file
+	}
+	return c.base.Chtimes(name, atime, mtime)
+}
+
+// chunkedInfo is the FileInfo of a file of the base as a directory, or of a
+// chunk.
+type chunkedInfo struct {
+	os.FileInfo // of the file
+	name        string
+	size        int64
+	mode        os.FileMode
+}
+
+func (fi *chunkedInfo) Name() string      { return fi.name }
+func (fi *chunkedInfo) Size() int64       { return fi.size }
+func (fi *chunkedInfo) Mode() os.FileMode { return fi.mode }
+func (fi *chunkedInfo) IsDir() bool       { return fi.mode.IsDir() }
+
+// chunkedDirFile is a directory of the base, listing its regular files as
+// directories.
+type chunkedDirFile struct {
+	File
+	fs   *ChunkedViewFs
+	name string
+}
+
+func (d *chunkedDirFile) Readdir(count int) ([]os.FileInfo, error) {
+	fis, err := d.File.Readdir(count)
+	for i, fi := range fis {
+		if fi.Mode().IsRegular() {
+			fis[i] = dirInfo(fi)
+		}
+	}
+	return fis, err
+}
+
+// chunkListFile is a file of the base opened as the directory of its
+// chunks.
+type chunkListFile struct {
+	name   string
+	fi     os.FileInfo
+	dir    []os.FileInfo // remaining Readdir entries
+	closed bool
+}
+
+func (f *chunkListFile) check(op string) error {
+	if f.closed {
+		return ErrFileClosed
+	}
+	return &os.PathError{Op: op, Path: f.name, Err: syscall.EISDIR}
+}
+
+func (f *chunkListFile) Name() string { return f.name }
+
+func (f *chunkListFile) Close() error {
+	if f.closed {
+		return ErrFileClosed
+	}
+	f.closed = true
+	return nil
+}
+
+func (f *chunkListFile) Read(p []byte) (int, error) {
+	return 0, f.check("read")
+}
+
+func (f *chunkListFile) ReadAt(p []byte, off int64) (int, error) {
+	return 0, f.check("read")
+}
+
+func (f *chunkListFile) Seek(offset int64, whence int) (int64, error) {
+	if f.closed {
+		return 0, ErrFileClosed
+	}
+	return 0, nil
+}
+
+func (f *chunkListFile) Write(p []byte) (int, error) {
+	return 0, f.check("write")
+}
+
+func (f *chunkListFile) WriteAt(p []byte, off int64) (int, error) {
+	return 0, f.check("write")
+}
+
+func (f *chunkListFile) WriteString(s string) (int, error) {
+	return 0, f.check("write")
+}
+
+func (f *chunkListFile) Truncate(size int64) error {
+	return f.check("truncate")
+}
+
+func (f *chunkListFile) Sync() error {
+	if f.closed {
+		return ErrFileClosed
+	}
+	return nil
+}
+
+func (f *chunkListFile) Stat() (os.FileInfo, error) {
+	if f.closed {
+		return nil, ErrFileClosed
+	}
+	return f.fi, nil
+}
+
+func (f *chunkListFile) Readdir(count int) ([]os.FileInfo, error) {
+	if f.closed {
+		return nil, ErrFileClosed
+	}
+	if count <= 0 {
+		list := f.dir
+		f.dir = nil
+		return list, nil
+	}
+	if len(f.dir) == 0 {
+		return nil, io.EOF
+	}
+	if count > len(f.dir) {
+		count = len(f.dir)
+	}
+	list := f.dir[:count]
+	f.dir = f.dir[count:]
+	return list, nil
+}
+
+func (f *chunkListFile) Readdirnames(n int) ([]string, error) {
+	list, err := f.Readdir(n)
+	names := make([]string, len(list))
+	for i, fi := range list {
+		names[i] = fi.Name()
+	}
+	return names, err
+}
+
+// chunkFile is a chunk, File is the file of the base opened.
+type chunkFile struct {
+	File
+	fs    *ChunkedViewFs
+	name  string
+	start int64 // of the chunk in the file
+	off   int64 // in the chunk
+}
+
+func (f *chunkFile) Name() string {
+	return f.name
+}
+
+// limit returns p cut to the end of the chunk, reading or writing at off.
+func (f *chunkFile) limit(p []byte, off int64) []byte {
+	if rest := f.fs.chunkSize - off; int64(len(p)) > rest {
+		if rest < 0 {
+			rest = 0
+		}
+		return p[:rest]
+	}
+	return p
+}
+
+func (f *chunkFile) Read(p []byte) (int, error) {
+	n, err := f.ReadAt(p, f.off)
+	f.off += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+func (f *chunkFile) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, &os.PathError{Op: "readat", Path: f.name, Err: syscall.EINVAL}
+	}
+	q := f.limit(p, off)
+	if len(q) == 0 && len(p) > 0 {
+		return 0, io.EOF
+	}
+	n, err := f.File.ReadAt(q, f.start+off)
+	if err == nil && len(q) < len(p) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (f *chunkFile) Write(p []byte) (int, error) {
+	n, err := f.WriteAt(p, f.off)
+	f.off += int64(n)
+	return n, err
+}
+
+// WriteAt writes up to the end of the chunk, writing past it fails with
+// syscall.EFBIG.
+func (f *chunkFile) WriteAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, &os.PathError{Op: "writeat", Path: f.name, Err: syscall.EINVAL}
+	}
+	q := f.limit(p, off)
+	n, err := f.File.WriteAt(q, f.start+off)
+	if err == nil && len(q) < len(p) {
+		err = &os.PathError{Op: "write", Path: f.name, Err: syscall.EFBIG}
+	}
+	return n, err
+}
+
+func (f *chunkFile) WriteString(s string) (int, error) {
+	return f.Write([]byte(s))
+}
+
+func (f *chunkFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.off
+	case io.SeekEnd:
+		fi, err := f.Stat()
+		if err != nil {
+			return 0, err
+		}
+		offset += fi.Size()
+	}
+	if offset < 0 {
+		return 0, &os.PathError{Op: "seek", Path: f.name, Err: syscall.EINVAL}
+	}
+	f.off = offset
+	return offset, nil
+}
+
+// Truncate truncates the last chunk, the other chunks can't change their
+// size.
+func (f *chunkFile) Truncate(size int64) error {
+	fi, err := f.File.Stat()
+	if err != nil {
+		return err
+	}
+	last := f.fs.isLast(f.start, fi.Size())
+	if size < 0 || size > f.fs.chunkSize || !last && size != f.fs.chunkSize {
+		return &os.PathError{Op: "truncate", Path: f.name, Err: syscall.EINVAL}
+	}
+	if !last {
+		return nil
+	}
+	return f.File.Truncate(f.start + size)
+}
+
+func (f *chunkFile) Stat() (os.FileInfo, error) {
+	fi, err := f.File.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return f.fs.chunkInfo(fi, filepath.Base(f.name), f.start), nil
+}
+
+func (f *chunkFile) Readdir(count int) ([]os.FileInfo, error) {
+	return nil, &os.PathError{Op: "readdir", Path: f.name, Err: syscall.ENOTDIR}
+}
+
+func (f *chunkFile) Readdirnames(n int) ([]string, error) {
+	return nil, &os.PathError{Op: "readdirnames", Path: f.name, Err: syscall.ENOTDIR}
+}
@@ -0,0 +1,144 @@
+package afero
+
+import (
+	"errors"
+	"io"
+	"os"
+	"reflect"
+	"syscall"
+	"testing"
+)
+
+func TestChunkedViewRead(t *testing.T) {
+	base := &MemMapFs{}
+	WriteFile(base, "/dir/big", []byte("0123456789"), 0644)
+	WriteFile(base, "/dir/empty", nil, 0644)
+	view := NewChunkedView(base, 4)
+
+	fi, err := view.Stat("/dir/big")
+	if err != nil || !fi.IsDir() {
+		t.Fatalf("file as directory: %v, %v", fi, err)
+	}
+	names, err := ReadDirNames(view, "/dir/big")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"000", "001", "002"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("chunks %v, want %v", names, want)
+	}
+	if names, _ := ReadDirNames(view, "/dir/empty"); len(names) != 0 {
+		t.Errorf("chunks of an empty file: %v", names)
+	}
+	fis, err := ReadDir(view, "/dir")
+	if err != nil || len(fis) != 2 || !fis[0].IsDir() || !fis[1].IsDir() {
+		t.Errorf("files of the base not listed as directories: %v, %v", fis, err)
+	}
+
+	for name, want := range map[string]string{"000": "0123", "001": "4567", "002": "89"} {
+		data, err := ReadFile(view, "/dir/big/"+name)
+		if err != nil || string(data) != want {
+			t.Errorf("chunk %s: %q, %v, want %q", name, data, err, want)
+		}
+		fi, err := view.Stat("/dir/big/" + name)
+		if err != nil || fi.Size() != int64(len(want)) || fi.IsDir() {
+			t.Errorf("stat chunk %s: %v, %v", name, fi, err)
+		}
+	}
+	if _, err := view.Stat("/dir/big/003"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("stat past the end: %v", err)
+	}
+	if _, err := view.Stat("/dir/big/3"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("stat of a name which isn't a chunk: %v", err)
+	}
+
+	f, err := view.Open("/dir/big/001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	buf := make([]byte, 3)
+	if n, err := f.ReadAt(buf, 2); n != 2 || err != io.EOF || string(buf[:n]) != "67" {
+		t.Errorf("ReadAt over the end of the chunk: %q, %v", buf[:n], err)
+	}
+	if pos, err := f.Seek(-1, io.SeekEnd); pos != 3 || err != nil {
+		t.Errorf("Seek from the end: %d, %v", pos, err)
+	}
+	if n, err := f.Read(buf); n != 1 || err != nil || buf[0] != '7' {
+		t.Errorf("Read after Seek: %q, %v", buf[:n], err)
+	}
+	if _, err := f.Read(buf); err != io.EOF {
+		t.Errorf("Read at the end of the chunk: %v", err)
+	}
+}
+
+func TestChunkedViewWrite(t *testing.T) {
+	base := &MemMapFs{}
+	WriteFile(base, "/big", []byte("0123456789"), 0644)
+	view := NewChunkedView(base, 4)
+
+	// a chunk before the last one keeps its size with O_TRUNC
+	if err := WriteFile(view, "/big/001", []byte("abcd"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ReadFile(base, "/big"); string(data) != "0123abcd89" {
+		t.Errorf("writing chunk 001: %q", data)
+	}
+
+	// the last chunk is truncated, and grows up to the chunk size
+	if err := WriteFile(view, "/big/002", []byte("xyz"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ReadFile(base, "/big"); string(data) != "0123abcdxyz" {
+		t.Errorf("writing chunk 002: %q", data)
+	}
+
+	f, err := view.OpenFile("/big/002", os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := f.Write([]byte("!?")); n != 1 || !errors.Is(err, syscall.EFBIG) {
+		t.Errorf("writing past the end of the chunk: %d, %v", n, err)
+	}
+	f.Close()
+	if data, _ := ReadFile(base, "/big"); string(data) != "0123abcdxyz!" {
+		t.Errorf("appending to chunk 002: %q", data)
+	}
+
+	// writing past the end of the file creates the chunks in between
+	if err := WriteFile(view, "/big/004", []byte("end"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ReadFile(base, "/big"); string(data) != "0123abcdxyz!\x00\x00\x00\x00end" {
+		t.Errorf("writing chunk 004: %q", data)
+	}
+	if names, _ := ReadDirNames(view, "/big"); len(names) != 5 {
+		t.Errorf("chunks after growing: %v", names)
+	}
+
+	if err := view.Remove("/big/001"); !errors.Is(err, syscall.EINVAL) {
+		t.Errorf("removing a chunk before the last one: %v", err)
+	}
+	if err := view.Remove("/big/004"); err != nil {
+		t.Fatal(err)
+	}
+	if fi, _ := base.Stat("/big"); fi.Size() != 16 {
+		t.Errorf("size after removing the last chunk: %d", fi.Size())
+	}
+	if err := view.Remove("/big"); !errors.Is(err, syscall.ENOTEMPTY) {
+		t.Errorf("removing a file with chunks: %v", err)
+	}
+
+	// creating a chunk creates the file
+	if err := WriteFile(view, "/new/000", []byte("abc"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ReadFile(base, "/new"); err != nil || string(data) != "abc" {
+		t.Errorf("creating a chunk: %q, %v", data, err)
+	}
+	if _, err := view.OpenFile("/new/000", os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644); !errors.Is(err, os.ErrExist) {
+		t.Errorf("O_EXCL on an existing chunk: %v", err)
+	}
+	if _, err := view.Create("/other"); !errors.Is(err, syscall.EISDIR) {
+		t.Errorf("creating a file which isn't a chunk: %v", err)
+	}
+}
@@ -1,9 +1,18 @@
 package afero
 
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"io"
 	"io/ioutil"
+	mrand "math/rand"
 	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"syscall"
 	"testing"
 	"time"
 )
@@ -122,6 +131,58 @@ func TestUnionMergeReaddir(t *testing.T) {
 	}
 }
 
+func TestUnionReaddirOverlapping(t *testing.T) {
+	base := &MemMapFs{}
+	layer := &MemMapFs{}
+	ufs := &CopyOnWriteFs{base: base, layer: layer}
+
+	base.MkdirAll("/dir", 0777)
+	layer.MkdirAll("/dir", 0777)
+	WriteFile(base, "/dir/a", []byte("base"), 0644)
+	WriteFile(base, "/dir/both", []byte("base"), 0644)
+	WriteFile(layer, "/dir/both", []byte("layer file"), 0644)
+	WriteFile(layer, "/dir/c", []byte("layer"), 0644)
+	WriteFile(base, "/dir/d", []byte("base"), 0644)
+
+	fh, err := ufs.Open("/dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fh.Close()
+
+	var all []os.FileInfo
+	for {
+		fis, err := fh.Readdir(2)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(fis) == 0 || len(fis) > 2 {
+			t.Fatalf("Readdir(2) returned %d entries", len(fis))
+		}
+		all = append(all, fis...)
+	}
+	var names []string
+	for _, fi := range all {
+		names = append(names, fi.Name())
+		if fi.Name() == "both" && fi.Size() != int64(len("layer file")) {
+			t.Errorf("Expected the FileInfo of the layer for both, got size %d", fi.Size())
+		}
+	}
+	if fmt.Sprint(names) != "[a both c d]" {
+		t.Errorf("Got %v", names)
+	}
+
+	if fis, err := fh.Readdir(-1); len(fis) != 0 || err != nil {
+		t.Errorf("Readdir(-1) at the end: got %v, %v", fis, err)
+	}
+	if names, err := fh.Readdirnames(1); len(names) != 0 || err != io.EOF {
+		t.Errorf("Readdirnames(1) at the end: got %v, %v", names, err)
+	}
+}
+
 func TestExistingDirectoryCollisionReaddir(t *testing.T) {
 	base := &MemMapFs{}
 	roBase := &ReadOnlyFs{source: base}
@@ -335,10 +396,79 @@ func TestUnionCacheWrite(t *testing.T) {
 	}
 }
 
+func TestUnionFileSeek(t *testing.T) {
+	defer CleanupTempDirs(t)
+	base := NewTempOsBaseFs(t)
+	layer := &MemMapFs{}
+	ref := NewTempOsBaseFs(t)
+
+	ufs := NewCacheOnReadFs(base, layer, 0)
+	uf, err := ufs.Create("/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := uf.(*UnionFile); !ok {
+		t.Fatalf("Expected a *UnionFile, got %T", uf)
+	}
+	rf, err := ref.Create("/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rnd := mrand.New(mrand.NewSource(42))
+	for i := 0; i < 500; i++ {
+		switch op := rnd.Intn(4); op {
+		case 0, 1:
+			data := make([]byte, rnd.Intn(16))
+			rnd.Read(data)
+			write := func(f File) (int, error) { return f.Write(data) }
+			if op == 1 {
+				write = func(f File) (int, error) { return f.WriteString(string(data)) }
+			}
+			un, uerr := write(uf)
+			rn, rerr := write(rf)
+			if un != rn || (uerr == nil) != (rerr == nil) {
+				t.Fatalf("%d: write: got %d, %v, expected %d, %v", i, un, uerr, rn, rerr)
+			}
+		case 2:
+			n := rnd.Intn(16)
+			ubuf, rbuf := make([]byte, n), make([]byte, n)
+			un, uerr := uf.Read(ubuf)
+			rn, rerr := rf.Read(rbuf)
+			if un != rn || uerr != rerr || !bytes.Equal(ubuf[:un], rbuf[:rn]) {
+				t.Fatalf("%d: read: got %q, %v, expected %q, %v", i, ubuf[:un], uerr, rbuf[:rn], rerr)
+			}
+		case 3:
+			whence := rnd.Intn(3)
+			offset := int64(rnd.Intn(32))
+			if whence != io.SeekStart {
+				offset -= 16
+			}
+			upos, uerr := uf.Seek(offset, whence)
+			rpos, rerr := rf.Seek(offset, whence)
+			if upos != rpos || (uerr == nil) != (rerr == nil) {
+				t.Fatalf("%d: seek(%d, %d): got %d, %v, expected %d, %v", i, offset, whence, upos, uerr, rpos, rerr)
+			}
+		}
+	}
+	uf.Close()
+	rf.Close()
+
+	want, _ := ReadFile(ref, "/file")
+	for _, fs := range []Fs{base, layer} {
+		if got, _ := ReadFile(fs, "/file"); !bytes.Equal(got, want) {
+			t.Errorf("%s: got %q, expected %q", fs.Name(), got, want)
+		}
+	}
+}
+
 func TestUnionCacheExpire(t *testing.T) {
 	base := &MemMapFs{}
 	layer := &MemMapFs{}
 	ufs := &CacheOnReadFs{base: base, layer: layer, cacheTime: 1 * time.Second}
+	past := time.Now().Add(-time.Hour)
+	base.SetClock(func() time.Time { return past })
+	layer.SetClock(func() time.Time { return past })
 
 	base.Mkdir("/data", 0777)
 
@@ -353,8 +483,8 @@ func TestUnionCacheExpire(t *testing.T) {
 	fh.Close()
 
 	fh, _ = base.Create("/data/file.txt")
-	// sleep some time, so we really get a different time.Now() on write...
-	time.Sleep(2 * time.Second)
+	// the base file must be newer, the layer copy older than the cache time
+	base.SetClock(func() time.Time { return past.Add(time.Minute) })
 	fh.WriteString("Another test")
 	fh.Close()
 
@@ -362,4 +492,739 @@ func TestUnionCacheExpire(t *testing.T) {
 	if string(data) != "Another test" {
 		t.Errorf("cache time failed: <%s>", data)
 	}
+	if stale := ufs.Stats().Stale; stale != 1 {
+		t.Errorf("expected 1 stale lookup, got %d", stale)
+	}
+}
+
+func TestCopyToLayerKeepsModeAndTime(t *testing.T) {
+	base := &MemMapFs{}
+	layer := &MemMapFs{}
+	mtime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	base.SetClock(func() time.Time { return mtime })
+	WriteFile(base, "/dir/file", []byte("data"), 0640)
+
+	for _, ufs := range []Fs{NewCacheOnReadFs(base, layer, time.Hour), NewCopyOnWriteFs(base, layer)} {
+		layer.RemoveAll("/dir")
+		if _, ok := ufs.(*CacheOnReadFs); ok {
+			ReadFile(ufs, "/dir/file")
+		} else {
+			ufs.Chtimes("/dir/file", mtime, mtime)
+		}
+		lfi, err := layer.Stat("/dir/file")
+		if err != nil {
+			t.Fatalf("%s: not copied: %v", ufs.Name(), err)
+		}
+		if !lfi.ModTime().Equal(mtime) {
+			t.Errorf("%s: layer mtime %v, want %v", ufs.Name(), lfi.ModTime(), mtime)
+		}
+		if lfi.Mode() != 0640 {
+			t.Errorf("%s: layer mode %v, want %v", ufs.Name(), lfi.Mode(), os.FileMode(0640))
+		}
+	}
+}
+
+func TestCopyToLayerReadOnlyFile(t *testing.T) {
+	base := &MemMapFs{}
+	layer := NewMemMapFsEnforcing(1000, 1000)
+	mtime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	WriteFile(base, "/dir/file", []byte("old"), 0444)
+	base.Chtimes("/dir/file", mtime, mtime)
+	ufs := NewCacheOnReadFs(base, layer, time.Nanosecond)
+
+	if data, err := ReadFile(ufs, "/dir/file"); err != nil || string(data) != "old" {
+		t.Fatalf("first copy: %q, %v", data, err)
+	}
+	if fi, _ := layer.Stat("/dir/file"); fi.Mode() != 0444 {
+		t.Errorf("layer mode %v, want %v", fi.Mode(), os.FileMode(0444))
+	}
+
+	// the base changes, the read only copy is replaced
+	WriteFile(base, "/dir/file", []byte("new"), 0444)
+	base.Chtimes("/dir/file", mtime.Add(time.Hour), mtime.Add(time.Hour))
+	if data, err := ReadFile(ufs, "/dir/file"); err != nil || string(data) != "new" {
+		t.Errorf("copy of the changed file: %q, %v", data, err)
+	}
+}
+
+func TestCacheOnReadFsStats(t *testing.T) {
+	base := &MemMapFs{}
+	layer := &MemMapFs{}
+	ufs := &CacheOnReadFs{base: base, layer: layer, cacheTime: time.Minute}
+
+	WriteFile(base, "/data/stale.txt", []byte("new content"), 0644)
+	WriteFile(layer, "/data/stale.txt", []byte("old"), 0644)
+	WriteFile(layer, "/data/local.txt", []byte("local"), 0644)
+	old := time.Now().Add(-time.Hour)
+	layer.Chtimes("/data/stale.txt", old, old)
+	layer.Chtimes("/data/local.txt", old, old)
+
+	if _, err := ReadFile(ufs, "/data/stale.txt"); err != nil {
+		t.Fatalf("ReadFile stale: %s", err)
+	}
+	if _, err := ReadFile(ufs, "/data/stale.txt"); err != nil {
+		t.Fatalf("ReadFile hit: %s", err)
+	}
+	if _, err := ReadFile(ufs, "/data/local.txt"); err != nil {
+		t.Fatalf("ReadFile local: %s", err)
+	}
+
+	want := CacheStats{Hits: 1, Stale: 1, Local: 1, BytesCopied: int64(len("new content"))}
+	if got := ufs.Stats(); got != want {
+		t.Errorf("Stats() = %+v, want %+v", got, want)
+	}
+
+	ufs.ResetStats()
+	if got := ufs.Stats(); got != (CacheStats{}) {
+		t.Errorf("Stats() after ResetStats() = %+v, want zero", got)
+	}
+}
+
+// failingWriteFs fails all OpenFile calls with write flags
+type failingWriteFs struct {
+	Fs
+}
+
+func (f *failingWriteFs) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) != 0 {
+		return nil, &os.PathError{Op: "open", Path: name, Err: syscall.EROFS}
+	}
+	return f.Fs.OpenFile(name, flag, perm)
+}
+
+// enoentFs reports missing files as a plain syscall.ENOENT, as some
+// backends do.
+type enoentFs struct {
+	Fs
+}
+
+func (fs enoentFs) Stat(name string) (os.FileInfo, error) {
+	fi, err := fs.Fs.Stat(name)
+	if os.IsNotExist(err) {
+		return nil, syscall.ENOENT
+	}
+	return fi, err
+}
+
+// wrappedNotExistFs reports missing files with an error wrapping
+// os.ErrNotExist.
+type wrappedNotExistFs struct {
+	Fs
+}
+
+func (fs wrappedNotExistFs) Stat(name string) (os.FileInfo, error) {
+	fi, err := fs.Fs.Stat(name)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("layer: %w", os.ErrNotExist)
+	}
+	return fi, err
+}
+
+func TestCacheOnReadFsMissShapes(t *testing.T) {
+	for _, wrap := range []func(Fs) Fs{
+		func(fs Fs) Fs { return fs },
+		func(fs Fs) Fs { return enoentFs{fs} },
+		func(fs Fs) Fs { return wrappedNotExistFs{fs} },
+	} {
+		base := NewMemMapFs()
+		layer := wrap(NewMemMapFs())
+		WriteFile(base, "/file", []byte("content"), 0644)
+		ufs := NewCacheOnReadFs(base, layer, 0).(*CacheOnReadFs)
+
+		if got, err := ReadFile(ufs, "/file"); err != nil || string(got) != "content" {
+			t.Errorf("%T: read: %q, %v", layer, got, err)
+		}
+		if stats := ufs.Stats(); stats.Misses != 1 {
+			t.Errorf("%T: misses %d, want 1", layer, stats.Misses)
+		}
+		if _, err := layer.Stat("/file"); err != nil {
+			t.Errorf("%T: not copied to the layer: %v", layer, err)
+		}
+		if _, err := ufs.Stat("/missing"); !os.IsNotExist(err) {
+			t.Errorf("%T: stat of a missing file: got %v", layer, err)
+		}
+	}
+}
+
+func TestCacheOnReadFsEviction(t *testing.T) {
+	base := &MemMapFs{}
+	layer := &MemMapFs{}
+	ufs := NewCacheOnReadFsWithEviction(base, layer, 0, 25)
+
+	for _, name := range []string{"/a", "/b", "/c", "/d"} {
+		WriteFile(base, name, []byte("0123456789"), 0644)
+	}
+	for _, name := range []string{"/a", "/b", "/a", "/c"} {
+		if _, err := ReadFile(ufs, name); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+	}
+	// /b was used least recently
+	for name, cached := range map[string]bool{"/a": true, "/b": false, "/c": true} {
+		if _, err := layer.Stat(name); (err == nil) != cached {
+			t.Errorf("%s: expected cached %t, got %v", name, cached, err)
+		}
+		if _, err := base.Stat(name); err != nil {
+			t.Errorf("%s: removed from the base: %v", name, err)
+		}
+	}
+
+	if err := ufs.Remove("/c"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadFile(ufs, "/d"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := layer.Stat("/a"); err != nil {
+		t.Errorf("/a evicted, but /c was removed and freed its space")
+	}
+}
+
+func TestCacheOnReadFsEvictionConcurrent(t *testing.T) {
+	base := &MemMapFs{}
+	layer := &MemMapFs{}
+	ufs := NewCacheOnReadFsWithEviction(base, layer, 0, 50)
+
+	for i := 0; i < 20; i++ {
+		WriteFile(base, fmt.Sprintf("/file%d", i), []byte("0123456789"), 0644)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				ReadFile(ufs, fmt.Sprintf("/file%d", (i+j)%20))
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	var size int64
+	Walk(layer, "/", func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	if size > 50 {
+		t.Errorf("Layer holds %d bytes, expected at most 50", size)
+	}
+	if names, _ := ReadDirNames(base, "/"); len(names) != 20 {
+		t.Errorf("Base changed: %v", names)
+	}
+}
+
+// recordingObserver records the calls of a CacheObserver, calling back
+// into fs on each. The calls made by the callback are not recorded.
+type recordingObserver struct {
+	fs       Fs
+	events   []string
+	callback bool
+}
+
+func (o *recordingObserver) record(event, name string) {
+	if o.callback {
+		return
+	}
+	o.events = append(o.events, event+" "+name)
+	o.callback = true
+	o.fs.Stat(name)
+	o.callback = false
+}
+
+func (o *recordingObserver) OnHit(name string)   { o.record("hit", name) }
+func (o *recordingObserver) OnMiss(name string)  { o.record("miss", name) }
+func (o *recordingObserver) OnStale(name string) { o.record("stale", name) }
+func (o *recordingObserver) OnEvict(name string) { o.record("evict", name) }
+
+func TestCacheOnReadFsCachedFiles(t *testing.T) {
+	base := &MemMapFs{}
+	layer := &MemMapFs{}
+	WriteFile(base, "/a/one", []byte("1"), 0644)
+	WriteFile(base, "/a/two", []byte("2"), 0644)
+	WriteFile(base, "/b/three", []byte("3"), 0644)
+	ufs := NewCacheOnReadFs(base, layer, 0).(*CacheOnReadFs)
+
+	if names, err := ufs.CachedFiles(); err != nil || len(names) != 0 {
+		t.Errorf("empty cache: %v, %v", names, err)
+	}
+	ReadFile(ufs, "/b/three")
+	ReadFile(ufs, "/a/one")
+	WriteFile(layer, whiteoutPath("/a/two"), nil, 0644)
+
+	want := []string{filepath.FromSlash("/a/one"), filepath.FromSlash("/b/three")}
+	if names, err := ufs.CachedFiles(); err != nil || !reflect.DeepEqual(names, want) {
+		t.Errorf("got %v, %v, want %v", names, err, want)
+	}
+}
+
+func TestCacheOnReadFsObserver(t *testing.T) {
+	base := &MemMapFs{}
+	layer := &MemMapFs{}
+	obs := &recordingObserver{}
+	ufs := NewCacheOnReadFsWithEviction(base, layer, time.Second, 15, WithCacheObserver(obs))
+	obs.fs = ufs
+
+	WriteFile(base, "/a", []byte("0123456789"), 0644)
+	WriteFile(base, "/b", []byte("0123456789"), 0644)
+	ReadFile(ufs, "/a")
+	if want := []string{"miss /a"}; !reflect.DeepEqual(obs.events, want) {
+		t.Errorf("first read: got %q, want %q", obs.events, want)
+	}
+
+	obs.events = nil
+	ReadFile(ufs, "/a")
+	if want := []string{"hit /a"}; !reflect.DeepEqual(obs.events, want) {
+		t.Errorf("cached read: got %q, want %q", obs.events, want)
+	}
+
+	obs.events = nil
+	old := time.Now().Add(-time.Hour)
+	layer.Chtimes("/a", old, old)
+	ReadFile(ufs, "/a")
+	if len(obs.events) == 0 || obs.events[0] != "stale /a" {
+		t.Errorf("stale read: got %q", obs.events)
+	}
+
+	obs.events = nil
+	ReadFile(ufs, "/b")
+	if len(obs.events) < 2 || obs.events[0] != "miss /b" || obs.events[1] != "evict /a" {
+		t.Errorf("evicting read: got %q", obs.events)
+	}
+}
+
+func TestCacheOnReadFsCopyProgress(t *testing.T) {
+	base := &MemMapFs{}
+	var calls int
+	var last int64
+	progress := func(path string, copied, total int64) {
+		calls++
+		last = copied
+		if path != "/big" || total != 3*progressInterval {
+			t.Errorf("progress of %s: %d/%d", path, copied, total)
+		}
+	}
+	ufs := NewCacheOnReadFs(base, &MemMapFs{}, 0, WithCopyProgress(progress))
+
+	WriteFile(base, "/big", make([]byte, 3*progressInterval), 0644)
+	if _, err := ReadFile(ufs, "/big"); err != nil {
+		t.Fatal(err)
+	}
+	if calls == 0 || calls > 4 || last != 3*progressInterval {
+		t.Errorf("%d calls, last at %d bytes", calls, last)
+	}
+
+	// served from the layer, nothing is copied
+	calls = 0
+	ReadFile(ufs, "/big")
+	if calls != 0 {
+		t.Errorf("%d calls reading a cached file", calls)
+	}
+}
+
+func TestCacheOnReadFsReaddirMixed(t *testing.T) {
+	for _, cacheTime := range []time.Duration{0, time.Hour} {
+		base := &MemMapFs{}
+		layer := &MemMapFs{}
+		ufs := NewCacheOnReadFs(base, layer, cacheTime)
+
+		base.MkdirAll("/dir/sub", 0777)
+		for _, name := range []string{"a", "b", "c", "d"} {
+			WriteFile(base, "/dir/"+name, []byte(name), 0644)
+		}
+		for _, name := range []string{"/dir/a", "/dir/c"} {
+			if _, err := ReadFile(ufs, name); err != nil {
+				t.Fatalf("%v: %s: %v", cacheTime, name, err)
+			}
+		}
+		WriteFile(layer, "/dir/local", []byte("local"), 0644)
+
+		for _, open := range []func() (File, error){
+			func() (File, error) { return ufs.Open("/dir") },
+			func() (File, error) { return ufs.OpenFile("/dir", os.O_RDONLY, 0) },
+		} {
+			f, err := open()
+			if err != nil {
+				t.Fatalf("%v: %v", cacheTime, err)
+			}
+			names, err := f.Readdirnames(-1)
+			f.Close()
+			if err != nil {
+				t.Fatalf("%v: %v", cacheTime, err)
+			}
+			sort.Strings(names)
+			if fmt.Sprint(names) != "[a b c d local sub]" {
+				t.Errorf("%v: got %v", cacheTime, names)
+			}
+		}
+	}
+}
+
+func TestCacheOnReadFsOpenFileTruncLayerFailure(t *testing.T) {
+	base := &MemMapFs{}
+	layer := &MemMapFs{}
+	ufs := NewCacheOnReadFs(base, &failingWriteFs{layer}, 0)
+
+	WriteFile(base, "/data/file.txt", []byte("This is a test"), 0644)
+	WriteFile(layer, "/data/file.txt", []byte("This is a test"), 0644)
+
+	if _, err := ufs.OpenFile("/data/file.txt", os.O_RDWR|os.O_TRUNC, 0644); err == nil {
+		t.Fatal("OpenFile succeeded with a failing layer")
+	}
+
+	data, err := ReadFile(base, "/data/file.txt")
+	if err != nil {
+		t.Fatalf("ReadFile: %s", err)
+	}
+	if string(data) != "This is a test" {
+		t.Errorf("base file was modified: %q", data)
+	}
+}
+
+func TestCacheOnReadFsCreateLayerFailure(t *testing.T) {
+	base := &MemMapFs{}
+	ufs := NewCacheOnReadFs(base, NewReadOnlyFs(&MemMapFs{}), 0)
+
+	base.Mkdir("/data", 0777)
+
+	if _, err := ufs.Create("/data/file.txt"); err == nil {
+		t.Fatal("Create succeeded with a read only layer")
+	}
+	if _, err := base.Stat("/data/file.txt"); !os.IsNotExist(err) {
+		t.Errorf("file left in the base after failed Create: %v", err)
+	}
+
+	// an existing base file is not truncated
+	WriteFile(base, "/data/existing.txt", []byte("This is a test"), 0644)
+	if _, err := ufs.Create("/data/existing.txt"); err == nil {
+		t.Fatal("Create of an existing file succeeded with a read only layer")
+	}
+	if data, err := ReadFile(base, "/data/existing.txt"); err != nil || string(data) != "This is a test" {
+		t.Errorf("base file changed after failed Create: %q, %v", data, err)
+	}
+}
+
+func TestCacheOnReadFsOpenContextCancel(t *testing.T) {
+	base := &MemMapFs{}
+	layer := &MemMapFs{}
+	ufs := &CacheOnReadFs{base: base, layer: layer, cacheTime: time.Minute}
+
+	WriteFile(base, "/data/file.txt", []byte("new content"), 0644)
+	WriteFile(layer, "/data/file.txt", []byte("old"), 0644)
+	old := time.Now().Add(-time.Hour)
+	layer.Chtimes("/data/file.txt", old, old)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := ufs.OpenContext(ctx, "/data/file.txt"); err != context.Canceled {
+		t.Fatalf("OpenContext with cancelled context: got %v, want %v", err, context.Canceled)
+	}
+	if _, err := layer.Stat("/data/file.txt"); !os.IsNotExist(err) {
+		t.Errorf("partial copy left in the layer: %v", err)
+	}
+}
+
+func newRenameTestFs(t *testing.T) (base, layer Fs, ufs Fs) {
+	base = &MemMapFs{}
+	layer = &MemMapFs{}
+	base.MkdirAll("/home/tree/sub", 0777)
+	for _, name := range []string{"/home/base.txt", "/home/tree/a.txt", "/home/tree/sub/b.txt"} {
+		if err := WriteFile(base, name, []byte("base "+name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return base, layer, NewCopyOnWriteFs(NewReadOnlyFs(base), layer)
+}
+
+func readDirNamesOrFail(t *testing.T, fs Fs, dir string) []string {
+	names, err := readDirNames(fs, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return names
+}
+
+func TestCopyOnWriteFsRenameBaseOnly(t *testing.T) {
+	base, _, ufs := newRenameTestFs(t)
+
+	if err := ufs.Rename("/home/base.txt", "/home/moved.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ufs.Stat("/home/base.txt"); !os.IsNotExist(err) {
+		t.Errorf("renamed file still visible: %v", err)
+	}
+	if _, err := ufs.Open("/home/base.txt"); !os.IsNotExist(err) {
+		t.Errorf("renamed file can still be opened: %v", err)
+	}
+	data, err := ReadFile(ufs, "/home/moved.txt")
+	if err != nil || string(data) != "base /home/base.txt" {
+		t.Errorf("got %q, %v", data, err)
+	}
+	if names := readDirNamesOrFail(t, ufs, "/home"); !reflect.DeepEqual(names, []string{"moved.txt", "tree"}) {
+		t.Errorf("got %v", names)
+	}
+	if _, err := base.Stat("/home/base.txt"); err != nil {
+		t.Errorf("base was changed: %v", err)
+	}
+}
+
+func TestCopyOnWriteFsRenameLayerOnly(t *testing.T) {
+	_, layer, ufs := newRenameTestFs(t)
+	if err := WriteFile(ufs, "/home/new.txt", []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ufs.Rename("/home/new.txt", "/home/tree/new.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ufs.Stat("/home/new.txt"); !os.IsNotExist(err) {
+		t.Errorf("renamed file still visible: %v", err)
+	}
+	if _, err := layer.Stat(whiteoutPath("/home/new.txt")); err == nil {
+		t.Error("unneeded whiteout for a file only in the overlay")
+	}
+	if names := readDirNamesOrFail(t, ufs, "/home/tree"); !reflect.DeepEqual(names, []string{"a.txt", "new.txt", "sub"}) {
+		t.Errorf("got %v", names)
+	}
+}
+
+func TestCopyOnWriteFsRenameMixedTree(t *testing.T) {
+	base, _, ufs := newRenameTestFs(t)
+	// a.txt is changed in the overlay, sub/b.txt only exists in the base
+	if err := WriteFile(ufs, "/home/tree/a.txt", []byte("changed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ufs.Rename("/home/tree", "/home/renamed"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"/home/tree", "/home/tree/a.txt", "/home/tree/sub/b.txt"} {
+		if _, err := ufs.Stat(name); !os.IsNotExist(err) {
+			t.Errorf("%s still visible: %v", name, err)
+		}
+	}
+	for name, want := range map[string]string{
+		"/home/renamed/a.txt":     "changed",
+		"/home/renamed/sub/b.txt": "base /home/tree/sub/b.txt",
+	} {
+		data, err := ReadFile(ufs, name)
+		if err != nil || string(data) != want {
+			t.Errorf("%s: got %q, %v", name, data, err)
+		}
+	}
+	if names := readDirNamesOrFail(t, ufs, "/home"); !reflect.DeepEqual(names, []string{"base.txt", "renamed"}) {
+		t.Errorf("got %v", names)
+	}
+
+	// a new directory of the old name doesn't show the base content
+	if err := ufs.Mkdir("/home/tree", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if names := readDirNamesOrFail(t, ufs, "/home/tree"); len(names) != 0 {
+		t.Errorf("got %v in a new directory", names)
+	}
+	if _, err := ufs.Stat("/home/tree/sub/b.txt"); !os.IsNotExist(err) {
+		t.Errorf("base content visible in the new directory: %v", err)
+	}
+	if _, err := base.Stat("/home/tree/sub/b.txt"); err != nil {
+		t.Errorf("base was changed: %v", err)
+	}
+}
+
+func TestCopyOnWriteFsRemoveWhiteout(t *testing.T) {
+	defer CleanupTempDirs(t)
+	for _, layer := range []Fs{&MemMapFs{}, NewTempOsBaseFs(t)} {
+		base, _, _ := newRenameTestFs(t)
+		ufs := NewCopyOnWriteFs(NewReadOnlyFs(base), layer)
+
+		if err := ufs.Remove("/home/base.txt"); err != nil {
+			t.Fatalf("%s: %v", layer.Name(), err)
+		}
+		if _, err := ufs.Stat("/home/base.txt"); !os.IsNotExist(err) {
+			t.Errorf("%s: removed file still visible: %v", layer.Name(), err)
+		}
+		if _, err := ufs.Open("/home/base.txt"); !os.IsNotExist(err) {
+			t.Errorf("%s: removed file can still be opened: %v", layer.Name(), err)
+		}
+		if names := readDirNamesOrFail(t, ufs, "/home"); !reflect.DeepEqual(names, []string{"tree"}) {
+			t.Errorf("%s: got %v", layer.Name(), names)
+		}
+		if err := ufs.Remove("/home/base.txt"); !os.IsNotExist(err) {
+			t.Errorf("%s: removing twice: %v", layer.Name(), err)
+		}
+
+		// a directory is only removed if it's empty in the union
+		if err := ufs.Remove("/home/tree/sub"); err == nil {
+			t.Errorf("%s: removed a non-empty directory", layer.Name())
+		}
+		if err := ufs.Remove("/home/tree/sub/b.txt"); err != nil {
+			t.Fatalf("%s: %v", layer.Name(), err)
+		}
+		if err := ufs.Remove("/home/tree/sub"); err != nil {
+			t.Fatalf("%s: %v", layer.Name(), err)
+		}
+
+		if err := ufs.RemoveAll("/home/tree"); err != nil {
+			t.Fatalf("%s: %v", layer.Name(), err)
+		}
+		if _, err := ufs.Stat("/home/tree/a.txt"); !os.IsNotExist(err) {
+			t.Errorf("%s: file in a removed directory still visible: %v", layer.Name(), err)
+		}
+		if names := readDirNamesOrFail(t, ufs, "/home"); len(names) != 0 {
+			t.Errorf("%s: got %v", layer.Name(), names)
+		}
+		if err := ufs.RemoveAll("/home/tree"); err != nil {
+			t.Errorf("%s: RemoveAll of a missing path: %v", layer.Name(), err)
+		}
+
+		// a removed file can be created again
+		if err := WriteFile(ufs, "/home/base.txt", []byte("new"), 0644); err != nil {
+			t.Fatalf("%s: %v", layer.Name(), err)
+		}
+		if data, err := ReadFile(ufs, "/home/base.txt"); err != nil || string(data) != "new" {
+			t.Errorf("%s: got %q, %v", layer.Name(), data, err)
+		}
+		if names := readDirNamesOrFail(t, ufs, "/home"); !reflect.DeepEqual(names, []string{"base.txt"}) {
+			t.Errorf("%s: got %v", layer.Name(), names)
+		}
+
+		if _, err := base.Stat("/home/tree/sub/b.txt"); err != nil {
+			t.Errorf("%s: base was changed: %v", layer.Name(), err)
+		}
+	}
+}
+
+func TestCopyOnWriteFsRemoveBoth(t *testing.T) {
+	_, _, ufs := newRenameTestFs(t)
+	if err := WriteFile(ufs, "/home/tree/a.txt", []byte("changed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ufs.Remove("/home/tree/a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	// the base version must not show up again
+	if _, err := ufs.Stat("/home/tree/a.txt"); !os.IsNotExist(err) {
+		t.Errorf("file still visible: %v", err)
+	}
+}
+
+func TestCopyOnWriteFsLazyCopy(t *testing.T) {
+	base := NewMemMapFs()
+	layer := NewMemMapFs()
+	WriteFile(base, "/data/file", []byte("hello world"), 0644)
+	ufs := NewCopyOnWriteFs(base, layer, WithLazyCopy())
+
+	f, err := ufs.OpenFile("/data/file", os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 6)
+	if _, err := io.ReadFull(f, buf); err != nil || string(buf) != "hello " {
+		t.Errorf("read from the base: %q, %v", buf, err)
+	}
+	f.Close()
+	if _, err := layer.Stat("/data/file"); !os.IsNotExist(err) {
+		t.Fatalf("file copied to the layer without a write: %v", err)
+	}
+
+	// the first write copies it, at the offset reached in the base
+	f, _ = ufs.OpenFile("/data/file", os.O_RDWR, 0)
+	io.ReadFull(f, buf)
+	if _, err := f.WriteString("afero"); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if got, _ := ReadFile(layer, "/data/file"); string(got) != "hello afero" {
+		t.Errorf("layer: got %q, want %q", got, "hello afero")
+	}
+	if got, _ := ReadFile(base, "/data/file"); string(got) != "hello world" {
+		t.Errorf("base changed: %q", got)
+	}
+
+	WriteFile(base, "/data/log", []byte("a"), 0644)
+	f, _ = ufs.OpenFile("/data/log", os.O_WRONLY|os.O_APPEND, 0)
+	if _, err := f.Read(buf); err == nil {
+		t.Error("read from a write-only file succeeded")
+	}
+	f.WriteString("b")
+	f.Close()
+	if got, _ := ReadFile(ufs, "/data/log"); string(got) != "ab" {
+		t.Errorf("append: got %q, want %q", got, "ab")
+	}
+}
+
+func TestUnionFsAccessors(t *testing.T) {
+	base := NewReadOnlyFs(NewMemMapFs())
+	layer := NewMemMapFs()
+	for _, fs := range []Fs{
+		NewCacheOnReadFs(base, layer, 0),
+		NewCopyOnWriteFs(base, layer),
+	} {
+		u, ok := fs.(UnionFs)
+		if !ok {
+			t.Fatalf("%s is not a UnionFs", fs.Name())
+		}
+		if u.Base() != base || u.Layer() != layer {
+			t.Errorf("%s: Base or Layer don't return the file systems passed", fs.Name())
+		}
+		// writing to the layer directly works even with a read only base
+		if err := WriteFile(u.Layer(), "/local", []byte("local"), 0644); err != nil {
+			t.Errorf("%s: write to the layer: %v", fs.Name(), err)
+		}
+		if got, err := ReadFile(fs, "/local"); err != nil || string(got) != "local" {
+			t.Errorf("%s: read file written to the layer: %q, %v", fs.Name(), got, err)
+		}
+	}
+}
+
+func TestCopyOnWriteFsLayerOnly(t *testing.T) {
+	base := NewMemMapFs()
+	layer := NewMemMapFs()
+	WriteFile(base, "/tmp/stale", []byte("base"), 0644)
+	WriteFile(base, "/tmpfile", []byte("base"), 0644)
+	WriteFile(base, "/data/tmp/stale", []byte("base"), 0644)
+	WriteFile(base, "/data/keep", []byte("base"), 0644)
+	ufs := NewCopyOnWriteFs(base, layer, WithLayerOnly("/tmp", "/data/tmp/"))
+
+	for _, name := range []string{"/tmp/stale", "/tmp", "/data/tmp/stale"} {
+		if _, err := ufs.Stat(name); !os.IsNotExist(err) {
+			t.Errorf("Stat %s: got %v, want a not exist error", name, err)
+		}
+		if _, err := ufs.Open(name); !os.IsNotExist(err) {
+			t.Errorf("Open %s: got %v, want a not exist error", name, err)
+		}
+	}
+	if got, err := ReadFile(ufs, "/tmpfile"); err != nil || string(got) != "base" {
+		t.Errorf("file next to a layer only prefix: %q, %v", got, err)
+	}
+
+	// the base directories are not listed, not even from a base only dir
+	for dir, want := range map[string][]string{
+		"/":     {"data", "tmpfile"},
+		"/data": {"keep"},
+	} {
+		if names, err := ReadDirNames(ufs, dir); err != nil || !reflect.DeepEqual(names, want) {
+			t.Errorf("ReadDirNames %s: got %v, %v, want %v", dir, names, err, want)
+		}
+	}
+
+	// files created there live in the layer, and are removed without a whiteout
+	if err := WriteFile(ufs, "/tmp/stale", []byte("layer"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := ReadFile(ufs, "/tmp/stale"); string(got) != "layer" {
+		t.Errorf("file written to the layer only dir: got %q", got)
+	}
+	if names, _ := ReadDirNames(ufs, "/"); !reflect.DeepEqual(names, []string{"data", "tmp", "tmpfile"}) {
+		t.Errorf("ReadDirNames / with the layer dir: got %v", names)
+	}
+	if err := ufs.RemoveAll("/tmp"); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := Exists(layer, whiteoutPath("/tmp")); ok {
+		t.Error("whiteout added for a layer only dir")
+	}
+	if got, _ := ReadFile(base, "/tmp/stale"); string(got) != "base" {
+		t.Errorf("base changed: got %q", got)
+	}
 }
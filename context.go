@@ -0,0 +1,41 @@
+package afero
+
+import (
+	"context"
+	"io"
+
+	"github.com/spf13/afero/mem"
+)
+
+// ContextFile is an optional interface of a File. It is implemented by files
+// whose reads and writes may block for long, e.g. on a network file system,
+// and can be cancelled with a context. When ctx is done, the calls return
+// ctx.Err().
+type ContextFile interface {
+	ReadContext(ctx context.Context, p []byte) (int, error)
+	WriteContext(ctx context.Context, p []byte) (int, error)
+}
+
+var _ ContextFile = &mem.File{}
+
+// ReadFull reads exactly len(p) bytes from f into p, like io.ReadFull, but
+// stops early with ctx.Err() when ctx is done. If f is a ContextFile, ctx is
+// passed to each read, otherwise it is checked between reads.
+func ReadFull(ctx context.Context, f File, p []byte) (n int, err error) {
+	cf, _ := f.(ContextFile)
+	for n < len(p) && err == nil {
+		var nn int
+		if cf != nil {
+			nn, err = cf.ReadContext(ctx, p[n:])
+		} else if err = ctx.Err(); err == nil {
+			nn, err = f.Read(p[n:])
+		}
+		n += nn
+	}
+	if n >= len(p) {
+		err = nil
+	} else if n > 0 && err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
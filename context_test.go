@@ -0,0 +1,41 @@
+package afero
+
+import (
+	"context"
+	"io"
+	"testing"
+)
+
+func TestReadFull(t *testing.T) {
+	defer removeAllTestFiles(t)
+	for _, fs := range Fss {
+		name := testDir(fs) + "/file"
+		if err := WriteFile(fs, name, []byte("0123456789"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		f, err := fs.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		buf := make([]byte, 4)
+		if n, err := ReadFull(context.Background(), f, buf); n != 4 || err != nil || string(buf) != "0123" {
+			t.Errorf("%s: got %d, %q, %v", fs.Name(), n, buf[:n], err)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if n, err := ReadFull(ctx, f, buf); n != 0 || err != context.Canceled {
+			t.Errorf("%s: expected context.Canceled, got %d, %v", fs.Name(), n, err)
+		}
+
+		buf = make([]byte, 10)
+		if n, err := ReadFull(context.Background(), f, buf); n != 6 || err != io.ErrUnexpectedEOF {
+			t.Errorf("%s: expected a short read, got %d, %v", fs.Name(), n, err)
+		}
+		if n, err := ReadFull(context.Background(), f, buf); n != 0 || err != io.EOF {
+			t.Errorf("%s: expected EOF, got %d, %v", fs.Name(), n, err)
+		}
+		f.Close()
+	}
+}
@@ -0,0 +1,237 @@
+package afero
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// CopyOptions controls how CopyFile and CopyDir treat an existing
+// destination. A nil *CopyOptions is the same as the zero value.
+type CopyOptions struct {
+	// Merge copies into existing directories and replaces existing files
+	// in the destination. Without it, any existing destination path is an
+	// error wrapping os.ErrExist.
+	Merge bool
+
+	// Progress, if not nil, is called while files are copied, see
+	// ProgressFunc.
+	Progress ProgressFunc
+}
+
+func (o *CopyOptions) merge() bool {
+	return o != nil && o.Merge
+}
+
+func (o *CopyOptions) progress() ProgressFunc {
+	if o == nil {
+		return nil
+	}
+	return o.Progress
+}
+
+// A ProgressFunc is told the progress of copying the file path, the name in
+// the source Fs: copied of its total bytes are copied. It is called after
+// every MiB copied, not for every write, and once the file is copied
+// completely, with copied equal to total.
+type ProgressFunc func(path string, copied, total int64)
+
+const progressInterval = 1 << 20
+
+// progressReader reports the bytes read from r to fn.
+type progressReader struct {
+	r        io.Reader
+	fn       ProgressFunc
+	path     string
+	total    int64
+	copied   int64
+	reported int64
+	done     bool
+}
+
+// withProgress returns r reporting to fn, r itself if fn is nil.
+func withProgress(r io.Reader, fn ProgressFunc, path string, total int64) io.Reader {
+	if fn == nil {
+		return r
+	}
+	return &progressReader{r: r, fn: fn, path: path, total: total}
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.copied += int64(n)
+	if err == io.EOF {
+		if !p.done && (p.copied != p.reported || p.copied == 0) {
+			p.fn(p.path, p.copied, p.total)
+		}
+		p.done = true
+	} else if p.copied-p.reported >= progressInterval {
+		p.reported = p.copied
+		p.fn(p.path, p.copied, p.total)
+	}
+	return n, err
+}
+
+// CopyFile copies the regular file srcPath in srcFs to dstPath in dstFs,
+// streaming its content. Missing parent directories of dstPath are created.
+// The permission bits and the modification time of the source are applied
+// to the copy.
+func (a Afero) CopyFile(srcPath string, dstFs Fs, dstPath string, opts *CopyOptions) error {
+	return CopyFile(a.Fs, srcPath, dstFs, dstPath, opts)
+}
+
+func CopyFile(srcFs Fs, srcPath string, dstFs Fs, dstPath string, opts *CopyOptions) error {
+	src, err := srcFs.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	fi, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		return &os.PathError{Op: "copy", Path: srcPath, Err: syscall.EISDIR}
+	}
+	if err := dstFs.MkdirAll(filepath.Dir(dstPath), 0777); err != nil {
+		return err
+	}
+	return copyFileContent(src, srcPath, fi, dstFs, dstPath, opts)
+}
+
+func copyFileContent(src File, srcPath string, fi os.FileInfo, dstFs Fs, dstPath string, opts *CopyOptions) error {
+	flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if !opts.merge() {
+		if _, err := dstFs.Stat(dstPath); err == nil {
+			return &os.PathError{Op: "copy", Path: dstPath, Err: os.ErrExist}
+		}
+		flag |= os.O_EXCL
+	}
+	dst, err := dstFs.OpenFile(dstPath, flag, fi.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, withProgress(src, opts.progress(), srcPath, fi.Size()))
+	if err1 := dst.Close(); err == nil {
+		err = err1
+	}
+	if err == nil {
+		err = dstFs.Chmod(dstPath, fi.Mode().Perm())
+	}
+	if err == nil {
+		err = dstFs.Chtimes(dstPath, fi.ModTime(), fi.ModTime())
+	}
+	if err != nil {
+		dstFs.Remove(dstPath)
+	}
+	return err
+}
+
+// CopyDir recursively copies the directory srcPath in srcFs to dstPath in
+// dstFs. Directories and files are created with the permission bits and
+// modification times of their sources, file contents are streamed.
+// Symbolic links (only seen if srcFs implements Symlinker) are recreated
+// in dstFs, which then also has to implement Symlinker.
+func (a Afero) CopyDir(srcPath string, dstFs Fs, dstPath string, opts *CopyOptions) error {
+	return CopyDir(a.Fs, srcPath, dstFs, dstPath, opts)
+}
+
+func CopyDir(srcFs Fs, srcPath string, dstFs Fs, dstPath string, opts *CopyOptions) error {
+	if err := dstFs.MkdirAll(filepath.Dir(dstPath), 0777); err != nil {
+		return err
+	}
+
+	type dirAttrs struct {
+		path  string
+		mode  os.FileMode
+		mtime time.Time
+	}
+	// set directory modes and times last, the content has to be copied into
+	// them first and changes their times
+	var dirs []dirAttrs
+
+	err := Walk(srcFs, srcPath, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(srcPath, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dstPath, rel)
+
+		switch {
+		case fi.IsDir():
+			if err := copyDirEntry(dstFs, target, fi, opts); err != nil {
+				return err
+			}
+			dirs = append(dirs, dirAttrs{target, fi.Mode().Perm(), fi.ModTime()})
+			return nil
+		case fi.Mode()&os.ModeSymlink != 0:
+			return copySymlink(srcFs, path, dstFs, target, opts)
+		default:
+			src, err := srcFs.Open(path)
+			if err != nil {
+				return err
+			}
+			defer src.Close()
+			return copyFileContent(src, path, fi, dstFs, target, opts)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := dstFs.Chmod(dirs[i].path, dirs[i].mode); err != nil {
+			return err
+		}
+		if err := dstFs.Chtimes(dirs[i].path, dirs[i].mtime, dirs[i].mtime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func copyDirEntry(dstFs Fs, target string, fi os.FileInfo, opts *CopyOptions) error {
+	dfi, err := dstFs.Stat(target)
+	switch {
+	case err == nil && (!dfi.IsDir() || !opts.merge()):
+		return &os.PathError{Op: "copy", Path: target, Err: os.ErrExist}
+	case err == nil:
+		// merge into the existing directory
+	case os.IsNotExist(err):
+		// owner needs write access while the content is copied
+		if err := dstFs.Mkdir(target, 0700); err != nil {
+			return err
+		}
+	default:
+		return err
+	}
+	return nil
+}
+
+func copySymlink(srcFs Fs, path string, dstFs Fs, target string, opts *CopyOptions) error {
+	srcLinker, ok := srcFs.(Symlinker)
+	if !ok {
+		return &os.LinkError{Op: "readlink", Old: path, New: target, Err: ErrNoSymlink}
+	}
+	dstLinker, ok := dstFs.(Symlinker)
+	if !ok {
+		return &os.LinkError{Op: "symlink", Old: path, New: target, Err: ErrNoSymlink}
+	}
+	link, err := srcLinker.ReadlinkIfPossible(path)
+	if err != nil {
+		return err
+	}
+	if opts.merge() {
+		if _, _, err := dstLinker.LstatIfPossible(target); err == nil {
+			if err := dstFs.Remove(target); err != nil {
+				return err
+			}
+		}
+	}
+	return dstLinker.SymlinkIfPossible(link, target)
+}
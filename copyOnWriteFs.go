@@ -1,11 +1,22 @@
 package afero
 
 import (
+	"io"
 	"os"
+	"path/filepath"
 	"syscall"
 	"time"
 )
 
+// whiteoutPrefix is prepended to the name of a base file to hide it, see
+// CopyOnWriteFs.
+const whiteoutPrefix = ".wh."
+
+func whiteoutPath(name string) string {
+	dir, file := filepath.Split(NormalizePath(name))
+	return filepath.Join(dir, whiteoutPrefix+file)
+}
+
 // The CopyOnWriteFs is a union filesystem: a read only base file system with
 // a possibly writeable layer on top. Changes to the file system will only
 // be made in the overlay: Changing an existing file in the base layer which
@@ -17,13 +28,63 @@ import (
 //    can handle this).
 //
 // Reading directories is currently only supported via Open(), not OpenFile().
+//
+// Files and directories of the base removed or moved away are hidden with a
+// whiteout: an empty file in the overlay named like the hidden file with a
+// ".wh." prefix. Whiteouts never show up in directory listings. If the
+// overlay has a directory of the same name, the whiteout makes it opaque,
+// i.e. the contents of the base directory are not merged into it.
 type CopyOnWriteFs struct {
-	base  Fs
-	layer Fs
+	base      Fs
+	layer     Fs
+	lazy      bool
+	layerOnly []string // normalized prefixes
+}
+
+func NewCopyOnWriteFs(base Fs, layer Fs, opts ...CopyOnWriteOption) Fs {
+	u := &CopyOnWriteFs{base: base, layer: layer}
+	for _, opt := range opts {
+		opt(u)
+	}
+	return u
+}
+
+// Base returns the read only file system below the overlay.
+func (u *CopyOnWriteFs) Base() Fs {
+	return u.base
 }
 
-func NewCopyOnWriteFs(base Fs, layer Fs) Fs {
-	return &CopyOnWriteFs{base: base, layer: layer}
+// Layer returns the overlay all changes are made in.
+func (u *CopyOnWriteFs) Layer() Fs {
+	return u.layer
+}
+
+// A CopyOnWriteOption configures a CopyOnWriteFs when passed to its
+// constructor.
+type CopyOnWriteOption func(*CopyOnWriteFs)
+
+// WithLazyCopy defers copying a base file to the overlay when it is opened
+// for writing until the first write or truncate through the returned File,
+// so files opened writable but never written are not copied. Until then
+// the File reads from the base. Opening with os.O_TRUNC still copies right
+// away. A lazily copied File must not be used concurrently.
+func WithLazyCopy() CopyOnWriteOption {
+	return func(u *CopyOnWriteFs) {
+		u.lazy = true
+	}
+}
+
+// WithLayerOnly makes the paths below the given prefixes live in the overlay
+// only, e.g. scratch directories: the base is never consulted for them, so
+// files of the base there are invisible, and removing files there needs no
+// whiteouts. A prefix is a directory: "/tmp" covers "/tmp" and "/tmp/file",
+// but not "/tmpfoo". The names are compared after NormalizePath.
+func WithLayerOnly(prefixes ...string) CopyOnWriteOption {
+	return func(u *CopyOnWriteFs) {
+		for _, prefix := range prefixes {
+			u.layerOnly = append(u.layerOnly, NormalizePath(prefix))
+		}
+	}
 }
 
 // isBaseFile Returns true if the given file is only found in the base layer
@@ -32,12 +93,115 @@ func (u *CopyOnWriteFs) isBaseFile(name string) (bool, error) {
 	if _, err := u.layer.Stat(name); err == nil {
 		return false, nil
 	}
+	if u.baseHidden(name) {
+		return true, &os.PathError{Op: "stat", Path: name, Err: os.ErrNotExist}
+	}
 	_, err := u.base.Stat(name)
 	return true, err
 }
 
+func (u *CopyOnWriteFs) inLayer(name string) bool {
+	_, err := u.layer.Stat(name)
+	return err == nil
+}
+
+// hasWhiteout returns true if the overlay has a whiteout for name.
+func (u *CopyOnWriteFs) hasWhiteout(name string) bool {
+	_, err := u.layer.Stat(whiteoutPath(name))
+	return err == nil
+}
+
+// baseHidden returns true if name must not be looked up in the base, as it
+// is below a layer only prefix or hidden by a whiteout.
+func (u *CopyOnWriteFs) baseHidden(name string) bool {
+	return hasPathPrefix(name, u.layerOnly) || u.isWhiteout(name)
+}
+
+// isWhiteout returns true if name or one of its parent directories is
+// hidden by a whiteout.
+func (u *CopyOnWriteFs) isWhiteout(name string) bool {
+	name = NormalizePath(name)
+	for {
+		if u.hasWhiteout(name) {
+			return true
+		}
+		dir := filepath.Dir(name)
+		if dir == name {
+			return false
+		}
+		name = dir
+	}
+}
+
+// isBaseDir returns true if name is a directory in the base, which is not
+// hidden by a whiteout.
+func (u *CopyOnWriteFs) isBaseDir(name string) (bool, error) {
+	if u.baseHidden(name) {
+		return false, &os.PathError{Op: "stat", Path: name, Err: os.ErrNotExist}
+	}
+	return IsDir(u.base, name)
+}
+
+// copyTreeToLayer copies name from the base to the overlay, for directories
+// with everything below it. Files already in the overlay and whiteouts are
+// respected, i.e. only what is visible from the base is copied.
+func (u *CopyOnWriteFs) copyTreeToLayer(name string) error {
+	lfi, err := u.layer.Stat(name)
+	inLayer := err == nil
+	if inLayer && !lfi.IsDir() || u.baseHidden(name) {
+		return nil
+	}
+	bfi, err := u.base.Stat(name)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !bfi.IsDir() {
+		if inLayer {
+			return nil
+		}
+		return u.copyToLayer(name)
+	}
+
+	if !inLayer {
+		if err := u.layer.MkdirAll(name, bfi.Mode().Perm()); err != nil {
+			return err
+		}
+	}
+	names, err := readDirNames(u.base, name)
+	if err != nil {
+		return err
+	}
+	for _, n := range names {
+		if err := u.copyTreeToLayer(filepath.Join(name, n)); err != nil {
+			return err
+		}
+	}
+	if !inLayer {
+		return u.layer.Chtimes(name, bfi.ModTime(), bfi.ModTime())
+	}
+	return nil
+}
+
+// addWhiteout hides name in the base.
+func (u *CopyOnWriteFs) addWhiteout(name string) error {
+	if dir := filepath.Dir(NormalizePath(name)); !u.inLayer(dir) {
+		if err := u.layer.MkdirAll(dir, 0777); err != nil {
+			return err
+		}
+	}
+	f, err := u.layer.Create(whiteoutPath(name))
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
 func (u *CopyOnWriteFs) copyToLayer(name string) error {
-	return copyToLayer(u.base, u.layer, name)
+	_, err := copyToLayer(u.base, u.layer, name)
+	return err
 }
 
 func (u *CopyOnWriteFs) Chtimes(name string, atime, mtime time.Time) error {
@@ -68,66 +232,106 @@ func (u *CopyOnWriteFs) Chmod(name string, mode os.FileMode) error {
 
 func (u *CopyOnWriteFs) Stat(name string) (os.FileInfo, error) {
 	fi, err := u.layer.Stat(name)
-	switch err {
-	case nil:
+	switch {
+	case err == nil:
 		return fi, nil
-	case syscall.ENOENT:
+	case err == syscall.ENOENT || os.IsNotExist(err):
+		if u.baseHidden(name) {
+			return nil, &os.PathError{Op: "stat", Path: name, Err: os.ErrNotExist}
+		}
 		return u.base.Stat(name)
 	default:
 		return nil, err
 	}
 }
 
-// Renaming files present only in the base layer is not permitted
+// Rename copies oldname from the base to the overlay if needed, directories
+// with all their content, and renames it there. If oldname exists in the
+// base, it is hidden with a whiteout afterwards.
 func (u *CopyOnWriteFs) Rename(oldname, newname string) error {
-	b, err := u.isBaseFile(oldname)
-	if err != nil {
+	if _, err := u.Stat(oldname); err != nil {
 		return err
 	}
-	if b {
-		return syscall.EPERM
+	if err := u.copyTreeToLayer(oldname); err != nil {
+		return err
+	}
+	if dir := filepath.Dir(newname); !u.inLayer(dir) {
+		if err := u.layer.MkdirAll(dir, 0777); err != nil {
+			return err
+		}
+	}
+	if err := u.layer.Rename(oldname, newname); err != nil {
+		return err
 	}
-	return u.layer.Rename(oldname, newname)
+	return u.hideBase(oldname)
 }
 
-// Removing files present only in the base layer is not permitted. If
-// a file is present in the base layer and the overlay, only the overlay
-// will be removed.
+// Remove removes name from the overlay. If it exists in the base, it is
+// hidden with a whiteout, the base itself is not changed.
 func (u *CopyOnWriteFs) Remove(name string) error {
-	err := u.layer.Remove(name)
-	switch err {
-	case syscall.ENOENT:
-		_, err = u.base.Stat(name)
-		if err == nil {
-			return syscall.EPERM
-		}
-		return syscall.ENOENT
-	default:
-		return err
+	fi, err := u.Stat(name)
+	if err != nil {
+		return &os.PathError{Op: "remove", Path: name, Err: os.ErrNotExist}
 	}
+	if fi.IsDir() {
+		names, err := readDirNames(u, name)
+		if err != nil {
+			return err
+		}
+		if len(names) > 0 {
+			return &os.PathError{Op: "remove", Path: name, Err: syscall.ENOTEMPTY}
+		}
+	}
+	if _, err := u.layer.Stat(name); err == nil {
+		// a directory may still contain whiteouts
+		if err := u.layer.RemoveAll(name); err != nil {
+			return err
+		}
+	}
+	return u.hideBase(name)
 }
 
+// RemoveAll removes name and everything below it from the overlay and hides
+// what exists of it in the base with a whiteout.
 func (u *CopyOnWriteFs) RemoveAll(name string) error {
-	err := u.layer.RemoveAll(name)
-	switch err {
-	case syscall.ENOENT:
-		_, err = u.base.Stat(name)
-		if err == nil {
-			return syscall.EPERM
-		}
-		return syscall.ENOENT
-	default:
+	if _, err := u.Stat(name); os.IsNotExist(err) {
+		return nil
+	}
+	if err := u.layer.RemoveAll(name); err != nil {
 		return err
 	}
+	return u.hideBase(name)
+}
+
+// hideBase adds a whiteout for name if it is visible in the base.
+func (u *CopyOnWriteFs) hideBase(name string) error {
+	if u.baseHidden(name) {
+		return nil
+	}
+	if _, err := u.base.Stat(name); err != nil {
+		return nil
+	}
+	return u.addWhiteout(name)
 }
 
 func (u *CopyOnWriteFs) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
 	b, err := u.isBaseFile(name)
+	if os.IsNotExist(err) && flag&os.O_CREATE != 0 {
+		// a new file, or one hidden by a whiteout: create it in the overlay
+		return u.layer.OpenFile(name, flag, perm)
+	}
 	if err != nil {
 		return nil, err
 	}
 
 	if flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) != 0 {
+		if b && u.lazy && flag&os.O_TRUNC == 0 {
+			bfile, err := u.base.Open(name)
+			if err != nil {
+				return nil, err
+			}
+			return &lazyCopyFile{File: bfile, fs: u, name: name, flag: flag}, nil
+		}
 		if b {
 			if err = u.copyToLayer(name); err != nil {
 				return nil, err
@@ -149,15 +353,24 @@ func (u *CopyOnWriteFs) Open(name string) (File, error) {
 
 	if b {
 		// If it's only in the base (not overlay) return that File
-		return u.base.Open(name)
+		bfile, err := u.base.Open(name)
+		if err != nil || len(u.layerOnly) == 0 {
+			return bfile, err
+		}
+		if fi, err := bfile.Stat(); err == nil && fi.IsDir() {
+			// leave out the layer only entries
+			return &UnionFile{base: bfile, hideBase: u.layerOnlyIn(name)}, nil
+		}
+		return bfile, nil
 	}
 
 	dir, err := IsDir(u.layer, name)
 	if err != nil {
 		return nil, err
 	}
-	if !dir {
-		// If it's in the overlay and not a directory, return that file
+	if !dir || u.baseHidden(name) {
+		// If it's in the overlay and not a directory or an opaque
+		// directory, return that file
 		return u.layer.Open(name)
 	}
 
@@ -167,11 +380,22 @@ func (u *CopyOnWriteFs) Open(name string) (File, error) {
 		return nil, err
 	}
 	// If it's a directory in both, return a unionFile
-	return &UnionFile{base: bfile, layer: lfile}, nil
+	return &UnionFile{base: bfile, layer: lfile, hideBase: u.layerOnlyIn(name)}, nil
+}
+
+// layerOnlyIn returns a function reporting the entries of the directory dir
+// which are below a layer only prefix, nil if there are no prefixes.
+func (u *CopyOnWriteFs) layerOnlyIn(dir string) func(name string) bool {
+	if len(u.layerOnly) == 0 {
+		return nil
+	}
+	return func(name string) bool {
+		return hasPathPrefix(filepath.Join(dir, name), u.layerOnly)
+	}
 }
 
 func (u *CopyOnWriteFs) Mkdir(name string, perm os.FileMode) error {
-	dir, err := IsDir(u.base, name)
+	dir, err := u.isBaseDir(name)
 	if err != nil {
 		return u.layer.MkdirAll(name, perm)
 	}
@@ -186,7 +410,7 @@ func (u *CopyOnWriteFs) Name() string {
 }
 
 func (u *CopyOnWriteFs) MkdirAll(name string, perm os.FileMode) error {
-	dir, err := IsDir(u.base, name)
+	dir, err := u.isBaseDir(name)
 	if err != nil {
 		return u.layer.MkdirAll(name, perm)
 	}
@@ -205,3 +429,85 @@ func (u *CopyOnWriteFs) Create(name string) (File, error) {
 	}
 	return u.layer.Create(name)
 }
+
+// lazyCopyFile is a base file opened for writing with WithLazyCopy. It reads
+// from the base until it is first changed, then the file is copied to the
+// overlay and opened there at the same offset.
+type lazyCopyFile struct {
+	File
+	fs     *CopyOnWriteFs
+	name   string
+	flag   int
+	copied bool
+}
+
+// copyUp copies the file to the overlay and switches to it, unless already
+// done.
+func (f *lazyCopyFile) copyUp() error {
+	if f.copied {
+		return nil
+	}
+	off, err := f.File.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	// another handle may have copied it in the meantime
+	if !f.fs.inLayer(f.name) {
+		if err := f.fs.copyToLayer(f.name); err != nil {
+			return err
+		}
+	}
+	lfile, err := f.fs.layer.OpenFile(f.name, f.flag&^(os.O_CREATE|os.O_EXCL), 0)
+	if err != nil {
+		return err
+	}
+	if f.flag&os.O_APPEND == 0 {
+		if _, err := lfile.Seek(off, io.SeekStart); err != nil {
+			lfile.Close()
+			return err
+		}
+	}
+	f.File.Close()
+	f.File = lfile
+	f.copied = true
+	return nil
+}
+
+func (f *lazyCopyFile) Read(p []byte) (int, error) {
+	if f.flag&os.O_WRONLY != 0 {
+		return 0, &os.PathError{Op: "read", Path: f.name, Err: syscall.EBADF}
+	}
+	return f.File.Read(p)
+}
+
+func (f *lazyCopyFile) ReadAt(p []byte, off int64) (int, error) {
+	if f.flag&os.O_WRONLY != 0 {
+		return 0, &os.PathError{Op: "read", Path: f.name, Err: syscall.EBADF}
+	}
+	return f.File.ReadAt(p, off)
+}
+
+func (f *lazyCopyFile) Write(p []byte) (int, error) {
+	if err := f.copyUp(); err != nil {
+		return 0, err
+	}
+	return f.File.Write(p)
+}
+
+func (f *lazyCopyFile) WriteAt(p []byte, off int64) (int, error) {
+	if err := f.copyUp(); err != nil {
+		return 0, err
+	}
+	return f.File.WriteAt(p, off)
+}
+
+func (f *lazyCopyFile) WriteString(s string) (int, error) {
+	return f.Write([]byte(s))
+}
+
+func (f *lazyCopyFile) Truncate(size int64) error {
+	if err := f.copyUp(); err != nil {
+		return err
+	}
+	return f.File.Truncate(size)
+}
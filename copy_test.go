@@ -0,0 +1,176 @@
+package afero
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func setupCopySource(t *testing.T) Fs {
+	src := &MemMapFs{}
+	mtime := time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := src.MkdirAll("/src/sub/empty", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFile(src, "/src/a.txt", []byte("aaa"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFile(src, "/src/sub/b.txt", []byte("bbbbb"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := src.SymlinkIfPossible("a.txt", "/src/link"); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{"/src/a.txt", "/src/sub/b.txt", "/src/sub/empty", "/src/sub", "/src"} {
+		if err := src.Chtimes(p, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return src
+}
+
+func TestCopyDir(t *testing.T) {
+	defer removeAllTestFiles(t)
+	for _, dst := range Fss {
+		src := setupCopySource(t)
+		dstPath := filepath.Join(testDir(dst), "copy")
+
+		if err := CopyDir(src, "/src", dst, dstPath, nil); err != nil {
+			t.Fatalf("%s: %v", dst.Name(), err)
+		}
+
+		for name, want := range map[string]string{"a.txt": "aaa", "sub/b.txt": "bbbbb", "link": "aaa"} {
+			got, err := ReadFile(dst, filepath.Join(dstPath, name))
+			if err != nil {
+				t.Fatalf("%s: %v", dst.Name(), err)
+			}
+			if string(got) != want {
+				t.Errorf("%s: %s: got %q, want %q", dst.Name(), name, got, want)
+			}
+		}
+
+		target, err := dst.(Symlinker).ReadlinkIfPossible(filepath.Join(dstPath, "link"))
+		if err != nil || target != "a.txt" {
+			t.Errorf("%s: got link %q, %v", dst.Name(), target, err)
+		}
+
+		for name, want := range map[string]os.FileMode{"a.txt": 0600, "sub/b.txt": 0644, "sub/empty": os.ModeDir | 0755} {
+			fi, err := dst.Stat(filepath.Join(dstPath, name))
+			if err != nil {
+				t.Fatalf("%s: %v", dst.Name(), err)
+			}
+			if fi.Mode() != want {
+				t.Errorf("%s: %s: got mode %v, want %v", dst.Name(), name, fi.Mode(), want)
+			}
+			sfi, _ := src.Stat(filepath.Join("/src", name))
+			if !fi.ModTime().Equal(sfi.ModTime()) {
+				t.Errorf("%s: %s: got mtime %v, want %v", dst.Name(), name, fi.ModTime(), sfi.ModTime())
+			}
+		}
+	}
+}
+
+func TestCopyDirExisting(t *testing.T) {
+	src := setupCopySource(t)
+	dst := &MemMapFs{}
+	if err := WriteFile(dst, "/dst/a.txt", []byte("old content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	err := CopyDir(src, "/src", dst, "/dst", nil)
+	if !os.IsExist(err) {
+		t.Fatalf("expected an exist error, got %v", err)
+	}
+
+	if err := CopyDir(src, "/src", dst, "/dst", &CopyOptions{Merge: true}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadFile(dst, "/dst/a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "aaa" {
+		t.Errorf("got %q, want %q", got, "aaa")
+	}
+}
+
+func TestCopyDirReadOnly(t *testing.T) {
+	src := &MemMapFs{}
+	WriteFile(src, "/s/d/f", []byte("f"), 0444)
+	src.Chmod("/s/d", 0555)
+	dst := NewMemMapFsEnforcing(1000, 1000)
+	dst.Mkdir("/t", 0755)
+
+	if err := CopyDir(src, "/s", dst, "/t/s", nil); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ReadFile(dst, "/t/s/d/f"); err != nil || string(got) != "f" {
+		t.Errorf("file in a read only directory: %q, %v", got, err)
+	}
+	if fi, err := dst.Stat("/t/s/d"); err != nil || fi.Mode() != os.ModeDir|0555 {
+		t.Errorf("read only directory: %v, %v", fi, err)
+	}
+}
+
+func TestCopyFile(t *testing.T) {
+	src := setupCopySource(t)
+	dst := &MemMapFs{}
+
+	if err := CopyFile(src, "/src/sub/b.txt", dst, "/x/y/b.txt", nil); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadFile(dst, "/x/y/b.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "bbbbb" {
+		t.Errorf("got %q, want %q", got, "bbbbb")
+	}
+
+	if err := CopyFile(src, "/src/a.txt", dst, "/x/y/b.txt", nil); !os.IsExist(err) {
+		t.Errorf("expected an exist error, got %v", err)
+	}
+	if err := CopyFile(src, "/src/sub", dst, "/x/sub", nil); err == nil {
+		t.Error("expected an error copying a directory")
+	}
+}
+
+func TestCopyDirNoSymlink(t *testing.T) {
+	src := setupCopySource(t)
+	// hide the Symlinker methods of MemMapFs
+	dst := struct{ Fs }{&MemMapFs{}}
+	err := CopyDir(src, "/src", dst, "/dst", nil)
+	if !errors.Is(err, ErrNoSymlink) {
+		t.Fatalf("expected ErrNoSymlink, got %v", err)
+	}
+}
+
+func TestCopyDirProgress(t *testing.T) {
+	src := setupCopySource(t)
+	WriteFile(src, "/src/big", make([]byte, 5*progressInterval/2), 0644)
+	WriteFile(src, "/src/sub/empty.txt", nil, 0644)
+
+	var got []string
+	progress := func(path string, copied, total int64) {
+		got = append(got, fmt.Sprintf("%s %d/%d", path, copied, total))
+	}
+	dst := &MemMapFs{}
+	if err := CopyDir(src, "/src", dst, "/dst", &CopyOptions{Progress: progress}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"/src/a.txt 3/3",
+		fmt.Sprintf("/src/big %d/%d", 1*progressInterval, 5*progressInterval/2),
+		fmt.Sprintf("/src/big %d/%d", 2*progressInterval, 5*progressInterval/2),
+		fmt.Sprintf("/src/big %d/%d", 5*progressInterval/2, 5*progressInterval/2),
+		"/src/sub/b.txt 5/5",
+		"/src/sub/empty.txt 0/0",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("progress:\ngot  %q\nwant %q", got, want)
+	}
+}
@@ -0,0 +1,160 @@
+package afero
+
+import (
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// CountingStats holds the counters of a CountingFs, see Stats().
+type CountingStats struct {
+	BytesRead    int64 // by Read and ReadAt of the files
+	BytesWritten int64 // by Write, WriteAt and WriteString of the files
+	Opens        int64 // calls of Open, OpenFile and Create
+	Stats        int64 // calls of Stat
+	Mkdirs       int64 // calls of Mkdir and MkdirAll
+	Removes      int64 // calls of Remove and RemoveAll
+	Renames      int64 // calls of Rename
+	Chmods       int64 // calls of Chmod
+	Chtimes      int64 // calls of Chtimes
+}
+
+// The CountingFs passes all calls to the source Fs and counts them, and the
+// bytes read from and written to the files it returns, e.g. to export them
+// as metrics. Counting is done with atomic operations only, so the overhead
+// is small enough to keep it enabled in production.
+type CountingFs struct {
+	// atomic requires 64-bit alignment for struct field access
+	stats  CountingStats
+	source Fs
+}
+
+func NewCountingFs(source Fs) *CountingFs {
+	return &CountingFs{source: source}
+}
+
+// BytesRead returns the number of bytes read from files of the Fs so far.
+func (c *CountingFs) BytesRead() int64 {
+	return atomic.LoadInt64(&c.stats.BytesRead)
+}
+
+// BytesWritten returns the number of bytes written to files of the Fs so
+// far.
+func (c *CountingFs) BytesWritten() int64 {
+	return atomic.LoadInt64(&c.stats.BytesWritten)
+}
+
+// Stats returns a snapshot of all counters. It is safe to call concurrently
+// with any other operation on the Fs.
+func (c *CountingFs) Stats() CountingStats {
+	return CountingStats{
+		BytesRead:    atomic.LoadInt64(&c.stats.BytesRead),
+		BytesWritten: atomic.LoadInt64(&c.stats.BytesWritten),
+		Opens:        atomic.LoadInt64(&c.stats.Opens),
+		Stats:        atomic.LoadInt64(&c.stats.Stats),
+		Mkdirs:       atomic.LoadInt64(&c.stats.Mkdirs),
+		Removes:      atomic.LoadInt64(&c.stats.Removes),
+		Renames:      atomic.LoadInt64(&c.stats.Renames),
+		Chmods:       atomic.LoadInt64(&c.stats.Chmods),
+		Chtimes:      atomic.LoadInt64(&c.stats.Chtimes),
+	}
+}
+
+func (c *CountingFs) count(f File, err error) (File, error) {
+	atomic.AddInt64(&c.stats.Opens, 1)
+	if err != nil {
+		return nil, err
+	}
+	return &countingFile{File: f, fs: c}, nil
+}
+
+func (c *CountingFs) Name() string {
+	return "CountingFs"
+}
+
+func (c *CountingFs) Create(name string) (File, error) {
+	return c.count(c.source.Create(name))
+}
+
+func (c *CountingFs) Open(name string) (File, error) {
+	return c.count(c.source.Open(name))
+}
+
+func (c *CountingFs) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	return c.count(c.source.OpenFile(name, flag, perm))
+}
+
+func (c *CountingFs) Mkdir(name string, perm os.FileMode) error {
+	atomic.AddInt64(&c.stats.Mkdirs, 1)
+	return c.source.Mkdir(name, perm)
+}
+
+func (c *CountingFs) MkdirAll(path string, perm os.FileMode) error {
+	atomic.AddInt64(&c.stats.Mkdirs, 1)
+	return c.source.MkdirAll(path, perm)
+}
+
+func (c *CountingFs) Remove(name string) error {
+	atomic.AddInt64(&c.stats.Removes, 1)
+	return c.source.Remove(name)
+}
+
+func (c *CountingFs) RemoveAll(path string) error {
+	atomic.AddInt64(&c.stats.Removes, 1)
+	return c.source.RemoveAll(path)
+}
+
+func (c *CountingFs) Rename(oldname, newname string) error {
+	atomic.AddInt64(&c.stats.Renames, 1)
+	return c.source.Rename(oldname, newname)
+}
+
+func (c *CountingFs) Stat(name string) (os.FileInfo, error) {
+	atomic.AddInt64(&c.stats.Stats, 1)
+	return c.source.Stat(name)
+}
+
+func (c *CountingFs) Chmod(name string, mode os.FileMode) error {
+	atomic.AddInt64(&c.stats.Chmods, 1)
+	return c.source.Chmod(name, mode)
+}
+
+func (c *CountingFs) Chtimes(name string, atime, mtime time.Time) error {
+	atomic.AddInt64(&c.stats.Chtimes, 1)
+	return c.source.Chtimes(name, atime, mtime)
+}
+
+type countingFile struct {
+	File
+	fs *CountingFs
+}
+
+func (f *countingFile) Read(p []byte) (int, error) {
+	n, err := f.File.Read(p)
+	atomic.AddInt64(&f.fs.stats.BytesRead, int64(n))
+	return n, err
+}
+
+func (f *countingFile) ReadAt(p []byte, off int64) (int, error) {
+	n, err := f.File.ReadAt(p, off)
+	atomic.AddInt64(&f.fs.stats.BytesRead, int64(n))
+	return n, err
+}
+
+func (f *countingFile) Write(p []byte) (int, error) {
+	n, err := f.File.Write(p)
+	atomic.AddInt64(&f.fs.stats.BytesWritten, int64(n))
+	return n, err
+}
+
+func (f *countingFile) WriteAt(p []byte, off int64) (int, error) {
+	n, err := f.File.WriteAt(p, off)
+	atomic.AddInt64(&f.fs.stats.BytesWritten, int64(n))
+	return n, err
+}
+
+func (f *countingFile) WriteString(s string) (int, error) {
+	n, err := f.File.WriteString(s)
+	atomic.AddInt64(&f.fs.stats.BytesWritten, int64(n))
+	return n, err
+}
@@ -0,0 +1,45 @@
+package afero
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestCountingFs(t *testing.T) {
+	fs := NewCountingFs(&MemMapFs{})
+
+	if err := fs.MkdirAll("/dir", 0755); err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			name := fmt.Sprintf("/dir/file%d", i)
+			WriteFile(fs, name, []byte("0123456789"), 0644)
+			ReadFile(fs, name)
+		}(i)
+	}
+	wg.Wait()
+	fs.Rename("/dir/file0", "/dir/moved")
+	fs.Remove("/dir/moved")
+	fs.Stat("/missing")
+
+	if fs.BytesWritten() != 100 || fs.BytesRead() != 100 {
+		t.Errorf("Got %d bytes written, %d read, expected 100", fs.BytesWritten(), fs.BytesRead())
+	}
+	want := CountingStats{
+		BytesRead:    100,
+		BytesWritten: 100,
+		Opens:        20,
+		Stats:        1,
+		Mkdirs:       1,
+		Removes:      1,
+		Renames:      1,
+	}
+	if got := fs.Stats(); got != want {
+		t.Errorf("Stats() = %+v, want %+v", got, want)
+	}
+}
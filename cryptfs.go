@@ -0,0 +1,284 @@
+package afero
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	crand "crypto/rand"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/spf13/afero/mem"
+)
+
+// ErrCryptTampered is returned when opening a file of a CryptFs which can't
+// be decrypted: it was modified, truncated or encrypted with another key.
+var ErrCryptTampered = errors.New("encrypted file is corrupt or was tampered with")
+
+// The CryptFs encrypts the files of the base Fs at rest with AES-GCM. Each
+// file is stored as a random nonce followed by the sealed content, a new
+// nonce is used on every write back.
+//
+// As GCM can only authenticate the content as a whole, a file is decrypted
+// into memory when it is opened and encrypted back to the base Fs on Sync
+// and on Close, if it was changed. This allows seeking, ReadAt and WriteAt,
+// but keeps the whole file in memory and is not meant for large files.
+// Concurrent writers of the same file overwrite each other on Close.
+//
+// Stat returns the size of the decrypted content. Directories and file names
+// are not encrypted.
+type CryptFs struct {
+	source Fs
+	aead   cipher.AEAD
+}
+
+// NewCryptFs returns a CryptFs using key, which must be 16, 24 or 32 bytes
+// long to select AES-128, AES-192 or AES-256.
+func NewCryptFs(source Fs, key []byte) (*CryptFs, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &CryptFs{source: source, aead: aead}, nil
+}
+
+// overhead is the number of bytes an encrypted file is larger than its
+// content.
+func (c *CryptFs) overhead() int64 {
+	return int64(c.aead.NonceSize() + c.aead.Overhead())
+}
+
+func (c *CryptFs) decrypt(ciphertext []byte) ([]byte, error) {
+	ns := c.aead.NonceSize()
+	if len(ciphertext) < ns {
+		return nil, ErrCryptTampered
+	}
+	plaintext, err := c.aead.Open(nil, ciphertext[:ns], ciphertext[ns:], nil)
+	if err != nil {
+		return nil, ErrCryptTampered
+	}
+	return plaintext, nil
+}
+
+func (c *CryptFs) encrypt(plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, c.aead.NonceSize(), int64(len(plaintext))+c.overhead())
+	if _, err := io.ReadFull(crand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return c.aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func (c *CryptFs) Name() string {
+	return "CryptFs"
+}
+
+func (c *CryptFs) Create(name string) (File, error) {
+	return c.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+func (c *CryptFs) Open(name string) (File, error) {
+	return c.OpenFile(name, os.O_RDONLY, 0)
+}
+
+func (c *CryptFs) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	write := flag&(os.O_WRONLY|os.O_RDWR) != 0
+	// a new or truncated file has no content to decrypt yet, all others
+	// must, so an emptied file is detected as tampered
+	fresh := write && flag&os.O_TRUNC != 0
+	if write && !fresh && flag&os.O_CREATE != 0 {
+		_, err := c.source.Stat(name)
+		fresh = os.IsNotExist(err)
+	}
+	bflag := flag &^ os.O_APPEND
+	if write {
+		// the content is needed to write it back encrypted
+		bflag = bflag&^os.O_WRONLY | os.O_RDWR
+	}
+	f, err := c.source.OpenFile(name, bflag, perm)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if fi.IsDir() {
+		return f, nil
+	}
+
+	var plaintext []byte
+	if !fresh {
+		ciphertext, err := ioutil.ReadAll(f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		plaintext, err = c.decrypt(ciphertext)
+		if err != nil {
+			f.Close()
+			return nil, &os.PathError{Op: "open", Path: name, Err: err}
+		}
+	}
+
+	data := mem.CreateFile(name)
+	if _, err := mem.NewFileHandle(data).Write(plaintext); err != nil {
+		f.Close()
+		return nil, err
+	}
+	var buf File
+	switch {
+	case !write:
+		buf = mem.NewReadOnlyFileHandle(data)
+	case flag&os.O_APPEND != 0:
+		buf = mem.NewAppendFileHandle(data)
+	default:
+		buf = mem.NewFileHandle(data)
+	}
+	// a fresh file is written back even if nothing is written to it
+	return &cryptFile{File: buf, fs: c, base: f, data: data, dirty: fresh}, nil
+}
+
+func (c *CryptFs) Mkdir(name string, perm os.FileMode) error {
+	return c.source.Mkdir(name, perm)
+}
+
+func (c *CryptFs) MkdirAll(path string, perm os.FileMode) error {
+	return c.source.MkdirAll(path, perm)
+}
+
+func (c *CryptFs) Remove(name string) error {
+	return c.source.Remove(name)
+}
+
+func (c *CryptFs) RemoveAll(path string) error {
+	return c.source.RemoveAll(path)
+}
+
+func (c *CryptFs) Rename(oldname, newname string) error {
+	return c.source.Rename(oldname, newname)
+}
+
+func (c *CryptFs) Stat(name string) (os.FileInfo, error) {
+	fi, err := c.source.Stat(name)
+	if err != nil || !fi.Mode().IsRegular() {
+		return fi, err
+	}
+	size := fi.Size() - c.overhead()
+	if size < 0 {
+		size = 0
+	}
+	return cryptFileInfo{FileInfo: fi, size: size}, nil
+}
+
+func (c *CryptFs) Chmod(name string, mode os.FileMode) error {
+	return c.source.Chmod(name, mode)
+}
+
+func (c *CryptFs) Chtimes(name string, atime, mtime time.Time) error {
+	return c.source.Chtimes(name, atime, mtime)
+}
+
+type cryptFileInfo struct {
+	os.FileInfo
+	size int64
+}
+
+func (fi cryptFileInfo) Size() int64 {
+	return fi.size
+}
+
+// cryptFile is the decrypted content of a file in memory, written back to
+// base if dirty.
+type cryptFile struct {
+	File  // the *mem.File holding the content
+	fs    *CryptFs
+	base  File
+	data  *mem.FileData
+	dirty bool
+}
+
+func (f *cryptFile) Write(p []byte) (int, error) {
+	n, err := f.File.Write(p)
+	if n > 0 {
+		f.dirty = true
+	}
+	return n, err
+}
+
+func (f *cryptFile) WriteAt(p []byte, off int64) (int, error) {
+	n, err := f.File.WriteAt(p, off)
+	if n > 0 {
+		f.dirty = true
+	}
+	return n, err
+}
+
+func (f *cryptFile) WriteString(s string) (int, error) {
+	return f.Write([]byte(s))
+}
+
+func (f *cryptFile) Truncate(size int64) error {
+	if err := f.File.Truncate(size); err != nil {
+		return err
+	}
+	f.dirty = true
+	return nil
+}
+
+// flush encrypts the content and replaces the base file with it.
+func (f *cryptFile) flush() error {
+	if !f.dirty {
+		return nil
+	}
+	plaintext, err := ioutil.ReadAll(mem.NewReadOnlyFileHandle(f.data))
+	if err != nil {
+		return err
+	}
+	ciphertext, err := f.fs.encrypt(plaintext)
+	if err != nil {
+		return err
+	}
+	if err := f.base.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := f.base.WriteAt(ciphertext, 0); err != nil {
+		return err
+	}
+	f.dirty = false
+	return nil
+}
+
+func (f *cryptFile) Sync() error {
+	if err := f.flush(); err != nil {
+		return err
+	}
+	return f.base.Sync()
+}
+
+func (f *cryptFile) Close() error {
+	err := f.flush()
+	f.File.Close()
+	if cerr := f.base.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (f *cryptFile) Name() string {
+	return f.base.Name()
+}
+
+func (f *cryptFile) Stat() (os.FileInfo, error) {
+	fi, err := f.base.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return cryptFileInfo{FileInfo: fi, size: mem.GetFileInfo(f.data).Size()}, nil
+}
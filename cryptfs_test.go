@@ -0,0 +1,156 @@
+package afero
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"testing"
+)
+
+var cryptTestKey = []byte("0123456789abcdef0123456789abcdef")
+
+func newTestCryptFs(t *testing.T, base Fs) *CryptFs {
+	t.Helper()
+	fs, err := NewCryptFs(base, cryptTestKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fs
+}
+
+func TestCryptFs(t *testing.T) {
+	defer removeAllTestFiles(t)
+	for _, base := range Fss {
+		fs := newTestCryptFs(t, base)
+		path := testDir(base) + "/secret.conf"
+		content := []byte("password=hunter2")
+
+		if err := WriteFile(fs, path, content, 0600); err != nil {
+			t.Fatal(base.Name(), err)
+		}
+		raw, err := ReadFile(base, path)
+		if err != nil {
+			t.Fatal(base.Name(), err)
+		}
+		if bytes.Contains(raw, content) {
+			t.Errorf("%s: the content is stored in plain text", base.Name())
+		}
+		got, err := ReadFile(fs, path)
+		if err != nil {
+			t.Fatal(base.Name(), err)
+		}
+		if !bytes.Equal(got, content) {
+			t.Errorf("%s: got %q, want %q", base.Name(), got, content)
+		}
+		fi, err := fs.Stat(path)
+		if err != nil {
+			t.Fatal(base.Name(), err)
+		}
+		if fi.Size() != int64(len(content)) {
+			t.Errorf("%s: Stat size %d, want %d", base.Name(), fi.Size(), len(content))
+		}
+
+		// a new nonce on every write
+		WriteFile(fs, path, content, 0600)
+		if raw2, _ := ReadFile(base, path); bytes.Equal(raw, raw2) {
+			t.Errorf("%s: same ciphertext after writing again", base.Name())
+		}
+	}
+}
+
+func TestCryptFsSeek(t *testing.T) {
+	fs := newTestCryptFs(t, NewMemMapFs())
+
+	f, err := fs.Create("/f")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("hello world")
+	f.Seek(6, io.SeekStart)
+	f.WriteString("there")
+	f.WriteAt([]byte("J"), 0)
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err = fs.OpenFile("/f", os.O_RDWR|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("!")
+	f.Seek(1, io.SeekStart)
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(f, buf); err != nil || string(buf) != "ello" {
+		t.Errorf("read after seek: %q, %v", buf, err)
+	}
+	f.Close()
+
+	if got, _ := ReadFile(fs, "/f"); string(got) != "Jello there!" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestCryptFsTampered(t *testing.T) {
+	base := NewMemMapFs()
+	fs := newTestCryptFs(t, base)
+	if err := WriteFile(fs, "/f", []byte("some secret"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := ReadFile(base, "/f")
+
+	for _, tc := range []struct {
+		name string
+		data []byte
+	}{
+		{"flipped bit", func() []byte {
+			b := append([]byte(nil), raw...)
+			b[len(b)/2] ^= 1
+			return b
+		}()},
+		{"flipped nonce", func() []byte {
+			b := append([]byte(nil), raw...)
+			b[0] ^= 1
+			return b
+		}()},
+		{"truncated", raw[:len(raw)-1]},
+		{"appended", append(append([]byte(nil), raw...), 0)},
+		{"short", raw[:4]},
+		{"empty", nil},
+	} {
+		WriteFile(base, "/f", tc.data, 0600)
+		_, err := fs.Open("/f")
+		if err == nil {
+			t.Errorf("%s: no error", tc.name)
+			continue
+		}
+		if perr, ok := err.(*os.PathError); !ok || perr.Err != ErrCryptTampered {
+			t.Errorf("%s: got %v, want %v", tc.name, err, ErrCryptTampered)
+		}
+	}
+
+	// another key
+	WriteFile(base, "/f", raw, 0600)
+	other, _ := NewCryptFs(base, []byte("fedcba9876543210"))
+	if _, err := other.Open("/f"); err == nil {
+		t.Error("opened with another key")
+	}
+}
+
+func TestCryptFsKey(t *testing.T) {
+	if _, err := NewCryptFs(NewMemMapFs(), []byte("short")); err == nil {
+		t.Error("expected an error for an invalid key size")
+	}
+}
+
+func TestCryptFsCreateEmpty(t *testing.T) {
+	fs := newTestCryptFs(t, NewMemMapFs())
+	f, err := fs.OpenFile("/new", os.O_WRONLY|os.O_CREATE, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	got, err := ReadFile(fs, "/new")
+	if err != nil || len(got) != 0 {
+		t.Errorf("new empty file: %q, %v", got, err)
+	}
+}
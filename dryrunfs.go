@@ -0,0 +1,159 @@
+package afero
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/spf13/afero/mem"
+)
+
+// The DryRunFs previews the changes code would make to a file system, e.g.
+// for the --dry-run option of a command. Reads are passed to the base Fs,
+// the changes are recorded as planned operations, and printed if an output
+// is set, but not done: they return success without touching the base.
+//
+// The operations use the Op names of SpyFs, with Err always nil. Since
+// nothing is changed, later reads don't see the planned changes: a file
+// created or truncated reads as empty through the returned File only.
+type DryRunFs struct {
+	base Fs
+	mu   sync.Mutex
+	ops  []Op
+	out  io.Writer
+}
+
+func NewDryRunFs(base Fs) *DryRunFs {
+	return &DryRunFs{base: base}
+}
+
+// SetOutput makes d print every planned operation to w, one per line, as it
+// is recorded. Passing nil turns the output off.
+func (d *DryRunFs) SetOutput(w io.Writer) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.out = w
+}
+
+// PlannedOps returns the operations which would have been done, oldest
+// first.
+func (d *DryRunFs) PlannedOps() []Op {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]Op(nil), d.ops...)
+}
+
+func (d *DryRunFs) plan(op, name string, args ...interface{}) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	o := Op{Op: op, Name: name, Args: args}
+	d.ops = append(d.ops, o)
+	if d.out != nil {
+		fmt.Fprintln(d.out, "dry-run:", o)
+	}
+}
+
+func (d *DryRunFs) Name() string {
+	return "DryRunFs"
+}
+
+func (d *DryRunFs) Create(name string) (File, error) {
+	d.plan("create", name)
+	return &dryRunFile{File: mem.NewFileHandle(mem.CreateFile(name)), fs: d}, nil
+}
+
+func (d *DryRunFs) Open(name string) (File, error) {
+	return d.base.Open(name)
+}
+
+// OpenFile opens the file in the base if flag doesn't ask for a change. A
+// File for writing reads from the base, if the file exists and is not
+// truncated, and records its writes.
+func (d *DryRunFs) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) == 0 {
+		return d.base.OpenFile(name, flag, perm)
+	}
+	f, err := d.base.Open(name)
+	switch {
+	case err == nil && flag&os.O_CREATE != 0 && flag&os.O_EXCL != 0:
+		f.Close()
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrExist}
+	case err == nil && flag&os.O_TRUNC != 0:
+		f.Close()
+		f = mem.NewFileHandle(mem.CreateFile(name))
+	case os.IsNotExist(err) && flag&os.O_CREATE != 0:
+		f = mem.NewFileHandle(mem.CreateFile(name))
+	case err != nil:
+		return nil, err
+	}
+	d.plan("openfile", name, flag, perm)
+	return &dryRunFile{File: f, fs: d}, nil
+}
+
+func (d *DryRunFs) Mkdir(name string, perm os.FileMode) error {
+	d.plan("mkdir", name, perm)
+	return nil
+}
+
+func (d *DryRunFs) MkdirAll(path string, perm os.FileMode) error {
+	d.plan("mkdirall", path, perm)
+	return nil
+}
+
+func (d *DryRunFs) Remove(name string) error {
+	d.plan("remove", name)
+	return nil
+}
+
+func (d *DryRunFs) RemoveAll(path string) error {
+	d.plan("removeall", path)
+	return nil
+}
+
+func (d *DryRunFs) Rename(oldname, newname string) error {
+	d.plan("rename", oldname, newname)
+	return nil
+}
+
+func (d *DryRunFs) Stat(name string) (os.FileInfo, error) {
+	return d.base.Stat(name)
+}
+
+func (d *DryRunFs) Chmod(name string, mode os.FileMode) error {
+	d.plan("chmod", name, mode)
+	return nil
+}
+
+func (d *DryRunFs) Chtimes(name string, atime, mtime time.Time) error {
+	d.plan("chtimes", name, atime, mtime)
+	return nil
+}
+
+// dryRunFile is a file opened for writing by a DryRunFs, File is the file of
+// the base opened for reading, or an empty one.
+type dryRunFile struct {
+	File
+	fs *DryRunFs
+}
+
+func (f *dryRunFile) Write(p []byte) (int, error) {
+	f.fs.plan("write", f.Name(), len(p))
+	return len(p), nil
+}
+
+func (f *dryRunFile) WriteAt(p []byte, off int64) (int, error) {
+	f.fs.plan("writeat", f.Name(), len(p), off)
+	return len(p), nil
+}
+
+func (f *dryRunFile) WriteString(s string) (int, error) {
+	f.fs.plan("writestring", f.Name(), len(s))
+	return len(s), nil
+}
+
+func (f *dryRunFile) Truncate(size int64) error {
+	f.fs.plan("truncate", f.Name(), size)
+	return nil
+}
@@ -0,0 +1,68 @@
+package afero
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestDryRunFs(t *testing.T) {
+	base := NewMemMapFs()
+	base.MkdirAll("/app", 0755)
+	WriteFile(base, "/app/config", []byte("old"), 0644)
+	fs := NewDryRunFs(base)
+	var out bytes.Buffer
+	fs.SetOutput(&out)
+
+	if err := WriteFile(fs, "/app/config", []byte("new"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	f, err := fs.Create("/app/new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("content")
+	f.Close()
+	fs.Mkdir("/app/cache", 0700)
+	fs.Rename("/app/config", "/app/config.bak")
+	fs.Chmod("/app/config.bak", 0600)
+	fs.RemoveAll("/app")
+
+	// reads still see the unchanged base
+	if got, err := ReadFile(fs, "/app/config"); err != nil || string(got) != "old" {
+		t.Errorf("read through the DryRunFs: %q, %v", got, err)
+	}
+	if ok, _ := Exists(base, "/app/new"); ok {
+		t.Error("Create changed the base")
+	}
+
+	var got []string
+	for _, op := range fs.PlannedOps() {
+		got = append(got, op.String())
+	}
+	want := []string{
+		fmt.Sprintf("openfile /app/config %d -rw-------", os.O_WRONLY|os.O_CREATE|os.O_TRUNC),
+		"write /app/config 3",
+		"create /app/new",
+		"writestring /app/new 7",
+		"mkdir /app/cache -rwx------",
+		"rename /app/config /app/config.bak",
+		"chmod /app/config.bak -rw-------",
+		"removeall /app",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("planned operations:\ngot  %q\nwant %q", got, want)
+	}
+	if lines := bytes.Count(out.Bytes(), []byte("dry-run: ")); lines != len(want) {
+		t.Errorf("output has %d operations, want %d:\n%s", lines, len(want), out.String())
+	}
+
+	if _, err := fs.OpenFile("/app/missing", os.O_WRONLY, 0); !os.IsNotExist(err) {
+		t.Errorf("OpenFile of a missing file without O_CREATE: got %v", err)
+	}
+	if _, err := fs.OpenFile("/app/config", os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644); !os.IsExist(err) {
+		t.Errorf("OpenFile with O_EXCL of an existing file: got %v", err)
+	}
+}
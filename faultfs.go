@@ -0,0 +1,266 @@
+package afero
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// The FaultFs passes all calls to the source Fs, unless an error has been
+// injected for them with one of the Fail methods. Then the call returns that
+// error without reaching the source. It is meant for testing error handling.
+//
+// Operations are named like the methods of Fs and File in lower case, as
+// recorded by the SpyFs: "create", "openfile", "rename", "write", "close"...
+// Calls on the files returned by a FaultFs can fail as well, they match with
+// the name of the file.
+type FaultFs struct {
+	source Fs
+	mu     sync.Mutex
+	faults []*fault
+}
+
+type fault struct {
+	match func(op, name string) bool
+	after int // matching calls to pass before failing
+	err   error
+}
+
+func NewFaultFs(source Fs) *FaultFs {
+	return &FaultFs{source: source}
+}
+
+// FailOn makes op on path fail with err. An empty op or path matches any
+// operation or path.
+func (f *FaultFs) FailOn(op, path string, err error) {
+	f.FailAfter(op, path, 0, err)
+}
+
+// FailAfter is like FailOn, but lets the first n matching calls pass, e.g.
+// to simulate a full disk in the middle of writing a file.
+func (f *FaultFs) FailAfter(op, path string, n int, err error) {
+	if path != "" {
+		path = filepath.Clean(path)
+	}
+	f.FailWhen(func(o, name string) bool {
+		return (op == "" || o == op) && (path == "" || filepath.Clean(name) == path)
+	}, n, err)
+}
+
+// FailWhen makes all calls fail with err for which match returns true,
+// after n of them passed. For rename, name is the old name.
+func (f *FaultFs) FailWhen(match func(op, name string) bool, n int, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.faults = append(f.faults, &fault{match: match, after: n, err: err})
+}
+
+// Reset removes all injected errors.
+func (f *FaultFs) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.faults = nil
+}
+
+// fault returns the error injected for op on name, if any.
+func (f *FaultFs) fault(op, name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, ft := range f.faults {
+		if !ft.match(op, name) {
+			continue
+		}
+		if ft.after > 0 {
+			ft.after--
+			continue
+		}
+		return ft.err
+	}
+	return nil
+}
+
+func (f *FaultFs) wrap(file File, err error) (File, error) {
+	if err != nil {
+		return nil, err
+	}
+	return &faultFile{f: file, fs: f}, nil
+}
+
+func (f *FaultFs) Name() string {
+	return "FaultFs"
+}
+
+func (f *FaultFs) Create(name string) (File, error) {
+	if err := f.fault("create", name); err != nil {
+		return nil, err
+	}
+	return f.wrap(f.source.Create(name))
+}
+
+func (f *FaultFs) Open(name string) (File, error) {
+	if err := f.fault("open", name); err != nil {
+		return nil, err
+	}
+	return f.wrap(f.source.Open(name))
+}
+
+func (f *FaultFs) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	if err := f.fault("openfile", name); err != nil {
+		return nil, err
+	}
+	return f.wrap(f.source.OpenFile(name, flag, perm))
+}
+
+func (f *FaultFs) Mkdir(name string, perm os.FileMode) error {
+	if err := f.fault("mkdir", name); err != nil {
+		return err
+	}
+	return f.source.Mkdir(name, perm)
+}
+
+func (f *FaultFs) MkdirAll(path string, perm os.FileMode) error {
+	if err := f.fault("mkdirall", path); err != nil {
+		return err
+	}
+	return f.source.MkdirAll(path, perm)
+}
+
+func (f *FaultFs) Remove(name string) error {
+	if err := f.fault("remove", name); err != nil {
+		return err
+	}
+	return f.source.Remove(name)
+}
+
+func (f *FaultFs) RemoveAll(path string) error {
+	if err := f.fault("removeall", path); err != nil {
+		return err
+	}
+	return f.source.RemoveAll(path)
+}
+
+func (f *FaultFs) Rename(oldname, newname string) error {
+	if err := f.fault("rename", oldname); err != nil {
+		return err
+	}
+	return f.source.Rename(oldname, newname)
+}
+
+func (f *FaultFs) Stat(name string) (os.FileInfo, error) {
+	if err := f.fault("stat", name); err != nil {
+		return nil, err
+	}
+	return f.source.Stat(name)
+}
+
+func (f *FaultFs) Chmod(name string, mode os.FileMode) error {
+	if err := f.fault("chmod", name); err != nil {
+		return err
+	}
+	return f.source.Chmod(name, mode)
+}
+
+func (f *FaultFs) Chtimes(name string, atime, mtime time.Time) error {
+	if err := f.fault("chtimes", name); err != nil {
+		return err
+	}
+	return f.source.Chtimes(name, atime, mtime)
+}
+
+type faultFile struct {
+	f  File
+	fs *FaultFs
+}
+
+func (f *faultFile) fault(op string) error {
+	return f.fs.fault(op, f.f.Name())
+}
+
+func (f *faultFile) Close() error {
+	if err := f.fault("close"); err != nil {
+		return err
+	}
+	return f.f.Close()
+}
+
+func (f *faultFile) Read(p []byte) (int, error) {
+	if err := f.fault("read"); err != nil {
+		return 0, err
+	}
+	return f.f.Read(p)
+}
+
+func (f *faultFile) ReadAt(p []byte, off int64) (int, error) {
+	if err := f.fault("readat"); err != nil {
+		return 0, err
+	}
+	return f.f.ReadAt(p, off)
+}
+
+func (f *faultFile) Seek(offset int64, whence int) (int64, error) {
+	if err := f.fault("seek"); err != nil {
+		return 0, err
+	}
+	return f.f.Seek(offset, whence)
+}
+
+func (f *faultFile) Write(p []byte) (int, error) {
+	if err := f.fault("write"); err != nil {
+		return 0, err
+	}
+	return f.f.Write(p)
+}
+
+func (f *faultFile) WriteAt(p []byte, off int64) (int, error) {
+	if err := f.fault("writeat"); err != nil {
+		return 0, err
+	}
+	return f.f.WriteAt(p, off)
+}
+
+func (f *faultFile) WriteString(s string) (int, error) {
+	if err := f.fault("writestring"); err != nil {
+		return 0, err
+	}
+	return f.f.WriteString(s)
+}
+
+func (f *faultFile) Name() string {
+	return f.f.Name()
+}
+
+func (f *faultFile) Readdir(count int) ([]os.FileInfo, error) {
+	if err := f.fault("readdir"); err != nil {
+		return nil, err
+	}
+	return f.f.Readdir(count)
+}
+
+func (f *faultFile) Readdirnames(n int) ([]string, error) {
+	if err := f.fault("readdirnames"); err != nil {
+		return nil, err
+	}
+	return f.f.Readdirnames(n)
+}
+
+func (f *faultFile) Stat() (os.FileInfo, error) {
+	if err := f.fault("stat"); err != nil {
+		return nil, err
+	}
+	return f.f.Stat()
+}
+
+func (f *faultFile) Sync() error {
+	if err := f.fault("sync"); err != nil {
+		return err
+	}
+	return f.f.Sync()
+}
+
+func (f *faultFile) Truncate(size int64) error {
+	if err := f.fault("truncate"); err != nil {
+		return err
+	}
+	return f.f.Truncate(size)
+}
@@ -0,0 +1,74 @@
+package afero
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestFaultFsFailOn(t *testing.T) {
+	fs := NewFaultFs(&MemMapFs{})
+	errInjected := errors.New("injected")
+	fs.FailOn("rename", "/dir/../a", errInjected)
+
+	if err := WriteFile(fs, "/a", []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Rename("/a", "/b"); err != errInjected {
+		t.Errorf("Expected the injected error, got %v", err)
+	}
+	if _, err := fs.Stat("/a"); err != nil {
+		t.Errorf("Source changed on a failed call: %v", err)
+	}
+
+	fs.Reset()
+	if err := fs.Rename("/a", "/b"); err != nil {
+		t.Errorf("Expected no error after Reset, got %v", err)
+	}
+}
+
+func TestFaultFsFailWhen(t *testing.T) {
+	fs := NewFaultFs(&MemMapFs{})
+	fs.FailWhen(func(op, name string) bool {
+		return op == "openfile" && strings.HasSuffix(name, ".lock")
+	}, 0, os.ErrPermission)
+
+	if err := WriteFile(fs, "/file", nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFile(fs, "/file.lock", nil, 0644); !errors.Is(err, os.ErrPermission) {
+		t.Errorf("Expected a permission error, got %v", err)
+	}
+}
+
+func TestFaultFsFailAfter(t *testing.T) {
+	fs := NewFaultFs(&MemMapFs{})
+	fs.FailAfter("write", "/file", 2, syscall.ENOSPC)
+
+	f, err := fs.Create("/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	for i := 0; i < 2; i++ {
+		if _, err := f.Write([]byte("data")); err != nil {
+			t.Fatalf("write %d: %v", i, err)
+		}
+	}
+	if _, err := f.Write([]byte("data")); err != syscall.ENOSPC {
+		t.Errorf("Expected ENOSPC, got %v", err)
+	}
+	if _, err := f.WriteString("data"); err != nil {
+		t.Errorf("Only write should fail, got %v", err)
+	}
+
+	fi, err := fs.Stat("/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Size() != 12 {
+		t.Errorf("Got size %d, expected 12", fi.Size())
+	}
+}
@@ -0,0 +1,223 @@
+package afero
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+var errGzipUnsupported = errors.New("operation not supported on a gzip file")
+
+// The GzipFs compresses and decompresses files transparently: reading a
+// gzip file of the base Fs returns the decompressed data, writing to it
+// compresses the data. Which files are compressed is decided by their name,
+// NewGzipFs selects the files with a ".gz" extension. All other files, and
+// all other operations, are passed to the base Fs unchanged.
+//
+// Compressed files can't be opened for reading and writing at once, and
+// can't be seeked, Seek only reports the current offset. Appending with
+// os.O_APPEND adds a new gzip member, which is read back as one stream.
+// Stat returns the size of the compressed file.
+type GzipFs struct {
+	source Fs
+	match  func(name string) bool
+}
+
+// NewGzipFs returns a GzipFs compressing the files with a ".gz" extension.
+func NewGzipFs(source Fs) Fs {
+	return NewGzipFsFunc(source, func(name string) bool {
+		return filepath.Ext(name) == ".gz"
+	})
+}
+
+// NewGzipFsFunc returns a GzipFs compressing the files for which match
+// returns true.
+func NewGzipFsFunc(source Fs, match func(name string) bool) Fs {
+	return &GzipFs{source: source, match: match}
+}
+
+func (g *GzipFs) Name() string {
+	return "GzipFs"
+}
+
+func (g *GzipFs) Create(name string) (File, error) {
+	return g.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+func (g *GzipFs) Open(name string) (File, error) {
+	return g.OpenFile(name, os.O_RDONLY, 0)
+}
+
+// OpenFile opens a compressed file either for reading or for writing. As
+// there is nothing to read after truncating it, os.O_RDWR is accepted
+// together with os.O_TRUNC, like Create does. A file which isn't empty can
+// only be written to with os.O_TRUNC or os.O_APPEND, a new stream written
+// over the start of the old one would corrupt it.
+func (g *GzipFs) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	if !g.match(name) {
+		return g.source.OpenFile(name, flag, perm)
+	}
+	write := flag&(os.O_WRONLY|os.O_RDWR) != 0
+	if flag&os.O_RDWR != 0 && flag&os.O_TRUNC == 0 {
+		return nil, &os.PathError{Op: "open", Path: name, Err: errGzipUnsupported}
+	}
+	f, err := g.source.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err == nil && fi.IsDir() {
+		return f, nil
+	}
+	if write && flag&(os.O_TRUNC|os.O_APPEND) == 0 && err == nil && fi.Size() > 0 {
+		f.Close()
+		return nil, &os.PathError{Op: "open", Path: name, Err: errGzipUnsupported}
+	}
+	gf := &gzipFile{f: f}
+	if write {
+		gf.zw = gzip.NewWriter(f)
+	}
+	return gf, nil
+}
+
+func (g *GzipFs) Mkdir(name string, perm os.FileMode) error {
+	return g.source.Mkdir(name, perm)
+}
+
+func (g *GzipFs) MkdirAll(path string, perm os.FileMode) error {
+	return g.source.MkdirAll(path, perm)
+}
+
+func (g *GzipFs) Remove(name string) error {
+	return g.source.Remove(name)
+}
+
+func (g *GzipFs) RemoveAll(path string) error {
+	return g.source.RemoveAll(path)
+}
+
+func (g *GzipFs) Rename(oldname, newname string) error {
+	return g.source.Rename(oldname, newname)
+}
+
+func (g *GzipFs) Stat(name string) (os.FileInfo, error) {
+	return g.source.Stat(name)
+}
+
+func (g *GzipFs) Chmod(name string, mode os.FileMode) error {
+	return g.source.Chmod(name, mode)
+}
+
+func (g *GzipFs) Chtimes(name string, atime, mtime time.Time) error {
+	return g.source.Chtimes(name, atime, mtime)
+}
+
+// gzipFile is a compressed file opened for reading or, with zw set, for
+// writing.
+type gzipFile struct {
+	f   File
+	zr  *gzip.Reader // created on the first read
+	zw  *gzip.Writer
+	off int64 // in the uncompressed data
+	eof bool  // the file is empty
+}
+
+func (f *gzipFile) unsupported(op string) error {
+	return &os.PathError{Op: op, Path: f.f.Name(), Err: errGzipUnsupported}
+}
+
+func (f *gzipFile) Read(p []byte) (int, error) {
+	if f.zw != nil {
+		return 0, f.unsupported("read")
+	}
+	if f.zr == nil && !f.eof {
+		zr, err := gzip.NewReader(f.f)
+		if err == io.EOF {
+			// an empty file, e.g. just created
+			f.eof = true
+		} else if err != nil {
+			return 0, &os.PathError{Op: "read", Path: f.f.Name(), Err: err}
+		}
+		f.zr = zr
+	}
+	if f.eof {
+		return 0, io.EOF
+	}
+	n, err := f.zr.Read(p)
+	f.off += int64(n)
+	return n, err
+}
+
+func (f *gzipFile) ReadAt(p []byte, off int64) (int, error) {
+	return 0, f.unsupported("readat")
+}
+
+func (f *gzipFile) Write(p []byte) (int, error) {
+	if f.zw == nil {
+		return 0, f.unsupported("write")
+	}
+	n, err := f.zw.Write(p)
+	f.off += int64(n)
+	return n, err
+}
+
+func (f *gzipFile) WriteAt(p []byte, off int64) (int, error) {
+	return 0, f.unsupported("writeat")
+}
+
+func (f *gzipFile) WriteString(s string) (int, error) {
+	return f.Write([]byte(s))
+}
+
+// Seek only reports the current offset in the uncompressed data.
+func (f *gzipFile) Seek(offset int64, whence int) (int64, error) {
+	if offset == 0 && whence == io.SeekCurrent {
+		return f.off, nil
+	}
+	return 0, &os.PathError{Op: "seek", Path: f.f.Name(), Err: syscall.ESPIPE}
+}
+
+// Close completes the gzip stream of a file opened for writing.
+func (f *gzipFile) Close() error {
+	var err error
+	if f.zw != nil {
+		err = f.zw.Close()
+	}
+	if cerr := f.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (f *gzipFile) Sync() error {
+	if f.zw != nil {
+		if err := f.zw.Flush(); err != nil {
+			return err
+		}
+	}
+	return f.f.Sync()
+}
+
+func (f *gzipFile) Truncate(size int64) error {
+	return f.unsupported("truncate")
+}
+
+func (f *gzipFile) Name() string {
+	return f.f.Name()
+}
+
+func (f *gzipFile) Readdir(count int) ([]os.FileInfo, error) {
+	return f.f.Readdir(count)
+}
+
+func (f *gzipFile) Readdirnames(n int) ([]string, error) {
+	return f.f.Readdirnames(n)
+}
+
+func (f *gzipFile) Stat() (os.FileInfo, error) {
+	return f.f.Stat()
+}
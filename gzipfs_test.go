@@ -0,0 +1,168 @@
+package afero
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestGzipFs(t *testing.T) {
+	base := NewMemMapFs()
+	fs := NewGzipFs(base)
+
+	content := strings.Repeat("hello gzip\n", 100)
+	if err := WriteFile(fs, "/data.txt.gz", []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// the base holds valid gzip data
+	raw, err := ReadFile(base, "/data.txt.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatal("base file is not gzip:", err)
+	}
+	plain, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(plain) != content {
+		t.Errorf("decompressed base file: got %d bytes, want %d", len(plain), len(content))
+	}
+	if len(raw) >= len(content) {
+		t.Errorf("base file not compressed: %d bytes", len(raw))
+	}
+
+	got, err := ReadFile(fs, "/data.txt.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != content {
+		t.Errorf("read through GzipFs: got %d bytes, want %d", len(got), len(content))
+	}
+
+	// other files are not touched
+	if err := WriteFile(fs, "/plain.txt", []byte("plain"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if raw, _ := ReadFile(base, "/plain.txt"); string(raw) != "plain" {
+		t.Errorf("plain file: got %q", raw)
+	}
+}
+
+func TestGzipFsAppend(t *testing.T) {
+	fs := NewGzipFs(NewMemMapFs())
+
+	for _, s := range []string{"one ", "two ", "three"} {
+		f, err := fs.OpenFile("/log.gz", os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.WriteString(s); err != nil {
+			t.Fatal(err)
+		}
+		if err := f.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err := ReadFile(fs, "/log.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "one two three" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestGzipFsFunc(t *testing.T) {
+	base := NewMemMapFs()
+	fs := NewGzipFsFunc(base, func(name string) bool {
+		return strings.HasPrefix(name, "/archive/")
+	})
+	fs.MkdirAll("/archive", 0755)
+
+	if err := WriteFile(fs, "/archive/a.txt", []byte("archived"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if raw, _ := ReadFile(base, "/archive/a.txt"); string(raw) == "archived" {
+		t.Error("file in /archive not compressed")
+	}
+	if got, _ := ReadFile(fs, "/archive/a.txt"); string(got) != "archived" {
+		t.Errorf("got %q", got)
+	}
+	// the directory itself is opened as is
+	if names, err := ReadDirNames(fs, "/archive"); err != nil || len(names) != 1 {
+		t.Errorf("ReadDirNames: %v, %v", names, err)
+	}
+}
+
+func TestGzipFsUnsupported(t *testing.T) {
+	fs := NewGzipFs(NewMemMapFs())
+
+	f, err := fs.Create("/x.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("abc")
+	if pos, err := f.Seek(0, io.SeekCurrent); err != nil || pos != 3 {
+		t.Errorf("Seek(0, SeekCurrent): %d, %v", pos, err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err == nil {
+		t.Error("Seek(0, SeekStart): expected an error")
+	}
+	if _, err := f.Read(make([]byte, 1)); err == nil {
+		t.Error("Read on a file opened for writing: expected an error")
+	}
+	if _, err := f.WriteAt([]byte("x"), 0); err == nil {
+		t.Error("WriteAt: expected an error")
+	}
+	f.Close()
+
+	if _, err := fs.OpenFile("/x.gz", os.O_RDWR, 0); err == nil {
+		t.Error("OpenFile(O_RDWR): expected an error")
+	}
+	if _, err := fs.OpenFile("/x.gz", os.O_WRONLY, 0); err == nil {
+		t.Error("OpenFile(O_WRONLY) on a compressed file: expected an error")
+	}
+	if got, err := ReadFile(fs, "/x.gz"); err != nil || string(got) != "abc" {
+		t.Errorf("after a rejected OpenFile: %q, %v", got, err)
+	}
+	f, err = fs.OpenFile("/new.gz", os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		t.Fatalf("OpenFile(O_WRONLY|O_CREATE) of a new file: %v", err)
+	}
+	f.Close()
+	f, err = fs.Open("/x.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.Write([]byte("x")); err == nil {
+		t.Error("Write on a file opened for reading: expected an error")
+	}
+	if _, err := f.ReadAt(make([]byte, 1), 0); err == nil {
+		t.Error("ReadAt: expected an error")
+	}
+}
+
+func TestGzipFsEmpty(t *testing.T) {
+	base := NewMemMapFs()
+	fs := NewGzipFs(base)
+	base.Create("/empty.gz")
+
+	got, err := ReadFile(fs, "/empty.gz")
+	if err != nil || len(got) != 0 {
+		t.Errorf("empty file: %q, %v", got, err)
+	}
+
+	WriteFile(base, "/broken.gz", []byte("not gzip"), 0644)
+	if _, err := ReadFile(fs, "/broken.gz"); err == nil {
+		t.Error("reading a file which is not gzip: expected an error")
+	}
+}
@@ -0,0 +1,99 @@
+package afero
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestHttpFsSeek(t *testing.T) {
+	defer removeAllTestFiles(t)
+	content := bytes.Repeat([]byte("0123456789"), 100)
+
+	for _, fs := range Fss {
+		dir := testDir(fs)
+		if err := WriteFile(fs, filepath.Join(dir, "video.bin"), content, 0644); err != nil {
+			t.Fatal(err)
+		}
+		f, err := NewHttpFs(fs).Open(filepath.Join(dir, "video.bin"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if size, err := f.Seek(0, io.SeekEnd); err != nil || size != 1000 {
+			t.Errorf("%s: seek to end: got %d, %v", fs.Name(), size, err)
+		}
+		if pos, err := f.Seek(512, io.SeekStart); err != nil || pos != 512 {
+			t.Errorf("%s: seek past the midpoint: got %d, %v", fs.Name(), pos, err)
+		}
+		buf := make([]byte, 8)
+		if _, err := io.ReadFull(f, buf); err != nil {
+			t.Fatalf("%s: %v", fs.Name(), err)
+		}
+		if string(buf) != "23456789" {
+			t.Errorf("%s: got %q", fs.Name(), buf)
+		}
+		if pos, err := f.Seek(-10, io.SeekCurrent); err != nil || pos != 510 {
+			t.Errorf("%s: relative seek: got %d, %v", fs.Name(), pos, err)
+		}
+		if _, err := f.Seek(-1, io.SeekStart); err == nil {
+			t.Errorf("%s: expected an error seeking to a negative offset", fs.Name())
+		}
+
+		// reading past the end is io.EOF, not an error or a panic
+		if _, err := f.Seek(2000, io.SeekStart); err != nil {
+			t.Fatalf("%s: %v", fs.Name(), err)
+		}
+		if n, err := f.Read(buf); n != 0 || err != io.EOF {
+			t.Errorf("%s: read past the end: got %d, %v", fs.Name(), n, err)
+		}
+		f.Close()
+	}
+}
+
+func TestHttpFsRange(t *testing.T) {
+	defer removeAllTestFiles(t)
+	content := bytes.Repeat([]byte("0123456789"), 100)
+
+	for _, fs := range Fss {
+		dir := testDir(fs)
+		if err := WriteFile(fs, filepath.Join(dir, "video.bin"), content, 0644); err != nil {
+			t.Fatal(err)
+		}
+		srv := httptest.NewServer(http.FileServer(NewHttpFs(fs).Dir(dir)))
+
+		req, _ := http.NewRequest("GET", srv.URL+"/video.bin", nil)
+		req.Header.Set("Range", "bytes=600-609,995-")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusPartialContent {
+			t.Errorf("%s: got status %d", fs.Name(), resp.StatusCode)
+		}
+		if !bytes.Contains(body, []byte("0123456789")) || !bytes.Contains(body, []byte("\r\n\r\n56789\r\n")) {
+			t.Errorf("%s: unexpected multipart body %q", fs.Name(), body)
+		}
+
+		req.Header.Set("Range", "bytes=500-503")
+		resp, err = http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ = ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusPartialContent || string(body) != "0123" {
+			t.Errorf("%s: got %d %q", fs.Name(), resp.StatusCode, body)
+		}
+		if cr := resp.Header.Get("Content-Range"); cr != "bytes 500-503/1000" {
+			t.Errorf("%s: got Content-Range %q", fs.Name(), cr)
+		}
+		srv.Close()
+	}
+}
@@ -0,0 +1,282 @@
+package afero
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// IOFS adapts an Fs to the io/fs interfaces of the standard library, so it
+// can be used with e.g. http.FS or template.ParseFS.
+//
+// Names are validated with fs.ValidPath and then passed to the Fs as they
+// are, i.e. they are relative to the working directory of the Fs. Wrap the
+// Fs in a BasePathFs to serve a specific directory.
+type IOFS struct {
+	Fs Fs
+}
+
+func NewIOFS(fs Fs) IOFS {
+	return IOFS{Fs: fs}
+}
+
+var (
+	_ fs.FS        = IOFS{}
+	_ fs.ReadDirFS = IOFS{}
+	_ fs.StatFS    = IOFS{}
+	_ fs.GlobFS    = IOFS{}
+)
+
+func (f IOFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	file, err := f.Fs.Open(name)
+	if err != nil {
+		return nil, ioError("open", name, err)
+	}
+	if _, ok := file.(fs.ReadDirFile); ok {
+		return file, nil
+	}
+	return ioFile{file}, nil
+}
+
+func (f IOFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	entries, err := ReadDirEntries(f.Fs, name)
+	if err != nil {
+		return nil, ioError("readdir", name, err)
+	}
+	return entries, nil
+}
+
+func (f IOFS) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+	fi, err := f.Fs.Stat(name)
+	if err != nil {
+		return nil, ioError("stat", name, err)
+	}
+	return fi, nil
+}
+
+func (f IOFS) Glob(pattern string) ([]string, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+	// hide our own Glob method, fs.Glob would call it again otherwise
+	return fs.Glob(struct{ fs.ReadDirFS }{f}, pattern)
+}
+
+// ioError returns err as *fs.PathError, errors already of this type are
+// returned unchanged.
+func ioError(op, name string, err error) error {
+	if _, ok := err.(*fs.PathError); ok {
+		return err
+	}
+	return &fs.PathError{Op: op, Path: name, Err: err}
+}
+
+// ioFile adds the ReadDir method of fs.ReadDirFile to a File.
+type ioFile struct {
+	File
+}
+
+func (f ioFile) ReadDir(count int) ([]fs.DirEntry, error) {
+	list, err := f.File.Readdir(count)
+	if count <= 0 {
+		sort.Sort(byName(list))
+	}
+	entries := make([]fs.DirEntry, len(list))
+	for i, fi := range list {
+		entries[i] = fs.FileInfoToDirEntry(fi)
+	}
+	return entries, err
+}
+
+// FromIOFS adapts an fs.FS of the standard library, e.g. an embed.FS, to a
+// read only Fs, the inverse of IOFS. Names are made relative to the root of
+// fsys: "/dir/file", "dir/file" and "./dir/file" are the same file. Stat
+// and the listing of directories use fs.StatFS and fs.ReadDirFile where
+// implemented. All changes fail with ErrReadOnly, which matches
+// syscall.EROFS.
+func FromIOFS(fsys fs.FS) Fs {
+	return &fromIOFS{fsys: fsys}
+}
+
+type fromIOFS struct {
+	fsys fs.FS
+}
+
+// ioName returns name as a name of the fs.FS.
+func ioName(op, name string) (string, error) {
+	p := strings.TrimPrefix(path.Clean(filepath.ToSlash(name)), "/")
+	if p == "" {
+		p = "."
+	}
+	if !fs.ValidPath(p) {
+		return "", &os.PathError{Op: op, Path: name, Err: os.ErrInvalid}
+	}
+	return p, nil
+}
+
+func (f *fromIOFS) Name() string {
+	return "FromIOFS"
+}
+
+func (f *fromIOFS) Create(name string) (File, error) {
+	return nil, &os.PathError{Op: "create", Path: name, Err: ErrReadOnly}
+}
+
+func (f *fromIOFS) Open(name string) (File, error) {
+	p, err := ioName("open", name)
+	if err != nil {
+		return nil, err
+	}
+	file, err := f.fsys.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	return &fromIOFile{f: file, name: name}, nil
+}
+
+func (f *fromIOFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) != 0 {
+		return nil, &os.PathError{Op: "open", Path: name, Err: ErrReadOnly}
+	}
+	return f.Open(name)
+}
+
+func (f *fromIOFS) Mkdir(name string, perm os.FileMode) error {
+	return &os.PathError{Op: "mkdir", Path: name, Err: ErrReadOnly}
+}
+
+func (f *fromIOFS) MkdirAll(path string, perm os.FileMode) error {
+	return &os.PathError{Op: "mkdir", Path: path, Err: ErrReadOnly}
+}
+
+func (f *fromIOFS) Remove(name string) error {
+	return &os.PathError{Op: "remove", Path: name, Err: ErrReadOnly}
+}
+
+func (f *fromIOFS) RemoveAll(path string) error {
+	return &os.PathError{Op: "removeall", Path: path, Err: ErrReadOnly}
+}
+
+func (f *fromIOFS) Rename(oldname, newname string) error {
+	return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: ErrReadOnly}
+}
+
+func (f *fromIOFS) Stat(name string) (os.FileInfo, error) {
+	p, err := ioName("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return fs.Stat(f.fsys, p)
+}
+
+func (f *fromIOFS) Chmod(name string, mode os.FileMode) error {
+	return &os.PathError{Op: "chmod", Path: name, Err: ErrReadOnly}
+}
+
+func (f *fromIOFS) Chtimes(name string, atime, mtime time.Time) error {
+	return &os.PathError{Op: "chtimes", Path: name, Err: ErrReadOnly}
+}
+
+// fromIOFile is a File of a fromIOFS. Reading at an offset and seeking
+// need the fs.File to implement io.ReaderAt and io.Seeker, listing a
+// directory fs.ReadDirFile.
+type fromIOFile struct {
+	f    fs.File
+	name string
+}
+
+func (f *fromIOFile) Close() error {
+	return f.f.Close()
+}
+
+func (f *fromIOFile) Read(p []byte) (int, error) {
+	return f.f.Read(p)
+}
+
+func (f *fromIOFile) ReadAt(p []byte, off int64) (int, error) {
+	if r, ok := f.f.(io.ReaderAt); ok {
+		return r.ReadAt(p, off)
+	}
+	return 0, &os.PathError{Op: "readat", Path: f.name, Err: errors.ErrUnsupported}
+}
+
+func (f *fromIOFile) Seek(offset int64, whence int) (int64, error) {
+	if s, ok := f.f.(io.Seeker); ok {
+		return s.Seek(offset, whence)
+	}
+	return 0, &os.PathError{Op: "seek", Path: f.name, Err: errors.ErrUnsupported}
+}
+
+func (f *fromIOFile) Write(p []byte) (int, error) {
+	return 0, &os.PathError{Op: "write", Path: f.name, Err: ErrReadOnly}
+}
+
+func (f *fromIOFile) WriteAt(p []byte, off int64) (int, error) {
+	return 0, &os.PathError{Op: "writeat", Path: f.name, Err: ErrReadOnly}
+}
+
+func (f *fromIOFile) WriteString(s string) (int, error) {
+	return 0, &os.PathError{Op: "write", Path: f.name, Err: ErrReadOnly}
+}
+
+func (f *fromIOFile) Truncate(size int64) error {
+	return &os.PathError{Op: "truncate", Path: f.name, Err: ErrReadOnly}
+}
+
+func (f *fromIOFile) Name() string {
+	return f.name
+}
+
+func (f *fromIOFile) Readdir(count int) ([]os.FileInfo, error) {
+	d, ok := f.f.(fs.ReadDirFile)
+	if !ok {
+		return nil, &os.PathError{Op: "readdir", Path: f.name, Err: syscall.ENOTDIR}
+	}
+	entries, err := d.ReadDir(count)
+	list := make([]os.FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		fi, ierr := entry.Info()
+		if ierr != nil {
+			return list, ierr
+		}
+		list = append(list, fi)
+	}
+	return list, err
+}
+
+func (f *fromIOFile) Readdirnames(n int) ([]string, error) {
+	d, ok := f.f.(fs.ReadDirFile)
+	if !ok {
+		return nil, &os.PathError{Op: "readdir", Path: f.name, Err: syscall.ENOTDIR}
+	}
+	entries, err := d.ReadDir(n)
+	names := make([]string, len(entries))
+	for i, entry := range entries {
+		names[i] = entry.Name()
+	}
+	return names, err
+}
+
+func (f *fromIOFile) Stat() (os.FileInfo, error) {
+	return f.f.Stat()
+}
+
+func (f *fromIOFile) Sync() error {
+	return nil
+}
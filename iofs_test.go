@@ -0,0 +1,124 @@
+package afero
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"testing"
+	"testing/fstest"
+)
+
+func setupIOFSFiles(t *testing.T, afs Fs, root string) {
+	for _, name := range []string{"a.txt", "dir/b.txt", "dir/sub/c.txt"} {
+		if err := afs.MkdirAll(filepath.Dir(filepath.Join(root, name)), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := WriteFile(afs, filepath.Join(root, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestIOFS(t *testing.T) {
+	tmp, err := TempDir(NewOsFs(), "", "afero-iofs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	setupIOFSFiles(t, NewOsFs(), tmp)
+
+	iofs := NewIOFS(NewBasePathFs(NewOsFs(), tmp))
+	if err := fstest.TestFS(iofs, "a.txt", "dir/b.txt", "dir/sub/c.txt"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestIOFSMemMapFs(t *testing.T) {
+	mfs := &MemMapFs{}
+	setupIOFSFiles(t, mfs, "/")
+	iofs := NewIOFS(NewBasePathFs(mfs, "/"))
+
+	data, err := fs.ReadFile(iofs, "dir/sub/c.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "dir/sub/c.txt" {
+		t.Errorf("got %q", data)
+	}
+
+	entries, err := fs.ReadDir(iofs, "dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Name() != "b.txt" || !entries[1].IsDir() {
+		t.Errorf("unexpected entries: %v", entries)
+	}
+
+	matches, err := fs.Glob(iofs, "dir/*/*.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 1 || matches[0] != "dir/sub/c.txt" {
+		t.Errorf("Glob: got %v", matches)
+	}
+
+	_, err = iofs.Open("nonexisting")
+	if _, ok := err.(*fs.PathError); !ok || !os.IsNotExist(err) {
+		t.Errorf("Open non-existing file: got %#v", err)
+	}
+	if _, err = iofs.Open("../a.txt"); err == nil {
+		t.Error("Open of invalid path succeeded")
+	}
+}
+
+func TestFromIOFS(t *testing.T) {
+	mapfs := fstest.MapFS{
+		"a.txt":         {Data: []byte("a")},
+		"dir/b.txt":     {Data: []byte("bb")},
+		"dir/sub/c.txt": {Data: []byte("ccc")},
+	}
+	// with and without the optional interfaces of fstest.MapFS
+	for _, fsys := range []fs.FS{mapfs, struct{ fs.FS }{mapfs}} {
+		afs := FromIOFS(fsys)
+
+		for _, name := range []string{"/dir/b.txt", "dir/b.txt", "./dir/sub/../b.txt"} {
+			if data, err := ReadFile(afs, name); err != nil || string(data) != "bb" {
+				t.Errorf("ReadFile(%q) = %q, %v", name, data, err)
+			}
+		}
+		if fi, err := afs.Stat("/dir/sub/c.txt"); err != nil || fi.Size() != 3 {
+			t.Errorf("Stat: %v, %v", fi, err)
+		}
+		if _, err := afs.Stat("/missing"); !os.IsNotExist(err) {
+			t.Errorf("Stat of a missing file: %v", err)
+		}
+
+		var walked []string
+		Walk(afs, "/", func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			walked = append(walked, filepath.ToSlash(path))
+			return nil
+		})
+		want := []string{"/", "/a.txt", "/dir", "/dir/b.txt", "/dir/sub", "/dir/sub/c.txt"}
+		if !reflect.DeepEqual(walked, want) {
+			t.Errorf("Walk: got %q, want %q", walked, want)
+		}
+
+		if err := WriteFile(afs, "/new", []byte("x"), 0644); !errors.Is(err, syscall.EROFS) {
+			t.Errorf("WriteFile: got %v, want EROFS", err)
+		}
+		if err := afs.Remove("/a.txt"); !errors.Is(err, syscall.EROFS) {
+			t.Errorf("Remove: got %v, want EROFS", err)
+		}
+		f, _ := afs.Open("/a.txt")
+		if _, err := f.Write([]byte("x")); !errors.Is(err, syscall.EROFS) {
+			t.Errorf("Write: got %v, want EROFS", err)
+		}
+		f.Close()
+	}
+}
@@ -17,12 +17,18 @@ package afero
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"io"
+	iofs "io/fs"
+	"math"
 	"os"
 	"path/filepath"
 	"sort"
 	"strconv"
+	"strings"
 	"sync"
+	"syscall"
 	"time"
 )
 
@@ -53,6 +59,138 @@ func ReadDir(fs Fs, dirname string) ([]os.FileInfo, error) {
 	return list, nil
 }
 
+func (a Afero) ReadDirBatched(dirname string, batchSize int, fn func([]os.FileInfo) error) error {
+	return ReadDirBatched(a.Fs, dirname, batchSize, fn)
+}
+
+// ReadDirBatched reads the directory named by dirname in batches of at most
+// batchSize entries, calling fn for each, so a large directory is never
+// held in memory at once. The entries are in directory order, not sorted.
+// It stops at the first error of fn or of reading the directory, and
+// returns it. Entries read along with an error are passed to fn first.
+func ReadDirBatched(fs Fs, dirname string, batchSize int, fn func([]os.FileInfo) error) error {
+	if batchSize <= 0 {
+		return &os.PathError{Op: "readdir", Path: dirname, Err: syscall.EINVAL}
+	}
+	f, err := fs.Open(dirname)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	for {
+		list, err := f.Readdir(batchSize)
+		if len(list) > 0 {
+			if ferr := fn(list); ferr != nil {
+				return ferr
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if len(list) == 0 {
+			// a Readdir not reporting the end with io.EOF
+			return nil
+		}
+	}
+}
+
+// ReadDirEntries reads the directory named by dirname and returns a list of
+// directory entries sorted by name. Unlike ReadDir, it doesn't need to Stat
+// every entry if the Fs can list directories without, like OsFs does with
+// os.ReadDir.
+func (a Afero) ReadDirEntries(dirname string) ([]iofs.DirEntry, error) {
+	return ReadDirEntries(a.Fs, dirname)
+}
+
+func ReadDirEntries(fs Fs, dirname string) ([]iofs.DirEntry, error) {
+	return readDirEntries(fs, dirname)
+}
+
+// DirEntryResult is a result of ReadDirChan, either an entry or an error.
+type DirEntryResult struct {
+	Entry iofs.DirEntry
+	Err   error
+}
+
+// readDirChanBatch is the number of entries ReadDirChan reads at once.
+const readDirChanBatch = 256
+
+// ReadDirChan sends the entries of the directory named by dirname on the
+// returned channel as they are read, for directories too large to be read
+// at once. The entries come in directory order, not sorted. An error reading
+// the directory is sent as the last result. The channel is closed, and the
+// directory with it, when all entries are sent or when ctx is done; a caller
+// stopping early must cancel ctx.
+func (a Afero) ReadDirChan(ctx context.Context, dirname string) (<-chan DirEntryResult, error) {
+	return ReadDirChan(ctx, a.Fs, dirname)
+}
+
+func ReadDirChan(ctx context.Context, fs Fs, dirname string) (<-chan DirEntryResult, error) {
+	f, err := fs.Open(dirname)
+	if err != nil {
+		return nil, err
+	}
+	if fi, err := f.Stat(); err != nil {
+		f.Close()
+		return nil, err
+	} else if !fi.IsDir() {
+		f.Close()
+		return nil, &os.PathError{Op: "readdir", Path: dirname, Err: syscall.ENOTDIR}
+	}
+
+	ch := make(chan DirEntryResult)
+	go func() {
+		defer close(ch)
+		defer f.Close()
+		rd, _ := f.(iofs.ReadDirFile)
+		for {
+			var entries []iofs.DirEntry
+			var err error
+			if rd != nil {
+				entries, err = rd.ReadDir(readDirChanBatch)
+			} else {
+				var list []os.FileInfo
+				list, err = f.Readdir(readDirChanBatch)
+				for _, fi := range list {
+					entries = append(entries, iofs.FileInfoToDirEntry(fi))
+				}
+			}
+			for _, entry := range entries {
+				select {
+				case ch <- DirEntryResult{Entry: entry}:
+				case <-ctx.Done():
+					return
+				}
+			}
+			if err == io.EOF || err == nil && len(entries) == 0 {
+				return
+			}
+			if err != nil {
+				select {
+				case ch <- DirEntryResult{Err: err}:
+				case <-ctx.Done():
+				}
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// ReadDirNames reads the directory named by dirname and returns the sorted
+// names of its entries. It uses File.Readdirnames, so it is cheaper than
+// ReadDir when only the names are needed.
+func (a Afero) ReadDirNames(dirname string) ([]string, error) {
+	return ReadDirNames(a.Fs, dirname)
+}
+
+func ReadDirNames(fs Fs, dirname string) ([]string, error) {
+	return readDirNames(fs, dirname)
+}
+
 // ReadFile reads the file named by filename and returns the contents.
 // A successful call returns err == nil, not err == EOF. Because ReadFile
 // reads the whole file, it does not treat an EOF from Read as an error
@@ -85,6 +223,47 @@ func ReadFile(fs Fs, filename string) ([]byte, error) {
 	return readAll(f, n+bytes.MinRead)
 }
 
+// ErrFileTooLarge is returned, wrapped in an *os.PathError, by ReadFileLimit
+// for a file larger than the limit.
+var ErrFileTooLarge = errors.New("file too large")
+
+// ReadFileLimit is like ReadFile, but fails with ErrFileTooLarge instead of
+// reading more than max bytes, e.g. for files from untrusted sources. The
+// size is checked with Stat first, and again while reading, in case the
+// file grows or Stat doesn't report it.
+func (a Afero) ReadFileLimit(filename string, max int64) ([]byte, error) {
+	return ReadFileLimit(a.Fs, filename, max)
+}
+
+func ReadFileLimit(fs Fs, filename string, max int64) ([]byte, error) {
+	f, err := fs.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var n int64
+	if fi, err := f.Stat(); err == nil {
+		if fi.Size() > max {
+			return nil, &os.PathError{Op: "read", Path: filename, Err: ErrFileTooLarge}
+		}
+		n = fi.Size()
+	}
+	// read one byte more than allowed to tell a file of max bytes from a
+	// larger one
+	limit := max
+	if limit < math.MaxInt64 {
+		limit++
+	}
+	data, err := readAll(io.LimitReader(f, limit), n+bytes.MinRead)
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > max {
+		return nil, &os.PathError{Op: "read", Path: filename, Err: ErrFileTooLarge}
+	}
+	return data, nil
+}
+
 // readAll reads from r until an error or EOF and returns the data it read
 // from the internal buffer allocated with a specified capacity.
 func readAll(r io.Reader, capacity int64) (b []byte, err error) {
@@ -136,6 +315,97 @@ func WriteFile(fs Fs, filename string, data []byte, perm os.FileMode) error {
 	return err
 }
 
+// ReadFileString is like ReadFile, but returns the content as a string.
+func (a Afero) ReadFileString(filename string) (string, error) {
+	data, err := a.ReadFile(filename)
+	return string(data), err
+}
+
+// WriteFileString is like WriteFile, but takes the content as a string.
+func (a Afero) WriteFileString(filename, contents string, perm os.FileMode) error {
+	return a.WriteFile(filename, []byte(contents), perm)
+}
+
+// OpenSeekable opens the file named by name for reading and returns a
+// handle which can be seeked, whichever Fs it comes from. A File which
+// supports Seek is returned as it is. Otherwise, e.g. for a GzipFs, the
+// whole file is read into memory and the file closed, so the fallback
+// costs as much memory as the file is large.
+func (a Afero) OpenSeekable(name string) (io.ReadSeekCloser, error) {
+	return OpenSeekable(a.Fs, name)
+}
+
+func OpenSeekable(fs Fs, name string) (io.ReadSeekCloser, error) {
+	f, err := fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err == nil {
+		return f, nil
+	}
+	data, err := ReadAll(f)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+	return bufferedFile{bytes.NewReader(data)}, nil
+}
+
+// bufferedFile is the content of a file read into memory by OpenSeekable.
+type bufferedFile struct {
+	*bytes.Reader
+}
+
+func (bufferedFile) Close() error {
+	return nil
+}
+
+// WriteFileAtomic writes data to a file named by filename, so that readers
+// see either the old or the new content of the file, never a partial write.
+// The data is written to a temporary file in the same directory, synced,
+// and then renamed to filename. On any error the temporary file is removed
+// and filename is left untouched. The file is created with permissions
+// perm, also if it existed before.
+//
+// The guarantee depends on the Fs: Rename must atomically replace an
+// existing file, which holds for OsFs on POSIX systems and for MemMapFs,
+// and Sync must make the data durable, which only OsFs does.
+func (a Afero) WriteFileAtomic(filename string, data []byte, perm os.FileMode) error {
+	return WriteFileAtomic(a.Fs, filename, data, perm)
+}
+
+func WriteFileAtomic(fs Fs, filename string, data []byte, perm os.FileMode) error {
+	dir, base := filepath.Split(filename)
+	if dir == "" {
+		dir = "." // TempFile would use os.TempDir()
+	}
+	f, err := TempFile(fs, dir, "."+base+".tmp*")
+	if err != nil {
+		return err
+	}
+	tmpname := filepath.Join(dir, filepath.Base(f.Name()))
+	n, err := f.Write(data)
+	if err == nil && n < len(data) {
+		err = io.ErrShortWrite
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if err1 := f.Close(); err == nil {
+		err = err1
+	}
+	if err == nil {
+		err = fs.Chmod(tmpname, perm)
+	}
+	if err == nil {
+		err = fs.Rename(tmpname, filename)
+	}
+	if err != nil {
+		fs.Remove(tmpname)
+	}
+	return err
+}
+
 // Random number state.
 // We generate random temporary file names so that there's a good
 // chance the file doesn't exist yet - keeps the number of tries in
@@ -159,72 +429,110 @@ func nextSuffix() string {
 	return strconv.Itoa(int(1e9 + r%1e9))[1:]
 }
 
-// TempFile creates a new temporary file in the directory dir
-// with a name beginning with prefix, opens the file for reading
-// and writing, and returns the resulting *File.
-// If dir is the empty string, TempFile uses the default directory
-// for temporary files (see os.TempDir).
+// errPatternHasSeparator is returned by TempFile and TempDir for a pattern
+// containing a path separator.
+var errPatternHasSeparator = errors.New("pattern contains path separator")
+
+// prefixAndSuffix splits pattern by the last wildcard "*", if applicable,
+// returning prefix as the part before "*" and suffix as the part after "*".
+// adapted from https://golang.org/src/os/tempfile.go
+func prefixAndSuffix(pattern string) (prefix, suffix string, err error) {
+	for i := 0; i < len(pattern); i++ {
+		if os.IsPathSeparator(pattern[i]) {
+			return "", "", errPatternHasSeparator
+		}
+	}
+	if pos := strings.LastIndexByte(pattern, '*'); pos != -1 {
+		prefix, suffix = pattern[:pos], pattern[pos+1:]
+	} else {
+		prefix = pattern
+	}
+	return prefix, suffix, nil
+}
+
+// nextTempName returns a new random name for TempFile and TempDir. After
+// too many conflicts, the random number generator is reseeded.
+func nextTempName(dir, prefix, suffix string, nconflict int) string {
+	if nconflict > 10 {
+		randmu.Lock()
+		rand = reseed()
+		randmu.Unlock()
+	}
+	return filepath.Join(dir, prefix+nextSuffix()+suffix)
+}
+
+// TempFile creates a new temporary file in the directory dir, opens the
+// file for reading and writing, and returns the resulting File, like
+// os.CreateTemp does on the real filesystem.
+// The filename is generated by taking pattern and adding a random string
+// to the end. If pattern includes a "*", the random string replaces the
+// last "*". If dir is the empty string, TempFile uses the default
+// directory for temporary files (see os.TempDir).
 // Multiple programs calling TempFile simultaneously
 // will not choose the same file.  The caller can use f.Name()
 // to find the pathname of the file.  It is the caller's responsibility
 // to remove the file when no longer needed.
-func (a Afero) TempFile(dir, prefix string) (f File, err error) {
-	return TempFile(a.Fs, dir, prefix)
+func (a Afero) TempFile(dir, pattern string) (f File, err error) {
+	return TempFile(a.Fs, dir, pattern)
 }
 
-func TempFile(fs Fs, dir, prefix string) (f File, err error) {
+func TempFile(fs Fs, dir, pattern string) (f File, err error) {
 	if dir == "" {
 		dir = os.TempDir()
 	}
+	prefix, suffix, err := prefixAndSuffix(pattern)
+	if err != nil {
+		return nil, &os.PathError{Op: "createtemp", Path: pattern, Err: err}
+	}
 
-	nconflict := 0
-	for i := 0; i < 10000; i++ {
-		name := filepath.Join(dir, prefix+nextSuffix())
+	try := 0
+	for {
+		name := nextTempName(dir, prefix, suffix, try)
 		f, err = fs.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
 		if os.IsExist(err) {
-			if nconflict++; nconflict > 10 {
-				randmu.Lock()
-				rand = reseed()
-				randmu.Unlock()
+			if try++; try < 10000 {
+				continue
 			}
-			continue
+			return nil, &os.PathError{Op: "createtemp", Path: filepath.Join(dir, prefix+"*"+suffix), Err: os.ErrExist}
 		}
-		break
+		return f, err
 	}
-	return
 }
 
-// TempDir creates a new temporary directory in the directory dir
-// with a name beginning with prefix and returns the path of the
-// new directory.  If dir is the empty string, TempDir uses the
+// TempDir creates a new temporary directory in the directory dir and
+// returns the path of the new directory, like os.MkdirTemp does on the
+// real filesystem. The directory name is generated from pattern as
+// described for TempFile. If dir is the empty string, TempDir uses the
 // default directory for temporary files (see os.TempDir).
 // Multiple programs calling TempDir simultaneously
 // will not choose the same directory.  It is the caller's responsibility
 // to remove the directory when no longer needed.
-func (a Afero) TempDir(dir, prefix string) (name string, err error) {
-	return TempDir(a.Fs, dir, prefix)
+func (a Afero) TempDir(dir, pattern string) (name string, err error) {
+	return TempDir(a.Fs, dir, pattern)
 }
-func TempDir(fs Fs, dir, prefix string) (name string, err error) {
+
+func TempDir(fs Fs, dir, pattern string) (name string, err error) {
 	if dir == "" {
 		dir = os.TempDir()
 	}
+	prefix, suffix, err := prefixAndSuffix(pattern)
+	if err != nil {
+		return "", &os.PathError{Op: "mkdirtemp", Path: pattern, Err: err}
+	}
 
-	nconflict := 0
-	for i := 0; i < 10000; i++ {
-		try := filepath.Join(dir, prefix+nextSuffix())
-		err = fs.Mkdir(try, 0700)
+	try := 0
+	for {
+		name := nextTempName(dir, prefix, suffix, try)
+		err = fs.Mkdir(name, 0700)
+		if err == nil {
+			return name, nil
+		}
 		if os.IsExist(err) {
-			if nconflict++; nconflict > 10 {
-				randmu.Lock()
-				rand = reseed()
-				randmu.Unlock()
+			if try++; try < 10000 {
+				continue
 			}
-			continue
-		}
-		if err == nil {
-			name = try
+			return "", &os.PathError{Op: "mkdirtemp", Path: filepath.Join(dir, prefix+"*"+suffix), Err: os.ErrExist}
 		}
-		break
+		return "", err
 	}
-	return
 }
@@ -15,7 +15,19 @@
 
 package afero
 
-import "testing"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero/mem"
+)
 
 func checkSizePath(t *testing.T, path string, size int64) {
 	dir, err := testFS.Stat(path)
@@ -77,6 +89,101 @@ func TestWriteFile(t *testing.T) {
 	testFS.Remove(filename) // ignore error
 }
 
+func TestReadWriteFileString(t *testing.T) {
+	fsutil := &Afero{Fs: &MemMapFs{}}
+	data := "name: afero\n"
+
+	if err := fsutil.WriteFileString("/config.yaml", data, 0644); err != nil {
+		t.Fatalf("WriteFileString: %v", err)
+	}
+	contents, err := fsutil.ReadFileString("/config.yaml")
+	if err != nil {
+		t.Fatalf("ReadFileString: %v", err)
+	}
+	if contents != data {
+		t.Fatalf("contents = %q\nexpected = %q", contents, data)
+	}
+
+	if _, err := fsutil.ReadFileString("/missing"); !os.IsNotExist(err) {
+		t.Errorf("ReadFileString of a missing file: got %v", err)
+	}
+}
+
+func TestOpenSeekable(t *testing.T) {
+	mfs := NewMemMapFs()
+	for _, fs := range []Fs{mfs, NewGzipFs(mfs)} {
+		name := "/file"
+		if _, ok := fs.(*GzipFs); ok {
+			name = "/file.gz"
+		}
+		if err := WriteFile(fs, name, []byte("hello, seekable"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		r, err := OpenSeekable(fs, name)
+		if err != nil {
+			t.Fatalf("%s: %v", fs.Name(), err)
+		}
+		if _, err := r.Seek(7, io.SeekStart); err != nil {
+			t.Fatalf("%s: Seek: %v", fs.Name(), err)
+		}
+		got, err := ReadAll(r)
+		if err != nil || string(got) != "seekable" {
+			t.Errorf("%s: read after Seek: %q, %v", fs.Name(), got, err)
+		}
+		if err := r.Close(); err != nil {
+			t.Errorf("%s: Close: %v", fs.Name(), err)
+		}
+		if _, ok := r.(File); ok != (fs == mfs) {
+			t.Errorf("%s: got a %T", fs.Name(), r)
+		}
+	}
+
+	if _, err := OpenSeekable(mfs, "/missing"); !os.IsNotExist(err) {
+		t.Errorf("OpenSeekable of a missing file: got %v", err)
+	}
+}
+
+func TestReadFileLimit(t *testing.T) {
+	fs := NewMemMapFs()
+	WriteFile(fs, "/small", []byte("12345"), 0644)
+
+	if got, err := ReadFileLimit(fs, "/small", 5); err != nil || string(got) != "12345" {
+		t.Errorf("file of the limit: %q, %v", got, err)
+	}
+	if _, err := ReadFileLimit(fs, "/small", 4); !errors.Is(err, ErrFileTooLarge) {
+		t.Errorf("file over the limit: got %v, want %v", err, ErrFileTooLarge)
+	}
+	if _, err := ReadFileLimit(fs, "/missing", 4); !os.IsNotExist(err) {
+		t.Errorf("missing file: got %v", err)
+	}
+
+	// a file larger than its Stat says is caught while reading
+	if _, err := ReadFileLimit(sizeLyingFs{fs}, "/small", 4); !errors.Is(err, ErrFileTooLarge) {
+		t.Errorf("file growing beyond the limit: got %v, want %v", err, ErrFileTooLarge)
+	}
+}
+
+// sizeLyingFs reports all its files as empty.
+type sizeLyingFs struct {
+	Fs
+}
+
+func (fs sizeLyingFs) Open(name string) (File, error) {
+	f, err := fs.Fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return sizeLyingFile{f}, nil
+}
+
+type sizeLyingFile struct {
+	File
+}
+
+func (f sizeLyingFile) Stat() (os.FileInfo, error) {
+	return &mem.FileInfo{FileData: mem.CreateFile(f.Name())}, nil
+}
+
 func TestReadDir(t *testing.T) {
 	testFS = &MemMapFs{}
 	testFS.Mkdir("/i-am-a-dir", 0777)
@@ -110,3 +217,301 @@ func TestReadDir(t *testing.T) {
 		t.Fatalf("ReadDir %s: i-am-a-dir directory not found", dirname)
 	}
 }
+
+func TestWriteFileAtomic(t *testing.T) {
+	defer removeAllTestFiles(t)
+	for _, fs := range Fss {
+		dir := testDir(fs)
+		filename := filepath.Join(dir, "config.json")
+		fsutil := &Afero{Fs: fs}
+
+		for _, data := range []string{"first", "second version"} {
+			if err := fsutil.WriteFileAtomic(filename, []byte(data), 0640); err != nil {
+				t.Fatalf("%s: WriteFileAtomic: %s", fs.Name(), err)
+			}
+			contents, err := fsutil.ReadFile(filename)
+			if err != nil {
+				t.Fatalf("%s: ReadFile: %s", fs.Name(), err)
+			}
+			if string(contents) != data {
+				t.Errorf("%s: contents = %q, want %q", fs.Name(), contents, data)
+			}
+		}
+
+		fi, err := fs.Stat(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.Mode().Perm() != 0640 {
+			t.Errorf("%s: mode = %v, want %v", fs.Name(), fi.Mode().Perm(), os.FileMode(0640))
+		}
+		names, err := readDirNames(fs, dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(names) != 1 {
+			t.Errorf("%s: temporary files left behind: %v", fs.Name(), names)
+		}
+	}
+}
+
+func TestWriteFileAtomicFailure(t *testing.T) {
+	base := &MemMapFs{}
+	WriteFile(base, "/config", []byte("old"), 0644)
+	fs := NewReadOnlyFs(base)
+
+	if err := WriteFileAtomic(fs, "/config", []byte("new"), 0644); err == nil {
+		t.Fatal("WriteFileAtomic on a read only Fs succeeded")
+	}
+	if data, _ := ReadFile(base, "/config"); string(data) != "old" {
+		t.Errorf("file changed after failed WriteFileAtomic: %q", data)
+	}
+}
+
+func TestReadDirEntries(t *testing.T) {
+	defer removeAllTestFiles(t)
+	for _, fs := range Fss {
+		dir := testDir(fs)
+		fs.Mkdir(filepath.Join(dir, "sub"), 0755)
+		WriteFile(fs, filepath.Join(dir, "b.txt"), []byte("b"), 0644)
+		WriteFile(fs, filepath.Join(dir, "a.txt"), []byte("a"), 0644)
+
+		entries, err := ReadDirEntries(fs, dir)
+		if err != nil {
+			t.Fatalf("%s: %v", fs.Name(), err)
+		}
+		list, err := ReadDir(fs, dir)
+		if err != nil {
+			t.Fatalf("%s: %v", fs.Name(), err)
+		}
+		if len(entries) != 3 || len(list) != 3 {
+			t.Fatalf("%s: got %d entries and %d FileInfos", fs.Name(), len(entries), len(list))
+		}
+		for i, e := range entries {
+			if e.Name() != list[i].Name() || e.IsDir() != list[i].IsDir() || e.Type() != list[i].Mode().Type() {
+				t.Errorf("%s: entry %d: got %s %v, want %s %v", fs.Name(), i, e.Name(), e.Type(), list[i].Name(), list[i].Mode().Type())
+			}
+			if fi, err := e.Info(); err != nil || fi.Size() != list[i].Size() {
+				t.Errorf("%s: %s: Info returned %v, %v", fs.Name(), e.Name(), fi, err)
+			}
+		}
+	}
+}
+
+func TestReadDirNames(t *testing.T) {
+	defer removeAllTestFiles(t)
+	for _, fs := range Fss {
+		dir := testDir(fs)
+		fs.Mkdir(filepath.Join(dir, "sub"), 0755)
+		WriteFile(fs, filepath.Join(dir, "b.txt"), []byte("b"), 0644)
+		WriteFile(fs, filepath.Join(dir, "a.txt"), []byte("a"), 0644)
+
+		names, err := ReadDirNames(fs, dir)
+		if err != nil {
+			t.Fatalf("%s: %v", fs.Name(), err)
+		}
+		if strings.Join(names, " ") != "a.txt b.txt sub" {
+			t.Errorf("%s: got %v", fs.Name(), names)
+		}
+	}
+
+	faultFs := NewFaultFs(&MemMapFs{})
+	faultFs.Mkdir("/dir", 0755)
+	faultFs.FailOn("readdirnames", "/dir", os.ErrPermission)
+	spyFs := NewSpyFs(faultFs)
+	if _, err := ReadDirNames(spyFs, "/dir"); !os.IsPermission(err) {
+		t.Errorf("Expected a permission error, got %v", err)
+	}
+	if ops := spyFs.Operations(); len(ops) != 3 || ops[2].Op != "close" {
+		t.Errorf("Directory not closed after an error: %v", ops)
+	}
+}
+
+func TestReadDirBatched(t *testing.T) {
+	defer removeAllTestFiles(t)
+	for _, fs := range Fss {
+		dir := testDir(fs)
+		for i := 0; i < 25; i++ {
+			WriteFile(fs, filepath.Join(dir, fmt.Sprintf("file%02d", i)), nil, 0644)
+		}
+
+		var sizes []int
+		seen := make(map[string]bool)
+		err := ReadDirBatched(fs, dir, 10, func(batch []os.FileInfo) error {
+			sizes = append(sizes, len(batch))
+			for _, fi := range batch {
+				seen[fi.Name()] = true
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("%s: %v", fs.Name(), err)
+		}
+		if len(seen) != 25 {
+			t.Errorf("%s: got %d entries, want 25", fs.Name(), len(seen))
+		}
+		for _, n := range sizes {
+			if n > 10 {
+				t.Errorf("%s: batch of %d entries, want at most 10", fs.Name(), n)
+			}
+		}
+
+		// an error of fn stops reading
+		stop := errors.New("stop")
+		calls := 0
+		err = ReadDirBatched(fs, dir, 10, func([]os.FileInfo) error {
+			calls++
+			return stop
+		})
+		if err != stop || calls != 1 {
+			t.Errorf("%s: got %v after %d calls, want %v after 1", fs.Name(), err, calls, stop)
+		}
+	}
+
+	faultFs := NewFaultFs(&MemMapFs{})
+	faultFs.Mkdir("/dir", 0755)
+	for i := 0; i < 5; i++ {
+		WriteFile(faultFs, fmt.Sprintf("/dir/file%d", i), nil, 0644)
+	}
+	faultFs.FailAfter("readdir", "/dir", 1, os.ErrPermission)
+	spyFs := NewSpyFs(faultFs)
+	batches := 0
+	err := ReadDirBatched(spyFs, "/dir", 2, func([]os.FileInfo) error {
+		batches++
+		return nil
+	})
+	if !os.IsPermission(err) || batches != 1 {
+		t.Errorf("Expected a permission error after 1 batch, got %v after %d", err, batches)
+	}
+	if ops := spyFs.Operations(); ops[len(ops)-1].Op != "close" {
+		t.Errorf("Directory not closed after an error: %v", ops)
+	}
+
+	if err := ReadDirBatched(faultFs, "/dir", 0, nil); err == nil {
+		t.Error("Expected an error for a batch size of 0")
+	}
+}
+
+func TestTempFilePattern(t *testing.T) {
+	fs := &MemMapFs{}
+	fs.MkdirAll("/tmp", 0777)
+
+	for _, tt := range []struct {
+		pattern, prefix, suffix string
+	}{
+		{"", "", ""},
+		{"prefix", "prefix", ""},
+		{"foo*.txt", "foo", ".txt"},
+		{"a*b*c", "a*b", "c"},
+	} {
+		f, err := TempFile(fs, "/tmp", tt.pattern)
+		if err != nil {
+			t.Fatalf("%q: %v", tt.pattern, err)
+		}
+		name := filepath.Base(f.Name())
+		f.Close()
+		if !strings.HasPrefix(name, tt.prefix) || !strings.HasSuffix(name, tt.suffix) ||
+			len(name) <= len(tt.prefix)+len(tt.suffix) {
+			t.Errorf("%q: got file name %q", tt.pattern, name)
+		}
+		if fi, err := fs.Stat(filepath.Join("/tmp", name)); err != nil || fi.Mode() != 0600 {
+			t.Errorf("%q: got %v, %v", tt.pattern, fi, err)
+		}
+
+		dir, err := TempDir(fs, "/tmp", tt.pattern)
+		if err != nil {
+			t.Fatalf("%q: %v", tt.pattern, err)
+		}
+		name = filepath.Base(dir)
+		if !strings.HasPrefix(name, tt.prefix) || !strings.HasSuffix(name, tt.suffix) {
+			t.Errorf("%q: got directory name %q", tt.pattern, name)
+		}
+		if fi, err := fs.Stat(dir); err != nil || !fi.IsDir() {
+			t.Errorf("%q: got %v, %v", tt.pattern, fi, err)
+		}
+	}
+
+	if _, err := TempFile(fs, "/tmp", "sub/x*"); err == nil {
+		t.Error("expected an error for a pattern with a path separator")
+	}
+	if _, err := TempDir(fs, "/tmp", "sub/x*"); err == nil {
+		t.Error("expected an error for a pattern with a path separator")
+	}
+}
+
+// closeCountFs counts the files closed.
+type closeCountFs struct {
+	Fs
+	closed chan struct{}
+}
+
+type closeCountFile struct {
+	File
+	fs *closeCountFs
+}
+
+func (f closeCountFile) Close() error {
+	f.fs.closed <- struct{}{}
+	return f.File.Close()
+}
+
+func (c *closeCountFs) Open(name string) (File, error) {
+	f, err := c.Fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return closeCountFile{f, c}, nil
+}
+
+func TestReadDirChan(t *testing.T) {
+	base := NewMemMapFs()
+	base.Mkdir("/dir", 0755)
+	const n = 1000
+	for i := 0; i < n; i++ {
+		WriteFile(base, fmt.Sprintf("/dir/file%04d", i), nil, 0644)
+	}
+	fs := &closeCountFs{Fs: base, closed: make(chan struct{}, 1)}
+
+	ch, err := ReadDirChan(context.Background(), fs, "/dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := make(map[string]bool)
+	for r := range ch {
+		if r.Err != nil {
+			t.Fatal(r.Err)
+		}
+		seen[r.Entry.Name()] = true
+	}
+	if len(seen) != n {
+		t.Errorf("got %d entries, want %d", len(seen), n)
+	}
+	select {
+	case <-fs.closed:
+	default:
+		t.Error("directory not closed after the channel drained")
+	}
+
+	// cancelled after a few entries
+	ctx, cancel := context.WithCancel(context.Background())
+	ch, err = ReadDirChan(ctx, fs, "/dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		<-ch
+	}
+	cancel()
+	select {
+	case <-fs.closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("directory not closed after cancel")
+	}
+	for range ch {
+		// drained until closed
+	}
+
+	if _, err := ReadDirChan(context.Background(), fs, "/dir/file0000"); err == nil {
+		t.Error("ReadDirChan of a file succeeded")
+	}
+}
@@ -0,0 +1,40 @@
+package afero
+
+import (
+	"encoding/json"
+	"os"
+)
+
+func (a Afero) ReadJSON(path string, v interface{}) error {
+	return ReadJSON(a.Fs, path, v)
+}
+
+// ReadJSON decodes the JSON file at path into v, like json.Unmarshal. A
+// decoding error is returned as an *os.PathError with Op "decode", so it
+// names the file.
+func ReadJSON(fs Fs, path string, v interface{}) error {
+	f, err := fs.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := json.NewDecoder(f).Decode(v); err != nil {
+		return &os.PathError{Op: "decode", Path: path, Err: err}
+	}
+	return nil
+}
+
+func (a Afero) WriteJSON(path string, v interface{}, perm os.FileMode) error {
+	return WriteJSON(a.Fs, path, v, perm)
+}
+
+// WriteJSON writes v encoded as indented JSON to the file at path, like
+// WriteFile. If v can't be encoded, an *os.PathError with Op "encode" is
+// returned and the file is not touched.
+func WriteJSON(fs Fs, path string, v interface{}, perm os.FileMode) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return &os.PathError{Op: "encode", Path: path, Err: err}
+	}
+	return WriteFile(fs, path, append(data, '\n'), perm)
+}
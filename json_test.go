@@ -0,0 +1,64 @@
+package afero
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+)
+
+type jsonTestConfig struct {
+	Name  string   `json:"name"`
+	Port  int      `json:"port"`
+	Hosts []string `json:"hosts"`
+}
+
+func TestReadWriteJSON(t *testing.T) {
+	fs := &Afero{Fs: NewMemMapFs()}
+	want := jsonTestConfig{Name: "afero", Port: 8080, Hosts: []string{"a", "b"}}
+
+	if err := fs.WriteJSON("/config.json", want, 0644); err != nil {
+		t.Fatal(err)
+	}
+	var got jsonTestConfig
+	if err := fs.ReadJSON("/config.json", &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	if err := fs.ReadJSON("/missing.json", &got); !os.IsNotExist(err) {
+		t.Errorf("missing file: got %v", err)
+	}
+}
+
+func TestReadJSONDecodeError(t *testing.T) {
+	fs := NewMemMapFs()
+	WriteFile(fs, "/bad.json", []byte(`{"port": "not a number"}`), 0644)
+
+	var cfg jsonTestConfig
+	err := ReadJSON(fs, "/bad.json", &cfg)
+	perr, ok := err.(*os.PathError)
+	if !ok || perr.Op != "decode" || perr.Path != "/bad.json" {
+		t.Fatalf("got %#v, want a decode *os.PathError for /bad.json", err)
+	}
+	var typeErr *json.UnmarshalTypeError
+	if !errors.As(err, &typeErr) {
+		t.Errorf("the json error is not wrapped: %v", err)
+	}
+}
+
+func TestWriteJSONEncodeError(t *testing.T) {
+	fs := NewMemMapFs()
+	WriteFile(fs, "/config.json", []byte("{}"), 0644)
+
+	err := WriteJSON(fs, "/config.json", map[string]interface{}{"f": func() {}}, 0644)
+	if perr, ok := err.(*os.PathError); !ok || perr.Op != "encode" {
+		t.Fatalf("got %v, want an encode *os.PathError", err)
+	}
+	if data, _ := ReadFile(fs, "/config.json"); string(data) != "{}" {
+		t.Errorf("file changed after a failed encode: %q", data)
+	}
+}
@@ -0,0 +1,51 @@
+package afero
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestGlob(t *testing.T) {
+	defer removeAllTestFiles(t)
+	for _, fs := range Fss {
+		tmp := testDir(fs)
+		for _, name := range []string{"a.txt", "b.txt", "c.md", "sub/d.txt", "sub/e.go", "sub2/f.txt"} {
+			path := filepath.Join(tmp, filepath.FromSlash(name))
+			fs.MkdirAll(filepath.Dir(path), 0777)
+			WriteFile(fs, path, []byte(name), 0644)
+		}
+
+		tests := []struct {
+			pattern string
+			want    []string
+		}{
+			{"*.txt", []string{"a.txt", "b.txt"}},
+			{"?.md", []string{"c.md"}},
+			{"[ab].txt", []string{"a.txt", "b.txt"}},
+			{"*/*.txt", []string{"sub/d.txt", "sub2/f.txt"}},
+			{"sub*/[d-f].*", []string{"sub/d.txt", "sub/e.go", "sub2/f.txt"}},
+			{"sub/e.go", []string{"sub/e.go"}},
+			{"*.none", nil},
+			{"missing", nil},
+		}
+		for _, test := range tests {
+			var want []string
+			for _, w := range test.want {
+				want = append(want, filepath.Join(tmp, filepath.FromSlash(w)))
+			}
+			got, err := Glob(fs, filepath.Join(tmp, filepath.FromSlash(test.pattern)))
+			if err != nil {
+				t.Errorf("%s: Glob(%q): %s", fs.Name(), test.pattern, err)
+				continue
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("%s: Glob(%q) = %v, want %v", fs.Name(), test.pattern, got, want)
+			}
+		}
+
+		if _, err := Glob(fs, filepath.Join(tmp, "[")); err != filepath.ErrBadPattern {
+			t.Errorf("%s: Glob with bad pattern: got %v, want %v", fs.Name(), err, filepath.ErrBadPattern)
+		}
+	}
+}
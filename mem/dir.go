@@ -22,14 +22,31 @@ type Dir interface {
 }
 
 func RemoveFromMemDir(dir *FileData, f *FileData) {
+	dir.Lock()
 	dir.memDir.Remove(f)
+	dir.Unlock()
 }
 
 func AddToMemDir(dir *FileData, f *FileData) {
+	dir.Lock()
 	dir.memDir.Add(f)
+	dir.Unlock()
+}
+
+// DirLen returns the number of entries of the directory d, 0 if d is not a
+// directory.
+func DirLen(d *FileData) int {
+	d.RLock()
+	defer d.RUnlock()
+	if d.memDir == nil {
+		return 0
+	}
+	return d.memDir.Len()
 }
 
 func InitializeDir(d *FileData) {
+	d.Lock()
+	defer d.Unlock()
 	if d.memDir == nil {
 		d.dir = true
 		d.memDir = &DirMap{}
@@ -15,13 +15,15 @@
 package mem
 
 import (
-	"bytes"
+	"context"
 	"errors"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"sync"
 	"sync/atomic"
+	"syscall"
 )
 
 import "time"
@@ -30,11 +32,17 @@ const FilePathSeparator = string(filepath.Separator)
 
 type File struct {
 	// atomic requires 64-bit alignment for struct field access
-	at           int64
-	readDirCount int64
-	closed       bool
-	readOnly     bool
-	fileData     *FileData
+	at       int64
+	closed   bool
+	readOnly bool
+	append   bool // every write goes to the end, see os.O_APPEND
+	fileData *FileData
+
+	// the entries of a directory as of the first Readdir, readDirCount
+	// of them have been returned
+	dirMu        sync.Mutex
+	dirFiles     []*FileData
+	readDirCount int
 }
 
 func NewFileHandle(data *FileData) *File {
@@ -45,30 +53,238 @@ func NewReadOnlyFileHandle(data *FileData) *File {
 	return &File{fileData: data, readOnly: true}
 }
 
-func (f File) Data() *FileData {
+// NewAppendFileHandle returns a handle for a file opened with os.O_APPEND:
+// all writes append to the end of the file, whatever the file offset.
+func NewAppendFileHandle(data *FileData) *File {
+	return &File{fileData: data, append: true}
+}
+
+func (f *File) Data() *FileData {
 	return f.fileData
 }
 
+// FileData is a name of a file of the file system. The content and the
+// metadata are shared by all the hard links of the file, see Link.
 type FileData struct {
-	sync.Mutex
-	name    string
-	data    []byte
+	*inode
+	name string
+}
+
+// inode is the content and the metadata of a file. Reading them takes the
+// read lock, so readers of the same file don't block each other.
+type inode struct {
+	sync.RWMutex
+	data    sparseData
 	memDir  Dir
 	dir     bool
 	mode    os.FileMode
 	modtime time.Time
+	uid     int
+	gid     int
+	nlink   int // the number of names of the file
+	limit   *Limit
+	clock   *Clock
+	onWrite func(name string)
+}
+
+// Limit restricts the total size of the data of all files sharing it.
+type Limit struct {
+	// atomic requires 64-bit alignment for struct field access
+	used int64
+	max  int64
+}
+
+func NewLimit(max int64) *Limit {
+	return &Limit{max: max}
+}
+
+// Used returns the number of bytes currently accounted to l.
+func (l *Limit) Used() int64 {
+	return atomic.LoadInt64(&l.used)
+}
+
+// grow accounts n more bytes (n may be negative) to l, it fails if this
+// would exceed the maximum. A nil Limit never fails.
+func (l *Limit) grow(n int64) bool {
+	if l == nil {
+		return true
+	}
+	for {
+		used := atomic.LoadInt64(&l.used)
+		if n > 0 && used+n > l.max {
+			return false
+		}
+		if atomic.CompareAndSwapInt64(&l.used, used, used+n) {
+			return true
+		}
+	}
+}
+
+// SetLimit makes the data of f count against l, instead of the Limit it
+// counted against before. The size of the data is moved to l even if it
+// exceeds the maximum, only later growth fails then.
+func SetLimit(f *FileData, l *Limit) {
+	f.Lock()
+	defer f.Unlock()
+	if f.limit == l {
+		return
+	}
+	f.limit.grow(-f.data.size)
+	if l != nil {
+		atomic.AddInt64(&l.used, f.data.size)
+	}
+	f.limit = l
+}
+
+// A Clock provides the modification times of the files sharing it. The zero
+// value and a nil Clock use time.Now.
+type Clock struct {
+	now atomic.Value // of func() time.Time
+}
+
+// Set makes c return the times of now, nil restores time.Now.
+func (c *Clock) Set(now func() time.Time) {
+	if now == nil {
+		now = time.Now
+	}
+	c.now.Store(now)
+}
+
+// Now returns the current time of c.
+func (c *Clock) Now() time.Time {
+	if c != nil {
+		if now, ok := c.now.Load().(func() time.Time); ok {
+			return now()
+		}
+	}
+	return time.Now()
+}
+
+// SetClock makes the modification time updates of f use c.
+func SetClock(f *FileData, c *Clock) {
+	f.Lock()
+	f.clock = c
+	f.Unlock()
 }
 
-func (d FileData) Name() string {
+// SetWriteHook makes every write to the data of f, including a truncate,
+// call fn with the name of f. fn is called with f locked, it must not block
+// or use f.
+func SetWriteHook(f *FileData, fn func(name string)) {
+	f.Lock()
+	f.onWrite = fn
+	f.Unlock()
+}
+
+// written calls the write hook of f, f must be locked.
+func (f *FileData) written() {
+	if f.onWrite != nil {
+		f.onWrite(f.name)
+	}
+}
+
+// ReleaseData drops the name f of its file. Once the last name is dropped,
+// the space used by the data is returned to its Limit and the data detached
+// from it. Used when f is removed from the file system.
+func ReleaseData(f *FileData) {
+	f.Lock()
+	if f.nlink--; f.nlink <= 0 {
+		f.limit.grow(-f.data.size)
+		f.limit = nil
+	}
+	f.Unlock()
+}
+
+// Link returns a new name for the file f, i.e. a hard link: the content and
+// the metadata are shared by both names.
+func Link(f *FileData, name string) *FileData {
+	f.Lock()
+	f.nlink++
+	f.Unlock()
+	return &FileData{inode: f.inode, name: name}
+}
+
+// LinkCount returns the number of names of the file f.
+func LinkCount(f *FileData) int {
+	f.RLock()
+	defer f.RUnlock()
+	return f.nlink
+}
+
+// Copy returns a deep copy of files, a set of files by name, as of a single
+// point in time: all of them are read locked while copying. Hard links
+// within the set are preserved, and the directories list the copies of
+// their entries. Limits, clocks and write hooks are not copied.
+func Copy(files map[string]*FileData) map[string]*FileData {
+	inodes := make(map[*inode]*inode)
+	for _, f := range files {
+		if _, ok := inodes[f.inode]; !ok {
+			f.RLock()
+			defer f.RUnlock()
+			inodes[f.inode] = &inode{
+				data:    f.data.clone(),
+				dir:     f.dir,
+				mode:    f.mode,
+				modtime: f.modtime,
+				uid:     f.uid,
+				gid:     f.gid,
+			}
+		}
+	}
+	copies := make(map[string]*FileData, len(files))
+	for name, f := range files {
+		c := &FileData{inode: inodes[f.inode], name: f.name}
+		c.nlink++
+		copies[name] = c
+	}
+	for name, f := range files {
+		if f.memDir == nil {
+			continue
+		}
+		dir := DirMap{}
+		for _, entry := range f.memDir.Files() {
+			if c, ok := copies[entry.name]; ok {
+				dir.Add(c)
+			}
+		}
+		copies[name].memDir = &dir
+	}
+	return copies
+}
+
+// SameFile reports whether a and b are names of the same file.
+func SameFile(a, b *FileData) bool {
+	return a.inode == b.inode
+}
+
+func (d *FileData) Name() string {
 	return d.name
 }
 
+// CreateFile and CreateDir return a new file or directory owned by the user
+// and group of the process, like on the operating system.
 func CreateFile(name string) *FileData {
-	return &FileData{name: name, mode: os.ModeTemporary, modtime: time.Now()}
+	return &FileData{name: name, inode: &inode{mode: 0666, modtime: time.Now(), uid: os.Getuid(), gid: os.Getgid(), nlink: 1}}
 }
 
 func CreateDir(name string) *FileData {
-	return &FileData{name: name, memDir: &DirMap{}, dir: true}
+	return &FileData{name: name, inode: &inode{memDir: &DirMap{}, dir: true, mode: os.ModeDir | 0777, uid: os.Getuid(), gid: os.Getgid(), nlink: 1}}
+}
+
+// CreateSymlink creates a symbolic link pointing to target. Like on most
+// operating systems, the target is stored as the content of the link.
+func CreateSymlink(name string, target string) *FileData {
+	link := &FileData{name: name, inode: &inode{mode: os.ModeSymlink | 0777, modtime: time.Now(), uid: os.Getuid(), gid: os.Getgid(), nlink: 1}}
+	link.data.writeAt([]byte(target), 0)
+	return link
+}
+
+func IsSymlink(f *FileData) bool {
+	return f.mode&os.ModeSymlink != 0
+}
+
+func SymlinkTarget(f *FileData) string {
+	return string(f.data.bytes())
 }
 
 func ChangeFileName(f *FileData, newname string) {
@@ -76,20 +292,35 @@ func ChangeFileName(f *FileData, newname string) {
 }
 
 func SetMode(f *FileData, mode os.FileMode) {
+	f.Lock()
 	f.mode = mode
+	f.Unlock()
 }
 
 func SetModTime(f *FileData, mtime time.Time) {
 	f.modtime = mtime
 }
 
+// SetOwner changes the numeric user and group id of f, like os.Chown a
+// value of -1 leaves it unchanged.
+func SetOwner(f *FileData, uid, gid int) {
+	f.Lock()
+	defer f.Unlock()
+	if uid != -1 {
+		f.uid = uid
+	}
+	if gid != -1 {
+		f.gid = gid
+	}
+}
+
 func GetFileInfo(f *FileData) *FileInfo {
 	return &FileInfo{f}
 }
 
 func (f *File) Open() error {
 	atomic.StoreInt64(&f.at, 0)
-	atomic.StoreInt64(&f.readDirCount, 0)
+	f.rewindDir()
 	f.fileData.Lock()
 	f.closed = false
 	f.fileData.Unlock()
@@ -100,7 +331,7 @@ func (f *File) Close() error {
 	f.fileData.Lock()
 	f.closed = true
 	if !f.readOnly {
-		SetModTime(f.fileData, time.Now())
+		SetModTime(f.fileData, f.fileData.clock.Now())
 	}
 	f.fileData.Unlock()
 	return nil
@@ -114,36 +345,74 @@ func (f *File) Stat() (os.FileInfo, error) {
 	return &FileInfo{f.fileData}, nil
 }
 
+// Sync does nothing: writes are not buffered, the data is shared by all
+// handles of the file as soon as a write returns.
 func (f *File) Sync() error {
 	return nil
 }
 
+// Readdir pages through the entries of a directory like os.File.Readdir:
+// with count > 0 successive calls return the next count entries at most,
+// and io.EOF once all are read, with count <= 0 all remaining entries are
+// returned. The entries are listed once, by the first call, so changes of
+// the directory while reading it don't make entries repeat or go missing.
+// Seeking to the start lists them again.
 func (f *File) Readdir(count int) (res []os.FileInfo, err error) {
-	var outLength int64
+	if !f.fileData.dir {
+		return nil, &os.PathError{Op: "readdir", Path: f.fileData.name, Err: syscall.ENOTDIR}
+	}
+	f.fileData.RLock()
+	closed := f.closed
+	f.fileData.RUnlock()
+	if closed {
+		return nil, ErrFileClosed
+	}
 
-	f.fileData.Lock()
-	files := f.fileData.memDir.Files()[f.readDirCount:]
-	if count > 0 {
-		if len(files) < count {
-			outLength = int64(len(files))
-		} else {
-			outLength = int64(count)
+	f.dirMu.Lock()
+	defer f.dirMu.Unlock()
+	if f.dirFiles == nil {
+		f.fileData.RLock()
+		f.dirFiles = f.fileData.memDir.Files()
+		f.fileData.RUnlock()
+		if f.dirFiles == nil {
+			f.dirFiles = []*FileData{}
 		}
+	}
+	files := f.dirFiles[f.readDirCount:]
+	if count > 0 {
 		if len(files) == 0 {
-			err = io.EOF
+			return nil, io.EOF
+		}
+		if len(files) > count {
+			files = files[:count]
 		}
-	} else {
-		outLength = int64(len(files))
 	}
-	f.readDirCount += outLength
-	f.fileData.Unlock()
+	f.readDirCount += len(files)
 
-	res = make([]os.FileInfo, outLength)
+	res = make([]os.FileInfo, len(files))
 	for i := range res {
 		res[i] = &FileInfo{files[i]}
 	}
+	return res, nil
+}
+
+// rewindDir makes the next Readdir list the entries of a directory again.
+func (f *File) rewindDir() {
+	f.dirMu.Lock()
+	f.dirFiles = nil
+	f.readDirCount = 0
+	f.dirMu.Unlock()
+}
 
-	return res, err
+// ReadDir is like Readdir, but returns fs.DirEntry values, see
+// fs.ReadDirFile.
+func (f *File) ReadDir(count int) ([]fs.DirEntry, error) {
+	list, err := f.Readdir(count)
+	entries := make([]fs.DirEntry, len(list))
+	for i, fi := range list {
+		entries[i] = fs.FileInfoToDirEntry(fi)
+	}
+	return entries, err
 }
 
 func (f *File) Readdirnames(n int) (names []string, err error) {
@@ -156,29 +425,57 @@ func (f *File) Readdirnames(n int) (names []string, err error) {
 }
 
 func (f *File) Read(b []byte) (n int, err error) {
-	f.fileData.Lock()
-	defer f.fileData.Unlock()
+	f.fileData.RLock()
+	defer f.fileData.RUnlock()
 	if f.closed == true {
 		return 0, ErrFileClosed
 	}
-	if len(b) > 0 && int(f.at) == len(f.fileData.data) {
-		return 0, io.EOF
-	}
-	if len(f.fileData.data)-int(f.at) >= len(b) {
-		n = len(b)
-	} else {
-		n = len(f.fileData.data) - int(f.at)
-	}
-	copy(b, f.fileData.data[f.at:f.at+int64(n)])
+	n, err = f.readAt(b, atomic.LoadInt64(&f.at))
 	atomic.AddInt64(&f.at, int64(n))
+	if err == io.EOF && n > 0 {
+		// like os.File, report io.EOF with the next call
+		err = nil
+	}
 	return
 }
 
-func (f *File) ReadAt(b []byte, off int64) (n int, err error) {
-	atomic.StoreInt64(&f.at, off)
+// ReadContext is Read, failing with ctx.Err() if ctx is done already.
+func (f *File) ReadContext(ctx context.Context, b []byte) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
 	return f.Read(b)
 }
 
+// ReadAt reads from off without changing the offset used by Read and Write.
+func (f *File) ReadAt(b []byte, off int64) (n int, err error) {
+	f.fileData.RLock()
+	defer f.fileData.RUnlock()
+	if f.closed == true {
+		return 0, ErrFileClosed
+	}
+	if off < 0 {
+		return 0, &os.PathError{Op: "readat", Path: f.fileData.name, Err: errors.New("negative offset")}
+	}
+	return f.readAt(b, off)
+}
+
+// readAt returns io.EOF if less than len(b) bytes are read, f.fileData must
+// be locked.
+func (f *File) readAt(b []byte, off int64) (n int, err error) {
+	if off >= f.fileData.data.size {
+		if len(b) == 0 {
+			return 0, nil
+		}
+		return 0, io.EOF
+	}
+	n = f.fileData.data.readAt(b, off)
+	if n < len(b) {
+		err = io.EOF
+	}
+	return
+}
+
 func (f *File) Truncate(size int64) error {
 	if f.closed == true {
 		return ErrFileClosed
@@ -186,16 +483,23 @@ func (f *File) Truncate(size int64) error {
 	if f.readOnly {
 		return &os.PathError{"truncate", f.fileData.name, errors.New("file handle is read only")}
 	}
+	return Truncate(f.fileData, size)
+}
+
+// Truncate changes the size of the file data, it is zero filled when grown.
+// The grown part takes no memory until it is written to.
+func Truncate(f *FileData, size int64) error {
 	if size < 0 {
 		return ErrOutOfRange
 	}
-	if size > int64(len(f.fileData.data)) {
-		diff := size - int64(len(f.fileData.data))
-		f.fileData.data = append(f.fileData.data, bytes.Repeat([]byte{00}, int(diff))...)
-	} else {
-		f.fileData.data = f.fileData.data[0:size]
+	f.Lock()
+	defer f.Unlock()
+	if !f.limit.grow(size - f.data.size) {
+		return &os.PathError{Op: "truncate", Path: f.name, Err: syscall.ENOSPC}
 	}
-	SetModTime(f.fileData, time.Now())
+	f.data.truncate(size)
+	SetModTime(f, f.clock.Now())
+	f.written()
 	return nil
 }
 
@@ -204,47 +508,78 @@ func (f *File) Seek(offset int64, whence int) (int64, error) {
 		return 0, ErrFileClosed
 	}
 	switch whence {
-	case 0:
-		atomic.StoreInt64(&f.at, offset)
-	case 1:
-		atomic.AddInt64(&f.at, int64(offset))
-	case 2:
-		atomic.StoreInt64(&f.at, int64(len(f.fileData.data))+offset)
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += atomic.LoadInt64(&f.at)
+	case io.SeekEnd:
+		f.fileData.RLock()
+		offset += f.fileData.data.size
+		f.fileData.RUnlock()
+	default:
+		return 0, &os.PathError{Op: "seek", Path: f.fileData.name, Err: syscall.EINVAL}
+	}
+	if offset < 0 {
+		return 0, &os.PathError{Op: "seek", Path: f.fileData.name, Err: syscall.EINVAL}
 	}
-	return f.at, nil
+	if offset == 0 && whence == io.SeekStart && f.fileData.dir {
+		f.rewindDir()
+	}
+	atomic.StoreInt64(&f.at, offset)
+	return offset, nil
 }
 
 func (f *File) Write(b []byte) (n int, err error) {
 	if f.readOnly {
 		return 0, &os.PathError{"write", f.fileData.name, errors.New("file handle is read only")}
 	}
-	n = len(b)
-	cur := atomic.LoadInt64(&f.at)
 	f.fileData.Lock()
 	defer f.fileData.Unlock()
-	diff := cur - int64(len(f.fileData.data))
-	var tail []byte
-	if n+int(cur) < len(f.fileData.data) {
-		tail = f.fileData.data[n+int(cur):]
-	}
-	if diff > 0 {
-		f.fileData.data = append(bytes.Repeat([]byte{00}, int(diff)), b...)
-		f.fileData.data = append(f.fileData.data, tail...)
-	} else {
-		f.fileData.data = append(f.fileData.data[:cur], b...)
-		f.fileData.data = append(f.fileData.data, tail...)
+	cur := atomic.LoadInt64(&f.at)
+	if f.append {
+		cur = f.fileData.data.size
 	}
-	SetModTime(f.fileData, time.Now())
+	n, err = f.writeAt(b, cur)
+	atomic.StoreInt64(&f.at, cur+int64(n))
+	return
+}
 
-	atomic.StoreInt64(&f.at, int64(len(f.fileData.data)))
+// writeAt writes b at off, a gap between the end of the data and off is a
+// hole reading as zeros. f.fileData must be locked.
+func (f *File) writeAt(b []byte, off int64) (n int, err error) {
+	n = len(b)
+	if grow := off + int64(n) - f.fileData.data.size; grow > 0 && !f.fileData.limit.grow(grow) {
+		return 0, &os.PathError{Op: "write", Path: f.fileData.name, Err: syscall.ENOSPC}
+	}
+	f.fileData.data.writeAt(b, off)
+	SetModTime(f.fileData, f.fileData.clock.Now())
+	f.fileData.written()
 	return
 }
 
-func (f *File) WriteAt(b []byte, off int64) (n int, err error) {
-	atomic.StoreInt64(&f.at, off)
+// WriteContext is Write, failing with ctx.Err() if ctx is done already.
+func (f *File) WriteContext(ctx context.Context, b []byte) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
 	return f.Write(b)
 }
 
+// WriteAt writes b at off, it doesn't change the file offset.
+func (f *File) WriteAt(b []byte, off int64) (n int, err error) {
+	if f.readOnly {
+		return 0, &os.PathError{"write", f.fileData.name, errors.New("file handle is read only")}
+	}
+	if f.append {
+		return 0, ErrWriteAtInAppendMode
+	}
+	if off < 0 {
+		return 0, &os.PathError{Op: "writeat", Path: f.fileData.name, Err: errors.New("negative offset")}
+	}
+	f.fileData.Lock()
+	defer f.fileData.Unlock()
+	return f.writeAt(b, off)
+}
+
 func (f *File) WriteString(s string) (ret int, err error) {
 	return f.Write([]byte(s))
 }
@@ -257,27 +592,48 @@ type FileInfo struct {
 	*FileData
 }
 
-// Implements os.FileInfo
+// Implements os.FileInfo. The name of the root is the separator, like
+// os.Stat("/") reports.
 func (s *FileInfo) Name() string {
-	_, name := filepath.Split(s.name)
-	return name
+	return filepath.Base(s.name)
+}
+func (s *FileInfo) Mode() os.FileMode {
+	s.RLock()
+	defer s.RUnlock()
+	return s.mode
+}
+func (s *FileInfo) IsDir() bool      { return s.dir }
+func (s *FileInfo) Sys() interface{} { return nil }
+func (s *FileInfo) Uid() int {
+	s.RLock()
+	defer s.RUnlock()
+	return s.uid
+}
+func (s *FileInfo) Gid() int {
+	s.RLock()
+	defer s.RUnlock()
+	return s.gid
+}
+func (s *FileInfo) ModTime() time.Time {
+	s.RLock()
+	defer s.RUnlock()
+	return s.modtime
 }
-func (s *FileInfo) Mode() os.FileMode  { return s.mode }
-func (s *FileInfo) ModTime() time.Time { return s.modtime }
-func (s *FileInfo) IsDir() bool        { return s.dir }
-func (s *FileInfo) Sys() interface{}   { return nil }
 func (s *FileInfo) Size() int64 {
 	if s.IsDir() {
 		return int64(42)
 	}
-	return int64(len(s.data))
+	s.RLock()
+	defer s.RUnlock()
+	return s.data.size
 }
 
 var (
-	ErrFileClosed        = errors.New("File is closed")
-	ErrOutOfRange        = errors.New("Out of range")
-	ErrTooLarge          = errors.New("Too large")
-	ErrFileNotFound      = os.ErrNotExist
-	ErrFileExists        = os.ErrExist
-	ErrDestinationExists = os.ErrExist
+	ErrFileClosed          = errors.New("File is closed")
+	ErrOutOfRange          = errors.New("Out of range")
+	ErrTooLarge            = errors.New("Too large")
+	ErrFileNotFound        = os.ErrNotExist
+	ErrFileExists          = os.ErrExist
+	ErrDestinationExists   = os.ErrExist
+	ErrWriteAtInAppendMode = errors.New("invalid use of WriteAt on file opened with O_APPEND")
 )
@@ -0,0 +1,123 @@
+package mem
+
+// chunkSize is the size of the chunks the content of a file is stored in.
+const chunkSize = 64 << 10
+
+// sparseData is the content of a file. It is stored in chunks which are only
+// allocated once written to, so the holes left by growing a file with
+// Truncate or by writing past its end take no memory, and read as zeros. A
+// chunk may be shorter than chunkSize, its missing bytes are zeros as well.
+// The zero value is an empty file.
+type sparseData struct {
+	size   int64
+	chunks map[int64][]byte // by index
+}
+
+// readAt reads from off into b, up to the end of the data, and returns the
+// number of bytes read.
+func (d *sparseData) readAt(b []byte, off int64) int {
+	if off >= d.size {
+		return 0
+	}
+	if rest := d.size - off; int64(len(b)) > rest {
+		b = b[:rest]
+	}
+	for n := 0; n < len(b); {
+		idx, in := (off+int64(n))/chunkSize, int((off+int64(n))%chunkSize)
+		dst := b[n:]
+		if len(dst) > chunkSize-in {
+			dst = dst[:chunkSize-in]
+		}
+		c := d.chunks[idx]
+		m := 0
+		if in < len(c) {
+			m = copy(dst, c[in:])
+		}
+		zero(dst[m:])
+		n += len(dst)
+	}
+	return len(b)
+}
+
+// writeAt writes b at off, growing the data if needed.
+func (d *sparseData) writeAt(b []byte, off int64) {
+	if d.chunks == nil {
+		d.chunks = make(map[int64][]byte)
+	}
+	for n := 0; n < len(b); {
+		idx, in := (off+int64(n))/chunkSize, int((off+int64(n))%chunkSize)
+		src := b[n:]
+		if len(src) > chunkSize-in {
+			src = src[:chunkSize-in]
+		}
+		c := d.chunks[idx]
+		if end := in + len(src); end > len(c) {
+			c = extend(c, end)
+		}
+		copy(c[in:], src)
+		d.chunks[idx] = c
+		n += len(src)
+	}
+	if end := off + int64(len(b)); end > d.size {
+		d.size = end
+	}
+}
+
+// truncate changes the size of the data, a grown part is a hole.
+func (d *sparseData) truncate(size int64) {
+	if size < d.size {
+		last, in := size/chunkSize, int(size%chunkSize)
+		for idx, c := range d.chunks {
+			switch {
+			case idx > last || idx == last && in == 0:
+				delete(d.chunks, idx)
+			case idx == last && len(c) > in:
+				d.chunks[idx] = c[:in]
+			}
+		}
+	}
+	d.size = size
+}
+
+// bytes returns all of the data, with the holes filled in.
+func (d *sparseData) bytes() []byte {
+	b := make([]byte, d.size)
+	d.readAt(b, 0)
+	return b
+}
+
+// clone returns a deep copy of d.
+func (d *sparseData) clone() sparseData {
+	c := sparseData{size: d.size, chunks: make(map[int64][]byte, len(d.chunks))}
+	for idx, chunk := range d.chunks {
+		c.chunks[idx] = append([]byte(nil), chunk...)
+	}
+	return c
+}
+
+// extend returns c grown to length n, with the new bytes zeroed. The
+// capacity is at least doubled, up to chunkSize, so appending is cheap.
+func extend(c []byte, n int) []byte {
+	if n <= cap(c) {
+		old := len(c)
+		c = c[:n]
+		zero(c[old:])
+		return c
+	}
+	size := 2 * cap(c)
+	if size < n {
+		size = n
+	}
+	if size > chunkSize {
+		size = chunkSize
+	}
+	grown := make([]byte, n, size)
+	copy(grown, c)
+	return grown
+}
+
+func zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
@@ -15,26 +15,142 @@ package afero
 
 import (
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/spf13/afero/mem"
 )
 
+// MemMapFs keeps its files in a map guarded by mu. Lookups take the read
+// lock, changes of the tree the write lock. The content and metadata of each
+// file are guarded by a lock of their own, again read locked for reading.
+// mu is always taken before the lock of a file, never while holding one, so
+// the two can't deadlock.
 type MemMapFs struct {
-	mu   sync.RWMutex
-	data map[string]*mem.FileData
-	init sync.Once
+	mu    sync.RWMutex
+	data  map[string]*mem.FileData
+	init  sync.Once
+	limit *mem.Limit
+	watch watchers
+	clock mem.Clock
+
+	// the caller, whose permissions are checked if enforce is set
+	enforce  bool
+	uid, gid int
 }
 
 func NewMemMapFs() Fs {
 	return &MemMapFs{}
 }
 
+// NewMemMapFsWithLimit returns a MemMapFs which holds at most maxBytes of
+// file data in total. Writes and truncates exceeding the limit fail with
+// syscall.ENOSPC wrapped in an *os.PathError. Removing a file returns its
+// space, writes to handles still open on a removed file are not accounted.
+func NewMemMapFsWithLimit(maxBytes int64) Fs {
+	return &MemMapFs{limit: mem.NewLimit(maxBytes)}
+}
+
+// NewMemMapFsEnforcing returns a MemMapFs which checks the permission bits
+// and owners of the files like a Unix system does for a process of user uid
+// in group gid, e.g. to test the handling of permission errors. Opening a
+// file needs read or write permission, as the flags ask for, looking up a
+// name needs search permission on the directories leading to it, and
+// creating, removing or renaming a name needs write and search permission
+// on its directory. Chmod and Chtimes are allowed to the owner only, Chown
+// to root only. User id 0 is root and may do everything. Denied calls fail
+// with an *os.PathError or *os.LinkError wrapping os.ErrPermission.
+//
+// New files and directories are owned by uid and gid, the root directory
+// too, with mode 0755. Files already open are not checked again, like on
+// Unix.
+func NewMemMapFsEnforcing(uid, gid int) Fs {
+	return &MemMapFs{enforce: true, uid: uid, gid: gid}
+}
+
+// The bits of the permission checks, as in the triples of a mode.
+const (
+	accessRead  os.FileMode = 4
+	accessWrite os.FileMode = 2
+	accessExec  os.FileMode = 1
+)
+
+// allows reports whether the caller may access f as want asks for.
+func (m *MemMapFs) allows(f *mem.FileData, want os.FileMode) bool {
+	if !m.enforce || m.uid == 0 {
+		return true
+	}
+	fi := mem.GetFileInfo(f)
+	perm := fi.Mode().Perm()
+	switch {
+	case fi.Uid() == m.uid:
+		perm >>= 6
+	case fi.Gid() == m.gid:
+		perm >>= 3
+	}
+	return perm&want == want
+}
+
+// lockfreeAccess checks that the caller may search the directories leading
+// to the resolved name, and access name as want asks for, if it exists.
+func (m *MemMapFs) lockfreeAccess(name string, want os.FileMode) error {
+	if !m.enforce || m.uid == 0 {
+		return nil
+	}
+	for dir := filepath.Dir(name); ; dir = filepath.Dir(dir) {
+		if f, ok := m.getData()[dir]; ok && !m.allows(f, accessExec) {
+			return os.ErrPermission
+		}
+		if dir == FilePathSeparator || dir == "." {
+			break
+		}
+	}
+	if f, ok := m.getData()[name]; ok && !m.allows(f, want) {
+		return os.ErrPermission
+	}
+	return nil
+}
+
+// lockfreeAccessParent checks that the caller may create or remove the
+// resolved name, in the closest of its parent directories that exists.
+func (m *MemMapFs) lockfreeAccessParent(name string) error {
+	dir := filepath.Dir(name)
+	for dir != FilePathSeparator && dir != "." {
+		if _, ok := m.getData()[dir]; ok {
+			break
+		}
+		dir = filepath.Dir(dir)
+	}
+	return m.lockfreeAccess(dir, accessWrite|accessExec)
+}
+
+// lockfreeAccessCreate checks that the caller may create the resolved name,
+// or truncate it if it exists.
+func (m *MemMapFs) lockfreeAccessCreate(name string) error {
+	if _, ok := m.getData()[name]; ok {
+		return m.lockfreeAccess(name, accessWrite)
+	}
+	return m.lockfreeAccessParent(name)
+}
+
+// lockfreeAccessOwner checks that the caller may change the metadata of f.
+func (m *MemMapFs) lockfreeAccessOwner(f *mem.FileData) error {
+	if err := m.lockfreeAccess(f.Name(), 0); err != nil {
+		return err
+	}
+	if m.enforce && m.uid != 0 && mem.GetFileInfo(f).Uid() != m.uid {
+		return os.ErrPermission
+	}
+	return nil
+}
+
 var memfsInit sync.Once
 
 func (m *MemMapFs) getData() map[string]*mem.FileData {
@@ -42,23 +158,170 @@ func (m *MemMapFs) getData() map[string]*mem.FileData {
 		m.data = make(map[string]*mem.FileData)
 		// Root should always exist, right?
 		// TODO: what about windows?
-		m.data[FilePathSeparator] = mem.CreateDir(FilePathSeparator)
+		perm := os.FileMode(0777)
+		if m.enforce {
+			// like on a real system, others can't write to the root
+			perm = 0755
+		}
+		m.data[FilePathSeparator] = m.newDir(FilePathSeparator, perm)
 	})
 	return m.data
 }
 
 func (MemMapFs) Name() string { return "MemMapFS" }
 
+// SetClock makes m use now instead of time.Now for the modification times
+// it sets, e.g. to control them in tests. Passing nil restores time.Now.
+func (m *MemMapFs) SetClock(now func() time.Time) {
+	m.clock.Set(now)
+}
+
+// A MemMapFsSnapshot holds the files of a MemMapFs as of a single point in
+// time, see Snapshot. It can't be changed: it is read through Fs, and
+// copied by Restore.
+type MemMapFsSnapshot struct {
+	fs *MemMapFs
+}
+
+// Fs returns a read only Fs of the files of s.
+func (s *MemMapFsSnapshot) Fs() Fs {
+	return NewReadOnlyFs(s.fs)
+}
+
+// Snapshot returns a copy of m as of a single point in time, e.g. to be
+// written to disk with CopyDir while m is still in use:
+//
+//	afero.CopyDir(m.Snapshot().Fs(), "/", afero.NewOsFs(), dir, nil)
+//
+// All writes that returned before are in the copy, including writes through
+// open files: they don't buffer. The copy has no size limit and doesn't
+// check permissions.
+func (m *MemMapFs) Snapshot() *MemMapFsSnapshot {
+	s := &MemMapFs{}
+	s.clock.Set(m.clock.Now)
+	s.init.Do(func() {})
+	s.data = s.adopt(m.copyData())
+	return &MemMapFsSnapshot{fs: s}
+}
+
+// Restore resets m to the files of snap, e.g. to set up the same tree for
+// every case of a table driven test:
+//
+//	snap := fs.Snapshot()
+//	for _, tt := range tests {
+//		fs.Restore(snap)
+//		...
+//	}
+//
+// The files are copied, so snap is left unchanged and can be restored again.
+// Files still open in m are detached from it, like removed files. The files
+// restored count against the size limit of m, even if they exceed it. No
+// events are sent to the watchers of m.
+func (m *MemMapFs) Restore(snap *MemMapFsSnapshot) {
+	data := m.adopt(snap.fs.copyData())
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, f := range m.getData() {
+		mem.ReleaseData(f)
+	}
+	m.data = data
+}
+
+// copyData returns a deep copy of the files of m.
+func (m *MemMapFs) copyData() map[string]*mem.FileData {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return mem.Copy(m.getData())
+}
+
+// adopt makes the copied files in data use the limit, clock and write hook
+// of m, and returns data.
+func (m *MemMapFs) adopt(data map[string]*mem.FileData) map[string]*mem.FileData {
+	for _, f := range data {
+		mem.SetClock(f, &m.clock)
+		if !mem.GetFileInfo(f).IsDir() {
+			mem.SetLimit(f, m.limit)
+			mem.SetWriteHook(f, m.written)
+		}
+	}
+	return data
+}
+
+// newFile returns a new file of m, using its limit, clock and write hook.
+func (m *MemMapFs) newFile(name string) *mem.FileData {
+	file := mem.CreateFile(name)
+	mem.SetLimit(file, m.limit)
+	mem.SetClock(file, &m.clock)
+	mem.SetModTime(file, m.clock.Now())
+	mem.SetWriteHook(file, m.written)
+	if m.enforce {
+		mem.SetOwner(file, m.uid, m.gid)
+	}
+	return file
+}
+
+// newDir returns a new directory of m.
+func (m *MemMapFs) newDir(name string, perm os.FileMode) *mem.FileData {
+	dir := mem.CreateDir(name)
+	mem.SetMode(dir, os.ModeDir|perm)
+	mem.SetClock(dir, &m.clock)
+	mem.SetModTime(dir, m.clock.Now())
+	if m.enforce {
+		mem.SetOwner(dir, m.uid, m.gid)
+	}
+	return dir
+}
+
 func (m *MemMapFs) Create(name string) (File, error) {
 	name = normalizePath(name)
 	m.mu.Lock()
-	file := mem.CreateFile(name)
+	name, err := m.lockfreeResolve(name, true)
+	if err != nil {
+		m.mu.Unlock()
+		return nil, &os.PathError{Op: "create", Path: name, Err: err}
+	}
+	if err := m.lockfreeAccessCreate(name); err != nil {
+		m.mu.Unlock()
+		return nil, &os.PathError{Op: "create", Path: name, Err: err}
+	}
+	op := EventCreate
+	if old, ok := m.getData()[name]; ok {
+		if mem.LinkCount(old) > 1 {
+			// truncate in place, so the other links keep sharing it
+			m.mu.Unlock()
+			if err := mem.Truncate(old, 0); err != nil {
+				return nil, err
+			}
+			return mem.NewFileHandle(old), nil
+		}
+		mem.ReleaseData(old)
+		op = EventWrite
+	}
+	file := m.newFile(name)
 	m.getData()[name] = file
 	m.registerWithParent(file)
+	m.watch.notify(name, op)
 	m.mu.Unlock()
 	return mem.NewFileHandle(file), nil
 }
 
+// written is the write hook of the files, see mem.SetWriteHook.
+func (m *MemMapFs) written(name string) {
+	m.watch.notify(name, EventWrite)
+}
+
+// Watch subscribes to the changes of the file or directory name, see
+// Watcher. The changes made through the MemMapFs and the files it returns
+// are reported.
+func (m *MemMapFs) Watch(name string) (<-chan Event, func(), error) {
+	name = normalizePath(name)
+	if _, err := m.open(name, 0); err != nil {
+		return nil, nil, &os.PathError{Op: "watch", Path: name, Err: err.(*os.PathError).Err}
+	}
+	ch, stop := m.watch.add(name)
+	return ch, stop, nil
+}
+
 func (m *MemMapFs) unRegisterWithParent(fileName string) error {
 	f, err := m.lockfreeOpen(fileName)
 	if err != nil {
@@ -115,9 +378,10 @@ func (m *MemMapFs) lockfreeMkdir(name string, perm os.FileMode) error {
 			return ErrFileExists
 		}
 	} else {
-		item := mem.CreateDir(name)
+		item := m.newDir(name, perm)
 		m.getData()[name] = item
 		m.registerWithParent(item)
+		m.watch.notify(name, EventCreate)
 	}
 	return nil
 }
@@ -132,9 +396,14 @@ func (m *MemMapFs) Mkdir(name string, perm os.FileMode) error {
 		return &os.PathError{"mkdir", name, ErrFileExists}
 	} else {
 		m.mu.Lock()
-		item := mem.CreateDir(name)
+		if err := m.lockfreeAccessParent(name); err != nil {
+			m.mu.Unlock()
+			return &os.PathError{Op: "mkdir", Path: name, Err: err}
+		}
+		item := m.newDir(name, perm)
 		m.getData()[name] = item
 		m.registerWithParent(item)
+		m.watch.notify(name, EventCreate)
 		m.mu.Unlock()
 	}
 	return nil
@@ -152,48 +421,94 @@ func (m *MemMapFs) MkdirAll(path string, perm os.FileMode) error {
 	return nil
 }
 
-// Handle some relative paths
+// normalizePath is NormalizePath, with the relative names resolved against
+// the root: the root is the working directory of a MemMapFs, so "." and ""
+// are the root and "a" is "/a".
 func normalizePath(path string) string {
-	path = filepath.Clean(path)
-
-	switch path {
-	case ".":
-		return FilePathSeparator
-	case "..":
-		return FilePathSeparator
-	default:
-		return path
+	path = NormalizePath(path)
+	if filepath.VolumeName(path) == "" && !strings.HasPrefix(path, FilePathSeparator) {
+		path = filepath.Join(FilePathSeparator, path)
 	}
+	return path
 }
 
+// Open opens the named file for reading. Every call returns a new File with
+// its own offset over the shared content, so readers of the same file don't
+// move each other's position.
 func (m *MemMapFs) Open(name string) (File, error) {
-	f, err := m.open(name)
+	f, err := m.open(name, accessRead)
 	if f != nil {
 		return mem.NewReadOnlyFileHandle(f), err
 	}
 	return nil, err
 }
 
-func (m *MemMapFs) openWrite(name string) (File, error) {
-	f, err := m.open(name)
-	if f != nil {
-		return mem.NewFileHandle(f), err
-	}
-	return nil, err
-}
-
-func (m *MemMapFs) open(name string) (*mem.FileData, error) {
+// open returns the file name, checking that the caller may access it as
+// want asks for.
+func (m *MemMapFs) open(name string, want os.FileMode) (*mem.FileData, error) {
 	name = normalizePath(name)
 
 	m.mu.RLock()
-	f, ok := m.getData()[name]
+	f, err := m.lockfreeOpenFollow(name)
+	if err == nil {
+		err = m.lockfreeAccess(f.Name(), want)
+	}
 	m.mu.RUnlock()
-	if !ok {
-		return nil, &os.PathError{"open", name, ErrFileNotFound}
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: name, Err: err}
 	}
 	return f, nil
 }
 
+// maxSymlinkHops limits the number of symlinks followed when resolving a
+// path, beyond that a symlink loop is assumed.
+const maxSymlinkHops = 255
+
+// lockfreeResolve returns the given normalized path with all symlinks in
+// it replaced by their targets. The last element of the path is only
+// resolved if followLast is true.
+func (m *MemMapFs) lockfreeResolve(name string, followLast bool) (string, error) {
+	hops := 0
+	resolved, rest := "", name
+	if strings.HasPrefix(rest, FilePathSeparator) {
+		resolved, rest = FilePathSeparator, rest[1:]
+	}
+	for rest != "" {
+		elem := rest
+		rest = ""
+		if i := strings.Index(elem, FilePathSeparator); i >= 0 {
+			elem, rest = elem[:i], elem[i+1:]
+		}
+		cur := filepath.Join(resolved, elem)
+		f, ok := m.getData()[cur]
+		if !ok || !mem.IsSymlink(f) || (rest == "" && !followLast) {
+			resolved = cur
+			continue
+		}
+		if hops++; hops > maxSymlinkHops {
+			return name, syscall.ELOOP
+		}
+		target := mem.SymlinkTarget(f)
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(resolved, target)
+		}
+		resolved, rest = "", filepath.Join(target, rest)
+		if strings.HasPrefix(rest, FilePathSeparator) {
+			resolved, rest = FilePathSeparator, rest[1:]
+		}
+	}
+	return normalizePath(resolved), nil
+}
+
+// lockfreeOpenFollow is like lockfreeOpen, but follows symlinks.
+func (m *MemMapFs) lockfreeOpenFollow(name string) (*mem.FileData, error) {
+	name, err := m.lockfreeResolve(normalizePath(name), true)
+	if err != nil {
+		return nil, err
+	}
+	return m.lockfreeOpen(name)
+}
+
 func (m *MemMapFs) lockfreeOpen(name string) (*mem.FileData, error) {
 	name = normalizePath(name)
 	f, ok := m.getData()[name]
@@ -204,30 +519,99 @@ func (m *MemMapFs) lockfreeOpen(name string) (*mem.FileData, error) {
 	}
 }
 
+// openFile opens name for OpenFile, handling os.O_CREATE, os.O_EXCL and
+// os.O_TRUNC. The lookup, the creation and the truncation are done under the
+// same lock, so only one caller creates the file, and no one sees it
+// between opening and truncating.
+func (m *MemMapFs) openFile(name string, flag int, perm os.FileMode) (*mem.FileData, error) {
+	name = normalizePath(name)
+	create := flag&os.O_CREATE > 0
+	excl := create && flag&os.O_EXCL > 0
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// like open(2), O_EXCL doesn't follow a symlink as last element
+	resolved, err := m.lockfreeResolve(name, !excl)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: name, Err: err}
+	}
+	if f, ok := m.getData()[resolved]; ok {
+		if excl {
+			return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrExist}
+		}
+		want := accessRead
+		if flag&os.O_WRONLY != 0 {
+			want = accessWrite
+		} else if flag&os.O_RDWR != 0 {
+			want |= accessWrite
+		}
+		if err := m.lockfreeAccess(resolved, want); err != nil {
+			return nil, &os.PathError{Op: "open", Path: name, Err: err}
+		}
+		if flag&os.O_TRUNC > 0 && flag&(os.O_RDWR|os.O_WRONLY) > 0 && !mem.GetFileInfo(f).IsDir() {
+			// resets the data and the mtime under the lock of f
+			if err := mem.Truncate(f, 0); err != nil {
+				return nil, err
+			}
+		}
+		return f, nil
+	}
+	if !create {
+		return nil, &os.PathError{Op: "open", Path: name, Err: ErrFileNotFound}
+	}
+	if err := m.lockfreeAccessParent(resolved); err != nil {
+		return nil, &os.PathError{Op: "open", Path: name, Err: err}
+	}
+	file := m.newFile(resolved)
+	mem.SetMode(file, perm&^os.ModeType)
+	m.getData()[resolved] = file
+	m.registerWithParent(file)
+	m.watch.notify(resolved, EventCreate)
+	return file, nil
+}
+
+// checkOpenFlag rejects the flag combinations listed at OpenFile.
+func checkOpenFlag(name string, flag int) error {
+	write := flag&(os.O_WRONLY|os.O_RDWR) != 0
+	if flag&os.O_WRONLY != 0 && flag&os.O_RDWR != 0 ||
+		flag&os.O_TRUNC != 0 && !write ||
+		flag&os.O_EXCL != 0 && flag&os.O_CREATE == 0 {
+		return &os.PathError{Op: "open", Path: name, Err: os.ErrInvalid}
+	}
+	return nil
+}
+
+// OpenFile opens the named file with the given flags, see os.OpenFile.
+// Combinations of flags which make no sense are rejected with an
+// *os.PathError wrapping os.ErrInvalid:
+//
+//   - os.O_WRONLY together with os.O_RDWR
+//   - os.O_TRUNC without os.O_WRONLY or os.O_RDWR
+//   - os.O_EXCL without os.O_CREATE
+//
+// Like for os.OpenFile, os.O_CREATE and os.O_APPEND are allowed without
+// write access: a missing file is created, but opened for reading only.
 func (m *MemMapFs) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
-	file, err := m.openWrite(name)
-	if os.IsNotExist(err) && (flag&os.O_CREATE > 0) {
-		file, err = m.Create(name)
+	if err := checkOpenFlag(name, flag); err != nil {
+		return nil, err
 	}
+	f, err := m.openFile(name, flag, perm)
 	if err != nil {
 		return nil, err
 	}
-	if flag == os.O_RDONLY {
-		file = mem.NewReadOnlyFileHandle(file.(*mem.File).Data())
-	}
-	if flag&os.O_APPEND > 0 {
-		_, err = file.Seek(0, os.SEEK_END)
-		if err != nil {
-			file.Close()
-			return nil, err
-		}
-	}
-	if flag&os.O_TRUNC > 0 && flag&(os.O_RDWR|os.O_WRONLY) > 0 {
-		err = file.Truncate(0)
+	var file File
+	switch {
+	case flag&(os.O_WRONLY|os.O_RDWR) == 0:
+		file = mem.NewReadOnlyFileHandle(f)
+	case flag&os.O_APPEND > 0:
+		file = mem.NewAppendFileHandle(f)
+		_, err = file.Seek(0, io.SeekEnd)
 		if err != nil {
 			file.Close()
 			return nil, err
 		}
+	default:
+		file = mem.NewFileHandle(f)
 	}
 	return file, nil
 }
@@ -238,12 +622,24 @@ func (m *MemMapFs) Remove(name string) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	if _, ok := m.getData()[name]; ok {
+	name, err := m.lockfreeResolve(name, false)
+	if err != nil {
+		return &os.PathError{Op: "remove", Path: name, Err: err}
+	}
+	if err := m.lockfreeAccessParent(name); err != nil {
+		return &os.PathError{Op: "remove", Path: name, Err: err}
+	}
+	if f, ok := m.getData()[name]; ok {
+		if mem.DirLen(f) > 0 {
+			return &os.PathError{Op: "remove", Path: name, Err: syscall.ENOTEMPTY}
+		}
 		err := m.unRegisterWithParent(name)
 		if err != nil {
 			return &os.PathError{"remove", name, err}
 		}
+		mem.ReleaseData(f)
 		delete(m.getData(), name)
+		m.watch.notify(name, EventRemove)
 	} else {
 		return &os.PathError{"remove", name, os.ErrNotExist}
 	}
@@ -253,17 +649,23 @@ func (m *MemMapFs) Remove(name string) error {
 func (m *MemMapFs) RemoveAll(path string) error {
 	path = normalizePath(path)
 	m.mu.Lock()
+	if err := m.lockfreeAccessParent(path); err != nil {
+		m.mu.Unlock()
+		return &os.PathError{Op: "removeall", Path: path, Err: err}
+	}
 	m.unRegisterWithParent(path)
 	m.mu.Unlock()
 
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	for p, _ := range m.getData() {
-		if strings.HasPrefix(p, path) {
+	for p, f := range m.getData() {
+		if hasPathPrefix(p, []string{path}) {
 			m.mu.RUnlock()
 			m.mu.Lock()
+			mem.ReleaseData(f)
 			delete(m.getData(), p)
+			m.watch.notify(p, EventRemove)
 			m.mu.Unlock()
 			m.mu.RLock()
 		}
@@ -279,62 +681,296 @@ func (m *MemMapFs) Rename(oldname, newname string) error {
 		return nil
 	}
 
-	m.mu.RLock()
-	defer m.mu.RUnlock()
-	if _, ok := m.getData()[oldname]; ok {
-		m.mu.RUnlock()
-		m.mu.Lock()
-		m.unRegisterWithParent(oldname)
-		fileData := m.getData()[oldname]
-		delete(m.getData(), oldname)
-		mem.ChangeFileName(fileData, newname)
-		m.getData()[newname] = fileData
-		m.registerWithParent(fileData)
-		m.mu.Unlock()
-		m.mu.RLock()
-	} else {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var err error
+	if oldname, err = m.lockfreeResolve(oldname, false); err != nil {
+		return &os.PathError{Op: "rename", Path: oldname, Err: err}
+	}
+	if newname, err = m.lockfreeResolve(newname, false); err != nil {
+		return &os.PathError{Op: "rename", Path: newname, Err: err}
+	}
+	if err := m.lockfreeAccessParent(oldname); err != nil {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: err}
+	}
+	if err := m.lockfreeAccessParent(newname); err != nil {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: err}
+	}
+	fileData, ok := m.getData()[oldname]
+	if !ok {
 		return &os.PathError{"rename", oldname, ErrFileNotFound}
 	}
+	if strings.HasPrefix(newname, oldname+FilePathSeparator) {
+		// a directory can't be moved below itself
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: syscall.EINVAL}
+	}
+	replaced, ok := m.getData()[newname]
+	if ok && mem.SameFile(replaced, fileData) {
+		// like rename(2), nothing to do for two links of the same file
+		return nil
+	}
+	if ok {
+		// like rename(2), a directory only replaces an empty directory,
+		// and a file only a file
+		dir, replacedDir := mem.GetFileInfo(fileData).IsDir(), mem.GetFileInfo(replaced).IsDir()
+		switch {
+		case dir && !replacedDir:
+			return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: syscall.ENOTDIR}
+		case !dir && replacedDir:
+			return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: syscall.EISDIR}
+		case dir && mem.DirLen(replaced) > 0:
+			return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: syscall.ENOTEMPTY}
+		}
+	}
+	children := m.lockfreeUnregisterChildren(oldname)
+	m.unRegisterWithParent(oldname)
+	if ok {
+		mem.ReleaseData(replaced)
+	}
+	delete(m.getData(), oldname)
+	mem.ChangeFileName(fileData, newname)
+	m.getData()[newname] = fileData
+	m.registerWithParent(fileData)
+	m.lockfreeMoveChildren(children, oldname, newname)
+	m.watch.notify(oldname, EventRename)
+	m.watch.notify(newname, EventCreate)
 	return nil
 }
 
+// lockfreeUnregisterChildren removes everything below the directory name
+// from its parent directories and returns it, sorted by name.
+func (m *MemMapFs) lockfreeUnregisterChildren(name string) []*mem.FileData {
+	prefix := name + FilePathSeparator
+	if name == FilePathSeparator {
+		prefix = name
+	}
+	var children []*mem.FileData
+	for path, f := range m.getData() {
+		if path != name && strings.HasPrefix(path, prefix) {
+			children = append(children, f)
+		}
+	}
+	sort.Slice(children, func(i, j int) bool { return children[i].Name() < children[j].Name() })
+	for _, f := range children {
+		if parent := m.findParent(f); parent != nil {
+			mem.RemoveFromMemDir(parent, f)
+		}
+	}
+	return children
+}
+
+// lockfreeMoveChildren moves children, as returned by
+// lockfreeUnregisterChildren, from below oldname to below newname.
+func (m *MemMapFs) lockfreeMoveChildren(children []*mem.FileData, oldname, newname string) {
+	for _, f := range children {
+		delete(m.getData(), f.Name())
+		mem.ChangeFileName(f, newname+strings.TrimPrefix(f.Name(), oldname))
+		m.getData()[f.Name()] = f
+	}
+	for _, f := range children {
+		m.registerWithParent(f)
+	}
+}
+
 func (m *MemMapFs) Stat(name string) (os.FileInfo, error) {
-	f, err := m.Open(name)
+	f, err := m.open(name, 0)
 	if err != nil {
 		return nil, err
 	}
-	fi := mem.GetFileInfo(f.(*mem.File).Data())
-	return fi, nil
+	return mem.GetFileInfo(f), nil
 }
 
-func (m *MemMapFs) Chmod(name string, mode os.FileMode) error {
+// Truncate changes the size of the named file, see Truncater.
+func (m *MemMapFs) Truncate(name string, size int64) error {
 	name = normalizePath(name)
-	f, ok := m.getData()[name]
-	if !ok {
-		return &os.PathError{"chmod", name, ErrFileNotFound}
+
+	m.mu.RLock()
+	f, err := m.lockfreeOpenFollow(name)
+	if err == nil {
+		err = m.lockfreeAccess(f.Name(), accessWrite)
 	}
+	m.mu.RUnlock()
+	if err != nil {
+		return &os.PathError{Op: "truncate", Path: name, Err: err}
+	}
+	if mem.GetFileInfo(f).IsDir() {
+		return &os.PathError{Op: "truncate", Path: name, Err: syscall.EISDIR}
+	}
+	if size < 0 {
+		return &os.PathError{Op: "truncate", Path: name, Err: syscall.EINVAL}
+	}
+	return mem.Truncate(f, size)
+}
+
+func (m *MemMapFs) Chmod(name string, mode os.FileMode) error {
+	name = normalizePath(name)
 
 	m.mu.Lock()
-	mem.SetMode(f, mode)
-	m.mu.Unlock()
+	defer m.mu.Unlock()
+	f, err := m.lockfreeOpenFollow(name)
+	if err == nil {
+		err = m.lockfreeAccessOwner(f)
+	}
+	if err != nil {
+		return &os.PathError{Op: "chmod", Path: name, Err: err}
+	}
+	// like os.Chmod, only change the permission bits, not the file type
+	prev := mem.GetFileInfo(f).Mode()
+	mem.SetMode(f, prev&os.ModeType|mode&^os.ModeType)
+	m.watch.notify(f.Name(), EventChmod)
+	return nil
+}
 
+// Chown changes the numeric user and group id of the named file, see
+// Chowner. They can be read back from the Uid and Gid methods of the
+// *mem.FileInfo returned by Stat.
+func (m *MemMapFs) Chown(name string, uid, gid int) error {
+	name = normalizePath(name)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, err := m.lockfreeOpenFollow(name)
+	if err == nil && m.enforce && m.uid != 0 {
+		err = os.ErrPermission
+	}
+	if err != nil {
+		return &os.PathError{Op: "chown", Path: name, Err: err}
+	}
+	mem.SetOwner(f, uid, gid)
+	m.watch.notify(f.Name(), EventChmod)
 	return nil
 }
 
 func (m *MemMapFs) Chtimes(name string, atime time.Time, mtime time.Time) error {
 	name = normalizePath(name)
-	f, ok := m.getData()[name]
-	if !ok {
-		return &os.PathError{"chtimes", name, ErrFileNotFound}
-	}
 
 	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, err := m.lockfreeOpenFollow(name)
+	if err == nil {
+		err = m.lockfreeAccessOwner(f)
+	}
+	if err != nil {
+		return &os.PathError{Op: "chtimes", Path: name, Err: err}
+	}
+	f.Lock()
 	mem.SetModTime(f, mtime)
-	m.mu.Unlock()
+	f.Unlock()
+	m.watch.notify(f.Name(), EventChmod)
+	return nil
+}
 
+// SymlinkIfPossible creates newname as a symbolic link to oldname, see
+// os.Symlink. The target is stored as given and resolved on access.
+func (m *MemMapFs) SymlinkIfPossible(oldname, newname string) error {
+	newname = normalizePath(newname)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	name, err := m.lockfreeResolve(newname, false)
+	if err != nil {
+		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: err}
+	}
+	if _, ok := m.getData()[name]; ok {
+		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: ErrFileExists}
+	}
+	if err := m.lockfreeAccessParent(name); err != nil {
+		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: err}
+	}
+	link := mem.CreateSymlink(name, oldname)
+	mem.SetModTime(link, m.clock.Now())
+	m.getData()[name] = link
+	m.registerWithParent(link)
+	m.watch.notify(name, EventCreate)
+	return nil
+}
+
+// Link creates newname as a hard link to the file oldname, see Linker. The
+// names share the content and the metadata of the file, the data is only
+// released once the last of them is removed. Like on Linux, a symbolic link
+// oldname is linked itself, not the file it points to.
+func (m *MemMapFs) Link(oldname, newname string) error {
+	oldname = normalizePath(oldname)
+	newname = normalizePath(newname)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, err := m.lockfreeOpenNoFollow(oldname)
+	if err != nil {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: err}
+	}
+	if mem.GetFileInfo(f).IsDir() {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: syscall.EPERM}
+	}
+	name, err := m.lockfreeResolve(newname, false)
+	if err != nil {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: err}
+	}
+	if _, ok := m.getData()[name]; ok {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: ErrFileExists}
+	}
+	if err := m.lockfreeAccessParent(name); err != nil {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: err}
+	}
+	if dir, err := m.lockfreeOpen(filepath.Dir(name)); err != nil {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: err}
+	} else if !mem.GetFileInfo(dir).IsDir() {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: syscall.ENOTDIR}
+	}
+	link := mem.Link(f, name)
+	m.getData()[name] = link
+	m.registerWithParent(link)
+	m.watch.notify(name, EventCreate)
 	return nil
 }
 
+// ReadlinkIfPossible returns the target of the named symbolic link, see
+// os.Readlink.
+func (m *MemMapFs) ReadlinkIfPossible(name string) (string, error) {
+	name = normalizePath(name)
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	f, err := m.lockfreeOpenNoFollow(name)
+	if err == nil {
+		err = m.lockfreeAccess(f.Name(), 0)
+	}
+	if err != nil {
+		return "", &os.PathError{Op: "readlink", Path: name, Err: err}
+	}
+	if !mem.IsSymlink(f) {
+		return "", &os.PathError{Op: "readlink", Path: name, Err: syscall.EINVAL}
+	}
+	return mem.SymlinkTarget(f), nil
+}
+
+// LstatIfPossible is like Stat, but does not follow a symbolic link in the
+// last element of the path, see os.Lstat. The returned bool is always true.
+func (m *MemMapFs) LstatIfPossible(name string) (os.FileInfo, bool, error) {
+	name = normalizePath(name)
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	f, err := m.lockfreeOpenNoFollow(name)
+	if err == nil {
+		err = m.lockfreeAccess(f.Name(), 0)
+	}
+	if err != nil {
+		return nil, true, &os.PathError{Op: "lstat", Path: name, Err: err}
+	}
+	return mem.GetFileInfo(f), true, nil
+}
+
+// lockfreeOpenNoFollow is like lockfreeOpen, but follows symlinks in all
+// but the last element of the path.
+func (m *MemMapFs) lockfreeOpenNoFollow(name string) (*mem.FileData, error) {
+	name, err := m.lockfreeResolve(name, false)
+	if err != nil {
+		return nil, err
+	}
+	return m.lockfreeOpen(name)
+}
+
 func (m *MemMapFs) List() {
 	for _, x := range m.data {
 		y := mem.FileInfo{x}
@@ -1,11 +1,22 @@
 package afero
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"reflect"
 	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"testing"
 	"time"
+
+	"github.com/spf13/afero/mem"
 )
 
 func TestNormalizePath(t *testing.T) {
@@ -31,6 +42,76 @@ func TestNormalizePath(t *testing.T) {
 	}
 }
 
+func TestNormalizePathSeparators(t *testing.T) {
+	data := []struct {
+		input    string
+		expected string
+	}{
+		{"", "."},
+		{"/a//b/./c/", filepath.FromSlash("/a/b/c")},
+		{"a/b/../c", filepath.FromSlash("a/c")},
+	}
+	if runtime.GOOS == "windows" {
+		data = append(data, []struct {
+			input    string
+			expected string
+		}{
+			{`C:/dir\sub/`, `C:\dir\sub`},
+			{`\dir/sub\file`, `\dir\sub\file`},
+			{`//host/share/file`, `\\host\share\file`},
+		}...)
+	} else {
+		data = append(data, struct {
+			input    string
+			expected string
+		}{`/dir/back\slash`, `/dir/back\slash`})
+	}
+
+	for _, d := range data {
+		if got := NormalizePath(d.input); got != d.expected {
+			t.Errorf("NormalizePath(%q): got %q, want %q", d.input, got, d.expected)
+		}
+	}
+}
+
+func TestMemMapFsMixedSeparators(t *testing.T) {
+	fs := NewMemMapFs()
+	dir, other := "/dir", "/dir//./sub/.."
+	if runtime.GOOS == "windows" {
+		dir, other = `C:\dir`, `C:/dir/sub\..`
+	}
+	if err := fs.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFile(fs, dir+"/file", []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := fs.Stat(other + "/file"); err != nil {
+		t.Errorf("Stat: %v", err)
+	}
+	f, err := fs.Open(other + string(filepath.Separator) + "file")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if want := filepath.Join(dir, "file"); f.Name() != want {
+		t.Errorf("Name: got %q, want %q", f.Name(), want)
+	}
+	f.Close()
+	if err := fs.Rename(other+"/file", dir+"/renamed"); err != nil {
+		t.Fatalf("Rename: %v", err)
+	}
+	names, _ := ReadDirNames(fs, other)
+	if len(names) != 1 || names[0] != "renamed" {
+		t.Errorf("listing after Rename: got %v, want [renamed]", names)
+	}
+
+	bfs := NewBasePathFs(fs, other)
+	if got, err := ReadFile(bfs, "/renamed"); err != nil || string(got) != "data" {
+		t.Errorf("BasePathFs: %q, %v", got, err)
+	}
+}
+
 func TestPathErrors(t *testing.T) {
 	path := filepath.Join(".", "some", "path")
 	path2 := filepath.Join(".", "different", "path")
@@ -259,3 +340,859 @@ func TestWriteCloseTime(t *testing.T) {
 		}
 	}
 }
+
+func TestMemMapFsLimit(t *testing.T) {
+	fs := NewMemMapFsWithLimit(10)
+	limit := fs.(*MemMapFs).limit
+
+	f, err := fs.Create("/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte("12345678")); err != nil {
+		t.Fatalf("Write within limit: %s", err)
+	}
+	if _, err := f.WriteAt([]byte("abcd"), 0); err != nil {
+		t.Fatalf("overwriting existing data: %s", err)
+	}
+	_, err = f.Write([]byte("too much"))
+	if perr, ok := err.(*os.PathError); !ok || perr.Err != syscall.ENOSPC {
+		t.Fatalf("Write over limit: got %v, want ENOSPC", err)
+	}
+	if err := f.Truncate(20); err == nil {
+		t.Error("Truncate over limit succeeded")
+	}
+	if err := f.Truncate(2); err != nil {
+		t.Fatal(err)
+	}
+	if used := limit.Used(); used != 2 {
+		t.Errorf("used %d bytes after Truncate, want 2", used)
+	}
+	f.Close()
+
+	if err := WriteFile(fs, "/file", []byte("0123456789"), 0644); err != nil {
+		t.Errorf("WriteFile replacing file content: %s", err)
+	}
+	if err := fs.Remove("/file"); err != nil {
+		t.Fatal(err)
+	}
+	if used := limit.Used(); used != 0 {
+		t.Errorf("used %d bytes after Remove, want 0", used)
+	}
+}
+
+func TestMemMapFsLimitConcurrent(t *testing.T) {
+	fs := NewMemMapFsWithLimit(100)
+	var wg sync.WaitGroup
+	var written int64
+	for i := 0; i < 200; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			f, err := fs.Create(fmt.Sprintf("/file%d", i))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer f.Close()
+			if _, err := f.Write([]byte{'x'}); err == nil {
+				atomic.AddInt64(&written, 1)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if written != 100 {
+		t.Errorf("%d writes succeeded, want 100", written)
+	}
+}
+
+func TestMemMapFsRenameDir(t *testing.T) {
+	fs := &MemMapFs{}
+	fs.MkdirAll("/a/b/c", 0755)
+	WriteFile(fs, "/a/b/c/file", []byte("x"), 0644)
+	WriteFile(fs, "/a/top", []byte("y"), 0644)
+
+	if err := fs.Rename("/a", "/z"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"/a", "/a/b", "/a/b/c/file", "/a/top"} {
+		if _, err := fs.Stat(name); !os.IsNotExist(err) {
+			t.Errorf("%s still exists: %v", name, err)
+		}
+	}
+	if data, err := ReadFile(fs, "/z/b/c/file"); err != nil || string(data) != "x" {
+		t.Errorf("got %q, %v", data, err)
+	}
+	names, err := readDirNames(fs, "/z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 2 || names[0] != "b" || names[1] != "top" {
+		t.Errorf("got %v", names)
+	}
+	if names, _ := readDirNames(fs, "/"); len(names) != 1 || names[0] != "z" {
+		t.Errorf("got %v in /", names)
+	}
+}
+
+func TestMemMapFsRenameDeepTree(t *testing.T) {
+	fs := &MemMapFs{}
+	fs.MkdirAll("/data/sub/deeper/deepest", 0755)
+	names := []string{"/data/sub/file.txt", "/data/sub/deeper/file.txt", "/data/sub/deeper/deepest/file.txt"}
+	for _, name := range names {
+		WriteFile(fs, name, []byte(name), 0644)
+	}
+	open, err := fs.OpenFile("/data/sub/deeper/file.txt", os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer open.Close()
+
+	if err := fs.Rename("/data", "/data2"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		moved := "/data2" + strings.TrimPrefix(name, "/data")
+		if _, err := fs.Stat(moved); err != nil {
+			t.Errorf("%s: %v", moved, err)
+		}
+		if _, err := fs.Stat(name); !os.IsNotExist(err) {
+			t.Errorf("%s still exists: %v", name, err)
+		}
+	}
+
+	// the open handle follows the file
+	if _, err := open.WriteString("changed"); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ReadFile(fs, "/data2/sub/deeper/file.txt"); err != nil || !strings.HasPrefix(string(data), "changed") {
+		t.Errorf("Write through an open handle got lost: %q, %v", data, err)
+	}
+	if open.Name() != normalizePath("/data2/sub/deeper/file.txt") {
+		t.Errorf("Open handle has name %q", open.Name())
+	}
+
+	if err := fs.Rename("/data2", "/data2/sub/inside"); err == nil {
+		t.Error("Moved a directory below itself")
+	}
+}
+
+func TestMemMapFsRenameOntoNonEmptyDir(t *testing.T) {
+	fs := &MemMapFs{}
+	WriteFile(fs, "/a/x", []byte("x"), 0644)
+	WriteFile(fs, "/b/y", []byte("y"), 0644)
+	fs.Mkdir("/empty", 0755)
+
+	if err := fs.Rename("/a", "/b"); !errors.Is(err, syscall.ENOTEMPTY) {
+		t.Errorf("Rename onto a non-empty directory: %v", err)
+	}
+	if names, _ := ReadDirNames(fs, "/b"); !reflect.DeepEqual(names, []string{"y"}) {
+		t.Errorf("target changed: %v", names)
+	}
+	if _, err := fs.Stat("/a/x"); err != nil {
+		t.Errorf("source changed: %v", err)
+	}
+
+	// an empty directory is replaced
+	if err := fs.Rename("/a", "/empty"); err != nil {
+		t.Fatal(err)
+	}
+	if names, _ := ReadDirNames(fs, "/empty"); !reflect.DeepEqual(names, []string{"x"}) {
+		t.Errorf("renamed onto an empty directory: %v", names)
+	}
+}
+
+func TestMemMapFsRenameTypeMismatch(t *testing.T) {
+	fs := &MemMapFs{}
+	WriteFile(fs, "/file", []byte("f"), 0644)
+	fs.Mkdir("/dir", 0755)
+
+	if err := fs.Rename("/file", "/dir"); !errors.Is(err, syscall.EISDIR) {
+		t.Errorf("Rename of a file onto a directory: %v", err)
+	}
+	if err := fs.Rename("/dir", "/file"); !errors.Is(err, syscall.ENOTDIR) {
+		t.Errorf("Rename of a directory onto a file: %v", err)
+	}
+	if fi, err := fs.Stat("/dir"); err != nil || !fi.IsDir() {
+		t.Errorf("directory changed: %v, %v", fi, err)
+	}
+	if data, _ := ReadFile(fs, "/file"); string(data) != "f" {
+		t.Errorf("file changed: %q", data)
+	}
+}
+
+func TestMemMapFsOpenFileExcl(t *testing.T) {
+	fs := &MemMapFs{}
+
+	const n = 50
+	var wg sync.WaitGroup
+	var created int32
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			f, err := fs.OpenFile("/lock", os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+			if err != nil {
+				errs <- err
+				return
+			}
+			atomic.AddInt32(&created, 1)
+			f.Close()
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	if created != 1 {
+		t.Errorf("%d goroutines created the file, want 1", created)
+	}
+	for err := range errs {
+		if !os.IsExist(err) {
+			t.Errorf("expected an exist error, got %v", err)
+		}
+		if _, ok := err.(*os.PathError); !ok {
+			t.Errorf("expected a *os.PathError, got %T", err)
+		}
+	}
+
+	fi, err := fs.Stat("/lock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode() != 0600 {
+		t.Errorf("got mode %v, want %v", fi.Mode(), os.FileMode(0600))
+	}
+
+	// without O_EXCL an existing file is opened
+	f, err := fs.OpenFile("/lock", os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+}
+
+func TestMemMapFsOpenFileFlags(t *testing.T) {
+	fs := &MemMapFs{}
+	WriteFile(fs, "/file", []byte("content"), 0644)
+
+	invalid := []int{
+		os.O_WRONLY | os.O_RDWR,
+		os.O_RDONLY | os.O_TRUNC,
+		os.O_RDWR | os.O_EXCL,
+	}
+	for _, flag := range invalid {
+		_, err := fs.OpenFile("/file", flag, 0644)
+		if perr, ok := err.(*os.PathError); !ok || perr.Err != os.ErrInvalid {
+			t.Errorf("flag %#x: got %v, want os.ErrInvalid", flag, err)
+		}
+	}
+	if data, _ := ReadFile(fs, "/file"); string(data) != "content" {
+		t.Errorf("file changed by rejected opens: %q", data)
+	}
+
+	// O_CREATE without write access creates a file opened for reading
+	f, err := fs.OpenFile("/new", os.O_RDONLY|os.O_CREATE, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.Write([]byte("x")); err == nil {
+		t.Error("write to a file opened for reading succeeded")
+	}
+	if ok, _ := Exists(fs, "/new"); !ok {
+		t.Error("file not created")
+	}
+}
+
+func TestMemMapFsEnforcing(t *testing.T) {
+	const uid, gid = 1000, 1000
+	root := NewMemMapFsEnforcing(0, 0)
+	fs := root.(*MemMapFs)
+	fs.MkdirAll("/home/user", 0755)
+	fs.Chown("/home/user", uid, gid)
+	WriteFile(fs, "/secret", []byte("secret"), 0600)
+	WriteFile(fs, "/group", []byte("group"), 0640)
+	fs.Chown("/group", 0, gid)
+	fs.MkdirAll("/locked/dir", 0700)
+	WriteFile(fs, "/locked/dir/file", []byte("x"), 0644)
+
+	// the same files, seen by another user
+	user := &MemMapFs{enforce: true, uid: uid, gid: gid}
+	user.init.Do(func() {})
+	user.data = fs.data
+
+	denied := func(what string, err error) {
+		t.Helper()
+		if !errors.Is(err, os.ErrPermission) {
+			t.Errorf("%s: got %v, want a permission error", what, err)
+		}
+	}
+	_, err := user.Open("/secret")
+	denied("read of a 0600 file of root", err)
+	_, err = user.OpenFile("/group", os.O_WRONLY, 0)
+	denied("write to a 0640 file of the group", err)
+	_, err = user.Stat("/locked/dir/file")
+	denied("stat below a 0700 directory of root", err)
+	denied("create in a directory of root", WriteFile(user, "/new", nil, 0644))
+	denied("remove from a directory of root", user.Remove("/group"))
+	denied("rename in a directory of root", user.Rename("/group", "/home/user/group"))
+	denied("chmod of a file of root", user.Chmod("/group", 0777))
+	denied("chown", user.Chown("/home/user", 0, 0))
+
+	if data, err := ReadFile(user, "/group"); err != nil || string(data) != "group" {
+		t.Errorf("read of a 0640 file of the group: %q, %v", data, err)
+	}
+	if err := WriteFile(user, "/home/user/file", []byte("mine"), 0600); err != nil {
+		t.Fatalf("create in the home directory: %v", err)
+	}
+	fi, err := user.Stat("/home/user/file")
+	if err != nil || fi.(*mem.FileInfo).Uid() != uid || fi.(*mem.FileInfo).Gid() != gid {
+		t.Errorf("new file: %v, %v, want it owned by the user", fi, err)
+	}
+	if err := user.Chmod("/home/user/file", 0000); err != nil {
+		t.Errorf("chmod of an own file: %v", err)
+	}
+	_, err = user.Open("/home/user/file")
+	denied("read of an own 0000 file", err)
+
+	// root may do everything, the default MemMapFs doesn't check
+	if _, err := ReadFile(root, "/home/user/file"); err != nil {
+		t.Errorf("read as root: %v", err)
+	}
+	plain := &MemMapFs{}
+	WriteFile(plain, "/file", nil, 0000)
+	if _, err := plain.Open("/file"); err != nil {
+		t.Errorf("read of a 0000 file without enforcing: %v", err)
+	}
+}
+
+func TestMemFileReadAtWriteAt(t *testing.T) {
+	defer CleanupTempDirs(t)
+	ref, err := NewTempOsBaseFs(t).Create("/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ref.Close()
+	f, err := (&MemMapFs{}).Create("/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	for i, step := range []struct {
+		op   string
+		data string
+		off  int64
+	}{
+		{"write", "0123456789", 0},
+		{"seek", "", 3},
+		{"writeat", "ab", 0},
+		{"read", "xxxx", 0},
+		{"writeat", "tail", 14}, // past EOF, zero filled
+		{"readat", "xxxxxxxxxxxxxxxxxxxx", 0},
+		{"readat", "xxxx", 8},
+		{"readat", "xxxx", 30},
+		{"write", "W", 0},
+		{"readat", "xxxxxxxxxxxxxxxxxx", 0},
+	} {
+		results := make([]string, 2)
+		for j, file := range []File{ref, f} {
+			var n int
+			var err error
+			buf := []byte(step.data)
+			switch step.op {
+			case "write":
+				n, err = file.Write(buf)
+			case "writeat":
+				n, err = file.WriteAt(buf, step.off)
+			case "read":
+				n, err = file.Read(buf)
+			case "readat":
+				n, err = file.ReadAt(buf, step.off)
+			case "seek":
+				_, err = file.Seek(step.off, io.SeekStart)
+			}
+			pos, _ := file.Seek(0, io.SeekCurrent)
+			results[j] = fmt.Sprintf("%q %d %v pos %d", buf[:n], n, err, pos)
+		}
+		if results[0] != results[1] {
+			t.Errorf("%d: %s: got %s, OsFs got %s", i, step.op, results[1], results[0])
+		}
+	}
+}
+
+func TestMemMapFsSetClock(t *testing.T) {
+	fs := &MemMapFs{}
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	fs.SetClock(func() time.Time { return now })
+
+	check := func(name string, want time.Time) {
+		t.Helper()
+		fi, err := fs.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !fi.ModTime().Equal(want) {
+			t.Errorf("%s: got mtime %v, want %v", name, fi.ModTime(), want)
+		}
+	}
+
+	fs.Mkdir("/dir", 0755)
+	f, _ := fs.Create("/dir/file")
+	check("/dir", now)
+	check("/dir/file", now)
+
+	now = now.Add(time.Minute)
+	f.WriteString("data")
+	check("/dir/file", now)
+
+	now = now.Add(time.Minute)
+	f.Close()
+	check("/dir/file", now)
+
+	now = now.Add(time.Minute)
+	fs.Truncate("/dir/file", 1)
+	check("/dir/file", now)
+
+	mtime := now.Add(-time.Hour)
+	fs.Chtimes("/dir/file", mtime, mtime)
+	check("/dir/file", mtime)
+
+	fs.SetClock(nil)
+	WriteFile(fs, "/dir/file", nil, 0644)
+	if fi, _ := fs.Stat("/dir/file"); time.Since(fi.ModTime()) > time.Minute {
+		t.Errorf("mtime %v after restoring time.Now", fi.ModTime())
+	}
+}
+
+func TestMemMapFsLink(t *testing.T) {
+	fs := NewMemMapFsWithLimit(10)
+	linker := fs.(Linker)
+	WriteFile(fs, "/a", []byte("123456"), 0644)
+	if err := linker.Link("/a", "/b"); err != nil {
+		t.Fatal(err)
+	}
+	fs.Mkdir("/dir", 0755)
+	if err := linker.Link("/dir", "/dir2"); err == nil {
+		t.Error("Link of a directory succeeded")
+	}
+	if err := linker.Link("/a", "/a/b"); err == nil {
+		t.Error("Link below a file succeeded")
+	}
+
+	fs.Chmod("/a", 0600)
+	if fi, _ := fs.Stat("/b"); fi.Mode() != 0600 {
+		t.Errorf("mode through the link: got %v, want %v", fi.Mode(), os.FileMode(0600))
+	}
+	if fi, _ := fs.Stat("/b"); fi.Name() != "b" {
+		t.Errorf("Stat of the link: got name %q", fi.Name())
+	}
+
+	// the data is counted once, and only released with the last name
+	if err := WriteFile(fs, "/c", []byte("1234"), 0644); err != nil {
+		t.Fatalf("writing within the limit: %v", err)
+	}
+	fs.Remove("/c")
+	fs.Remove("/a")
+	if err := WriteFile(fs, "/c", []byte("123456"), 0644); err == nil {
+		t.Error("the data of a removed name with a remaining link was released")
+	}
+	fs.Remove("/b")
+	if err := WriteFile(fs, "/c", []byte("123456"), 0644); err != nil {
+		t.Errorf("the data of the last removed name wasn't released: %v", err)
+	}
+
+	// Create truncates the shared file, Rename onto a link does nothing
+	linker.Link("/c", "/d")
+	f, _ := fs.Create("/d")
+	f.WriteString("new")
+	f.Close()
+	if got, _ := ReadFile(fs, "/c"); string(got) != "new" {
+		t.Errorf("Create through the link: got %q, want %q", got, "new")
+	}
+	if err := fs.Rename("/c", "/d"); err != nil {
+		t.Fatal(err)
+	}
+	names, _ := ReadDirNames(fs, "/")
+	if want := []string{"c", "d", "dir"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("after Rename onto a link: got %v, want %v", names, want)
+	}
+}
+
+func TestMemMapFsOpenTruncConcurrent(t *testing.T) {
+	fs := &MemMapFs{}
+	const size = 1024
+	WriteFile(fs, "/file", bytes.Repeat([]byte{'a'}, size), 0644)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 500; i++ {
+			f, err := fs.OpenFile("/file", os.O_WRONLY|os.O_TRUNC, 0)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			f.Write(bytes.Repeat([]byte{byte('a' + i%26)}, size))
+			f.Close()
+		}
+	}()
+
+	f, err := fs.Open("/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	buf := make([]byte, 2*size)
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		n, _ := f.ReadAt(buf, 0)
+		if n != 0 && n != size {
+			t.Fatalf("read %d bytes, want 0 or %d", n, size)
+		}
+		if n > 0 && !bytes.Equal(buf[:n], bytes.Repeat(buf[:1], n)) {
+			t.Fatalf("read mixed content %q", buf[:n])
+		}
+		fi, err := fs.Stat("/file")
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the FileInfo is live, read the size once
+		if got := fi.Size(); got != 0 && got != size {
+			t.Fatalf("Stat: size %d, want 0 or %d", got, size)
+		}
+	}
+}
+
+func TestMemMapFsConcurrentReadWrite(t *testing.T) {
+	fs := NewMemMapFs()
+	fs.MkdirAll("/data", 0755)
+	WriteFile(fs, "/data/file", []byte("content"), 0644)
+
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			buf := make([]byte, 7)
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				if fi, err := fs.Stat("/data/file"); err == nil {
+					fi.Mode()
+					fi.ModTime()
+					fi.Size()
+				}
+				if f, err := fs.Open("/data/file"); err == nil {
+					f.ReadAt(buf, 0)
+					f.Close()
+				}
+				ReadDirNames(fs, "/data")
+			}
+		}()
+	}
+	for i := 0; i < 200; i++ {
+		name := fmt.Sprintf("/data/tmp%d", i%5)
+		WriteFile(fs, name, []byte("tmp"), 0644)
+		fs.Chmod("/data/file", os.FileMode(0600+i%2))
+		fs.Chtimes("/data/file", time.Now(), time.Now())
+		f, _ := fs.OpenFile("/data/file", os.O_WRONLY, 0)
+		f.WriteAt([]byte("CONTENT"), 0)
+		f.Close()
+		fs.Rename(name, name+".old")
+		fs.Remove(name + ".old")
+	}
+	close(done)
+	wg.Wait()
+}
+
+// TestMemMapFsIndependentReaders reads the same file through two handles at
+// once, each from its own offset.
+func TestMemMapFsIndependentReaders(t *testing.T) {
+	fs := NewMemMapFs()
+	content := make([]byte, 64*1024)
+	for i := range content {
+		content[i] = byte(i % 251)
+	}
+	WriteFile(fs, "/file", content, 0644)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 2)
+	for _, start := range []int64{0, int64(len(content)) / 2} {
+		f, err := fs.Open("/file")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Seek(start, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		wg.Add(1)
+		go func(f File, start int64) {
+			defer wg.Done()
+			defer f.Close()
+			buf := make([]byte, 100)
+			for off := start; off < int64(len(content)); off += int64(len(buf)) {
+				n, err := f.Read(buf)
+				if err != nil && err != io.EOF {
+					errs <- err
+					return
+				}
+				if !bytes.Equal(buf[:n], content[off:off+int64(n)]) {
+					errs <- fmt.Errorf("reader from %d: wrong data at %d", start, off)
+					return
+				}
+			}
+		}(f, start)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+// BenchmarkMemMapFsConcurrentRead measures the throughput of readers of the
+// same files and directory, which must not serialize each other.
+func BenchmarkMemMapFsConcurrentRead(b *testing.B) {
+	fs := NewMemMapFs()
+	fs.MkdirAll("/data", 0755)
+	for i := 0; i < 10; i++ {
+		WriteFile(fs, fmt.Sprintf("/data/file%d", i), bytes.Repeat([]byte("x"), 4096), 0644)
+	}
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		buf := make([]byte, 4096)
+		i := 0
+		for pb.Next() {
+			name := fmt.Sprintf("/data/file%d", i%10)
+			i++
+			if _, err := fs.Stat(name); err != nil {
+				b.Fatal(err)
+			}
+			f, err := fs.Open(name)
+			if err != nil {
+				b.Fatal(err)
+			}
+			f.ReadAt(buf, 0)
+			f.Close()
+			if i%10 == 0 {
+				ReadDirNames(fs, "/data")
+			}
+		}
+	})
+}
+
+func TestMemMapFsSnapshot(t *testing.T) {
+	fs := NewMemMapFs().(*MemMapFs)
+	fs.MkdirAll("/app/logs", 0755)
+	WriteFile(fs, "/app/config", []byte("v1"), 0600)
+	fs.Link("/app/config", "/app/config.link")
+
+	// a write through an open file is in the snapshot without Sync
+	f, _ := fs.OpenFile("/app/logs/log", os.O_CREATE|os.O_WRONLY, 0644)
+	defer f.Close()
+	f.WriteString("line 1\n")
+
+	snap := fs.Snapshot().Fs()
+	f.WriteString("line 2\n")
+	WriteFile(fs, "/app/config", []byte("v2"), 0600)
+	fs.Remove("/app/config.link")
+
+	if got, _ := ReadFile(snap, "/app/logs/log"); string(got) != "line 1\n" {
+		t.Errorf("log in the snapshot: got %q", got)
+	}
+	if got, _ := ReadFile(snap, "/app/config"); string(got) != "v1" {
+		t.Errorf("config in the snapshot: got %q", got)
+	}
+	names, _ := ReadDirNames(snap, "/app")
+	if want := []string{"config", "config.link", "logs"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("snapshot listing: got %v, want %v", names, want)
+	}
+	// the snapshot can't be changed
+	if err := WriteFile(snap, "/app/config.link", []byte("v3"), 0600); err == nil {
+		t.Error("wrote to the snapshot")
+	}
+	if got, _ := ReadFile(snap, "/app/config"); string(got) != "v1" {
+		t.Errorf("config in the snapshot after a write: got %q", got)
+	}
+
+	dir, err := TempDir(NewOsFs(), "", "afero-snapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := CopyDir(snap, "/app", NewOsFs(), filepath.Join(dir, "app"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(dir, "app", "logs", "log")); string(got) != "line 1\n" {
+		t.Errorf("log on disk: got %q", got)
+	}
+	if fi, err := os.Stat(filepath.Join(dir, "app", "config")); err != nil || fi.Mode().Perm() != 0600 {
+		t.Errorf("config on disk: %v, %v", fi, err)
+	}
+}
+
+func TestMemMapFsRestore(t *testing.T) {
+	fs := NewMemMapFsWithLimit(100).(*MemMapFs)
+	fs.MkdirAll("/app", 0755)
+	WriteFile(fs, "/app/config", []byte("default"), 0644)
+	fs.Link("/app/config", "/app/config.link")
+	snap := fs.Snapshot()
+
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{"/app/config", "first"},
+		{"/app/config.link", "second"},
+		{"/app/other", "third"},
+	}
+	for _, tt := range tests {
+		fs.Restore(snap)
+		if got, _ := ReadFile(fs, "/app/config"); string(got) != "default" {
+			t.Errorf("%s: config after Restore: got %q", tt.name, got)
+		}
+		if ok, _ := Exists(fs, "/app/other"); ok {
+			t.Errorf("%s: file created before Restore still exists", tt.name)
+		}
+		if err := WriteFile(fs, tt.name, []byte(tt.value), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the links are restored, and the snapshot is not changed through them
+	fs.Restore(snap)
+	WriteFile(fs, "/app/config.link", []byte("changed"), 0644)
+	if got, _ := ReadFile(fs, "/app/config"); string(got) != "changed" {
+		t.Errorf("restored link: got %q", got)
+	}
+	if got, _ := ReadFile(snap.Fs(), "/app/config"); string(got) != "default" {
+		t.Errorf("snapshot changed by writing after Restore: got %q", got)
+	}
+
+	// the limit counts the restored files once, and only those
+	fs.Restore(snap)
+	if used := fs.limit.Used(); used != int64(len("default")) {
+		t.Errorf("limit used after Restore: %d", used)
+	}
+}
+
+func TestMemMapFsReaddirChanging(t *testing.T) {
+	fs := NewMemMapFs()
+	for i := 0; i < 4; i++ {
+		WriteFile(fs, fmt.Sprintf("/dir/%d", i), nil, 0644)
+	}
+	f, err := fs.Open("/dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	first, _ := f.Readdirnames(3)
+	// entries removed while reading don't make the next call fail or repeat
+	for _, name := range first {
+		fs.Remove(filepath.Join("/dir", name))
+	}
+	rest, err := f.Readdirnames(3)
+	if err != nil || !reflect.DeepEqual(rest, []string{"3"}) {
+		t.Errorf("after removing entries: %v, %v", rest, err)
+	}
+	f.Close()
+	if _, err := f.Readdir(1); err == nil {
+		t.Error("Readdir on a closed file: expected an error")
+	}
+}
+
+func TestMemMapFsSparseTruncate(t *testing.T) {
+	fs := NewMemMapFs()
+	f, err := fs.Create("/sparse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	const size = 10 << 30
+	if err := f.Truncate(size); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt([]byte("end"), size-3); err != nil {
+		t.Fatal(err)
+	}
+	runtime.ReadMemStats(&after)
+	if grown := int64(after.HeapAlloc) - int64(before.HeapAlloc); grown > 16<<20 {
+		t.Errorf("truncating to %d bytes allocated %d bytes", size, grown)
+	}
+
+	if fi, _ := fs.Stat("/sparse"); fi.Size() != size {
+		t.Errorf("size: got %d, want %d", fi.Size(), size)
+	}
+	buf := make([]byte, 4096)
+	if _, err := f.ReadAt(buf, size/2); err != nil || !bytes.Equal(buf, make([]byte, 4096)) {
+		t.Errorf("read of the hole: %v, non-zero bytes: %v", err, !bytes.Equal(buf, make([]byte, 4096)))
+	}
+	if n, err := f.ReadAt(buf, size-5); n != 5 || err != io.EOF || string(buf[:5]) != "\x00\x00end" {
+		t.Errorf("read at the end: %q, %v", buf[:n], err)
+	}
+}
+
+// TestMemMapFsSparseContent checks the sparse file data against a plain
+// byte slice, with writes and truncates across the chunk boundaries.
+func TestMemMapFsSparseContent(t *testing.T) {
+	fs := NewMemMapFs()
+	f, _ := fs.Create("/file")
+	defer f.Close()
+	var want []byte
+	ops := []struct {
+		truncate bool
+		off, len int64
+	}{
+		{false, 0, 100},
+		{false, 200 << 10, 10},        // leaves a hole
+		{false, 64<<10 - 5, 10},       // across a chunk boundary
+		{true, 64<<10 + 2, 0},         // into the middle of a chunk
+		{false, 70 << 10, 3},          // extends it again, reads zeros between
+		{true, 10, 0},                 // shrinks to the first chunk
+		{true, 300 << 10, 0},          // grows with a hole
+		{false, 5, 64 << 10},          // fills a chunk and more
+		{false, 300<<10 - 1, 1 << 10}, // appends at the end
+	}
+	for i, op := range ops {
+		if op.truncate {
+			if err := f.Truncate(op.off); err != nil {
+				t.Fatal(err)
+			}
+			if int64(len(want)) > op.off {
+				want = want[:op.off]
+			} else {
+				want = append(want, make([]byte, op.off-int64(len(want)))...)
+			}
+		} else {
+			data := bytes.Repeat([]byte{byte('a' + i)}, int(op.len))
+			if _, err := f.WriteAt(data, op.off); err != nil {
+				t.Fatal(err)
+			}
+			if end := op.off + op.len; end > int64(len(want)) {
+				want = append(want, make([]byte, end-int64(len(want)))...)
+			}
+			copy(want[op.off:], data)
+		}
+		got, err := ReadFile(fs, "/file")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Fatalf("after op %d: content differs, got %d bytes, want %d", i, len(got), len(want))
+		}
+	}
+}
@@ -0,0 +1,299 @@
+package afero
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MirrorMode tells a MirrorFs when to replicate changes to the mirrors.
+type MirrorMode int
+
+const (
+	// MirrorSync replicates a change before the call making it returns.
+	MirrorSync MirrorMode = iota
+	// MirrorAsync replicates changes in the background, in the order they
+	// were made.
+	MirrorAsync
+)
+
+// MirrorError is the error of replicating a change to the mirrors of a
+// MirrorFs, holding the errors of the mirrors which failed.
+type MirrorError struct {
+	Op   string
+	Path string
+	Errs []error
+}
+
+func (e *MirrorError) Error() string {
+	msgs := make([]string, len(e.Errs))
+	for i, err := range e.Errs {
+		msgs[i] = err.Error()
+	}
+	return fmt.Sprintf("mirror %s %s: %s", e.Op, e.Path, strings.Join(msgs, "; "))
+}
+
+func (e *MirrorError) Unwrap() []error {
+	return e.Errs
+}
+
+// The MirrorFs reads from the primary Fs and makes all changes there, which
+// are replicated to the mirrors, e.g. to keep a MemMapFs copy of an OsFs. A
+// change failing on the primary is not replicated. Mkdir, MkdirAll, Remove,
+// RemoveAll, Rename, Chmod and Chtimes are replicated as they are. Files
+// are replicated by writing their content to the mirrors as a whole: when
+// they are created or truncated, and when a file written is closed or
+// synced.
+//
+// In MirrorSync mode, the default, a change failing on some mirrors returns
+// a *MirrorError, although the change was made on the primary. In
+// MirrorAsync mode the changes are queued and replicated by a background
+// goroutine, the errors are passed to the handler set with OnError, if any;
+// Wait waits for the queue to drain.
+type MirrorFs struct {
+	primary Fs
+	mirrors []Fs
+
+	mu      sync.Mutex
+	mode    MirrorMode
+	onError func(*MirrorError)
+	queue   chan func()
+	pending sync.WaitGroup
+}
+
+func NewMirrorFs(primary Fs, mirrors ...Fs) *MirrorFs {
+	return &MirrorFs{primary: primary, mirrors: mirrors}
+}
+
+// SetMode sets the replication mode, it should be called before changes
+// are made.
+func (m *MirrorFs) SetMode(mode MirrorMode) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.mode = mode
+	if mode == MirrorAsync && m.queue == nil {
+		m.queue = make(chan func(), 64)
+		go func() {
+			for fn := range m.queue {
+				fn()
+				m.pending.Done()
+			}
+		}()
+	}
+}
+
+// OnError sets the handler of replication errors in MirrorAsync mode. It is
+// called from the background goroutine, one error at a time.
+func (m *MirrorFs) OnError(fn func(*MirrorError)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onError = fn
+}
+
+// Wait blocks until all changes queued in MirrorAsync mode are replicated.
+func (m *MirrorFs) Wait() {
+	m.pending.Wait()
+}
+
+// replicate calls fn for every mirror. In MirrorSync mode the errors are
+// returned as a *MirrorError, in MirrorAsync mode fn is called later and
+// nil is returned.
+func (m *MirrorFs) replicate(op, path string, fn func(mirror Fs) error) error {
+	run := func() *MirrorError {
+		var errs []error
+		for _, mirror := range m.mirrors {
+			if err := fn(mirror); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		if errs == nil {
+			return nil
+		}
+		return &MirrorError{Op: op, Path: path, Errs: errs}
+	}
+
+	m.mu.Lock()
+	async := m.mode == MirrorAsync
+	m.mu.Unlock()
+	if !async {
+		if err := run(); err != nil {
+			return err
+		}
+		return nil
+	}
+	m.pending.Add(1)
+	m.queue <- func() {
+		if err := run(); err != nil {
+			m.mu.Lock()
+			onError := m.onError
+			m.mu.Unlock()
+			if onError != nil {
+				onError(err)
+			}
+		}
+	}
+	return nil
+}
+
+// replicateFile writes the content of name in the primary to the mirrors.
+func (m *MirrorFs) replicateFile(name string) error {
+	fi, err := m.primary.Stat(name)
+	if err != nil {
+		return err
+	}
+	data, err := ReadFile(m.primary, name)
+	if err != nil {
+		return err
+	}
+	return m.replicate("write", name, func(mirror Fs) error {
+		return WriteFile(mirror, name, data, fi.Mode().Perm())
+	})
+}
+
+func (m *MirrorFs) Name() string {
+	return "MirrorFs"
+}
+
+func (m *MirrorFs) Create(name string) (File, error) {
+	return m.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+func (m *MirrorFs) Open(name string) (File, error) {
+	return m.primary.Open(name)
+}
+
+func (m *MirrorFs) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	f, err := m.primary.OpenFile(name, flag, perm)
+	if err != nil || flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) == 0 {
+		return f, err
+	}
+	// a created or truncated file is replicated right away, even if it is
+	// never written
+	if flag&(os.O_CREATE|os.O_TRUNC) != 0 {
+		if err := m.replicateFile(name); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	return &mirrorFile{File: f, fs: m, name: name}, nil
+}
+
+func (m *MirrorFs) Mkdir(name string, perm os.FileMode) error {
+	if err := m.primary.Mkdir(name, perm); err != nil {
+		return err
+	}
+	return m.replicate("mkdir", name, func(mirror Fs) error {
+		return mirror.Mkdir(name, perm)
+	})
+}
+
+func (m *MirrorFs) MkdirAll(path string, perm os.FileMode) error {
+	if err := m.primary.MkdirAll(path, perm); err != nil {
+		return err
+	}
+	return m.replicate("mkdirall", path, func(mirror Fs) error {
+		return mirror.MkdirAll(path, perm)
+	})
+}
+
+func (m *MirrorFs) Remove(name string) error {
+	if err := m.primary.Remove(name); err != nil {
+		return err
+	}
+	return m.replicate("remove", name, func(mirror Fs) error {
+		return mirror.Remove(name)
+	})
+}
+
+func (m *MirrorFs) RemoveAll(path string) error {
+	if err := m.primary.RemoveAll(path); err != nil {
+		return err
+	}
+	return m.replicate("removeall", path, func(mirror Fs) error {
+		return mirror.RemoveAll(path)
+	})
+}
+
+func (m *MirrorFs) Rename(oldname, newname string) error {
+	if err := m.primary.Rename(oldname, newname); err != nil {
+		return err
+	}
+	return m.replicate("rename", oldname, func(mirror Fs) error {
+		return mirror.Rename(oldname, newname)
+	})
+}
+
+func (m *MirrorFs) Stat(name string) (os.FileInfo, error) {
+	return m.primary.Stat(name)
+}
+
+func (m *MirrorFs) Chmod(name string, mode os.FileMode) error {
+	if err := m.primary.Chmod(name, mode); err != nil {
+		return err
+	}
+	return m.replicate("chmod", name, func(mirror Fs) error {
+		return mirror.Chmod(name, mode)
+	})
+}
+
+func (m *MirrorFs) Chtimes(name string, atime, mtime time.Time) error {
+	if err := m.primary.Chtimes(name, atime, mtime); err != nil {
+		return err
+	}
+	return m.replicate("chtimes", name, func(mirror Fs) error {
+		return mirror.Chtimes(name, atime, mtime)
+	})
+}
+
+// mirrorFile is a file of the primary opened for writing, its content is
+// replicated on Sync and Close if it was changed.
+type mirrorFile struct {
+	File
+	fs    *MirrorFs
+	name  string
+	dirty bool
+}
+
+func (f *mirrorFile) Write(p []byte) (int, error) {
+	f.dirty = true
+	return f.File.Write(p)
+}
+
+func (f *mirrorFile) WriteAt(p []byte, off int64) (int, error) {
+	f.dirty = true
+	return f.File.WriteAt(p, off)
+}
+
+func (f *mirrorFile) WriteString(s string) (int, error) {
+	f.dirty = true
+	return f.File.WriteString(s)
+}
+
+func (f *mirrorFile) Truncate(size int64) error {
+	f.dirty = true
+	return f.File.Truncate(size)
+}
+
+func (f *mirrorFile) Sync() error {
+	if err := f.File.Sync(); err != nil {
+		return err
+	}
+	return f.replicate()
+}
+
+func (f *mirrorFile) Close() error {
+	if err := f.File.Close(); err != nil {
+		return err
+	}
+	return f.replicate()
+}
+
+func (f *mirrorFile) replicate() error {
+	if !f.dirty {
+		return nil
+	}
+	f.dirty = false
+	return f.fs.replicateFile(f.name)
+}
@@ -0,0 +1,120 @@
+package afero
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"sync"
+	"syscall"
+	"testing"
+)
+
+// checkMirrored compares the files of the mirrors with those of primary.
+func checkMirrored(t *testing.T, primary Fs, mirrors ...Fs) {
+	t.Helper()
+	want := map[string]string{}
+	Walk(primary, "/", func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			data, _ := ReadFile(primary, path)
+			want[path] = string(data)
+		}
+		return nil
+	})
+	for _, mirror := range mirrors {
+		got := map[string]string{}
+		Walk(mirror, "/", func(path string, info os.FileInfo, err error) error {
+			if err == nil && !info.IsDir() {
+				data, _ := ReadFile(mirror, path)
+				got[path] = string(data)
+			}
+			return nil
+		})
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("mirror has %q, want %q", got, want)
+		}
+	}
+}
+
+func changeMirrorFs(t *testing.T, fs Fs) {
+	if err := fs.MkdirAll("/a/b", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFile(fs, "/a/b/file", []byte("content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := fs.OpenFile("/a/b/file", os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(" appended")
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	WriteFile(fs, "/a/gone", []byte("x"), 0644)
+	if err := fs.Remove("/a/gone"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Rename("/a/b/file", "/a/moved"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Create("/a/empty"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMirrorFs(t *testing.T) {
+	primary, m1, m2 := NewMemMapFs(), NewMemMapFs(), NewMemMapFs()
+	fs := NewMirrorFs(primary, m1, m2)
+	changeMirrorFs(t, fs)
+	// the file created last is not closed, but replicated as empty
+	if ok, _ := Exists(m1, "/a/empty"); !ok {
+		t.Error("created file not replicated")
+	}
+	checkMirrored(t, primary, m1, m2)
+
+	// changes failing on the primary are not replicated
+	if err := fs.Remove("/missing"); !os.IsNotExist(err) {
+		t.Errorf("remove of a missing file: %v", err)
+	}
+}
+
+func TestMirrorFsAsync(t *testing.T) {
+	primary, mirror := NewMemMapFs(), NewMemMapFs()
+	fs := NewMirrorFs(primary, mirror)
+	fs.SetMode(MirrorAsync)
+	changeMirrorFs(t, fs)
+	fs.Wait()
+	checkMirrored(t, primary, mirror)
+}
+
+func TestMirrorFsErrors(t *testing.T) {
+	faulty := NewFaultFs(NewMemMapFs())
+	faulty.FailOn("mkdir", "/dir", syscall.EIO)
+	fs := NewMirrorFs(NewMemMapFs(), NewMemMapFs(), faulty)
+
+	err := fs.Mkdir("/dir", 0755)
+	var merr *MirrorError
+	if !errors.As(err, &merr) || len(merr.Errs) != 1 || !errors.Is(err, syscall.EIO) {
+		t.Fatalf("mirror failure: got %v", err)
+	}
+	if ok, _ := DirExists(fs, "/dir"); !ok {
+		t.Error("change not made on the primary")
+	}
+
+	var mu sync.Mutex
+	var reported []*MirrorError
+	fs.SetMode(MirrorAsync)
+	fs.OnError(func(err *MirrorError) {
+		mu.Lock()
+		reported = append(reported, err)
+		mu.Unlock()
+	})
+	faulty.FailOn("chmod", "/dir", syscall.EIO)
+	if err := fs.Chmod("/dir", 0700); err != nil {
+		t.Errorf("async chmod: %v", err)
+	}
+	fs.Wait()
+	if len(reported) != 1 || reported[0].Op != "chmod" {
+		t.Errorf("reported errors: %v", reported)
+	}
+}
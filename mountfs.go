@@ -0,0 +1,136 @@
+package afero
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// The MountFs presents several file systems in a single namespace. Each Fs
+// is mounted at a path prefix, an operation is passed to the Fs with the
+// longest prefix matching the file name, with the name rewritten relative
+// to that prefix: with an Fs mounted at /data, "/data/file" is "/file" in
+// it. Names outside of all mount points go to the root Fs.
+//
+// To serve a directory of the operating system, mount a BasePathFs on an
+// OsFs. Mount points are not listed in the directories of the Fs they are
+// mounted on, unless a directory of that name exists there. Renaming across
+// mount points fails with syscall.EXDEV, like on the operating system.
+//
+// Like the BasePathFs, it does not clean the error messages on return, so
+// they contain the names within the mounted file systems.
+type MountFs struct {
+	mu     sync.RWMutex
+	mounts map[string]Fs
+}
+
+// NewMountFs returns a MountFs with root mounted at "/". If root is nil,
+// only the names below mount points exist.
+func NewMountFs(root Fs) *MountFs {
+	if root == nil {
+		root = NewReadOnlyFs(NewMemMapFs())
+	}
+	return &MountFs{mounts: map[string]Fs{mountPath("/"): root}}
+}
+
+func mountPath(name string) string {
+	return filepath.Join(string(filepath.Separator), name)
+}
+
+// Mount mounts fs at prefix, replacing the Fs mounted there before.
+func (m *MountFs) Mount(prefix string, fs Fs) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.mounts[mountPath(prefix)] = fs
+}
+
+// Unmount removes the Fs mounted at prefix. The root can't be unmounted,
+// only replaced with Mount.
+func (m *MountFs) Unmount(prefix string) {
+	prefix = mountPath(prefix)
+	if prefix == mountPath("/") {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.mounts, prefix)
+}
+
+// resolve returns the Fs name is mounted on, its mount point and the name
+// within that Fs.
+func (m *MountFs) resolve(name string) (fs Fs, prefix, rel string) {
+	name = mountPath(name)
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for p := name; ; p = filepath.Dir(p) {
+		if fs, ok := m.mounts[p]; ok {
+			return fs, p, mountPath(strings.TrimPrefix(name, p))
+		}
+	}
+}
+
+func (m *MountFs) Name() string {
+	return "MountFs"
+}
+
+func (m *MountFs) Create(name string) (File, error) {
+	fs, _, rel := m.resolve(name)
+	return fs.Create(rel)
+}
+
+func (m *MountFs) Open(name string) (File, error) {
+	fs, _, rel := m.resolve(name)
+	return fs.Open(rel)
+}
+
+func (m *MountFs) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	fs, _, rel := m.resolve(name)
+	return fs.OpenFile(rel, flag, perm)
+}
+
+func (m *MountFs) Mkdir(name string, perm os.FileMode) error {
+	fs, _, rel := m.resolve(name)
+	return fs.Mkdir(rel, perm)
+}
+
+func (m *MountFs) MkdirAll(path string, perm os.FileMode) error {
+	fs, _, rel := m.resolve(path)
+	return fs.MkdirAll(rel, perm)
+}
+
+func (m *MountFs) Remove(name string) error {
+	fs, _, rel := m.resolve(name)
+	return fs.Remove(rel)
+}
+
+func (m *MountFs) RemoveAll(path string) error {
+	fs, _, rel := m.resolve(path)
+	return fs.RemoveAll(rel)
+}
+
+func (m *MountFs) Rename(oldname, newname string) error {
+	oldFs, oldPrefix, oldRel := m.resolve(oldname)
+	_, newPrefix, newRel := m.resolve(newname)
+	if oldPrefix != newPrefix {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: syscall.EXDEV}
+	}
+	return oldFs.Rename(oldRel, newRel)
+}
+
+func (m *MountFs) Stat(name string) (os.FileInfo, error) {
+	fs, _, rel := m.resolve(name)
+	return fs.Stat(rel)
+}
+
+func (m *MountFs) Chmod(name string, mode os.FileMode) error {
+	fs, _, rel := m.resolve(name)
+	return fs.Chmod(rel, mode)
+}
+
+func (m *MountFs) Chtimes(name string, atime, mtime time.Time) error {
+	fs, _, rel := m.resolve(name)
+	return fs.Chtimes(rel, atime, mtime)
+}
@@ -0,0 +1,80 @@
+package afero
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestMountFs(t *testing.T) {
+	defer CleanupTempDirs(t)
+	root := &MemMapFs{}
+	data := NewTempOsBaseFs(t)
+	mem := &MemMapFs{}
+	deep := &MemMapFs{}
+
+	fs := NewMountFs(root)
+	fs.Mount("/data", data)
+	fs.Mount("mem/", mem)
+	fs.Mount("/mem/deep", deep)
+
+	for name, want := range map[string]Fs{
+		"/root.txt":           root,
+		"/database.txt":       root,
+		"/data/file.txt":      data,
+		"/mem/file.txt":       mem,
+		"/mem/deeper.txt":     mem,
+		"/mem/deep/file.txt":  deep,
+		"/mem/./deep/../x.md": mem,
+	} {
+		if err := fs.MkdirAll(filepath.Dir(name), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := WriteFile(fs, name, []byte(name), 0644); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		got, _, rel := fs.resolve(name)
+		if got != want {
+			t.Errorf("%s: written to the wrong Fs", name)
+		}
+		if data, err := ReadFile(want, rel); err != nil || string(data) != name {
+			t.Errorf("%s: got %q, %v in the mounted Fs", name, data, err)
+		}
+	}
+	if _, err := mem.Stat("/deep/file.txt"); err == nil {
+		t.Error("File written to the shorter mount point")
+	}
+
+	if err := fs.Rename("/mem/file.txt", "/mem/moved.txt"); err != nil {
+		t.Errorf("Rename within a mount point: %v", err)
+	}
+	if _, err := mem.Stat("/moved.txt"); err != nil {
+		t.Errorf("Rename within a mount point: %v", err)
+	}
+	err := fs.Rename("/data/file.txt", "/mem/file.txt")
+	if !errors.Is(err, syscall.EXDEV) {
+		t.Errorf("Expected EXDEV renaming across mount points, got %v", err)
+	}
+
+	fs.Unmount("/mem/deep")
+	if _, err := fs.Stat("/mem/deep/file.txt"); !os.IsNotExist(err) {
+		t.Errorf("Expected the unmounted file to be gone, got %v", err)
+	}
+}
+
+func TestMountFsNilRoot(t *testing.T) {
+	fs := NewMountFs(nil)
+	fs.Mount("/mem", &MemMapFs{})
+
+	if err := WriteFile(fs, "/mem/file", nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFile(fs, "/file", nil, 0644); err == nil {
+		t.Error("Created a file outside of the mount points")
+	}
+	if _, err := fs.Stat("/other"); !os.IsNotExist(err) {
+		t.Errorf("Expected a not exist error, got %v", err)
+	}
+}
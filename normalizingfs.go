@@ -0,0 +1,198 @@
+package afero
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"time"
+)
+
+// The NormalizingFs passes all calls to the base Fs, but translates the
+// errors it returns, and those of the files it returns, to a canonical form,
+// so they can be checked the same way whatever the backend:
+//
+//	error matching (errors.Is)          returned as
+//	os.ErrNotExist, syscall.ENOENT      &os.PathError{Err: os.ErrNotExist}
+//	os.ErrExist, syscall.EEXIST         &os.PathError{Err: os.ErrExist}
+//	os.ErrPermission, syscall.EACCES,   &os.PathError{Err: os.ErrPermission}
+//	syscall.EPERM, syscall.EROFS
+//
+// The Op and Path of the error are kept if the backend returned an
+// *os.PathError, else they are set to those of the call. Errors of Rename
+// are returned as an *os.LinkError instead. The original error is replaced,
+// it doesn't match e.g. syscall.ENOENT anymore. All other errors, e.g.
+// io.EOF, are returned unchanged.
+type NormalizingFs struct {
+	base Fs
+}
+
+func NewNormalizingFs(base Fs) Fs {
+	return &NormalizingFs{base: base}
+}
+
+// canonicalError returns the sentinel err is translated to by a
+// NormalizingFs, or nil if it is not translated.
+func canonicalError(err error) error {
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return os.ErrNotExist
+	case errors.Is(err, os.ErrExist):
+		return os.ErrExist
+	case errors.Is(err, os.ErrPermission), errors.Is(err, syscall.EROFS):
+		return os.ErrPermission
+	}
+	return nil
+}
+
+// normalizeError translates err of the call op on path, see NormalizingFs.
+func normalizeError(op, path string, err error) error {
+	if err == nil {
+		return nil
+	}
+	canonical := canonicalError(err)
+	if canonical == nil {
+		return err
+	}
+	var perr *os.PathError
+	if errors.As(err, &perr) {
+		op, path = perr.Op, perr.Path
+	}
+	return &os.PathError{Op: op, Path: path, Err: canonical}
+}
+
+func (n *NormalizingFs) wrap(op, name string, f File, err error) (File, error) {
+	if err != nil {
+		return nil, normalizeError(op, name, err)
+	}
+	return &normalizingFile{File: f}, nil
+}
+
+func (n *NormalizingFs) Name() string {
+	return "NormalizingFs"
+}
+
+func (n *NormalizingFs) Create(name string) (File, error) {
+	f, err := n.base.Create(name)
+	return n.wrap("open", name, f, err)
+}
+
+func (n *NormalizingFs) Open(name string) (File, error) {
+	f, err := n.base.Open(name)
+	return n.wrap("open", name, f, err)
+}
+
+func (n *NormalizingFs) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	f, err := n.base.OpenFile(name, flag, perm)
+	return n.wrap("open", name, f, err)
+}
+
+func (n *NormalizingFs) Mkdir(name string, perm os.FileMode) error {
+	return normalizeError("mkdir", name, n.base.Mkdir(name, perm))
+}
+
+func (n *NormalizingFs) MkdirAll(path string, perm os.FileMode) error {
+	return normalizeError("mkdir", path, n.base.MkdirAll(path, perm))
+}
+
+func (n *NormalizingFs) Remove(name string) error {
+	return normalizeError("remove", name, n.base.Remove(name))
+}
+
+func (n *NormalizingFs) RemoveAll(path string) error {
+	return normalizeError("removeall", path, n.base.RemoveAll(path))
+}
+
+func (n *NormalizingFs) Rename(oldname, newname string) error {
+	err := n.base.Rename(oldname, newname)
+	if err == nil {
+		return nil
+	}
+	canonical := canonicalError(err)
+	if canonical == nil {
+		return err
+	}
+	lerr := &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: canonical}
+	var orig *os.LinkError
+	if errors.As(err, &orig) {
+		lerr.Op, lerr.Old, lerr.New = orig.Op, orig.Old, orig.New
+	}
+	return lerr
+}
+
+func (n *NormalizingFs) Stat(name string) (os.FileInfo, error) {
+	fi, err := n.base.Stat(name)
+	return fi, normalizeError("stat", name, err)
+}
+
+func (n *NormalizingFs) Chmod(name string, mode os.FileMode) error {
+	return normalizeError("chmod", name, n.base.Chmod(name, mode))
+}
+
+func (n *NormalizingFs) Chtimes(name string, atime, mtime time.Time) error {
+	return normalizeError("chtimes", name, n.base.Chtimes(name, atime, mtime))
+}
+
+type normalizingFile struct {
+	File
+}
+
+func (f *normalizingFile) err(op string, err error) error {
+	return normalizeError(op, f.File.Name(), err)
+}
+
+func (f *normalizingFile) Close() error {
+	return f.err("close", f.File.Close())
+}
+
+func (f *normalizingFile) Read(p []byte) (int, error) {
+	n, err := f.File.Read(p)
+	return n, f.err("read", err)
+}
+
+func (f *normalizingFile) ReadAt(p []byte, off int64) (int, error) {
+	n, err := f.File.ReadAt(p, off)
+	return n, f.err("read", err)
+}
+
+func (f *normalizingFile) Seek(offset int64, whence int) (int64, error) {
+	n, err := f.File.Seek(offset, whence)
+	return n, f.err("seek", err)
+}
+
+func (f *normalizingFile) Write(p []byte) (int, error) {
+	n, err := f.File.Write(p)
+	return n, f.err("write", err)
+}
+
+func (f *normalizingFile) WriteAt(p []byte, off int64) (int, error) {
+	n, err := f.File.WriteAt(p, off)
+	return n, f.err("write", err)
+}
+
+func (f *normalizingFile) WriteString(s string) (int, error) {
+	n, err := f.File.WriteString(s)
+	return n, f.err("write", err)
+}
+
+func (f *normalizingFile) Readdir(count int) ([]os.FileInfo, error) {
+	fis, err := f.File.Readdir(count)
+	return fis, f.err("readdir", err)
+}
+
+func (f *normalizingFile) Readdirnames(n int) ([]string, error) {
+	names, err := f.File.Readdirnames(n)
+	return names, f.err("readdir", err)
+}
+
+func (f *normalizingFile) Stat() (os.FileInfo, error) {
+	fi, err := f.File.Stat()
+	return fi, f.err("stat", err)
+}
+
+func (f *normalizingFile) Sync() error {
+	return f.err("sync", f.File.Sync())
+}
+
+func (f *normalizingFile) Truncate(size int64) error {
+	return f.err("truncate", f.File.Truncate(size))
+}
@@ -0,0 +1,90 @@
+package afero
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"syscall"
+	"testing"
+)
+
+func TestNormalizingFs(t *testing.T) {
+	faults := NewFaultFs(NewMemMapFs())
+	fs := NewNormalizingFs(faults)
+
+	tests := []struct {
+		err  error
+		want error
+	}{
+		{syscall.ENOENT, os.ErrNotExist},
+		{fmt.Errorf("lookup: %w", os.ErrNotExist), os.ErrNotExist},
+		{&os.PathError{Op: "stat", Path: "/f", Err: syscall.EEXIST}, os.ErrExist},
+		{syscall.EACCES, os.ErrPermission},
+		{syscall.EROFS, os.ErrPermission},
+		{&os.PathError{Op: "stat", Path: "/f", Err: ErrChecksumMismatch}, ErrChecksumMismatch},
+	}
+	for _, tt := range tests {
+		faults.Reset()
+		faults.FailOn("stat", "/f", tt.err)
+		_, err := fs.Stat("/f")
+		perr, ok := err.(*os.PathError)
+		if !ok || !errors.Is(err, tt.want) || perr.Path != "/f" || perr.Op != "stat" {
+			t.Errorf("%#v: got %#v, want a PathError of stat /f wrapping %v", tt.err, err, tt.want)
+			continue
+		}
+		if tt.want != ErrChecksumMismatch && perr.Err != tt.want {
+			t.Errorf("%#v: got %#v, want the error replaced by %v", tt.err, perr.Err, tt.want)
+		}
+	}
+
+	faults.Reset()
+	faults.FailOn("rename", "/a", syscall.ENOENT)
+	err := fs.Rename("/a", "/b")
+	if lerr, ok := err.(*os.LinkError); !ok || lerr.Err != os.ErrNotExist || lerr.Old != "/a" || lerr.New != "/b" {
+		t.Errorf("rename: got %#v", err)
+	}
+
+	// errors of the files are translated as well, io.EOF is left alone
+	faults.Reset()
+	WriteFile(fs, "/file", []byte("x"), 0644)
+	f, err := fs.Open("/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.Read(make([]byte, 2)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Read(make([]byte, 2)); err != io.EOF {
+		t.Errorf("read at the end: got %v, want io.EOF", err)
+	}
+	faults.FailOn("write", "/file", syscall.EPERM)
+	if _, err := f.Write([]byte("y")); !errors.Is(err, os.ErrPermission) || errors.Is(err, syscall.EPERM) {
+		t.Errorf("write: got %v, want os.ErrPermission only", err)
+	}
+}
+
+func TestNormalizingFsBackends(t *testing.T) {
+	// RegexpFs returns a bare syscall.ENOENT for files not matching
+	backends := []Fs{
+		NewMemMapFs(),
+		NewRegexpFs(NewMemMapFs(), regexp.MustCompile(`\.txt$`)),
+		NewReadOnlyFs(NewMemMapFs()),
+	}
+	for _, base := range backends {
+		fs := NewNormalizingFs(base)
+		_, err := fs.Open("/missing.go")
+		perr, ok := err.(*os.PathError)
+		if !ok || perr.Err != os.ErrNotExist {
+			t.Errorf("%s: open of a missing file: got %#v", base.Name(), err)
+		}
+	}
+
+	fs := NewNormalizingFs(NewReadOnlyFs(NewMemMapFs()))
+	err := fs.Mkdir("/dir", 0755)
+	if perr, ok := err.(*os.PathError); !ok || perr.Err != os.ErrPermission {
+		t.Errorf("mkdir on a read only Fs: got %#v", err)
+	}
+}
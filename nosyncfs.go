@@ -0,0 +1,85 @@
+package afero
+
+import (
+	"os"
+	"time"
+)
+
+// The NoSyncFs passes all calls to the source Fs, but the Sync method of
+// the files it returns does nothing. It is meant for benchmarks, tests and
+// other ephemeral workloads on an OsFs, where the fsync on every Sync call
+// would dominate the run time.
+//
+// With a NoSyncFs, all durability guarantees are lost: data written is not
+// guaranteed to be on disk after Sync returns, and may be lost on a crash
+// or power failure. Don't use it for data you need to keep.
+type NoSyncFs struct {
+	source Fs
+}
+
+func NewNoSyncFs(source Fs) Fs {
+	return &NoSyncFs{source: source}
+}
+
+type noSyncFile struct {
+	File
+}
+
+func (f noSyncFile) Sync() error {
+	return nil
+}
+
+func noSync(f File, err error) (File, error) {
+	if err != nil {
+		return nil, err
+	}
+	return noSyncFile{f}, nil
+}
+
+func (n *NoSyncFs) Name() string {
+	return "NoSyncFs"
+}
+
+func (n *NoSyncFs) Create(name string) (File, error) {
+	return noSync(n.source.Create(name))
+}
+
+func (n *NoSyncFs) Open(name string) (File, error) {
+	return noSync(n.source.Open(name))
+}
+
+func (n *NoSyncFs) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	return noSync(n.source.OpenFile(name, flag, perm))
+}
+
+func (n *NoSyncFs) Mkdir(name string, perm os.FileMode) error {
+	return n.source.Mkdir(name, perm)
+}
+
+func (n *NoSyncFs) MkdirAll(path string, perm os.FileMode) error {
+	return n.source.MkdirAll(path, perm)
+}
+
+func (n *NoSyncFs) Remove(name string) error {
+	return n.source.Remove(name)
+}
+
+func (n *NoSyncFs) RemoveAll(path string) error {
+	return n.source.RemoveAll(path)
+}
+
+func (n *NoSyncFs) Rename(oldname, newname string) error {
+	return n.source.Rename(oldname, newname)
+}
+
+func (n *NoSyncFs) Stat(name string) (os.FileInfo, error) {
+	return n.source.Stat(name)
+}
+
+func (n *NoSyncFs) Chmod(name string, mode os.FileMode) error {
+	return n.source.Chmod(name, mode)
+}
+
+func (n *NoSyncFs) Chtimes(name string, atime, mtime time.Time) error {
+	return n.source.Chtimes(name, atime, mtime)
+}
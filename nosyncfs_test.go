@@ -0,0 +1,60 @@
+package afero
+
+import (
+	"os"
+	"testing"
+)
+
+// syncCountFs counts the Sync calls on the files it returns.
+type syncCountFs struct {
+	Fs
+	syncs int
+}
+
+type syncCountFile struct {
+	File
+	fs *syncCountFs
+}
+
+func (f syncCountFile) Sync() error {
+	f.fs.syncs++
+	return f.File.Sync()
+}
+
+func (s *syncCountFs) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	f, err := s.Fs.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return syncCountFile{f, s}, nil
+}
+
+func TestNoSyncFs(t *testing.T) {
+	source := &syncCountFs{Fs: &MemMapFs{}}
+	fs := NewNoSyncFs(source)
+
+	f, err := fs.OpenFile("/file", os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString("data"); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if source.syncs != 0 {
+		t.Errorf("Sync reached the source %d times", source.syncs)
+	}
+
+	data, err := ReadFile(fs, "/file")
+	if err != nil || string(data) != "data" {
+		t.Errorf("got %q, %v", data, err)
+	}
+	if _, err := fs.Open("/missing"); !os.IsNotExist(err) {
+		t.Errorf("expected a not exist error, got %v", err)
+	}
+}
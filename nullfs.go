@@ -0,0 +1,139 @@
+package afero
+
+import (
+	"io"
+	"os"
+	"time"
+
+	"github.com/spf13/afero/mem"
+)
+
+// The NullFs is a sink, like /dev/null: all operations succeed, but nothing
+// is kept. Files can be created and opened under any name, writes to them
+// report the full length written and discard the data, reads return io.EOF
+// right away. Stat returns an empty file for every name but the root, which
+// is an empty directory. It is meant for benchmarks, to measure the overhead
+// of a write path without any real I/O.
+type NullFs struct{}
+
+func NewNullFs() Fs {
+	return &NullFs{}
+}
+
+func (NullFs) Name() string {
+	return "NullFs"
+}
+
+func (NullFs) Create(name string) (File, error) {
+	return &nullFile{name: name}, nil
+}
+
+func (NullFs) Open(name string) (File, error) {
+	return &nullFile{name: name}, nil
+}
+
+func (NullFs) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	return &nullFile{name: name}, nil
+}
+
+func (NullFs) Mkdir(name string, perm os.FileMode) error {
+	return nil
+}
+
+func (NullFs) MkdirAll(path string, perm os.FileMode) error {
+	return nil
+}
+
+func (NullFs) Remove(name string) error {
+	return nil
+}
+
+func (NullFs) RemoveAll(path string) error {
+	return nil
+}
+
+func (NullFs) Rename(oldname, newname string) error {
+	return nil
+}
+
+func (NullFs) Stat(name string) (os.FileInfo, error) {
+	return nullStat(name), nil
+}
+
+func (NullFs) Chmod(name string, mode os.FileMode) error {
+	return nil
+}
+
+func (NullFs) Chtimes(name string, atime, mtime time.Time) error {
+	return nil
+}
+
+func nullStat(name string) os.FileInfo {
+	if isRoot(name) {
+		return mem.GetFileInfo(mem.CreateDir(name))
+	}
+	return mem.GetFileInfo(mem.CreateFile(name))
+}
+
+// nullFile is a file of a NullFs.
+type nullFile struct {
+	name string
+}
+
+func (f *nullFile) Close() error {
+	return nil
+}
+
+func (f *nullFile) Read(p []byte) (int, error) {
+	return 0, io.EOF
+}
+
+func (f *nullFile) ReadAt(p []byte, off int64) (int, error) {
+	return 0, io.EOF
+}
+
+func (f *nullFile) Seek(offset int64, whence int) (int64, error) {
+	return 0, nil
+}
+
+func (f *nullFile) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+func (f *nullFile) WriteAt(p []byte, off int64) (int, error) {
+	return len(p), nil
+}
+
+func (f *nullFile) WriteString(s string) (int, error) {
+	return len(s), nil
+}
+
+func (f *nullFile) Name() string {
+	return f.name
+}
+
+func (f *nullFile) Readdir(count int) ([]os.FileInfo, error) {
+	if count > 0 {
+		return nil, io.EOF
+	}
+	return nil, nil
+}
+
+func (f *nullFile) Readdirnames(n int) ([]string, error) {
+	if n > 0 {
+		return nil, io.EOF
+	}
+	return nil, nil
+}
+
+func (f *nullFile) Stat() (os.FileInfo, error) {
+	return nullStat(f.name), nil
+}
+
+func (f *nullFile) Sync() error {
+	return nil
+}
+
+func (f *nullFile) Truncate(size int64) error {
+	return nil
+}
@@ -0,0 +1,55 @@
+package afero
+
+import (
+	"io"
+	"testing"
+)
+
+func TestNullFs(t *testing.T) {
+	fs := NewNullFs()
+
+	if err := fs.MkdirAll("/a/b", 0755); err != nil {
+		t.Fatal(err)
+	}
+	f, err := fs.Create("/a/b/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := f.Write(make([]byte, 1<<20)); n != 1<<20 || err != nil {
+		t.Errorf("Write = %d, %v", n, err)
+	}
+	if n, err := f.WriteString("data"); n != 4 || err != nil {
+		t.Errorf("WriteString = %d, %v", n, err)
+	}
+	if err := f.Close(); err != nil {
+		t.Error(err)
+	}
+
+	if data, err := ReadFile(fs, "/a/b/file"); len(data) != 0 || err != nil {
+		t.Errorf("ReadFile = %q, %v", data, err)
+	}
+	f, _ = fs.Open("/any")
+	if n, err := f.Read(make([]byte, 10)); n != 0 || err != io.EOF {
+		t.Errorf("Read = %d, %v, want io.EOF", n, err)
+	}
+	if fi, err := fs.Stat("/a/b/file"); err != nil || fi.IsDir() || fi.Size() != 0 {
+		t.Errorf("Stat = %v, %v, want an empty file", fi, err)
+	}
+	if fi, err := fs.Stat("/"); err != nil || !fi.IsDir() {
+		t.Errorf("Stat of the root = %v, %v, want a directory", fi, err)
+	}
+	if names, err := ReadDirNames(fs, "/"); len(names) != 0 || err != nil {
+		t.Errorf("ReadDirNames = %v, %v", names, err)
+	}
+}
+
+func BenchmarkNullFsWrite(b *testing.B) {
+	fs := NewNullFs()
+	data := make([]byte, 4096)
+	b.SetBytes(int64(len(data)))
+	for i := 0; i < b.N; i++ {
+		f, _ := fs.Create("/file")
+		f.Write(data)
+		f.Close()
+	}
+}
@@ -16,7 +16,10 @@ package afero
 
 import (
 	"os"
+	"sync"
 	"time"
+
+	"github.com/fsnotify/fsnotify"
 )
 
 // OsFs is a Fs implementation that uses functions provided by the os package.
@@ -84,6 +87,75 @@ func (OsFs) Chmod(name string, mode os.FileMode) error {
 	return os.Chmod(name, mode)
 }
 
+func (OsFs) Truncate(name string, size int64) error {
+	return os.Truncate(name, size)
+}
+
+func (OsFs) Chown(name string, uid, gid int) error {
+	return os.Chown(name, uid, gid)
+}
+
 func (OsFs) Chtimes(name string, atime time.Time, mtime time.Time) error {
 	return os.Chtimes(name, atime, mtime)
 }
+
+func (OsFs) LstatIfPossible(name string) (os.FileInfo, bool, error) {
+	fi, err := os.Lstat(name)
+	return fi, true, err
+}
+
+func (OsFs) SymlinkIfPossible(oldname, newname string) error {
+	return os.Symlink(oldname, newname)
+}
+
+func (OsFs) ReadlinkIfPossible(name string) (string, error) {
+	return os.Readlink(name)
+}
+
+func (OsFs) Link(oldname, newname string) error {
+	return os.Link(oldname, newname)
+}
+
+// Watch subscribes to the changes of the file or directory name, see
+// Watcher. It uses the notification mechanism of the operating system
+// through fsnotify.
+func (OsFs) Watch(name string) (<-chan Event, func(), error) {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := w.Add(name); err != nil {
+		w.Close()
+		return nil, nil, &os.PathError{Op: "watch", Path: name, Err: err}
+	}
+	ch := make(chan Event, watchBuffer)
+	done := make(chan struct{})
+	go func() {
+		defer close(ch)
+		for {
+			select {
+			case e, ok := <-w.Events:
+				if !ok {
+					return
+				}
+				select {
+				case ch <- Event{Name: e.Name, Op: EventOp(e.Op)}:
+				default:
+				}
+			case _, ok := <-w.Errors:
+				if !ok {
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			close(done)
+			w.Close()
+		})
+	}, nil
+}
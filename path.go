@@ -16,11 +16,43 @@
 package afero
 
 import (
+	iofs "io/fs"
 	"os"
 	"path/filepath"
 	"sort"
+	"strings"
+	"syscall"
 )
 
+// NormalizePath returns the form of path the file systems store and compare
+// names in: slashes are replaced by the OS separator and the result is
+// cleaned, so on Windows "C:/dir\\sub/" and "C:\\dir\\sub" are the same
+// name. A backslash is a valid character of a file name elsewhere and is
+// left alone there. An empty path normalizes to ".".
+//
+// MemMapFs, BasePathFs and the union file systems normalize the names they
+// are given with it. Names passed to an OsFs are handed to the os package
+// as they are, which already accepts both separators on Windows.
+func NormalizePath(path string) string {
+	return filepath.Clean(filepath.FromSlash(path))
+}
+
+// hasPathPrefix returns true if name, after NormalizePath, is one of the
+// normalized prefixes or below it. A prefix is a directory: "/tmp" covers
+// "/tmp" and "/tmp/file", but not "/tmpfoo".
+func hasPathPrefix(name string, prefixes []string) bool {
+	if len(prefixes) == 0 {
+		return false
+	}
+	name = NormalizePath(name)
+	for _, prefix := range prefixes {
+		if name == prefix || strings.HasPrefix(name, strings.TrimSuffix(prefix, string(filepath.Separator))+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
 // readDirNames reads the directory named by dirname and returns
 // a sorted list of directory entries.
 // adapted from https://golang.org/src/path/filepath/path.go
@@ -60,7 +92,7 @@ func walk(fs Fs, path string, info os.FileInfo, walkFn filepath.WalkFunc) error
 
 	for _, name := range names {
 		filename := filepath.Join(path, name)
-		fileInfo, err := lstatIfOs(fs, filename)
+		fileInfo, err := Lstat(fs, filename)
 		if err != nil {
 			if err := walkFn(filename, fileInfo, err); err != nil && err != filepath.SkipDir {
 				return err
@@ -77,32 +109,272 @@ func walk(fs Fs, path string, info os.FileInfo, walkFn filepath.WalkFunc) error
 	return nil
 }
 
-// if the filesystem is OsFs use Lstat, else use fs.Stat
-func lstatIfOs(fs Fs, path string) (info os.FileInfo, err error) {
-	_, ok := fs.(*OsFs)
-	if ok {
-		info, err = os.Lstat(path)
-	} else {
-		info, err = fs.Stat(path)
-	}
-	return
-}
-
 // Walk walks the file tree rooted at root, calling walkFn for each file or
 // directory in the tree, including root. All errors that arise visiting files
 // and directories are filtered by walkFn. The files are walked in lexical
 // order, which makes the output deterministic but means that for very
 // large directories Walk can be inefficient.
 // Walk does not follow symbolic links.
+//
+// As with filepath.Walk, walkFn may return filepath.SkipDir to skip the
+// contents of a directory, or, returned for a file, the remaining files of
+// the directory containing it.
 
 func (a Afero) Walk(root string, walkFn filepath.WalkFunc) error {
 	return Walk(a.Fs, root, walkFn)
 }
 
 func Walk(fs Fs, root string, walkFn filepath.WalkFunc) error {
-	info, err := lstatIfOs(fs, root)
+	info, err := Lstat(fs, root)
 	if err != nil {
 		return walkFn(root, nil, err)
 	}
-	return walk(fs, root, info, walkFn)
+	err = walk(fs, root, info, walkFn)
+	if err == filepath.SkipDir {
+		return nil
+	}
+	return err
+}
+
+func (a Afero) WalkFollow(root string, followSymlinks bool, walkFn filepath.WalkFunc) error {
+	return WalkFollow(a.Fs, root, followSymlinks, walkFn)
+}
+
+// WalkFollow is like Walk, but with followSymlinks set, it follows symbolic
+// links: walkFn gets the path of the link with the FileInfo of its target,
+// and the directories linked to are descended into, reached by paths below
+// the link. A link to a directory being walked already, which would loop
+// forever, is passed to walkFn but not descended into. Broken links are
+// passed with their own FileInfo. Without followSymlinks, or on an Fs not
+// implementing Symlinker, it is the same as Walk.
+func WalkFollow(fs Fs, root string, followSymlinks bool, walkFn filepath.WalkFunc) error {
+	linker, ok := fs.(Symlinker)
+	if !followSymlinks || !ok {
+		return Walk(fs, root, walkFn)
+	}
+	info, err := fs.Stat(root)
+	if err != nil {
+		return walkFn(root, nil, err)
+	}
+	real, err := evalSymlinks(linker, root)
+	if err != nil {
+		return walkFn(root, nil, err)
+	}
+	w := &followWalker{fs: fs, linker: linker, walkFn: walkFn, ancestors: make(map[string]bool)}
+	err = w.walk(root, real, info)
+	if err == filepath.SkipDir {
+		return nil
+	}
+	return err
+}
+
+// followWalker is the state of WalkFollow.
+type followWalker struct {
+	fs        Fs
+	linker    Symlinker
+	walkFn    filepath.WalkFunc
+	ancestors map[string]bool // the real paths of the directories being walked
+}
+
+// walk is like walk for the Walk function, real is path with all symbolic
+// links resolved.
+func (w *followWalker) walk(path, real string, info os.FileInfo) error {
+	err := w.walkFn(path, info, nil)
+	if err != nil {
+		if info.IsDir() && err == filepath.SkipDir {
+			return nil
+		}
+		return err
+	}
+
+	if !info.IsDir() {
+		return nil
+	}
+
+	names, err := readDirNames(w.fs, path)
+	if err != nil {
+		return w.walkFn(path, info, err)
+	}
+
+	w.ancestors[real] = true
+	defer delete(w.ancestors, real)
+	for _, name := range names {
+		filename := filepath.Join(path, name)
+		fileReal := filepath.Join(real, name)
+		fileInfo, err := Lstat(w.fs, filename)
+		if err != nil {
+			if err := w.walkFn(filename, fileInfo, err); err != nil && err != filepath.SkipDir {
+				return err
+			}
+			continue
+		}
+		if fileInfo.Mode()&os.ModeSymlink != 0 {
+			if target, err := evalSymlinks(w.linker, fileReal); err == nil {
+				if targetInfo, err := w.fs.Stat(filename); err == nil {
+					fileInfo, fileReal = targetInfo, target
+				}
+			}
+			if fileInfo.IsDir() && w.ancestors[fileReal] {
+				// a loop, don't descend
+				if err := w.walkFn(filename, fileInfo, nil); err != nil && err != filepath.SkipDir {
+					return err
+				}
+				continue
+			}
+		}
+		err = w.walk(filename, fileReal, fileInfo)
+		if err != nil {
+			if !fileInfo.IsDir() || err != filepath.SkipDir {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// evalSymlinks returns name with all symbolic links in it replaced by their
+// targets, like filepath.EvalSymlinks.
+func evalSymlinks(linker Symlinker, name string) (string, error) {
+	return resolveSymlinks(linker, name, false)
+}
+
+// resolveSymlinks is evalSymlinks, with missing set a name which doesn't
+// exist is not an error: its missing part is appended as it is, e.g. to
+// find out where a file would be created.
+func resolveSymlinks(linker Symlinker, name string, missing bool) (string, error) {
+	const maxHops = 255
+	hops := 0
+	resolved, rest := splitRoot(filepath.Clean(name))
+	for rest != "" {
+		elem := rest
+		rest = ""
+		if i := strings.IndexRune(elem, filepath.Separator); i >= 0 {
+			elem, rest = elem[:i], elem[i+1:]
+		}
+		cur := filepath.Join(resolved, elem)
+		fi, _, err := linker.LstatIfPossible(cur)
+		if missing && os.IsNotExist(err) {
+			return filepath.Join(cur, rest), nil
+		}
+		if err != nil {
+			return "", err
+		}
+		if fi.Mode()&os.ModeSymlink == 0 {
+			resolved = cur
+			continue
+		}
+		if hops++; hops > maxHops {
+			return "", &os.PathError{Op: "lstat", Path: name, Err: syscall.ELOOP}
+		}
+		target, err := linker.ReadlinkIfPossible(cur)
+		if err != nil {
+			return "", err
+		}
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(resolved, target)
+		}
+		resolved, rest = splitRoot(filepath.Join(target, rest))
+	}
+	if resolved == "" {
+		return ".", nil
+	}
+	return resolved, nil
+}
+
+// splitRoot splits the root, i.e. the volume name and a leading separator,
+// off the clean path name.
+func splitRoot(name string) (root, rest string) {
+	vol := filepath.VolumeName(name)
+	rest = name[len(vol):]
+	if strings.HasPrefix(rest, string(filepath.Separator)) {
+		return vol + string(filepath.Separator), rest[1:]
+	}
+	return vol, rest
+}
+
+// WalkDirFunc is the type of the function called by WalkDir, see
+// fs.WalkDirFunc for how the arguments and the returned error are handled.
+type WalkDirFunc = iofs.WalkDirFunc
+
+// readDirEntries reads the directory named by dirname and returns a sorted
+// list of directory entries. If the File supports it, the entries are read
+// without a Stat per entry.
+func readDirEntries(fs Fs, dirname string) ([]iofs.DirEntry, error) {
+	f, err := fs.Open(dirname)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []iofs.DirEntry
+	if rd, ok := f.(iofs.ReadDirFile); ok {
+		entries, err = rd.ReadDir(-1)
+	} else {
+		var list []os.FileInfo
+		list, err = f.Readdir(-1)
+		entries = make([]iofs.DirEntry, len(list))
+		for i, fi := range list {
+			entries[i] = iofs.FileInfoToDirEntry(fi)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+// walkDir recursively descends path, calling fn
+// adapted from https://golang.org/src/path/filepath/path.go
+func walkDir(fs Fs, path string, d iofs.DirEntry, fn WalkDirFunc) error {
+	if err := fn(path, d, nil); err != nil || !d.IsDir() {
+		if err == filepath.SkipDir && d.IsDir() {
+			err = nil
+		}
+		return err
+	}
+
+	entries, err := readDirEntries(fs, path)
+	if err != nil {
+		// second call, to report the error
+		err = fn(path, d, err)
+		if err != nil {
+			if err == filepath.SkipDir {
+				err = nil
+			}
+			return err
+		}
+	}
+
+	for _, d1 := range entries {
+		if err := walkDir(fs, filepath.Join(path, d1.Name()), d1, fn); err != nil {
+			if err == filepath.SkipDir {
+				break
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// WalkDir is like Walk, but calls fn with an fs.DirEntry instead of an
+// os.FileInfo, just like filepath.WalkDir. Directory entries are read
+// without calling Stat on every file if the Fs supports it, as OsFs does,
+// which makes WalkDir faster than Walk on large trees. Returning
+// fs.SkipAll from fn stops the walk.
+func (a Afero) WalkDir(root string, fn WalkDirFunc) error {
+	return WalkDir(a.Fs, root, fn)
+}
+
+func WalkDir(fs Fs, root string, fn WalkDirFunc) error {
+	info, err := Lstat(fs, root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = walkDir(fs, root, iofs.FileInfoToDirEntry(info), fn)
+	}
+	if err == filepath.SkipDir || err == iofs.SkipAll {
+		return nil
+	}
+	return err
 }
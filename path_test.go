@@ -16,7 +16,10 @@ package afero
 
 import (
 	"fmt"
+	iofs "io/fs"
 	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
 )
 
@@ -67,3 +70,333 @@ func TestWalk(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestWalkOrder(t *testing.T) {
+	defer removeAllTestFiles(t)
+	// created out of order, so no backend returns them sorted by accident
+	names := []string{"zeta", "b/2", "b/10", "C", "a.txt", "a", "b/1"}
+	want := []string{".", "C", "a", "a.txt", "b", "b/1", "b/10", "b/2", "zeta"}
+	for _, fs := range Fss {
+		root := testDir(fs)
+		for _, name := range names {
+			path := filepath.Join(root, filepath.FromSlash(name))
+			if name == "a" || name == "b/10" {
+				fs.MkdirAll(path, 0755)
+			} else {
+				fs.MkdirAll(filepath.Dir(path), 0755)
+				WriteFile(fs, path, nil, 0644)
+			}
+		}
+
+		var walked, walkedDir, walkedFollow []string
+		rel := func(path string) string {
+			r, _ := filepath.Rel(root, path)
+			return filepath.ToSlash(r)
+		}
+		Walk(fs, root, func(path string, info os.FileInfo, err error) error {
+			walked = append(walked, rel(path))
+			return err
+		})
+		WalkDir(fs, root, func(path string, d iofs.DirEntry, err error) error {
+			walkedDir = append(walkedDir, rel(path))
+			return err
+		})
+		WalkFollow(fs, root, true, func(path string, info os.FileInfo, err error) error {
+			walkedFollow = append(walkedFollow, rel(path))
+			return err
+		})
+		for _, got := range [][]string{walked, walkedDir, walkedFollow} {
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("%s: visited %v, want %v", fs.Name(), got, want)
+			}
+		}
+	}
+}
+
+func TestWalkSkipDir(t *testing.T) {
+	defer removeAllTestFiles(t)
+	for _, fs := range Fss {
+		root := testDir(fs)
+		for _, name := range []string{
+			"a.js",
+			"node_modules/dep/index.js",
+			"node_modules/other.js",
+			"src/main.js",
+			"src/node_modules/nested/index.js",
+			"src/z.js",
+			"vendor/1.go",
+			"vendor/2.go",
+			"vendor/3.go",
+		} {
+			name = filepath.Join(root, filepath.FromSlash(name))
+			if err := fs.MkdirAll(filepath.Dir(name), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := WriteFile(fs, name, nil, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		var visited []string
+		err := Walk(fs, root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, _ := filepath.Rel(root, path)
+			visited = append(visited, filepath.ToSlash(rel))
+			if info.IsDir() && info.Name() == "node_modules" {
+				return filepath.SkipDir
+			}
+			// skips the remaining files of vendor
+			if info.Name() == "1.go" {
+				return filepath.SkipDir
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("%s: %v", fs.Name(), err)
+		}
+		want := []string{
+			".",
+			"a.js",
+			"node_modules",
+			"src",
+			"src/main.js",
+			"src/node_modules",
+			"src/z.js",
+			"vendor",
+			"vendor/1.go",
+		}
+		if !reflect.DeepEqual(visited, want) {
+			t.Errorf("%s: got %v, want %v", fs.Name(), visited, want)
+		}
+	}
+}
+
+func TestWalkSkipDirRoot(t *testing.T) {
+	fs := &MemMapFs{}
+	WriteFile(fs, "/root/file", nil, 0644)
+	WriteFile(fs, "/root/other", nil, 0644)
+
+	for _, root := range []string{"/root", "/root/file"} {
+		n := 0
+		err := Walk(fs, root, func(path string, info os.FileInfo, err error) error {
+			n++
+			if !info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		})
+		if err != nil {
+			t.Errorf("%s: SkipDir returned from Walk: %v", root, err)
+		}
+		if n > 2 {
+			t.Errorf("%s: walked %d files after SkipDir", root, n)
+		}
+	}
+}
+
+func TestWalkFollow(t *testing.T) {
+	defer removeAllTestFiles(t)
+	for _, fs := range Fss {
+		linker := fs.(Symlinker)
+		root := testDir(fs)
+		fs.MkdirAll(filepath.Join(root, "a"), 0755)
+		WriteFile(fs, filepath.Join(root, "a", "file"), []byte("x"), 0644)
+		for link, target := range map[string]string{
+			"a/loop": "..", // back to root
+			"link":   "a",
+			"flink":  filepath.Join(root, "a", "file"),
+			"broken": "missing",
+		} {
+			if err := linker.SymlinkIfPossible(target, filepath.Join(root, filepath.FromSlash(link))); err != nil {
+				t.Fatalf("%s: %v", fs.Name(), err)
+			}
+		}
+
+		visited := make(map[string]os.FileMode)
+		var order []string
+		err := WalkFollow(fs, root, true, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, _ := filepath.Rel(root, path)
+			rel = filepath.ToSlash(rel)
+			visited[rel] = info.Mode()
+			order = append(order, rel)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("%s: %v", fs.Name(), err)
+		}
+		want := []string{".", "a", "a/file", "a/loop", "broken", "flink", "link", "link/file", "link/loop"}
+		if !reflect.DeepEqual(order, want) {
+			t.Errorf("%s: got %v, want %v", fs.Name(), order, want)
+		}
+		for _, dir := range []string{"a/loop", "link", "link/loop"} {
+			if !visited[dir].IsDir() {
+				t.Errorf("%s: %s: got mode %v, want the directory it links to", fs.Name(), dir, visited[dir])
+			}
+		}
+		if !visited["flink"].IsRegular() {
+			t.Errorf("%s: flink: got mode %v, want the file it links to", fs.Name(), visited["flink"])
+		}
+		if visited["broken"]&os.ModeSymlink == 0 {
+			t.Errorf("%s: broken: got mode %v, want a symlink", fs.Name(), visited["broken"])
+		}
+
+		// without following, the links are just reported
+		order = nil
+		WalkFollow(fs, root, false, func(path string, info os.FileInfo, err error) error {
+			rel, _ := filepath.Rel(root, path)
+			order = append(order, filepath.ToSlash(rel))
+			return nil
+		})
+		want = []string{".", "a", "a/file", "a/loop", "broken", "flink", "link"}
+		if !reflect.DeepEqual(order, want) {
+			t.Errorf("%s: not following: got %v, want %v", fs.Name(), order, want)
+		}
+	}
+}
+
+func TestWalkDir(t *testing.T) {
+	defer removeAllTestFiles(t)
+	for _, fs := range Fss {
+		root := setupTestDirRoot(t, fs)
+
+		var walked, walkedDir []string
+		err := Walk(fs, root, func(path string, info os.FileInfo, err error) error {
+			walked = append(walked, fmt.Sprintln(path, info.Name(), info.IsDir(), info.Mode().Type()))
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = WalkDir(fs, root, func(path string, d iofs.DirEntry, err error) error {
+			walkedDir = append(walkedDir, fmt.Sprintln(path, d.Name(), d.IsDir(), d.Type()))
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(walked, walkedDir) {
+			t.Errorf("%s: Walk and WalkDir differ:\n%v\n%v", fs.Name(), walked, walkedDir)
+		}
+	}
+}
+
+func TestWalkDirSkip(t *testing.T) {
+	fs := &MemMapFs{}
+	for _, name := range []string{"/r/a/1", "/r/a/2", "/r/b/1", "/r/c/1"} {
+		fs.MkdirAll(filepath.Dir(name), 0755)
+		WriteFile(fs, name, nil, 0644)
+	}
+
+	var visited []string
+	err := WalkDir(fs, "/r", func(path string, d iofs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		visited = append(visited, filepath.ToSlash(path))
+		switch filepath.ToSlash(path) {
+		case "/r/a/1":
+			return filepath.SkipDir
+		case "/r/b":
+			return filepath.SkipDir
+		case "/r/c/1":
+			return iofs.SkipAll
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"/r", "/r/a", "/r/a/1", "/r/b", "/r/c", "/r/c/1"}
+	if !reflect.DeepEqual(visited, want) {
+		t.Errorf("got %v, want %v", visited, want)
+	}
+
+	if err := WalkDir(fs, "/missing", func(path string, d iofs.DirEntry, err error) error {
+		return err
+	}); !os.IsNotExist(err) {
+		t.Errorf("expected a not exist error, got %v", err)
+	}
+}
+
+func setupWalkBench(b *testing.B) (Fs, string) {
+	fs := &OsFs{}
+	root, err := TempDir(fs, "", "afero-walk")
+	if err != nil {
+		b.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		dir := filepath.Join(root, fmt.Sprintf("dir%03d", i))
+		if err := fs.Mkdir(dir, 0755); err != nil {
+			b.Fatal(err)
+		}
+		for j := 0; j < 100; j++ {
+			if err := WriteFile(fs, filepath.Join(dir, fmt.Sprintf("file%03d", j)), nil, 0644); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+	b.ResetTimer()
+	return fs, root
+}
+
+func BenchmarkWalk(b *testing.B) {
+	fs, root := setupWalkBench(b)
+	defer fs.RemoveAll(root)
+	for i := 0; i < b.N; i++ {
+		Walk(fs, root, func(path string, info os.FileInfo, err error) error {
+			return err
+		})
+	}
+}
+
+// BenchmarkWalkStat walks stating every file again, as callers checking the
+// files found do: with Stat, and with Open and Stat on the file as the
+// helpers used to.
+func BenchmarkWalkStat(b *testing.B) {
+	for _, bm := range []struct {
+		name string
+		stat func(fs Fs, path string) error
+	}{
+		{"Stat", func(fs Fs, path string) error {
+			_, err := fs.Stat(path)
+			return err
+		}},
+		{"OpenStat", func(fs Fs, path string) error {
+			f, err := fs.Open(path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			_, err = f.Stat()
+			return err
+		}},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			fs, root := setupWalkBench(b)
+			defer fs.RemoveAll(root)
+			for i := 0; i < b.N; i++ {
+				Walk(fs, root, func(path string, info os.FileInfo, err error) error {
+					if err != nil {
+						return err
+					}
+					return bm.stat(fs, path)
+				})
+			}
+		})
+	}
+}
+
+func BenchmarkWalkDir(b *testing.B) {
+	fs, root := setupWalkBench(b)
+	defer fs.RemoveAll(root)
+	for i := 0; i < b.N; i++ {
+		WalkDir(fs, root, func(path string, d iofs.DirEntry, err error) error {
+			return err
+		})
+	}
+}
@@ -0,0 +1,242 @@
+package afero
+
+import (
+	"os"
+	"sync"
+	"time"
+)
+
+// The RateLimitedFs passes all calls to the source Fs, but limits the rate
+// of the bytes read from and written to the files it returns, e.g. to keep a
+// background job from saturating the disk. The limit is shared by all files
+// of the Fs: a Read or Write blocks until it is allowed by a token bucket
+// refilled at the rate, holding up to a second worth of bytes. The bucket
+// starts empty, so transferring n bytes takes at least n/rate seconds.
+//
+// Large reads and writes are split in parts of at most the bucket size, so
+// the data is transferred evenly. Reads are accounted for after the bytes are
+// read, so a read at the end of a file doesn't wait for bytes it doesn't get.
+// The rate can be changed with SetRate, and reads and writes stopped with
+// Pause, at any time.
+type RateLimitedFs struct {
+	source Fs
+
+	mu      sync.Mutex
+	rate    int64   // bytes per second, unlimited if <= 0
+	tokens  float64 // may be negative for bytes waited for
+	last    time.Time
+	paused  bool
+	resumed chan struct{} // closed by Resume
+}
+
+func NewRateLimitedFs(source Fs, bytesPerSec int64) *RateLimitedFs {
+	return &RateLimitedFs{source: source, rate: bytesPerSec, last: time.Now()}
+}
+
+// Rate returns the current limit in bytes per second, 0 or less for none.
+func (r *RateLimitedFs) Rate() int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.rate
+}
+
+// SetRate changes the limit to bytesPerSec, 0 or less removes it. Reads and
+// writes already waiting are not affected.
+func (r *RateLimitedFs) SetRate(bytesPerSec int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.refill(time.Now())
+	r.rate = bytesPerSec
+	if r.rate > 0 && r.tokens > float64(r.rate) {
+		r.tokens = float64(r.rate)
+	}
+}
+
+// Pause blocks all reads and writes of the files of r, until Resume is
+// called. Other calls, e.g. Open or Stat, are not affected.
+func (r *RateLimitedFs) Pause() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.paused {
+		r.paused = true
+		r.resumed = make(chan struct{})
+	}
+}
+
+// Resume continues the reads and writes stopped by Pause.
+func (r *RateLimitedFs) Resume() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.paused {
+		r.paused = false
+		close(r.resumed)
+	}
+}
+
+// refill adds the tokens for the time since the last refill. It must be
+// called with mu held.
+func (r *RateLimitedFs) refill(now time.Time) {
+	if r.rate > 0 {
+		r.tokens += now.Sub(r.last).Seconds() * float64(r.rate)
+		if r.tokens > float64(r.rate) {
+			r.tokens = float64(r.rate)
+		}
+	}
+	r.last = now
+}
+
+// chunk returns the size of the parts reads and writes are split in, 0 if
+// there is no limit.
+func (r *RateLimitedFs) chunk() int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.rate <= 0 {
+		return 0
+	}
+	return r.rate
+}
+
+// wait takes n tokens from the bucket, blocking while r is paused and until
+// the tokens are available.
+func (r *RateLimitedFs) wait(n int) {
+	r.mu.Lock()
+	for r.paused {
+		resumed := r.resumed
+		r.mu.Unlock()
+		<-resumed
+		r.mu.Lock()
+	}
+	now := time.Now()
+	r.refill(now)
+	var d time.Duration
+	if r.rate > 0 {
+		r.tokens -= float64(n)
+		if r.tokens < 0 {
+			d = time.Duration(-r.tokens / float64(r.rate) * float64(time.Second))
+		}
+	}
+	r.mu.Unlock()
+	if d > 0 {
+		time.Sleep(d)
+	}
+}
+
+func (r *RateLimitedFs) wrap(f File, err error) (File, error) {
+	if err != nil {
+		return nil, err
+	}
+	return &rateLimitedFile{File: f, fs: r}, nil
+}
+
+func (r *RateLimitedFs) Name() string {
+	return "RateLimitedFs"
+}
+
+func (r *RateLimitedFs) Create(name string) (File, error) {
+	return r.wrap(r.source.Create(name))
+}
+
+func (r *RateLimitedFs) Open(name string) (File, error) {
+	return r.wrap(r.source.Open(name))
+}
+
+func (r *RateLimitedFs) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	return r.wrap(r.source.OpenFile(name, flag, perm))
+}
+
+func (r *RateLimitedFs) Mkdir(name string, perm os.FileMode) error {
+	return r.source.Mkdir(name, perm)
+}
+
+func (r *RateLimitedFs) MkdirAll(path string, perm os.FileMode) error {
+	return r.source.MkdirAll(path, perm)
+}
+
+func (r *RateLimitedFs) Remove(name string) error {
+	return r.source.Remove(name)
+}
+
+func (r *RateLimitedFs) RemoveAll(path string) error {
+	return r.source.RemoveAll(path)
+}
+
+func (r *RateLimitedFs) Rename(oldname, newname string) error {
+	return r.source.Rename(oldname, newname)
+}
+
+func (r *RateLimitedFs) Stat(name string) (os.FileInfo, error) {
+	return r.source.Stat(name)
+}
+
+func (r *RateLimitedFs) Chmod(name string, mode os.FileMode) error {
+	return r.source.Chmod(name, mode)
+}
+
+func (r *RateLimitedFs) Chtimes(name string, atime, mtime time.Time) error {
+	return r.source.Chtimes(name, atime, mtime)
+}
+
+type rateLimitedFile struct {
+	File
+	fs *RateLimitedFs
+}
+
+// limit shortens p to the size of a part, a read returns at most that.
+func (f *rateLimitedFile) limit(p []byte) []byte {
+	if c := f.fs.chunk(); c > 0 && int64(len(p)) > c {
+		return p[:c]
+	}
+	return p
+}
+
+func (f *rateLimitedFile) Read(p []byte) (int, error) {
+	n, err := f.File.Read(f.limit(p))
+	f.fs.wait(n)
+	return n, err
+}
+
+func (f *rateLimitedFile) ReadAt(p []byte, off int64) (int, error) {
+	// ReadAt must fill p unless it fails, so read the parts one by one
+	var n int
+	for n < len(p) {
+		part := f.limit(p[n:])
+		m, err := f.File.ReadAt(part, off+int64(n))
+		f.fs.wait(m)
+		n += m
+		if err != nil || m < len(part) {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// write writes p in parts, waiting for each before writing it.
+func (f *rateLimitedFile) write(p []byte, fn func(p []byte, off int64) (int, error)) (int, error) {
+	var n int
+	for n < len(p) {
+		part := f.limit(p[n:])
+		f.fs.wait(len(part))
+		m, err := fn(part, int64(n))
+		n += m
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+func (f *rateLimitedFile) Write(p []byte) (int, error) {
+	return f.write(p, func(p []byte, _ int64) (int, error) {
+		return f.File.Write(p)
+	})
+}
+
+func (f *rateLimitedFile) WriteAt(p []byte, off int64) (int, error) {
+	return f.write(p, func(p []byte, n int64) (int, error) {
+		return f.File.WriteAt(p, off+n)
+	})
+}
+
+func (f *rateLimitedFile) WriteString(s string) (int, error) {
+	return f.Write([]byte(s))
+}
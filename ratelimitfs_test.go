@@ -0,0 +1,89 @@
+package afero
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestRateLimitedFsWrite(t *testing.T) {
+	const rate, size = 10000, 3000
+	fs := NewRateLimitedFs(NewMemMapFs(), rate)
+
+	start := time.Now()
+	if err := WriteFile(fs, "/file", make([]byte, size), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if took, min := time.Since(start), size*time.Second/rate; took < min {
+		t.Errorf("writing %d bytes at %d bytes/s took %v, want at least %v", size, rate, took, min)
+	}
+}
+
+func TestRateLimitedFsSharedLimit(t *testing.T) {
+	const rate, size = 10000, 1000
+	base := NewMemMapFs()
+	WriteFile(base, "/a", bytes.Repeat([]byte("a"), size), 0644)
+	WriteFile(base, "/b", bytes.Repeat([]byte("b"), size), 0644)
+	fs := NewRateLimitedFs(base, rate)
+
+	start := time.Now()
+	done := make(chan error, 2)
+	for _, name := range []string{"/a", "/b"} {
+		go func(name string) {
+			f, err := fs.Open(name)
+			if err != nil {
+				done <- err
+				return
+			}
+			defer f.Close()
+			_, err = ioutil.ReadAll(f)
+			done <- err
+		}(name)
+	}
+	for i := 0; i < 2; i++ {
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if took, min := time.Since(start), 2*size*time.Second/rate; took < min {
+		t.Errorf("reading 2 files of %d bytes took %v, want at least %v", size, took, min)
+	}
+}
+
+func TestRateLimitedFsPauseAndSetRate(t *testing.T) {
+	fs := NewRateLimitedFs(NewMemMapFs(), 1)
+	fs.SetRate(0)
+	if rate := fs.Rate(); rate != 0 {
+		t.Errorf("Rate: got %d", rate)
+	}
+
+	// without a limit, writing is not held up
+	start := time.Now()
+	if err := WriteFile(fs, "/file", make([]byte, 1<<20), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if took := time.Since(start); took > time.Second {
+		t.Errorf("writing without a limit took %v", took)
+	}
+
+	fs.Pause()
+	done := make(chan error, 1)
+	go func() {
+		done <- WriteFile(fs, "/paused", []byte("data"), 0644)
+	}()
+	select {
+	case err := <-done:
+		t.Fatalf("write while paused returned: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	fs.Resume()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("write not done after Resume")
+	}
+}
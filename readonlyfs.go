@@ -2,28 +2,94 @@ package afero
 
 import (
 	"os"
+	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 )
 
+// ErrReadOnly is returned, wrapped in an *os.PathError or *os.LinkError, by
+// all modifying methods of a ReadOnlyFs. It matches os.ErrPermission and
+// syscall.EROFS with errors.Is.
+var ErrReadOnly error = readOnlyError{}
+
+type readOnlyError struct{}
+
+func (readOnlyError) Error() string { return "read-only file system" }
+
+func (readOnlyError) Is(target error) bool {
+	return target == os.ErrPermission || target == syscall.EROFS
+}
+
 type ReadOnlyFs struct {
-	source Fs
+	source   Fs
+	writable []string
 }
 
 func NewReadOnlyFs(source Fs) Fs {
 	return &ReadOnlyFs{source: source}
 }
 
+// NewPartialReadOnlyFs returns a ReadOnlyFs which lets the changes below the
+// writable prefixes through, e.g. to a scratch directory. A prefix is a
+// directory: "/scratch" covers "/scratch" and "/scratch/file", but not
+// "/scratchfoo". The names are compared after NormalizePath, symbolic links
+// are not resolved. A Rename needs both names to be writable.
+func NewPartialReadOnlyFs(source Fs, writable []string) Fs {
+	r := &ReadOnlyFs{source: source}
+	for _, prefix := range writable {
+		r.writable = append(r.writable, NormalizePath(prefix))
+	}
+	return r
+}
+
+// isWritable returns true if name is below one of the writable prefixes.
+func (r *ReadOnlyFs) isWritable(name string) bool {
+	return hasPathPrefix(name, r.writable)
+}
+
+// NewReadOnlyMapFs returns a read-only Fs holding the given files, mapping
+// names, with slash as separator, to contents. It is meant for fixtures in
+// tests:
+//
+//	fs := afero.NewReadOnlyMapFs(map[string][]byte{
+//		"/etc/app.conf": []byte("debug = true"),
+//		"/var/log/app/": nil, // an empty directory
+//	})
+//
+// The parent directories are created as needed, a name ending with a slash
+// creates a directory. Names used both as file and as directory are not
+// supported.
+func NewReadOnlyMapFs(files map[string][]byte) Fs {
+	fs := &MemMapFs{}
+	for name, data := range files {
+		path := filepath.FromSlash(name)
+		if strings.HasSuffix(name, "/") {
+			fs.MkdirAll(path, 0755)
+			continue
+		}
+		fs.MkdirAll(filepath.Dir(path), 0755)
+		WriteFile(fs, path, data, 0644)
+	}
+	return NewReadOnlyFs(fs)
+}
+
 func (r *ReadOnlyFs) ReadDir(name string) ([]os.FileInfo, error) {
 	return ReadDir(r.source, name)
 }
 
 func (r *ReadOnlyFs) Chtimes(n string, a, m time.Time) error {
-	return syscall.EPERM
+	if r.isWritable(n) {
+		return r.source.Chtimes(n, a, m)
+	}
+	return &os.PathError{Op: "chtimes", Path: n, Err: ErrReadOnly}
 }
 
 func (r *ReadOnlyFs) Chmod(n string, m os.FileMode) error {
-	return syscall.EPERM
+	if r.isWritable(n) {
+		return r.source.Chmod(n, m)
+	}
+	return &os.PathError{Op: "chmod", Path: n, Err: ErrReadOnly}
 }
 
 func (r *ReadOnlyFs) Name() string {
@@ -35,20 +101,29 @@ func (r *ReadOnlyFs) Stat(name string) (os.FileInfo, error) {
 }
 
 func (r *ReadOnlyFs) Rename(o, n string) error {
-	return syscall.EPERM
+	if r.isWritable(o) && r.isWritable(n) {
+		return r.source.Rename(o, n)
+	}
+	return &os.LinkError{Op: "rename", Old: o, New: n, Err: ErrReadOnly}
 }
 
 func (r *ReadOnlyFs) RemoveAll(p string) error {
-	return syscall.EPERM
+	if r.isWritable(p) {
+		return r.source.RemoveAll(p)
+	}
+	return &os.PathError{Op: "remove", Path: p, Err: ErrReadOnly}
 }
 
 func (r *ReadOnlyFs) Remove(n string) error {
-	return syscall.EPERM
+	if r.isWritable(n) {
+		return r.source.Remove(n)
+	}
+	return &os.PathError{Op: "remove", Path: n, Err: ErrReadOnly}
 }
 
 func (r *ReadOnlyFs) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
-	if flag&(os.O_WRONLY|syscall.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) != 0 {
-		return nil, syscall.EPERM
+	if flag&(os.O_WRONLY|syscall.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) != 0 && !r.isWritable(name) {
+		return nil, &os.PathError{Op: "open", Path: name, Err: ErrReadOnly}
 	}
 	return r.source.OpenFile(name, flag, perm)
 }
@@ -58,13 +133,22 @@ func (r *ReadOnlyFs) Open(n string) (File, error) {
 }
 
 func (r *ReadOnlyFs) Mkdir(n string, p os.FileMode) error {
-	return syscall.EPERM
+	if r.isWritable(n) {
+		return r.source.Mkdir(n, p)
+	}
+	return &os.PathError{Op: "mkdir", Path: n, Err: ErrReadOnly}
 }
 
 func (r *ReadOnlyFs) MkdirAll(n string, p os.FileMode) error {
-	return syscall.EPERM
+	if r.isWritable(n) {
+		return r.source.MkdirAll(n, p)
+	}
+	return &os.PathError{Op: "mkdir", Path: n, Err: ErrReadOnly}
 }
 
 func (r *ReadOnlyFs) Create(n string) (File, error) {
-	return nil, syscall.EPERM
+	if r.isWritable(n) {
+		return r.source.Create(n)
+	}
+	return nil, &os.PathError{Op: "create", Path: n, Err: ErrReadOnly}
 }
@@ -2,7 +2,9 @@ package afero
 
 import (
 	"os"
+	"path/filepath"
 	"regexp"
+	"strings"
 	"syscall"
 	"time"
 )
@@ -12,23 +14,42 @@ import (
 // "No such file or directory").
 //
 type RegexpFs struct {
-	re     *regexp.Regexp
-	source Fs
+	re        *regexp.Regexp
+	source    Fs
+	matchPath bool
 }
 
 func NewRegexpFs(source Fs, re *regexp.Regexp) Fs {
 	return &RegexpFs{source: source, re: re}
 }
 
+// NewRegexpFsMatchPath returns a RegexpFs matching re against the full path
+// of a file instead of the name only, e.g. `^docs/.*\.md$`. The path is
+// cleaned, uses forward slashes and has no leading slash. Directories are
+// never filtered, so matching files in subdirectories can be reached.
+func NewRegexpFsMatchPath(source Fs, re *regexp.Regexp) Fs {
+	return &RegexpFs{source: source, re: re, matchPath: true}
+}
+
 type RegexpFile struct {
-	f  File
-	re *regexp.Regexp
+	f         File
+	re        *regexp.Regexp
+	path      string // as opened, for matchPath
+	matchPath bool
+}
+
+// regexpPath returns name as matched by a RegexpFs with matchPath set.
+func regexpPath(name string) string {
+	return strings.TrimPrefix(filepath.ToSlash(filepath.Clean(name)), "/")
 }
 
 func (r *RegexpFs) matchesName(name string) error {
 	if r.re == nil {
 		return nil
 	}
+	if r.matchPath {
+		name = regexpPath(name)
+	}
 	if r.re.MatchString(name) {
 		return nil
 	}
@@ -126,7 +147,10 @@ func (r *RegexpFs) Open(name string) (File, error) {
 		}
 	}
 	f, err := r.source.Open(name)
-	return &RegexpFile{f: f, re: r.re}, nil
+	if err != nil {
+		return nil, err
+	}
+	return &RegexpFile{f: f, re: r.re, path: name, matchPath: r.matchPath}, nil
 }
 
 func (r *RegexpFs) Mkdir(n string, p os.FileMode) error {
@@ -179,7 +203,11 @@ func (f *RegexpFile) Readdir(c int) (fi []os.FileInfo, err error) {
 		return nil, err
 	}
 	for _, i := range rfi {
-		if i.IsDir() || f.re.MatchString(i.Name()) {
+		name := i.Name()
+		if f.matchPath {
+			name = regexpPath(filepath.Join(f.path, name))
+		}
+		if i.IsDir() || f.re == nil || f.re.MatchString(name) {
 			fi = append(fi, i)
 		}
 	}
@@ -1,8 +1,14 @@
 package afero
 
 import (
+	"errors"
+	"os"
+	"path/filepath"
 	"regexp"
+	"strings"
+	"syscall"
 	"testing"
+	"time"
 )
 
 func TestFilterReadOnly(t *testing.T) {
@@ -14,6 +20,109 @@ func TestFilterReadOnly(t *testing.T) {
 	// t.Logf("ERR=%s", err)
 }
 
+func TestFilterReadOnlyErr(t *testing.T) {
+	fs := NewReadOnlyFs(&MemMapFs{})
+	_, createErr := fs.Create("/file.txt")
+	_, openErr := fs.OpenFile("/file.txt", os.O_WRONLY|os.O_CREATE, 0644)
+	for i, err := range []error{
+		createErr,
+		openErr,
+		fs.Mkdir("/dir", 0755),
+		fs.MkdirAll("/dir/sub", 0755),
+		fs.Remove("/file.txt"),
+		fs.RemoveAll("/dir"),
+		fs.Rename("/file.txt", "/moved.txt"),
+		fs.Chmod("/file.txt", 0600),
+		fs.Chtimes("/file.txt", time.Now(), time.Now()),
+	} {
+		if !errors.Is(err, ErrReadOnly) {
+			t.Errorf("%d: expected ErrReadOnly, got %v", i, err)
+		}
+		if !errors.Is(err, os.ErrPermission) {
+			t.Errorf("%d: expected a permission error, got %v", i, err)
+		}
+	}
+	if perr, ok := createErr.(*os.PathError); !ok || perr.Path != "/file.txt" {
+		t.Errorf("expected a *os.PathError with the path, got %#v", createErr)
+	}
+}
+
+func TestReadOnlyMapFs(t *testing.T) {
+	fs := NewReadOnlyMapFs(map[string][]byte{
+		"/etc/app.conf":     []byte("debug = true"),
+		"/etc/app.d/a.conf": []byte("a"),
+		"/var/log/app/":     nil,
+	})
+
+	if data, err := ReadFile(fs, "/etc/app.conf"); err != nil || string(data) != "debug = true" {
+		t.Errorf("ReadFile: %q, %v", data, err)
+	}
+	if names, err := ReadDirNames(fs, "/etc"); err != nil || strings.Join(names, " ") != "app.conf app.d" {
+		t.Errorf("ReadDirNames: %v, %v", names, err)
+	}
+	if fi, err := fs.Stat("/var/log/app"); err != nil || !fi.IsDir() {
+		t.Errorf("empty directory: %v, %v", fi, err)
+	}
+
+	var walked []string
+	Walk(fs, "/", func(path string, info os.FileInfo, err error) error {
+		walked = append(walked, filepath.ToSlash(path))
+		return err
+	})
+	want := "/ /etc /etc/app.conf /etc/app.d /etc/app.d/a.conf /var /var/log /var/log/app"
+	if strings.Join(walked, " ") != want {
+		t.Errorf("Walk: got %v, want %s", walked, want)
+	}
+
+	err := WriteFile(fs, "/etc/app.conf", nil, 0644)
+	if !errors.Is(err, syscall.EROFS) || !errors.Is(err, ErrReadOnly) {
+		t.Errorf("WriteFile: expected EROFS, got %v", err)
+	}
+	if err := fs.Remove("/etc/app.conf"); !errors.Is(err, syscall.EROFS) {
+		t.Errorf("Remove: expected EROFS, got %v", err)
+	}
+}
+
+func TestPartialReadOnlyFs(t *testing.T) {
+	base := NewMemMapFs()
+	base.MkdirAll("/scratch", 0755)
+	base.MkdirAll("/data", 0755)
+	WriteFile(base, "/data/file", []byte("data"), 0644)
+	fs := NewPartialReadOnlyFs(base, []string{"/scratch/", "/tmp/../cache"})
+
+	writable := []string{"/scratch/file", "/scratch/sub/../file2", "/cache/entry"}
+	for _, name := range writable {
+		if err := fs.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Errorf("MkdirAll %s: %v", filepath.Dir(name), err)
+		}
+		if err := WriteFile(fs, name, []byte("x"), 0644); err != nil {
+			t.Errorf("write %s: %v", name, err)
+		}
+	}
+	if err := fs.Chmod("/scratch", 0700); err != nil {
+		t.Errorf("Chmod of a writable prefix itself: %v", err)
+	}
+	if err := fs.Rename("/scratch/file", "/cache/moved"); err != nil {
+		t.Errorf("rename between writable dirs: %v", err)
+	}
+
+	readOnly := []string{"/scratchfoo", "/scratchfoo/file", "/data/file", "/cache2/file", "/"}
+	for _, name := range readOnly {
+		if _, err := fs.Create(name); !errors.Is(err, ErrReadOnly) {
+			t.Errorf("Create %s: got %v, want %v", name, err, ErrReadOnly)
+		}
+		if err := fs.Chmod(name, 0600); !errors.Is(err, ErrReadOnly) {
+			t.Errorf("Chmod %s: got %v, want %v", name, err, ErrReadOnly)
+		}
+	}
+	if err := fs.Rename("/data/file", "/scratch/stolen"); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("rename out of a read-only dir: got %v", err)
+	}
+	if err := fs.Remove("/scratch/file2"); err != nil {
+		t.Errorf("remove below a writable prefix: %v", err)
+	}
+}
+
 func TestFilterReadonlyRemoveAndRead(t *testing.T) {
 	mfs := &MemMapFs{}
 	fh, err := mfs.Create("/file.txt")
@@ -94,3 +203,60 @@ func TestFilterRegexReadDir(t *testing.T) {
 		t.Errorf("Got wrong number of names: %v", names)
 	}
 }
+
+func TestFilterRegexpMatchPath(t *testing.T) {
+	mfs := &MemMapFs{}
+	fs := NewRegexpFsMatchPath(mfs, regexp.MustCompile(`^docs/(sub/)?[^/]*\.md$`))
+
+	mfs.MkdirAll("/docs/sub/deep", 0777)
+	mfs.MkdirAll("/other", 0777)
+	for _, name := range []string{
+		"/readme.md",
+		"/docs/a.md", "/docs/a.txt",
+		"/docs/sub/b.md",
+		"/docs/sub/deep/c.md",
+		"/other/d.md",
+	} {
+		fh, _ := mfs.Create(name)
+		fh.Close()
+	}
+
+	for name, visible := range map[string]bool{
+		"/readme.md":          false,
+		"/docs/a.md":          true,
+		"/docs/./sub/../a.md": true,
+		"/docs/a.txt":         false,
+		"/docs/sub/b.md":      true,
+		"/docs/sub/deep/c.md": false,
+		"/other/d.md":         false,
+	} {
+		_, err := fs.Stat(name)
+		if visible && err != nil {
+			t.Errorf("%s: expected a match, got %v", name, err)
+		}
+		if !visible && err == nil {
+			t.Errorf("%s: expected no match", name)
+		}
+	}
+
+	if _, err := fs.Create("/other/new.md"); err == nil {
+		t.Error("Did not fail to create file")
+	}
+
+	var found []string
+	err := Walk(fs, "/", func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			found = append(found, path)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 2 || found[0] != "/docs/a.md" || found[1] != "/docs/sub/b.md" {
+		t.Errorf("Got wrong files: %v", found)
+	}
+}
@@ -0,0 +1,181 @@
+package afero
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// The ScopedOsFs gives access to the operating system's file system below a
+// set of allowed roots only, like a chroot with several bind mounts. Unlike
+// with a BasePathFs, names are not prefixed: they are absolute paths, or
+// relative to the working directory.
+//
+// A name is checked after resolving all symbolic links in it, so a link
+// inside a root pointing outside of all roots can't be used to escape, nor
+// can "..": it is resolved lexically, like filepath.Clean does, and the
+// operation is then done on the resolved name. A name outside the roots is
+// rejected with an *os.PathError wrapping os.ErrPermission.
+//
+// The check and the operation are not atomic: if a directory below a root
+// is replaced by a symbolic link between both, the operation follows it.
+type ScopedOsFs struct {
+	source OsFs
+	roots  []string
+}
+
+// NewScopedOsFs returns a ScopedOsFs allowing the paths below the given
+// roots, with the symbolic links in them resolved.
+func NewScopedOsFs(roots []string) Fs {
+	s := &ScopedOsFs{}
+	for _, root := range roots {
+		if abs, err := filepath.Abs(root); err == nil {
+			root = abs
+		}
+		if real, err := resolveSymlinks(s.source, root, true); err == nil {
+			root = real
+		}
+		s.roots = append(s.roots, filepath.Clean(root))
+	}
+	return s
+}
+
+// realPath returns name with its symbolic links resolved, the last element
+// only with follow set, or an error if that is outside the roots.
+func (s *ScopedOsFs) realPath(op, name string, follow bool) (string, error) {
+	abs, err := filepath.Abs(name)
+	if err != nil {
+		return "", &os.PathError{Op: op, Path: name, Err: err}
+	}
+	var real string
+	if follow {
+		real, err = resolveSymlinks(s.source, abs, true)
+	} else {
+		var dir string
+		dir, err = resolveSymlinks(s.source, filepath.Dir(abs), true)
+		real = filepath.Join(dir, filepath.Base(abs))
+	}
+	if err != nil {
+		return "", err
+	}
+	for _, root := range s.roots {
+		rel, err := filepath.Rel(root, real)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return real, nil
+		}
+	}
+	return "", &os.PathError{Op: op, Path: name, Err: os.ErrPermission}
+}
+
+func (s *ScopedOsFs) Name() string {
+	return "ScopedOsFs"
+}
+
+func (s *ScopedOsFs) Create(name string) (File, error) {
+	real, err := s.realPath("open", name, true)
+	if err != nil {
+		return nil, err
+	}
+	return s.source.Create(real)
+}
+
+func (s *ScopedOsFs) Mkdir(name string, perm os.FileMode) error {
+	real, err := s.realPath("mkdir", name, false)
+	if err != nil {
+		return err
+	}
+	return s.source.Mkdir(real, perm)
+}
+
+func (s *ScopedOsFs) MkdirAll(path string, perm os.FileMode) error {
+	real, err := s.realPath("mkdir", path, true)
+	if err != nil {
+		return err
+	}
+	return s.source.MkdirAll(real, perm)
+}
+
+func (s *ScopedOsFs) Open(name string) (File, error) {
+	real, err := s.realPath("open", name, true)
+	if err != nil {
+		return nil, err
+	}
+	return s.source.Open(real)
+}
+
+func (s *ScopedOsFs) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	real, err := s.realPath("open", name, true)
+	if err != nil {
+		return nil, err
+	}
+	return s.source.OpenFile(real, flag, perm)
+}
+
+func (s *ScopedOsFs) Remove(name string) error {
+	real, err := s.realPath("remove", name, false)
+	if err != nil {
+		return err
+	}
+	return s.source.Remove(real)
+}
+
+func (s *ScopedOsFs) RemoveAll(path string) error {
+	real, err := s.realPath("removeall", path, false)
+	if err != nil {
+		return err
+	}
+	return s.source.RemoveAll(real)
+}
+
+func (s *ScopedOsFs) Rename(oldname, newname string) error {
+	oldReal, err := s.realPath("rename", oldname, false)
+	if err != nil {
+		return err
+	}
+	newReal, err := s.realPath("rename", newname, false)
+	if err != nil {
+		return err
+	}
+	return s.source.Rename(oldReal, newReal)
+}
+
+func (s *ScopedOsFs) Stat(name string) (os.FileInfo, error) {
+	real, err := s.realPath("stat", name, true)
+	if err != nil {
+		return nil, err
+	}
+	return s.source.Stat(real)
+}
+
+func (s *ScopedOsFs) LstatIfPossible(name string) (os.FileInfo, bool, error) {
+	real, err := s.realPath("lstat", name, false)
+	if err != nil {
+		return nil, true, err
+	}
+	return s.source.LstatIfPossible(real)
+}
+
+func (s *ScopedOsFs) Chmod(name string, mode os.FileMode) error {
+	real, err := s.realPath("chmod", name, true)
+	if err != nil {
+		return err
+	}
+	return s.source.Chmod(real, mode)
+}
+
+func (s *ScopedOsFs) Chown(name string, uid, gid int) error {
+	real, err := s.realPath("chown", name, true)
+	if err != nil {
+		return err
+	}
+	return s.source.Chown(real, uid, gid)
+}
+
+func (s *ScopedOsFs) Chtimes(name string, atime, mtime time.Time) error {
+	real, err := s.realPath("chtimes", name, true)
+	if err != nil {
+		return err
+	}
+	return s.source.Chtimes(real, atime, mtime)
+}
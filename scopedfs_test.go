@@ -0,0 +1,94 @@
+package afero
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestScopedOsFs(t *testing.T) {
+	tmp, err := TempDir(NewOsFs(), "", "afero-scoped")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	for _, dir := range []string{"a", "b", "secret"} {
+		os.Mkdir(filepath.Join(tmp, dir), 0777)
+	}
+	os.WriteFile(filepath.Join(tmp, "secret", "key"), []byte("key"), 0644)
+	fs := NewScopedOsFs([]string{filepath.Join(tmp, "a"), filepath.Join(tmp, "b")})
+
+	for _, dir := range []string{"a", "b"} {
+		name := filepath.Join(tmp, dir, "file")
+		if err := WriteFile(fs, name, []byte(dir), 0644); err != nil {
+			t.Errorf("write below root %s: %v", dir, err)
+		}
+	}
+	if err := fs.Rename(filepath.Join(tmp, "a", "file"), filepath.Join(tmp, "b", "moved")); err != nil {
+		t.Errorf("rename between roots: %v", err)
+	}
+
+	denied := []string{
+		filepath.Join(tmp, "secret", "key"),
+		filepath.Join(tmp, "a", "..", "secret", "key"),
+		filepath.Join(tmp, "a", "..", "..", filepath.Base(tmp), "secret", "key"),
+		tmp,
+	}
+	for _, name := range denied {
+		if _, err := fs.Open(name); !os.IsPermission(err) {
+			t.Errorf("Open %s: got %v, want a permission error", name, err)
+		}
+	}
+	if err := fs.Rename(filepath.Join(tmp, "b", "moved"), filepath.Join(tmp, "secret", "moved")); !os.IsPermission(err) {
+		t.Errorf("rename out of the roots: got %v, want a permission error", err)
+	}
+}
+
+func TestScopedOsFsSymlinkEscape(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks need special privileges on windows")
+	}
+	tmp, err := TempDir(NewOsFs(), "", "afero-scoped")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	root := filepath.Join(tmp, "root")
+	secret := filepath.Join(tmp, "secret")
+	os.Mkdir(root, 0777)
+	os.Mkdir(secret, 0777)
+	os.WriteFile(filepath.Join(secret, "key"), []byte("key"), 0644)
+	os.Symlink(secret, filepath.Join(root, "escape"))
+	os.Symlink(filepath.Join(secret, "new"), filepath.Join(root, "dangling"))
+	os.Symlink("inside", filepath.Join(root, "local"))
+	os.Mkdir(filepath.Join(root, "inside"), 0777)
+
+	// the root itself given through a symlink
+	os.Symlink(root, filepath.Join(tmp, "rootlink"))
+	fs := NewScopedOsFs([]string{filepath.Join(tmp, "rootlink")})
+
+	if _, err := fs.Open(filepath.Join(root, "escape", "key")); !os.IsPermission(err) {
+		t.Errorf("read through a symlink out of the root: got %v", err)
+	}
+	if _, err := fs.Create(filepath.Join(root, "dangling")); !os.IsPermission(err) {
+		t.Errorf("create through a dangling symlink: got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(secret, "new")); !os.IsNotExist(err) {
+		t.Errorf("file created outside the root: %v", err)
+	}
+	if _, err := fs.Stat(filepath.Join(root, "escape", "..", "..", "secret")); !os.IsPermission(err) {
+		t.Errorf("stat through a symlink and ..: got %v", err)
+	}
+
+	if err := WriteFile(fs, filepath.Join(root, "local", "file"), []byte("ok"), 0644); err != nil {
+		t.Errorf("write through a symlink inside the root: %v", err)
+	}
+	// the link itself is inside the root, so it can be removed
+	if err := fs.Remove(filepath.Join(root, "escape")); err != nil {
+		t.Errorf("remove a symlink pointing out of the root: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(secret, "key")); err != nil {
+		t.Errorf("removing the symlink removed its target: %v", err)
+	}
+}
@@ -0,0 +1,229 @@
+package afero
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Op is an operation recorded by a SpyFs.
+type Op struct {
+	Op   string        // lower case method name, e.g. "create" or "write"
+	Name string        // name of the file, the old name for "rename"
+	Args []interface{} // the other arguments, for reads and writes the length of the buffer
+	Err  error         // returned by the call
+}
+
+func (o Op) String() string {
+	s := o.Op + " " + o.Name
+	for _, a := range o.Args {
+		s += fmt.Sprintf(" %v", a)
+	}
+	if o.Err != nil {
+		s += ": " + o.Err.Error()
+	}
+	return s
+}
+
+// The SpyFs passes all calls to the source Fs and records them, including
+// the calls on the files it returns. It is meant for tests, to assert which
+// operations the code under test did in which order, e.g. with a MemMapFs
+// as the source:
+//
+//	fs := afero.NewSpyFs(afero.NewMemMapFs())
+//	doSomething(fs)
+//	for _, op := range fs.Operations() {
+//		...
+//	}
+type SpyFs struct {
+	source Fs
+	mu     sync.Mutex
+	ops    []Op
+}
+
+func NewSpyFs(source Fs) *SpyFs {
+	return &SpyFs{source: source}
+}
+
+// Operations returns the operations recorded so far, oldest first.
+func (s *SpyFs) Operations() []Op {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Op(nil), s.ops...)
+}
+
+// Reset discards the operations recorded so far.
+func (s *SpyFs) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ops = nil
+}
+
+func (s *SpyFs) record(op, name string, err error, args ...interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ops = append(s.ops, Op{Op: op, Name: name, Args: args, Err: err})
+}
+
+func (s *SpyFs) spy(f File, err error) (File, error) {
+	if err != nil {
+		return nil, err
+	}
+	return &spyFile{f: f, fs: s}, nil
+}
+
+func (s *SpyFs) Name() string {
+	return "SpyFs"
+}
+
+func (s *SpyFs) Create(name string) (File, error) {
+	f, err := s.source.Create(name)
+	s.record("create", name, err)
+	return s.spy(f, err)
+}
+
+func (s *SpyFs) Open(name string) (File, error) {
+	f, err := s.source.Open(name)
+	s.record("open", name, err)
+	return s.spy(f, err)
+}
+
+func (s *SpyFs) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	f, err := s.source.OpenFile(name, flag, perm)
+	s.record("openfile", name, err, flag, perm)
+	return s.spy(f, err)
+}
+
+func (s *SpyFs) Mkdir(name string, perm os.FileMode) error {
+	err := s.source.Mkdir(name, perm)
+	s.record("mkdir", name, err, perm)
+	return err
+}
+
+func (s *SpyFs) MkdirAll(path string, perm os.FileMode) error {
+	err := s.source.MkdirAll(path, perm)
+	s.record("mkdirall", path, err, perm)
+	return err
+}
+
+func (s *SpyFs) Remove(name string) error {
+	err := s.source.Remove(name)
+	s.record("remove", name, err)
+	return err
+}
+
+func (s *SpyFs) RemoveAll(path string) error {
+	err := s.source.RemoveAll(path)
+	s.record("removeall", path, err)
+	return err
+}
+
+func (s *SpyFs) Rename(oldname, newname string) error {
+	err := s.source.Rename(oldname, newname)
+	s.record("rename", oldname, err, newname)
+	return err
+}
+
+func (s *SpyFs) Stat(name string) (os.FileInfo, error) {
+	fi, err := s.source.Stat(name)
+	s.record("stat", name, err)
+	return fi, err
+}
+
+func (s *SpyFs) Chmod(name string, mode os.FileMode) error {
+	err := s.source.Chmod(name, mode)
+	s.record("chmod", name, err, mode)
+	return err
+}
+
+func (s *SpyFs) Chtimes(name string, atime, mtime time.Time) error {
+	err := s.source.Chtimes(name, atime, mtime)
+	s.record("chtimes", name, err, atime, mtime)
+	return err
+}
+
+type spyFile struct {
+	f  File
+	fs *SpyFs
+}
+
+func (f *spyFile) record(op string, err error, args ...interface{}) {
+	f.fs.record(op, f.f.Name(), err, args...)
+}
+
+func (f *spyFile) Close() error {
+	err := f.f.Close()
+	f.record("close", err)
+	return err
+}
+
+func (f *spyFile) Read(p []byte) (int, error) {
+	n, err := f.f.Read(p)
+	f.record("read", err, len(p))
+	return n, err
+}
+
+func (f *spyFile) ReadAt(p []byte, off int64) (int, error) {
+	n, err := f.f.ReadAt(p, off)
+	f.record("readat", err, len(p), off)
+	return n, err
+}
+
+func (f *spyFile) Seek(offset int64, whence int) (int64, error) {
+	n, err := f.f.Seek(offset, whence)
+	f.record("seek", err, offset, whence)
+	return n, err
+}
+
+func (f *spyFile) Write(p []byte) (int, error) {
+	n, err := f.f.Write(p)
+	f.record("write", err, len(p))
+	return n, err
+}
+
+func (f *spyFile) WriteAt(p []byte, off int64) (int, error) {
+	n, err := f.f.WriteAt(p, off)
+	f.record("writeat", err, len(p), off)
+	return n, err
+}
+
+func (f *spyFile) WriteString(s string) (int, error) {
+	n, err := f.f.WriteString(s)
+	f.record("writestring", err, len(s))
+	return n, err
+}
+
+func (f *spyFile) Name() string {
+	return f.f.Name()
+}
+
+func (f *spyFile) Readdir(count int) ([]os.FileInfo, error) {
+	fi, err := f.f.Readdir(count)
+	f.record("readdir", err, count)
+	return fi, err
+}
+
+func (f *spyFile) Readdirnames(n int) ([]string, error) {
+	names, err := f.f.Readdirnames(n)
+	f.record("readdirnames", err, n)
+	return names, err
+}
+
+func (f *spyFile) Stat() (os.FileInfo, error) {
+	fi, err := f.f.Stat()
+	f.record("stat", err)
+	return fi, err
+}
+
+func (f *spyFile) Sync() error {
+	err := f.f.Sync()
+	f.record("sync", err)
+	return err
+}
+
+func (f *spyFile) Truncate(size int64) error {
+	err := f.f.Truncate(size)
+	f.record("truncate", err, size)
+	return err
+}
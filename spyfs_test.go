@@ -0,0 +1,89 @@
+package afero
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"testing"
+)
+
+func TestSpyFs(t *testing.T) {
+	fs := NewSpyFs(&MemMapFs{})
+
+	f, err := fs.Create("/file.tmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte("data")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 8)
+	if _, err := f.Read(buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Rename("/file.tmp", "/file"); err != nil {
+		t.Fatal(err)
+	}
+	_, statErr := fs.Stat("/file.tmp")
+
+	want := []string{
+		"create /file.tmp",
+		"write /file.tmp 4",
+		"seek /file.tmp 0 0",
+		"read /file.tmp 8",
+		"close /file.tmp",
+		"rename /file.tmp /file",
+		"stat /file.tmp: " + statErr.Error(),
+	}
+	ops := fs.Operations()
+	if len(ops) != len(want) {
+		t.Fatalf("Got %d operations, expected %d: %v", len(ops), len(want), ops)
+	}
+	for i, op := range ops {
+		if op.String() != want[i] {
+			t.Errorf("%d: got %q, expected %q", i, op, want[i])
+		}
+	}
+	if !os.IsNotExist(ops[6].Err) {
+		t.Errorf("Expected the error to be recorded, got %v", ops[6].Err)
+	}
+
+	fs.Reset()
+	if ops := fs.Operations(); len(ops) != 0 {
+		t.Errorf("Expected no operations after Reset, got %v", ops)
+	}
+}
+
+func TestSpyFsConcurrent(t *testing.T) {
+	fs := NewSpyFs(&MemMapFs{})
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			WriteFile(fs, fmt.Sprintf("/file%d", i), []byte("data"), 0644)
+		}(i)
+	}
+	wg.Wait()
+
+	ops := fs.Operations()
+	files := map[string][]string{}
+	for _, op := range ops {
+		files[op.Name] = append(files[op.Name], op.Op)
+	}
+	if len(files) != 10 {
+		t.Fatalf("Got operations on %d files, expected 10: %v", len(files), ops)
+	}
+	for name, fileOps := range files {
+		if fmt.Sprint(fileOps) != "[openfile write close]" {
+			t.Errorf("%s: got %v", name, fileOps)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package afero
+
+import (
+	"errors"
+	"os"
+)
+
+// Lstater is an optional interface of an Fs. It is implemented by file
+// systems which can stat a symbolic link itself instead of the file it
+// points to, see os.Lstat. The returned bool tells whether Lstat semantics
+// were used, Fs wrappers may fall back to Stat for sources without support.
+type Lstater interface {
+	LstatIfPossible(name string) (os.FileInfo, bool, error)
+}
+
+// Symlinker is an optional interface of an Fs. It is implemented by file
+// systems supporting symbolic links, code needing symlinks can type-assert
+// the Fs and fall back gracefully if it is not implemented:
+//
+//	if linker, ok := fs.(afero.Symlinker); ok {
+//		err = linker.SymlinkIfPossible("target", "link")
+//	}
+type Symlinker interface {
+	Lstater
+
+	// SymlinkIfPossible creates newname as a symbolic link to oldname,
+	// see os.Symlink.
+	SymlinkIfPossible(oldname, newname string) error
+
+	// ReadlinkIfPossible returns the destination of the named symbolic
+	// link, see os.Readlink.
+	ReadlinkIfPossible(name string) (string, error)
+}
+
+// Lstat returns the FileInfo of the named file without following a symbolic
+// link in its last element, see os.Lstat, if fs implements Lstater, and the
+// FileInfo of fs.Stat otherwise.
+func (a Afero) Lstat(name string) (os.FileInfo, error) {
+	return Lstat(a.Fs, name)
+}
+
+func Lstat(fs Fs, name string) (os.FileInfo, error) {
+	if lstater, ok := fs.(Lstater); ok {
+		fi, _, err := lstater.LstatIfPossible(name)
+		return fi, err
+	}
+	return fs.Stat(name)
+}
+
+// ErrNoSymlink is returned, wrapped in an *os.LinkError, when a symbolic
+// link is to be created on an Fs not implementing Symlinker.
+var ErrNoSymlink = errors.New("symlink not supported")
+
+// Linker is an optional interface of an Fs. It is implemented by file
+// systems supporting hard links.
+type Linker interface {
+	// Link creates newname as a hard link to the file oldname, see
+	// os.Link: both names refer to the same file, which is only deleted
+	// once all its names are removed.
+	Link(oldname, newname string) error
+}
+
+var (
+	_ Linker = OsFs{}
+	_ Linker = (*MemMapFs)(nil)
+)
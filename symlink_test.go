@@ -0,0 +1,142 @@
+package afero
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestSymlink(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks need special privileges on windows")
+	}
+	defer removeAllTestFiles(t)
+	for _, fs := range Fss {
+		linker, ok := fs.(Symlinker)
+		if !ok {
+			t.Fatalf("%s does not implement Symlinker", fs.Name())
+		}
+		tmp := testDir(fs)
+		dir := filepath.Join(tmp, "dir")
+		file := filepath.Join(dir, "file.txt")
+		fs.MkdirAll(dir, 0777)
+		WriteFile(fs, file, []byte("content"), 0644)
+
+		fileLink := filepath.Join(tmp, "file-link")
+		if err := linker.SymlinkIfPossible(file, fileLink); err != nil {
+			t.Fatalf("%s: SymlinkIfPossible: %s", fs.Name(), err)
+		}
+		if err := linker.SymlinkIfPossible(file, fileLink); err == nil {
+			t.Errorf("%s: SymlinkIfPossible over existing file succeeded", fs.Name())
+		}
+		dirLink := filepath.Join(tmp, "dir-link")
+		if err := linker.SymlinkIfPossible("dir", dirLink); err != nil {
+			t.Fatalf("%s: SymlinkIfPossible: %s", fs.Name(), err)
+		}
+
+		if target, err := linker.ReadlinkIfPossible(fileLink); err != nil || target != file {
+			t.Errorf("%s: ReadlinkIfPossible = %q, %v, want %q", fs.Name(), target, err, file)
+		}
+		if _, err := linker.ReadlinkIfPossible(file); err == nil {
+			t.Errorf("%s: ReadlinkIfPossible on a regular file succeeded", fs.Name())
+		}
+
+		fi, lstatCalled, err := linker.LstatIfPossible(fileLink)
+		if err != nil || !lstatCalled {
+			t.Fatalf("%s: LstatIfPossible = %v, %v", fs.Name(), lstatCalled, err)
+		}
+		if fi.Mode()&os.ModeSymlink == 0 {
+			t.Errorf("%s: LstatIfPossible mode = %v, want a symlink", fs.Name(), fi.Mode())
+		}
+		if fi, err = fs.Stat(fileLink); err != nil || fi.Mode()&os.ModeSymlink != 0 || fi.Size() != 7 {
+			t.Errorf("%s: Stat did not follow the symlink: %v, %v", fs.Name(), fi, err)
+		}
+
+		for _, name := range []string{fileLink, filepath.Join(dirLink, "file.txt")} {
+			data, err := ReadFile(fs, name)
+			if err != nil || string(data) != "content" {
+				t.Errorf("%s: ReadFile(%q) = %q, %v", fs.Name(), name, data, err)
+			}
+		}
+
+		if err := fs.Remove(fileLink); err != nil {
+			t.Fatalf("%s: Remove: %s", fs.Name(), err)
+		}
+		if _, err := fs.Stat(file); err != nil {
+			t.Errorf("%s: removing the symlink removed the target: %s", fs.Name(), err)
+		}
+	}
+}
+
+func TestLstat(t *testing.T) {
+	fs := &MemMapFs{}
+	WriteFile(fs, "/file", []byte("content"), 0644)
+	fs.SymlinkIfPossible("/file", "/link")
+	fs.SymlinkIfPossible("/missing", "/dangling")
+
+	if fi, err := Lstat(fs, "/link"); err != nil || fi.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("Lstat of a symlink: %v, %v", fi, err)
+	}
+	if _, err := Lstat(fs, "/dangling"); err != nil {
+		t.Errorf("Lstat of a dangling symlink: %v", err)
+	}
+	// without Lstater the symlink is followed
+	ro := NewReadOnlyFs(fs)
+	if fi, err := Lstat(ro, "/link"); err != nil || fi.Mode()&os.ModeSymlink != 0 || fi.Size() != 7 {
+		t.Errorf("Lstat of a symlink without Lstater: %v, %v", fi, err)
+	}
+}
+
+func TestSymlinkLoop(t *testing.T) {
+	fs := &MemMapFs{}
+	fs.SymlinkIfPossible("/b", "/a")
+	fs.SymlinkIfPossible("/a", "/b")
+	if _, err := fs.Stat("/a"); err == nil {
+		t.Error("Stat of a symlink loop succeeded")
+	}
+	if _, _, err := fs.LstatIfPossible("/a"); err != nil {
+		t.Errorf("LstatIfPossible of a symlink loop: %s", err)
+	}
+}
+
+func TestLink(t *testing.T) {
+	defer removeAllTestFiles(t)
+	for _, fs := range Fss {
+		linker, ok := fs.(Linker)
+		if !ok {
+			t.Fatalf("%s does not implement Linker", fs.Name())
+		}
+		tmp := testDir(fs)
+		file := filepath.Join(tmp, "file")
+		link := filepath.Join(tmp, "link")
+		WriteFile(fs, file, []byte("shared"), 0644)
+
+		if err := linker.Link(file, link); err != nil {
+			t.Fatalf("%s: Link: %s", fs.Name(), err)
+		}
+		if err := linker.Link(file, link); !os.IsExist(err) {
+			t.Errorf("%s: Link to an existing name: got %v", fs.Name(), err)
+		}
+		if err := linker.Link(filepath.Join(tmp, "missing"), filepath.Join(tmp, "other")); !os.IsNotExist(err) {
+			t.Errorf("%s: Link of a missing file: got %v", fs.Name(), err)
+		}
+
+		f, err := fs.OpenFile(link, os.O_WRONLY|os.O_APPEND, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.WriteString(" data")
+		f.Close()
+		if got, err := ReadFile(fs, file); err != nil || string(got) != "shared data" {
+			t.Errorf("%s: write through the link: got %q, %v", fs.Name(), got, err)
+		}
+
+		if err := fs.Remove(file); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := ReadFile(fs, link); err != nil || string(got) != "shared data" {
+			t.Errorf("%s: link after removing the file: got %q, %v", fs.Name(), got, err)
+		}
+	}
+}
@@ -0,0 +1,368 @@
+package afero
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// TarFs is a read-only Fs serving the members of a tar archive. The
+// archive is indexed once on creation, member contents are read from the
+// underlying io.ReaderAt on demand.
+//
+// Directories are synthesized from the member paths, so archives without
+// explicit directory entries can be listed as well. All modifying
+// operations fail with syscall.EROFS.
+type TarFs struct {
+	r     io.ReaderAt
+	files map[string]*tarEntry
+	err   error // error from indexing the archive
+}
+
+type tarEntry struct {
+	hdr      *tar.Header
+	offset   int64  // start of the content in the archive
+	data     []byte // content of sparse members, they can't be read in place
+	children map[string]*tarEntry
+}
+
+// NewTarFs returns a TarFs for the tar archive of the given size in r. If
+// the archive can't be read, every operation on the Fs returns the error.
+func NewTarFs(r io.ReaderAt, size int64) Fs {
+	fs := &TarFs{r: r, files: make(map[string]*tarEntry)}
+	fs.err = fs.index(io.NewSectionReader(r, 0, size))
+	return fs
+}
+
+func tarName(name string) string {
+	return path.Clean("/" + filepath.ToSlash(name))
+}
+
+func (fs *TarFs) index(sr *io.SectionReader) error {
+	fs.files["/"] = &tarEntry{
+		hdr:      &tar.Header{Name: "/", Typeflag: tar.TypeDir, Mode: 0555},
+		children: make(map[string]*tarEntry),
+	}
+	var links []*tarEntry
+
+	tr := tar.NewReader(sr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		name := tarName(hdr.Name)
+		if name == "/" {
+			continue
+		}
+		// the tar reader doesn't read ahead, so we are at the member's content
+		offset, err := sr.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return err
+		}
+		hdr.Name = name
+		e := &tarEntry{hdr: hdr, offset: offset}
+		switch {
+		case hdr.Typeflag == tar.TypeDir:
+			if old, ok := fs.files[name]; ok && old.children != nil {
+				// keep the children of a synthesized directory
+				old.hdr = hdr
+				continue
+			}
+			e.children = make(map[string]*tarEntry)
+		case hdr.Typeflag == tar.TypeLink:
+			links = append(links, e)
+		case isSparse(hdr):
+			if e.data, err = ioutil.ReadAll(tr); err != nil {
+				return err
+			}
+		}
+		fs.add(name, e)
+	}
+
+	// hard links share the content of their target
+	for _, e := range links {
+		if t, ok := fs.files[tarName(e.hdr.Linkname)]; ok && t.hdr.Typeflag != tar.TypeLink {
+			e.hdr.Size, e.offset, e.data = t.hdr.Size, t.offset, t.data
+		}
+	}
+	return nil
+}
+
+func isSparse(hdr *tar.Header) bool {
+	if hdr.Typeflag == tar.TypeGNUSparse {
+		return true
+	}
+	for k := range hdr.PAXRecords {
+		if strings.HasPrefix(k, "GNU.sparse.") {
+			return true
+		}
+	}
+	return false
+}
+
+// add stores e under name, creating any missing parent directory.
+func (fs *TarFs) add(name string, e *tarEntry) {
+	fs.files[name] = e
+	for {
+		dir := path.Dir(name)
+		parent, ok := fs.files[dir]
+		exists := ok && parent.children != nil
+		if !exists {
+			parent = &tarEntry{
+				hdr:      &tar.Header{Name: dir, Typeflag: tar.TypeDir, Mode: 0555},
+				children: make(map[string]*tarEntry),
+			}
+			fs.files[dir] = parent
+		}
+		parent.children[path.Base(name)] = e
+		if exists {
+			return
+		}
+		name, e = dir, parent
+	}
+}
+
+// lookup returns the entry for name, following symbolic links in the
+// archive if follow is set.
+func (fs *TarFs) lookup(op, name string, follow bool) (*tarEntry, error) {
+	if fs.err != nil {
+		return nil, &os.PathError{Op: op, Path: name, Err: fs.err}
+	}
+	p := tarName(name)
+	for hops := 0; ; hops++ {
+		e, ok := fs.files[p]
+		if !ok {
+			return nil, &os.PathError{Op: op, Path: name, Err: os.ErrNotExist}
+		}
+		if !follow || e.hdr.Typeflag != tar.TypeSymlink {
+			return e, nil
+		}
+		if hops == maxSymlinkHops {
+			return nil, &os.PathError{Op: op, Path: name, Err: syscall.ELOOP}
+		}
+		if target := e.hdr.Linkname; path.IsAbs(target) {
+			p = tarName(target)
+		} else {
+			p = tarName(path.Join(path.Dir(p), target))
+		}
+	}
+}
+
+func (fs *TarFs) Name() string { return "TarFs" }
+
+func (fs *TarFs) Open(name string) (File, error) {
+	e, err := fs.lookup("open", name, true)
+	if err != nil {
+		return nil, err
+	}
+	f := &tarFile{name: name, entry: e}
+	switch {
+	case e.children != nil:
+	case e.data != nil:
+		f.r = bytes.NewReader(e.data)
+	default:
+		f.r = io.NewSectionReader(fs.r, e.offset, e.hdr.Size)
+	}
+	return f, nil
+}
+
+func (fs *TarFs) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	if flag&(os.O_WRONLY|syscall.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) != 0 {
+		return nil, &os.PathError{Op: "open", Path: name, Err: syscall.EROFS}
+	}
+	return fs.Open(name)
+}
+
+func (fs *TarFs) Stat(name string) (os.FileInfo, error) {
+	e, err := fs.lookup("stat", name, true)
+	if err != nil {
+		return nil, err
+	}
+	return e.hdr.FileInfo(), nil
+}
+
+func (fs *TarFs) LstatIfPossible(name string) (os.FileInfo, bool, error) {
+	e, err := fs.lookup("lstat", name, false)
+	if err != nil {
+		return nil, true, err
+	}
+	return e.hdr.FileInfo(), true, nil
+}
+
+func (fs *TarFs) Create(name string) (File, error) {
+	return nil, &os.PathError{Op: "create", Path: name, Err: syscall.EROFS}
+}
+
+func (fs *TarFs) Mkdir(name string, perm os.FileMode) error {
+	return &os.PathError{Op: "mkdir", Path: name, Err: syscall.EROFS}
+}
+
+func (fs *TarFs) MkdirAll(name string, perm os.FileMode) error {
+	return &os.PathError{Op: "mkdir", Path: name, Err: syscall.EROFS}
+}
+
+func (fs *TarFs) Remove(name string) error {
+	return &os.PathError{Op: "remove", Path: name, Err: syscall.EROFS}
+}
+
+func (fs *TarFs) RemoveAll(name string) error {
+	return &os.PathError{Op: "remove", Path: name, Err: syscall.EROFS}
+}
+
+func (fs *TarFs) Rename(oldname, newname string) error {
+	return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: syscall.EROFS}
+}
+
+func (fs *TarFs) Chmod(name string, mode os.FileMode) error {
+	return &os.PathError{Op: "chmod", Path: name, Err: syscall.EROFS}
+}
+
+func (fs *TarFs) Chtimes(name string, atime, mtime time.Time) error {
+	return &os.PathError{Op: "chtimes", Path: name, Err: syscall.EROFS}
+}
+
+type tarContent interface {
+	io.ReadSeeker
+	io.ReaderAt
+}
+
+type tarFile struct {
+	name   string
+	entry  *tarEntry
+	r      tarContent // nil for directories
+	closed bool
+	dir    []os.FileInfo // remaining Readdir entries, set on the first call
+	listed bool
+}
+
+func (f *tarFile) check(op string) error {
+	if f.closed {
+		return ErrFileClosed
+	}
+	if f.r == nil {
+		return &os.PathError{Op: op, Path: f.name, Err: syscall.EISDIR}
+	}
+	return nil
+}
+
+func (f *tarFile) Name() string { return f.name }
+
+func (f *tarFile) Close() error {
+	if f.closed {
+		return ErrFileClosed
+	}
+	f.closed = true
+	return nil
+}
+
+func (f *tarFile) Read(p []byte) (int, error) {
+	if err := f.check("read"); err != nil {
+		return 0, err
+	}
+	return f.r.Read(p)
+}
+
+func (f *tarFile) ReadAt(p []byte, off int64) (int, error) {
+	if err := f.check("read"); err != nil {
+		return 0, err
+	}
+	return f.r.ReadAt(p, off)
+}
+
+func (f *tarFile) Seek(offset int64, whence int) (int64, error) {
+	if f.closed {
+		return 0, ErrFileClosed
+	}
+	if f.r == nil {
+		return 0, nil
+	}
+	return f.r.Seek(offset, whence)
+}
+
+func (f *tarFile) Write(p []byte) (int, error) {
+	return 0, f.readOnly("write")
+}
+
+func (f *tarFile) WriteAt(p []byte, off int64) (int, error) {
+	return 0, f.readOnly("write")
+}
+
+func (f *tarFile) WriteString(s string) (int, error) {
+	return 0, f.readOnly("write")
+}
+
+func (f *tarFile) Truncate(size int64) error {
+	return f.readOnly("truncate")
+}
+
+func (f *tarFile) readOnly(op string) error {
+	if f.closed {
+		return ErrFileClosed
+	}
+	return &os.PathError{Op: op, Path: f.name, Err: syscall.EROFS}
+}
+
+func (f *tarFile) Sync() error {
+	if f.closed {
+		return ErrFileClosed
+	}
+	return nil
+}
+
+func (f *tarFile) Stat() (os.FileInfo, error) {
+	if f.closed {
+		return nil, ErrFileClosed
+	}
+	return f.entry.hdr.FileInfo(), nil
+}
+
+func (f *tarFile) Readdir(count int) ([]os.FileInfo, error) {
+	if f.closed {
+		return nil, ErrFileClosed
+	}
+	if f.entry.children == nil {
+		return nil, &os.PathError{Op: "readdir", Path: f.name, Err: syscall.ENOTDIR}
+	}
+	if !f.listed {
+		f.listed = true
+		for _, e := range f.entry.children {
+			f.dir = append(f.dir, e.hdr.FileInfo())
+		}
+		sort.Sort(byName(f.dir))
+	}
+	if count <= 0 {
+		list := f.dir
+		f.dir = nil
+		return list, nil
+	}
+	if len(f.dir) == 0 {
+		return nil, io.EOF
+	}
+	if count > len(f.dir) {
+		count = len(f.dir)
+	}
+	list := f.dir[:count]
+	f.dir = f.dir[count:]
+	return list, nil
+}
+
+func (f *tarFile) Readdirnames(n int) ([]string, error) {
+	list, err := f.Readdir(n)
+	names := make([]string, len(list))
+	for i, fi := range list {
+		names[i] = fi.Name()
+	}
+	return names, err
+}
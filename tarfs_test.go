@@ -0,0 +1,198 @@
+package afero
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func newTestTarFs(t *testing.T) Fs {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, m := range []struct {
+		hdr  tar.Header
+		body string
+	}{
+		{tar.Header{Name: "top.txt", Mode: 0644}, "top level"},
+		{tar.Header{Name: "dir/", Typeflag: tar.TypeDir, Mode: 0700}, ""},
+		{tar.Header{Name: "dir/a.txt", Mode: 0600}, "0123456789"},
+		// no header for deep or deep/er
+		{tar.Header{Name: "./deep/er/b.txt", Mode: 0644}, "bbb"},
+		{tar.Header{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "dir/a.txt"}, ""},
+		{tar.Header{Name: "hard", Typeflag: tar.TypeLink, Linkname: "top.txt"}, ""},
+	} {
+		hdr := m.hdr
+		hdr.Size = int64(len(m.body))
+		if err := tw.WriteHeader(&hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(tw, m.body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return NewTarFs(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+}
+
+func TestTarFsRead(t *testing.T) {
+	fs := newTestTarFs(t)
+
+	for name, want := range map[string]string{
+		"top.txt":          "top level",
+		"/dir/a.txt":       "0123456789",
+		"deep/er/b.txt":    "bbb",
+		"link":             "0123456789",
+		"hard":             "top level",
+		"dir/../top.txt":   "top level",
+		"/deep/er/./b.txt": "bbb",
+	} {
+		got, err := ReadFile(fs, name)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+		} else if string(got) != want {
+			t.Errorf("%s: got %q, want %q", name, got, want)
+		}
+	}
+
+	fi, err := fs.Stat("dir/a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Name() != "a.txt" || fi.Size() != 10 || fi.Mode() != 0600 {
+		t.Errorf("unexpected FileInfo: %s %d %v", fi.Name(), fi.Size(), fi.Mode())
+	}
+	if fi, _, err := fs.(Lstater).LstatIfPossible("link"); err != nil || fi.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("expected a symlink, got %v, %v", fi, err)
+	}
+	if _, err := fs.Stat("missing"); !os.IsNotExist(err) {
+		t.Errorf("expected a not exist error, got %v", err)
+	}
+}
+
+func TestTarFsReadDir(t *testing.T) {
+	fs := newTestTarFs(t)
+
+	for dir, want := range map[string][]string{
+		"/":       {"deep", "dir", "hard", "link", "top.txt"},
+		"dir":     {"a.txt"},
+		"deep":    {"er"},
+		"deep/er": {"b.txt"},
+	} {
+		list, err := ReadDir(fs, dir)
+		if err != nil {
+			t.Fatalf("%s: %v", dir, err)
+		}
+		var names []string
+		for _, fi := range list {
+			names = append(names, fi.Name())
+		}
+		if !reflect.DeepEqual(names, want) {
+			t.Errorf("%s: got %v, want %v", dir, names, want)
+		}
+	}
+
+	fi, err := fs.Stat("deep/er")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fi.IsDir() {
+		t.Error("synthesized directory is not a directory")
+	}
+	if fi, _ := fs.Stat("dir"); fi.Mode() != os.ModeDir|0700 {
+		t.Errorf("got mode %v for an explicit directory", fi.Mode())
+	}
+
+	f, err := fs.Open("/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	for i := 0; i < 5; i++ {
+		if names, err := f.Readdirnames(1); err != nil || len(names) != 1 {
+			t.Fatalf("got %v, %v", names, err)
+		}
+	}
+	if _, err := f.Readdirnames(1); err != io.EOF {
+		t.Errorf("expected io.EOF, got %v", err)
+	}
+}
+
+func TestTarFsSeek(t *testing.T) {
+	fs := newTestTarFs(t)
+	f, err := fs.Open("dir/a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if pos, err := f.Seek(6, io.SeekStart); err != nil || pos != 6 {
+		t.Fatalf("got %d, %v", pos, err)
+	}
+	got, err := ioutil.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "6789" {
+		t.Errorf("got %q, want %q", got, "6789")
+	}
+
+	buf := make([]byte, 3)
+	if _, err := f.ReadAt(buf, 2); err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "234" {
+		t.Errorf("got %q, want %q", buf, "234")
+	}
+}
+
+func TestTarFsReadOnly(t *testing.T) {
+	fs := newTestTarFs(t)
+
+	errs := []error{
+		fs.Mkdir("new", 0777),
+		fs.MkdirAll("new/dir", 0777),
+		fs.Remove("top.txt"),
+		fs.RemoveAll("dir"),
+		fs.Rename("top.txt", "moved"),
+		fs.Chmod("top.txt", 0777),
+	}
+	_, err := fs.Create("new")
+	errs = append(errs, err)
+	_, err = fs.OpenFile("top.txt", os.O_RDWR, 0)
+	errs = append(errs, err)
+
+	f, err := fs.Open("top.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.Write([]byte("x"))
+	errs = append(errs, err, f.Truncate(0))
+
+	for i, err := range errs {
+		if !errors.Is(err, syscall.EROFS) {
+			t.Errorf("%d: expected EROFS, got %v", i, err)
+		}
+	}
+
+	f.Close()
+	if _, err := f.Read(make([]byte, 1)); err != ErrFileClosed {
+		t.Errorf("expected ErrFileClosed, got %v", err)
+	}
+}
+
+func TestTarFsBroken(t *testing.T) {
+	data := strings.Repeat("not a tar archive ", 100)
+	fs := NewTarFs(strings.NewReader(data), int64(len(data)))
+	if _, err := fs.Open("anything"); err == nil || os.IsNotExist(err) {
+		t.Errorf("expected the archive error, got %v", err)
+	}
+}
@@ -0,0 +1,145 @@
+package afero
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// The TeeFs copies the files read from the base Fs into the sink Fs while
+// they are read, populating the sink lazily on access, e.g. to warm a cache.
+// Unlike CacheOnReadFs, which copies a file as a whole before it is read,
+// the copy is streamed along with the reads.
+//
+// A file opened for reading is written to a temporary file next to its name
+// in the sink, which replaces the file in the sink when the file is closed,
+// with the modification time of the base file. Only files read from the
+// start to the end in sequence are copied: after a Seek elsewhere, or if
+// writing to the sink fails, the temporary file is removed on Close.
+// Failures of the sink never fail the reads.
+//
+// All other calls are passed to the base, directories are not copied.
+type TeeFs struct {
+	base Fs
+	sink Fs
+}
+
+func NewTeeFs(base Fs, sink Fs) Fs {
+	return &TeeFs{base: base, sink: sink}
+}
+
+func (t *TeeFs) Name() string {
+	return "TeeFs"
+}
+
+func (t *TeeFs) Create(name string) (File, error) {
+	return t.base.Create(name)
+}
+
+func (t *TeeFs) Open(name string) (File, error) {
+	return t.OpenFile(name, os.O_RDONLY, 0)
+}
+
+func (t *TeeFs) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	f, err := t.base.OpenFile(name, flag, perm)
+	if err != nil || flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) != 0 {
+		return f, err
+	}
+	fi, err := f.Stat()
+	if err != nil || !fi.Mode().IsRegular() {
+		return f, nil
+	}
+	if err := t.sink.MkdirAll(filepath.Dir(name), 0777); err != nil {
+		return f, nil
+	}
+	tmp, err := TempFile(t.sink, filepath.Dir(name), "."+filepath.Base(name)+".tee-*")
+	if err != nil {
+		return f, nil
+	}
+	return &teeFile{File: f, fs: t, name: name, fi: fi, tmp: tmp}, nil
+}
+
+func (t *TeeFs) Mkdir(name string, perm os.FileMode) error {
+	return t.base.Mkdir(name, perm)
+}
+
+func (t *TeeFs) MkdirAll(path string, perm os.FileMode) error {
+	return t.base.MkdirAll(path, perm)
+}
+
+func (t *TeeFs) Remove(name string) error {
+	return t.base.Remove(name)
+}
+
+func (t *TeeFs) RemoveAll(path string) error {
+	return t.base.RemoveAll(path)
+}
+
+func (t *TeeFs) Rename(oldname, newname string) error {
+	return t.base.Rename(oldname, newname)
+}
+
+func (t *TeeFs) Stat(name string) (os.FileInfo, error) {
+	return t.base.Stat(name)
+}
+
+func (t *TeeFs) Chmod(name string, mode os.FileMode) error {
+	return t.base.Chmod(name, mode)
+}
+
+func (t *TeeFs) Chtimes(name string, atime, mtime time.Time) error {
+	return t.base.Chtimes(name, atime, mtime)
+}
+
+// teeFile is a file of the base read into tmp, a temporary file in the sink.
+type teeFile struct {
+	File
+	fs     *TeeFs
+	name   string
+	fi     os.FileInfo
+	tmp    File
+	off    int64 // bytes written to tmp
+	eof    bool
+	broken bool // tmp is incomplete
+}
+
+func (f *teeFile) Read(p []byte) (int, error) {
+	n, err := f.File.Read(p)
+	if n > 0 && !f.broken {
+		if _, werr := f.tmp.Write(p[:n]); werr != nil {
+			f.broken = true
+		}
+		f.off += int64(n)
+	}
+	if err == io.EOF {
+		f.eof = true
+	}
+	return n, err
+}
+
+func (f *teeFile) Seek(offset int64, whence int) (int64, error) {
+	pos, err := f.File.Seek(offset, whence)
+	if err == nil && pos != f.off {
+		f.broken = true
+	}
+	return pos, err
+}
+
+// Close closes the file and moves the copy into place, if it is complete.
+func (f *teeFile) Close() error {
+	err := f.File.Close()
+	terr := f.tmp.Close()
+	sink := f.fs.sink
+	if f.broken || !f.eof || terr != nil {
+		sink.Remove(f.tmp.Name())
+		return err
+	}
+	if rerr := sink.Rename(f.tmp.Name(), f.name); rerr != nil {
+		sink.Remove(f.tmp.Name())
+		return err
+	}
+	sink.Chmod(f.name, f.fi.Mode().Perm())
+	sink.Chtimes(f.name, f.fi.ModTime(), f.fi.ModTime())
+	return err
+}
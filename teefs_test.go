@@ -0,0 +1,70 @@
+package afero
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTeeFs(t *testing.T) {
+	base, sink := NewMemMapFs(), NewMemMapFs()
+	content := strings.Repeat("data ", 10000)
+	WriteFile(base, "/dir/file", []byte(content), 0640)
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	base.Chtimes("/dir/file", mtime, mtime)
+	fs := NewTeeFs(base, sink)
+
+	f, err := fs.Open("/dir/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 1000)
+	if _, err := io.ReadFull(f, buf); err != nil {
+		t.Fatal(err)
+	}
+	// not in the sink before the file is read completely and closed
+	if ok, _ := Exists(sink, "/dir/file"); ok {
+		t.Error("sink populated before Close")
+	}
+	if _, err := io.Copy(io.Discard, f); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ReadFile(sink, "/dir/file")
+	if err != nil || string(data) != content {
+		t.Fatalf("sink has %d bytes, %v", len(data), err)
+	}
+	fi, _ := sink.Stat("/dir/file")
+	if !fi.ModTime().Equal(mtime) || fi.Mode().Perm() != 0640 {
+		t.Errorf("sink file has mtime %v, mode %v", fi.ModTime(), fi.Mode())
+	}
+	if names, _ := ReadDirNames(sink, "/dir"); !reflect.DeepEqual(names, []string{"file"}) {
+		t.Errorf("sink directory: %v", names)
+	}
+}
+
+func TestTeeFsPartialRead(t *testing.T) {
+	base, sink := NewMemMapFs(), NewMemMapFs()
+	WriteFile(base, "/file", []byte("0123456789"), 0644)
+	WriteFile(base, "/seek", []byte("0123456789"), 0644)
+	fs := NewTeeFs(base, sink)
+
+	f, _ := fs.Open("/file")
+	f.Read(make([]byte, 4))
+	f.Close()
+
+	f, _ = fs.Open("/seek")
+	f.Seek(5, io.SeekStart)
+	io.ReadAll(f)
+	f.Close()
+
+	// incomplete copies are dropped
+	if names, _ := ReadDirNames(sink, "/"); len(names) != 0 {
+		t.Errorf("sink has %v, want nothing", names)
+	}
+}
@@ -0,0 +1,266 @@
+package afero
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var errTextUnsupported = errors.New("operation not supported on a text file")
+
+// LineEndingMode is the line ending a TextFs stores text files with.
+type LineEndingMode int
+
+const (
+	// LineEndingLF stores lines ending in "\n", as on Unix.
+	LineEndingLF LineEndingMode = iota
+	// LineEndingCRLF stores lines ending in "\r\n", as on Windows.
+	LineEndingCRLF
+)
+
+// textExtensions are the extensions of the files converted by NewTextFs.
+var textExtensions = map[string]bool{
+	".txt": true, ".md": true, ".csv": true, ".json": true, ".xml": true,
+	".yaml": true, ".yml": true, ".toml": true, ".ini": true, ".conf": true,
+	".html": true, ".css": true, ".js": true, ".go": true, ".sh": true,
+	".bat": true, ".cmd": true, ".ps1": true,
+}
+
+// The TextFs converts the line endings of text files transparently: reading
+// a text file of the base Fs returns lines ending in "\n", whatever they end
+// in in the file, and writing to it stores the lines with the line ending of
+// the mode. Which files are text files is decided by their name, all other
+// files, and all other operations, are passed to the base Fs unchanged.
+//
+// The conversion changes the length of the data, so text files can't be
+// opened for reading and writing at once, and can't be seeked, Seek only
+// reports the current offset. Stat returns the size of the stored file.
+type TextFs struct {
+	source Fs
+	mode   LineEndingMode
+	match  func(name string) bool
+}
+
+// NewTextFs returns a TextFs converting the files with the extension of a
+// common text format, e.g. ".txt", ".md", ".json" or ".go", ignoring case.
+func NewTextFs(source Fs, mode LineEndingMode) Fs {
+	return NewTextFsFunc(source, mode, func(name string) bool {
+		return textExtensions[strings.ToLower(filepath.Ext(name))]
+	})
+}
+
+// NewTextFsFunc returns a TextFs converting the files for which match
+// returns true.
+func NewTextFsFunc(source Fs, mode LineEndingMode, match func(name string) bool) Fs {
+	return &TextFs{source: source, mode: mode, match: match}
+}
+
+func (t *TextFs) Name() string {
+	return "TextFs"
+}
+
+func (t *TextFs) Create(name string) (File, error) {
+	return t.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+func (t *TextFs) Open(name string) (File, error) {
+	return t.OpenFile(name, os.O_RDONLY, 0)
+}
+
+// OpenFile opens a text file either for reading or for writing. As there is
+// nothing to read after truncating it, os.O_RDWR is accepted together with
+// os.O_TRUNC, like Create does.
+func (t *TextFs) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	if !t.match(name) {
+		return t.source.OpenFile(name, flag, perm)
+	}
+	write := flag&(os.O_WRONLY|os.O_RDWR) != 0
+	if flag&os.O_RDWR != 0 && flag&os.O_TRUNC == 0 {
+		return nil, &os.PathError{Op: "open", Path: name, Err: errTextUnsupported}
+	}
+	f, err := t.source.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	if fi, err := f.Stat(); err == nil && fi.IsDir() {
+		return f, nil
+	}
+	tf := &textFile{f: f, mode: t.mode}
+	if !write {
+		tf.r = bufio.NewReader(f)
+	}
+	return tf, nil
+}
+
+func (t *TextFs) Mkdir(name string, perm os.FileMode) error {
+	return t.source.Mkdir(name, perm)
+}
+
+func (t *TextFs) MkdirAll(path string, perm os.FileMode) error {
+	return t.source.MkdirAll(path, perm)
+}
+
+func (t *TextFs) Remove(name string) error {
+	return t.source.Remove(name)
+}
+
+func (t *TextFs) RemoveAll(path string) error {
+	return t.source.RemoveAll(path)
+}
+
+func (t *TextFs) Rename(oldname, newname string) error {
+	return t.source.Rename(oldname, newname)
+}
+
+func (t *TextFs) Stat(name string) (os.FileInfo, error) {
+	return t.source.Stat(name)
+}
+
+func (t *TextFs) Chmod(name string, mode os.FileMode) error {
+	return t.source.Chmod(name, mode)
+}
+
+func (t *TextFs) Chtimes(name string, atime, mtime time.Time) error {
+	return t.source.Chtimes(name, atime, mtime)
+}
+
+// textFile is a text file opened for reading or, with r nil, for writing.
+type textFile struct {
+	f    File
+	mode LineEndingMode
+	r    *bufio.Reader
+	off  int64 // in the converted data
+	cr   bool  // the last byte written was a '\r', held back in LF mode
+}
+
+func (f *textFile) unsupported(op string) error {
+	return &os.PathError{Op: op, Path: f.f.Name(), Err: errTextUnsupported}
+}
+
+// Read returns the data with every "\r\n" replaced by "\n".
+func (f *textFile) Read(p []byte) (int, error) {
+	if f.r == nil {
+		return 0, f.unsupported("read")
+	}
+	n := 0
+	for n < len(p) {
+		c, err := f.r.ReadByte()
+		if err != nil {
+			f.off += int64(n)
+			return n, err
+		}
+		if c == '\r' {
+			if next, err := f.r.Peek(1); err == nil && next[0] == '\n' {
+				continue
+			}
+		}
+		p[n] = c
+		n++
+		// don't block for more data once there is some to return
+		if f.r.Buffered() == 0 {
+			break
+		}
+	}
+	f.off += int64(n)
+	return n, nil
+}
+
+func (f *textFile) ReadAt(p []byte, off int64) (int, error) {
+	return 0, f.unsupported("readat")
+}
+
+// Write stores p with the line endings of the mode. In LF mode a '\r' at the
+// end of p is held back until it is known whether a '\n' follows.
+func (f *textFile) Write(p []byte) (int, error) {
+	if f.r != nil {
+		return 0, f.unsupported("write")
+	}
+	buf := make([]byte, 0, len(p)+len(p)/16+1)
+	for _, c := range p {
+		switch f.mode {
+		case LineEndingCRLF:
+			if c == '\n' && !f.cr {
+				buf = append(buf, '\r')
+			}
+			buf = append(buf, c)
+			f.cr = c == '\r'
+		default:
+			if f.cr && c != '\n' {
+				buf = append(buf, '\r')
+			}
+			f.cr = c == '\r'
+			if !f.cr {
+				buf = append(buf, c)
+			}
+		}
+	}
+	if _, err := f.f.Write(buf); err != nil {
+		return 0, err
+	}
+	f.off += int64(len(p))
+	return len(p), nil
+}
+
+func (f *textFile) WriteAt(p []byte, off int64) (int, error) {
+	return 0, f.unsupported("writeat")
+}
+
+func (f *textFile) WriteString(s string) (int, error) {
+	return f.Write([]byte(s))
+}
+
+// flush writes a '\r' held back by Write, at the end of the file.
+func (f *textFile) flush() error {
+	if f.r != nil || f.mode != LineEndingLF || !f.cr {
+		return nil
+	}
+	f.cr = false
+	_, err := f.f.Write([]byte{'\r'})
+	return err
+}
+
+// Seek only reports the current offset in the converted data.
+func (f *textFile) Seek(offset int64, whence int) (int64, error) {
+	if offset == 0 && whence == io.SeekCurrent {
+		return f.off, nil
+	}
+	return 0, &os.PathError{Op: "seek", Path: f.f.Name(), Err: syscall.ESPIPE}
+}
+
+func (f *textFile) Close() error {
+	err := f.flush()
+	if cerr := f.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Sync doesn't write a '\r' held back by Write, it is written on Close.
+func (f *textFile) Sync() error {
+	return f.f.Sync()
+}
+
+func (f *textFile) Truncate(size int64) error {
+	return f.unsupported("truncate")
+}
+
+func (f *textFile) Name() string {
+	return f.f.Name()
+}
+
+func (f *textFile) Readdir(count int) ([]os.FileInfo, error) {
+	return f.f.Readdir(count)
+}
+
+func (f *textFile) Readdirnames(n int) ([]string, error) {
+	return f.f.Readdirnames(n)
+}
+
+func (f *textFile) Stat() (os.FileInfo, error) {
+	return f.f.Stat()
+}
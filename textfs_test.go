@@ -0,0 +1,136 @@
+package afero
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+	"testing/iotest"
+)
+
+func TestTextFsRoundTrip(t *testing.T) {
+	tests := []struct {
+		mode   LineEndingMode
+		write  string
+		stored string
+		read   string
+	}{
+		{LineEndingCRLF, "a\nb\r\nc\n", "a\r\nb\r\nc\r\n", "a\nb\nc\n"},
+		{LineEndingCRLF, "no newline", "no newline", "no newline"},
+		{LineEndingCRLF, "\r\r\n\n", "\r\r\n\r\n", "\r\n\n"},
+		{LineEndingLF, "a\r\nb\nc\r\n", "a\nb\nc\n", "a\nb\nc\n"},
+		{LineEndingLF, "lone\rcr\r", "lone\rcr\r", "lone\rcr\r"},
+		{LineEndingLF, "\r\r\n", "\r\n", "\n"},
+	}
+	for _, tt := range tests {
+		base := NewMemMapFs()
+		fs := NewTextFs(base, tt.mode)
+
+		// byte by byte, so the line endings are split between writes
+		f, err := fs.Create("/file.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < len(tt.write); i++ {
+			if _, err := f.Write([]byte{tt.write[i]}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := f.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if raw, _ := ReadFile(base, "/file.txt"); string(raw) != tt.stored {
+			t.Errorf("mode %d, write %q: stored %q, want %q", tt.mode, tt.write, raw, tt.stored)
+		}
+
+		f, err = fs.Open("/file.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ioutil.ReadAll(iotest.OneByteReader(f))
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != tt.read {
+			t.Errorf("mode %d, stored %q: read %q, want %q", tt.mode, tt.stored, got, tt.read)
+		}
+	}
+}
+
+func TestTextFsReadsCRLF(t *testing.T) {
+	base := NewMemMapFs()
+	fs := NewTextFs(base, LineEndingLF)
+	WriteFile(base, "/dos.TXT", []byte("one\r\ntwo\r\n"), 0644)
+
+	got, err := ReadFile(fs, "/dos.TXT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "one\ntwo\n" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestTextFsBinary(t *testing.T) {
+	base := NewMemMapFs()
+	fs := NewTextFs(base, LineEndingCRLF)
+	data := []byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x1a, '\n'}
+
+	if err := WriteFile(fs, "/image.png", data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if raw, _ := ReadFile(base, "/image.png"); string(raw) != string(data) {
+		t.Errorf("stored %q, want %q", raw, data)
+	}
+	if got, _ := ReadFile(fs, "/image.png"); string(got) != string(data) {
+		t.Errorf("read %q, want %q", got, data)
+	}
+
+	// a file matching the predicate is converted whatever its extension
+	fs = NewTextFsFunc(base, LineEndingCRLF, func(name string) bool {
+		return name == "/Makefile"
+	})
+	WriteFile(fs, "/Makefile", []byte("all:\n"), 0644)
+	if raw, _ := ReadFile(base, "/Makefile"); string(raw) != "all:\r\n" {
+		t.Errorf("Makefile: stored %q", raw)
+	}
+}
+
+func TestTextFsUnsupported(t *testing.T) {
+	fs := NewTextFs(NewMemMapFs(), LineEndingCRLF)
+
+	f, err := fs.Create("/x.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("a\nb")
+	if pos, err := f.Seek(0, io.SeekCurrent); err != nil || pos != 3 {
+		t.Errorf("Seek(0, SeekCurrent): %d, %v", pos, err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err == nil {
+		t.Error("Seek(0, SeekStart): expected an error")
+	}
+	if _, err := f.Read(make([]byte, 1)); err == nil {
+		t.Error("Read on a file opened for writing: expected an error")
+	}
+	if _, err := f.WriteAt([]byte("x"), 0); err == nil {
+		t.Error("WriteAt: expected an error")
+	}
+	f.Close()
+
+	if _, err := fs.OpenFile("/x.txt", os.O_RDWR, 0); err == nil {
+		t.Error("OpenFile(O_RDWR): expected an error")
+	}
+	f, err = fs.Open("/x.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.Write([]byte("x")); err == nil {
+		t.Error("Write on a file opened for reading: expected an error")
+	}
+	if _, err := f.ReadAt(make([]byte, 1), 0); err == nil {
+		t.Error("ReadAt: expected an error")
+	}
+}
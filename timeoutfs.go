@@ -0,0 +1,257 @@
+package afero
+
+import (
+	"os"
+	"time"
+)
+
+// The TimeoutFs passes all calls to the source Fs, but gives up on a call
+// not done after the timeout and returns an *os.PathError wrapping
+// os.ErrDeadlineExceeded. The same applies to the calls on the files it
+// returns. It is meant for file systems which may hang, e.g. on a network.
+//
+// This is best effort: a call given up on is not cancelled, it runs on in
+// the background and may still complete, i.e. a Write or Remove may happen
+// after it has been reported as timed out. A file opened too late is closed
+// again. Reads and writes go through a copy of the buffer, so a late call
+// never touches the buffer of the caller.
+type TimeoutFs struct {
+	source  Fs
+	timeout time.Duration
+}
+
+func NewTimeoutFs(source Fs, timeout time.Duration) Fs {
+	return &TimeoutFs{source: source, timeout: timeout}
+}
+
+// timeout runs fn and waits at most d for it to return.
+func timeout(d time.Duration, op, name string, fn func() error) error {
+	done := make(chan error, 1)
+	go func() { done <- fn() }()
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+		return &os.PathError{Op: op, Path: name, Err: os.ErrDeadlineExceeded}
+	}
+}
+
+// timedOut returns true for the errors returned by timeout when giving up,
+// the results of the call must not be used then.
+func timedOut(err error) bool {
+	perr, ok := err.(*os.PathError)
+	return ok && perr.Err == os.ErrDeadlineExceeded
+}
+
+func (t *TimeoutFs) do(op, name string, fn func() error) error {
+	return timeout(t.timeout, op, name, fn)
+}
+
+// open is like do for the calls returning a File, a file opened after the
+// timeout is closed.
+func (t *TimeoutFs) open(op, name string, open func() (File, error)) (File, error) {
+	type result struct {
+		f   File
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		f, err := open()
+		done <- result{f, err}
+	}()
+	timer := time.NewTimer(t.timeout)
+	defer timer.Stop()
+	select {
+	case r := <-done:
+		if r.err != nil {
+			return nil, r.err
+		}
+		return &timeoutFile{f: r.f, timeout: t.timeout}, nil
+	case <-timer.C:
+		go func() {
+			if r := <-done; r.err == nil {
+				r.f.Close()
+			}
+		}()
+		return nil, &os.PathError{Op: op, Path: name, Err: os.ErrDeadlineExceeded}
+	}
+}
+
+func (t *TimeoutFs) Name() string {
+	return "TimeoutFs"
+}
+
+func (t *TimeoutFs) Create(name string) (File, error) {
+	return t.open("open", name, func() (File, error) { return t.source.Create(name) })
+}
+
+func (t *TimeoutFs) Open(name string) (File, error) {
+	return t.open("open", name, func() (File, error) { return t.source.Open(name) })
+}
+
+func (t *TimeoutFs) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	return t.open("open", name, func() (File, error) { return t.source.OpenFile(name, flag, perm) })
+}
+
+func (t *TimeoutFs) Mkdir(name string, perm os.FileMode) error {
+	return t.do("mkdir", name, func() error { return t.source.Mkdir(name, perm) })
+}
+
+func (t *TimeoutFs) MkdirAll(path string, perm os.FileMode) error {
+	return t.do("mkdir", path, func() error { return t.source.MkdirAll(path, perm) })
+}
+
+func (t *TimeoutFs) Remove(name string) error {
+	return t.do("remove", name, func() error { return t.source.Remove(name) })
+}
+
+func (t *TimeoutFs) RemoveAll(path string) error {
+	return t.do("remove", path, func() error { return t.source.RemoveAll(path) })
+}
+
+func (t *TimeoutFs) Rename(oldname, newname string) error {
+	return t.do("rename", oldname, func() error { return t.source.Rename(oldname, newname) })
+}
+
+func (t *TimeoutFs) Stat(name string) (fi os.FileInfo, err error) {
+	var sfi os.FileInfo
+	err = t.do("stat", name, func() (err error) {
+		sfi, err = t.source.Stat(name)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sfi, nil
+}
+
+func (t *TimeoutFs) Chmod(name string, mode os.FileMode) error {
+	return t.do("chmod", name, func() error { return t.source.Chmod(name, mode) })
+}
+
+func (t *TimeoutFs) Chtimes(name string, atime, mtime time.Time) error {
+	return t.do("chtimes", name, func() error { return t.source.Chtimes(name, atime, mtime) })
+}
+
+type timeoutFile struct {
+	f       File
+	timeout time.Duration
+}
+
+func (f *timeoutFile) do(op string, fn func() error) error {
+	return timeout(f.timeout, op, f.f.Name(), fn)
+}
+
+// read runs a read into a copy of p, so a late read doesn't write to p.
+func (f *timeoutFile) read(op string, p []byte, read func(buf []byte) (int, error)) (int, error) {
+	buf := make([]byte, len(p))
+	var n int
+	err := f.do(op, func() (err error) {
+		n, err = read(buf)
+		return err
+	})
+	if timedOut(err) {
+		return 0, err
+	}
+	return copy(p, buf[:n]), err
+}
+
+// write runs a write of a copy of p, so a late write doesn't read from p.
+func (f *timeoutFile) write(op string, p []byte, write func(buf []byte) (int, error)) (int, error) {
+	buf := append([]byte(nil), p...)
+	var n int
+	err := f.do(op, func() (err error) {
+		n, err = write(buf)
+		return err
+	})
+	if timedOut(err) {
+		return 0, err
+	}
+	return n, err
+}
+
+func (f *timeoutFile) Close() error {
+	return f.do("close", f.f.Close)
+}
+
+func (f *timeoutFile) Read(p []byte) (int, error) {
+	return f.read("read", p, f.f.Read)
+}
+
+func (f *timeoutFile) ReadAt(p []byte, off int64) (int, error) {
+	return f.read("read", p, func(buf []byte) (int, error) { return f.f.ReadAt(buf, off) })
+}
+
+func (f *timeoutFile) Write(p []byte) (int, error) {
+	return f.write("write", p, f.f.Write)
+}
+
+func (f *timeoutFile) WriteAt(p []byte, off int64) (int, error) {
+	return f.write("write", p, func(buf []byte) (int, error) { return f.f.WriteAt(buf, off) })
+}
+
+func (f *timeoutFile) WriteString(s string) (int, error) {
+	return f.Write([]byte(s))
+}
+
+func (f *timeoutFile) Seek(offset int64, whence int) (int64, error) {
+	var pos int64
+	err := f.do("seek", func() (err error) {
+		pos, err = f.f.Seek(offset, whence)
+		return err
+	})
+	if timedOut(err) {
+		return 0, err
+	}
+	return pos, err
+}
+
+func (f *timeoutFile) Name() string {
+	return f.f.Name()
+}
+
+func (f *timeoutFile) Readdir(count int) (fis []os.FileInfo, err error) {
+	var rfis []os.FileInfo
+	err = f.do("readdir", func() (err error) {
+		rfis, err = f.f.Readdir(count)
+		return err
+	})
+	if timedOut(err) {
+		return nil, err
+	}
+	return rfis, err
+}
+
+func (f *timeoutFile) Readdirnames(n int) (names []string, err error) {
+	var rnames []string
+	err = f.do("readdir", func() (err error) {
+		rnames, err = f.f.Readdirnames(n)
+		return err
+	})
+	if timedOut(err) {
+		return nil, err
+	}
+	return rnames, err
+}
+
+func (f *timeoutFile) Stat() (os.FileInfo, error) {
+	var fi os.FileInfo
+	err := f.do("stat", func() (err error) {
+		fi, err = f.f.Stat()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fi, nil
+}
+
+func (f *timeoutFile) Sync() error {
+	return f.do("sync", f.f.Sync)
+}
+
+func (f *timeoutFile) Truncate(size int64) error {
+	return f.do("truncate", func() error { return f.f.Truncate(size) })
+}
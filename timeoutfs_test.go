@@ -0,0 +1,76 @@
+package afero
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+// slowFs blocks Stat and the writes to files until release is closed,
+// every write done is signaled on wrote.
+type slowFs struct {
+	Fs
+	release chan struct{}
+	wrote   chan struct{}
+}
+
+type slowFile struct {
+	File
+	fs *slowFs
+}
+
+func (s *slowFs) Stat(name string) (os.FileInfo, error) {
+	<-s.release
+	return s.Fs.Stat(name)
+}
+
+func (s *slowFs) Create(name string) (File, error) {
+	f, err := s.Fs.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	return slowFile{f, s}, nil
+}
+
+func (f slowFile) Write(p []byte) (int, error) {
+	<-f.fs.release
+	defer func() { f.fs.wrote <- struct{}{} }()
+	return f.File.Write(p)
+}
+
+func TestTimeoutFs(t *testing.T) {
+	source := &slowFs{Fs: &MemMapFs{}, release: make(chan struct{}), wrote: make(chan struct{}, 1)}
+	fs := NewTimeoutFs(source, 10*time.Millisecond)
+
+	if err := fs.Mkdir("/dir", 0755); err != nil {
+		t.Errorf("Mkdir: %v", err)
+	}
+	if _, err := fs.Stat("/dir"); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("Stat: expected a timeout, got %v", err)
+	}
+
+	f, err := fs.Create("/dir/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := []byte("data")
+	if n, err := f.Write(buf); n != 0 || !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("Write: expected a timeout, got %d, %v", n, err)
+	}
+	buf[0] = 'X'
+
+	// the abandoned write completes in the background, with the data
+	// as it was when Write was called
+	close(source.release)
+	<-source.wrote
+	if _, err := fs.Stat("/dir/file"); err != nil {
+		t.Errorf("Stat: %v", err)
+	}
+	if data, err := ReadFile(fs, "/dir/file"); err != nil || string(data) != "data" {
+		t.Errorf("Got %q, %v", data, err)
+	}
+	if err := f.Close(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,18 @@
+package afero
+
+// Truncater is an optional interface of an Fs. It is implemented by file
+// systems which can change the size of a file by name, see os.Truncate.
+// A file grown this way is zero filled. Without it, open the file, call
+// File.Truncate and close it again:
+//
+//	if t, ok := fs.(afero.Truncater); ok {
+//		err = t.Truncate("file", size)
+//	}
+type Truncater interface {
+	Truncate(name string, size int64) error
+}
+
+var (
+	_ Truncater = OsFs{}
+	_ Truncater = &MemMapFs{}
+)
@@ -0,0 +1,47 @@
+package afero
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTruncater(t *testing.T) {
+	defer removeAllTestFiles(t)
+	for _, fs := range Fss {
+		truncater, ok := fs.(Truncater)
+		if !ok {
+			t.Fatalf("%s does not implement Truncater", fs.Name())
+		}
+		dir := testDir(fs)
+		name := filepath.Join(dir, "file")
+		if err := WriteFile(fs, name, []byte("0123456789"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := truncater.Truncate(name, 4); err != nil {
+			t.Fatalf("%s: %v", fs.Name(), err)
+		}
+		if data, err := ReadFile(fs, name); err != nil || string(data) != "0123" {
+			t.Errorf("%s: shrinking: got %q, %v", fs.Name(), data, err)
+		}
+
+		if err := truncater.Truncate(name, 8); err != nil {
+			t.Fatalf("%s: %v", fs.Name(), err)
+		}
+		if data, err := ReadFile(fs, name); err != nil || !bytes.Equal(data, []byte("0123\x00\x00\x00\x00")) {
+			t.Errorf("%s: growing: got %q, %v", fs.Name(), data, err)
+		}
+
+		if err := truncater.Truncate(filepath.Join(dir, "missing"), 0); !os.IsNotExist(err) {
+			t.Errorf("%s: expected a not exist error, got %v", fs.Name(), err)
+		}
+		if err := truncater.Truncate(dir, 0); err == nil {
+			t.Errorf("%s: truncated a directory", fs.Name())
+		}
+		if err := truncater.Truncate(name, -1); err == nil {
+			t.Errorf("%s: truncated to a negative size", fs.Name())
+		}
+	}
+}
@@ -1,12 +1,36 @@
 package afero
 
 import (
+	"context"
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"syscall"
 )
 
+// UnionFs is implemented by the union file systems, CacheOnReadFs and
+// CopyOnWriteFs. It gives access to the file systems they are made of, e.g.
+// to inspect or wrap them again, or to write to the layer directly.
+//
+//	if u, ok := fs.(afero.UnionFs); ok {
+//		err = afero.WriteFile(u.Layer(), "file", data, 0644)
+//	}
+type UnionFs interface {
+	Fs
+	// Base returns the file system below the layer.
+	Base() Fs
+	// Layer returns the file system on top of the base, the cache or the
+	// overlay.
+	Layer() Fs
+}
+
+var (
+	_ UnionFs = &CacheOnReadFs{}
+	_ UnionFs = &CopyOnWriteFs{}
+)
+
 // The UnionFile implements the afero.File interface and will be returned
 // when reading a directory present at least in the overlay or opening a file
 // for writing.
@@ -17,14 +41,15 @@ import (
 // from the overlay will be used.
 //
 // When opening files for writing (Create() / OpenFile() with the right flags)
-// the operations will be done in both layers, starting with the overlay. A
-// successful read in the overlay will move the cursor position in the base layer
-// by the number of bytes read.
+// the operations will be done in both layers, starting with the overlay. The
+// file offset of the overlay is authoritative: after every read, write or
+// seek, the offset of the base is set to the one of the overlay.
 type UnionFile struct {
-	base  File
-	layer File
-	off   int
-	files []os.FileInfo
+	base     File
+	layer    File
+	off      int
+	files    []os.FileInfo          // merged directory entries, nil until read
+	hideBase func(name string) bool // base entries to leave out, may be nil
 }
 
 func (f *UnionFile) Close() error {
@@ -40,13 +65,23 @@ func (f *UnionFile) Close() error {
 	return BADFD
 }
 
+// syncBase moves the file offset of the base to the one of the overlay.
+func (f *UnionFile) syncBase() error {
+	pos, err := f.layer.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	_, err = f.base.Seek(pos, io.SeekStart)
+	return err
+}
+
 func (f *UnionFile) Read(s []byte) (int, error) {
 	if f.layer != nil {
 		n, err := f.layer.Read(s)
 		if (err == nil || err == io.EOF) && f.base != nil {
 			// advance the file position also in the base file, the next
 			// call may be a write at this position (or a seek with SEEK_CUR)
-			if _, seekErr := f.base.Seek(int64(n), os.SEEK_CUR); seekErr != nil {
+			if seekErr := f.syncBase(); seekErr != nil {
 				// only overwrite err in case the seek fails: we need to
 				// report an eventual io.EOF to the caller
 				err = seekErr
@@ -60,13 +95,10 @@ func (f *UnionFile) Read(s []byte) (int, error) {
 	return 0, BADFD
 }
 
+// ReadAt reads from the overlay only, it doesn't change the file offsets.
 func (f *UnionFile) ReadAt(s []byte, o int64) (int, error) {
 	if f.layer != nil {
-		n, err := f.layer.ReadAt(s, o)
-		if (err == nil || err == io.EOF) && f.base != nil {
-			_, err = f.base.Seek(o+int64(n), os.SEEK_SET)
-		}
-		return n, err
+		return f.layer.ReadAt(s, o)
 	}
 	if f.base != nil {
 		return f.base.ReadAt(s, o)
@@ -77,8 +109,10 @@ func (f *UnionFile) ReadAt(s []byte, o int64) (int, error) {
 func (f *UnionFile) Seek(o int64, w int) (pos int64, err error) {
 	if f.layer != nil {
 		pos, err = f.layer.Seek(o, w)
-		if (err == nil || err == io.EOF) && f.base != nil {
-			_, err = f.base.Seek(o, w)
+		if err == nil && f.base != nil {
+			// the base may have a different size, don't seek relative
+			// to its end
+			_, err = f.base.Seek(pos, io.SeekStart)
 		}
 		return pos, err
 	}
@@ -92,7 +126,9 @@ func (f *UnionFile) Write(s []byte) (n int, err error) {
 	if f.layer != nil {
 		n, err = f.layer.Write(s)
 		if err == nil && f.base != nil { // hmm, do we have fixed size files where a write may hit the EOF mark?
-			_, err = f.base.Write(s)
+			if _, err = f.base.Write(s); err == nil {
+				err = f.syncBase()
+			}
 		}
 		return n, err
 	}
@@ -123,11 +159,15 @@ func (f *UnionFile) Name() string {
 	return f.base.Name()
 }
 
-// Readdir will weave the two directories together and
-// return a single view of the overlayed directories
+// Readdir will weave the two directories together and return a single
+// view of the overlayed directories. Files of the base hidden by a
+// whiteout in the overlay or below a layer only prefix (see
+// CopyOnWriteFs) and the whiteouts themselves are left out. Entries are
+// sorted by name, count behaves like for os.File.Readdir.
 func (f *UnionFile) Readdir(c int) (ofi []os.FileInfo, err error) {
-	if f.off == 0 {
+	if f.files == nil {
 		var files = make(map[string]os.FileInfo)
+		var hidden = make(map[string]bool)
 		var rfi []os.FileInfo
 		if f.layer != nil {
 			rfi, err = f.layer.Readdir(-1)
@@ -135,6 +175,10 @@ func (f *UnionFile) Readdir(c int) (ofi []os.FileInfo, err error) {
 				return nil, err
 			}
 			for _, fi := range rfi {
+				if strings.HasPrefix(fi.Name(), whiteoutPrefix) {
+					hidden[strings.TrimPrefix(fi.Name(), whiteoutPrefix)] = true
+					continue
+				}
 				files[fi.Name()] = fi
 			}
 		}
@@ -145,20 +189,33 @@ func (f *UnionFile) Readdir(c int) (ofi []os.FileInfo, err error) {
 				return nil, err
 			}
 			for _, fi := range rfi {
-				if _, exists := files[fi.Name()]; !exists {
+				if f.hideBase != nil && f.hideBase(fi.Name()) {
+					continue
+				}
+				if _, exists := files[fi.Name()]; !exists && !hidden[fi.Name()] {
 					files[fi.Name()] = fi
 				}
 			}
 		}
+		f.files = make([]os.FileInfo, 0, len(files))
 		for _, fi := range files {
 			f.files = append(f.files, fi)
 		}
+		sort.Sort(byName(f.files))
+	}
+	rest := f.files[f.off:]
+	if c <= 0 {
+		f.off = len(f.files)
+		return rest, nil
+	}
+	if len(rest) == 0 {
+		return nil, io.EOF
 	}
-	if c == -1 {
-		return f.files[f.off:], nil
+	if c > len(rest) {
+		c = len(rest)
 	}
-	defer func() { f.off += c }()
-	return f.files[f.off:c], nil
+	f.off += c
+	return rest[:c], nil
 }
 
 func (f *UnionFile) Readdirnames(c int) ([]string, error) {
@@ -215,7 +272,9 @@ func (f *UnionFile) WriteString(s string) (n int, err error) {
 	if f.layer != nil {
 		n, err = f.layer.WriteString(s)
 		if err == nil && f.base != nil {
-			_, err = f.base.WriteString(s)
+			if _, err = f.base.WriteString(s); err == nil {
+				err = f.syncBase()
+			}
 		}
 		return n, err
 	}
@@ -225,50 +284,85 @@ func (f *UnionFile) WriteString(s string) (n int, err error) {
 	return 0, BADFD
 }
 
-func copyToLayer(base Fs, layer Fs, name string) error {
+// copyToLayer copies the named file from base to layer and returns the
+// number of bytes copied.
+func copyToLayer(base Fs, layer Fs, name string) (int64, error) {
+	return copyToLayerContext(context.Background(), base, layer, name, nil)
+}
+
+// contextReader fails reads with the context's error once it is done.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+// copyToLayerContext is like copyToLayer, but stops copying when ctx is
+// done. The partial copy is removed from the layer in that case. The
+// progress is reported to progress, if not nil.
+func copyToLayerContext(ctx context.Context, base Fs, layer Fs, name string, progress ProgressFunc) (int64, error) {
 	bfh, err := base.Open(name)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer bfh.Close()
+	bfi, err := bfh.Stat()
+	if err != nil {
+		return 0, err
+	}
 
 	// First make sure the directory exists
 	exists, err := Exists(layer, filepath.Dir(name))
 	if err != nil {
-		return err
+		return 0, err
 	}
 	if !exists {
 		err = layer.MkdirAll(filepath.Dir(name), 0777) // FIXME?
 		if err != nil {
-			return err
+			return 0, err
 		}
 	}
 
+	// Remove a stale copy first: it has the mode of the base file, which
+	// may not allow writing to it.
+	layer.Remove(name)
+
 	// Create the file on the overlay
 	lfh, err := layer.Create(name)
 	if err != nil {
-		return err
+		return 0, err
 	}
-	n, err := io.Copy(lfh, bfh)
+	n, err := io.Copy(lfh, withProgress(&contextReader{ctx: ctx, r: bfh}, progress, name, bfi.Size()))
 	if err != nil {
 		// If anything fails, clean up the file
 		layer.Remove(name)
 		lfh.Close()
-		return err
+		return 0, err
 	}
 
-	bfi, err := bfh.Stat()
-	if err != nil || bfi.Size() != n {
+	if bfi.Size() != n {
 		layer.Remove(name)
 		lfh.Close()
-		return syscall.EIO
+		return 0, syscall.EIO
 	}
 
 	err = lfh.Close()
 	if err != nil {
 		layer.Remove(name)
 		lfh.Close()
-		return err
+		return 0, err
+	}
+	// the copy must not look newer than the base file, even if its mode
+	// can't be set
+	err = layer.Chmod(name, bfi.Mode())
+	if terr := layer.Chtimes(name, bfi.ModTime(), bfi.ModTime()); err == nil {
+		err = terr
 	}
-	return layer.Chtimes(name, bfi.ModTime(), bfi.ModTime())
+	return n, err
 }
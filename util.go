@@ -20,10 +20,10 @@ import (
 	"bytes"
 	"fmt"
 	"io"
-	"log"
 	"os"
 	"path/filepath"
 	"strings"
+	"syscall"
 	"unicode"
 
 	"golang.org/x/text/transform"
@@ -38,6 +38,10 @@ func (a Afero) WriteReader(path string, r io.Reader) (err error) {
 	return WriteReader(a.Fs, path, r)
 }
 
+// WriteReader streams the content of r into the file at path, without
+// buffering it in memory. Missing parent directories are created. The file
+// is created or truncated as with Create (mode 0666 before umask on OsFs);
+// if copying fails, the partially written file is removed.
 func WriteReader(fs Fs, path string, r io.Reader) (err error) {
 	dir, _ := filepath.Split(path)
 	ospath := filepath.FromSlash(dir)
@@ -46,7 +50,7 @@ func WriteReader(fs Fs, path string, r io.Reader) (err error) {
 		err = fs.MkdirAll(ospath, 0777) // rwx, rw, r
 		if err != nil {
 			if err != os.ErrExist {
-				log.Fatalln(err)
+				return
 			}
 		}
 	}
@@ -55,10 +59,20 @@ func WriteReader(fs Fs, path string, r io.Reader) (err error) {
 	if err != nil {
 		return
 	}
-	defer file.Close()
+	return copyToFile(fs, path, file, r)
+}
 
-	_, err = io.Copy(file, r)
-	return
+// copyToFile copies r into the newly created file at path and closes it.
+// The file is removed if anything fails.
+func copyToFile(fs Fs, path string, file File, r io.Reader) error {
+	_, err := io.Copy(file, r)
+	if err1 := file.Close(); err == nil {
+		err = err1
+	}
+	if err != nil {
+		fs.Remove(path)
+	}
+	return err
 }
 
 // Same as WriteReader but checks to see if file/directory already exists.
@@ -89,10 +103,7 @@ func SafeWriteReader(fs Fs, path string, r io.Reader) (err error) {
 	if err != nil {
 		return
 	}
-	defer file.Close()
-
-	_, err = io.Copy(file, r)
-	return
+	return copyToFile(fs, path, file, r)
 }
 
 func (a Afero) GetTempDir(subPath string) string {
@@ -224,7 +235,26 @@ func (a Afero) DirExists(path string) (bool, error) {
 	return DirExists(a.Fs, path)
 }
 
-// DirExists checks if a path exists and is a directory.
+func (a Afero) FileExists(path string) (bool, error) {
+	return FileExists(a.Fs, path)
+}
+
+// FileExists checks if a path exists and is not a directory. A missing path
+// is reported as false with a nil error, the error is only set if Stat fails
+// for another reason, e.g. a permission error.
+func FileExists(fs Fs, path string) (bool, error) {
+	fi, err := fs.Stat(path)
+	if err == nil {
+		return !fi.IsDir(), nil
+	}
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return false, err
+}
+
+// DirExists checks if a path exists and is a directory. Like FileExists, it
+// returns an error only if Stat fails for another reason than a missing path.
 func DirExists(fs Fs, path string) (bool, error) {
 	fi, err := fs.Stat(path)
 	if err == nil && fi.IsDir() {
@@ -236,6 +266,36 @@ func DirExists(fs Fs, path string) (bool, error) {
 	return false, err
 }
 
+func (a Afero) EnsureDir(path string, perm os.FileMode) error {
+	return EnsureDir(a.Fs, path, perm)
+}
+
+// EnsureDir makes sure path is a directory, it creates it and its parents
+// with MkdirAll if missing. If path exists, but is not a directory, it
+// returns an *os.PathError wrapping syscall.ENOTDIR. It is safe to call
+// concurrently for the same path.
+func EnsureDir(fs Fs, path string, perm os.FileMode) error {
+	if ok, err := DirExists(fs, path); ok || err != nil {
+		return err
+	}
+	if err := fs.MkdirAll(path, perm); err != nil {
+		// someone else may have created it in the meantime
+		if ok, _ := DirExists(fs, path); ok {
+			return nil
+		}
+		return err
+	}
+	// not all Fs fail MkdirAll on an existing file, check it
+	fi, err := fs.Stat(path)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return &os.PathError{Op: "mkdir", Path: path, Err: syscall.ENOTDIR}
+	}
+	return nil
+}
+
 func (a Afero) IsDir(path string) (bool, error) {
 	return IsDir(a.Fs, path)
 }
@@ -253,32 +313,54 @@ func (a Afero) IsEmpty(path string) (bool, error) {
 	return IsEmpty(a.Fs, path)
 }
 
-// IsEmpty checks if a given file or directory is empty.
+// IsEmpty checks if a given file or directory is empty: a file of zero
+// length, or a directory without entries. Only the first entry of a
+// directory is read. If path doesn't exist, the error says so and matches
+// os.ErrNotExist with errors.Is.
 func IsEmpty(fs Fs, path string) (bool, error) {
-	if b, _ := Exists(fs, path); !b {
-		return false, fmt.Errorf("%q path does not exist", path)
-	}
 	fi, err := fs.Stat(path)
+	if os.IsNotExist(err) {
+		return false, notExistError{path}
+	}
 	if err != nil {
 		return false, err
 	}
-	if fi.IsDir() {
-		f, err := fs.Open(path)
-		defer f.Close()
-		if err != nil {
-			return false, err
-		}
-		list, err := f.Readdir(-1)
-		return len(list) == 0, nil
+	if !fi.IsDir() {
+		return fi.Size() == 0, nil
+	}
+	f, err := fs.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	names, err := f.Readdirnames(1)
+	if err != nil && err != io.EOF {
+		return false, err
 	}
-	return fi.Size() == 0, nil
+	return len(names) == 0, nil
+}
+
+// notExistError is returned by IsEmpty for a missing path.
+type notExistError struct {
+	path string
+}
+
+func (e notExistError) Error() string {
+	return fmt.Sprintf("%q path does not exist", e.path)
+}
+
+func (notExistError) Is(target error) bool {
+	return target == os.ErrNotExist
 }
 
 func (a Afero) Exists(path string) (bool, error) {
 	return Exists(a.Fs, path)
 }
 
-// Check if a file or directory exists.
+// Exists checks if a file or directory exists. Like FileExists and
+// DirExists, it returns an error only if Stat fails for another reason than
+// a missing path, but it doesn't tell files and directories apart: use one
+// of them to know whether path has the expected type.
 func Exists(fs Fs, path string) (bool, error) {
 	_, err := fs.Stat(path)
 	if err == nil {
@@ -18,12 +18,16 @@
 package afero
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"testing/iotest"
 	"time"
 )
 
@@ -65,6 +69,69 @@ func TestDirExists(t *testing.T) {
 	}
 }
 
+func TestFileExists(t *testing.T) {
+	fs := NewFaultFs(&MemMapFs{})
+	fs.MkdirAll("/dir", 0777)
+	WriteFile(fs, "/dir/file", []byte("data"), 0644)
+	fs.FailOn("stat", "/denied", os.ErrPermission)
+
+	for _, d := range []struct {
+		path       string
+		file, dir  bool
+		permission bool
+	}{
+		{"/dir/file", true, false, false},
+		{"/dir", false, true, false},
+		{"/dir/missing", false, false, false},
+		{"/denied", false, false, true},
+	} {
+		file, err := FileExists(fs, d.path)
+		if file != d.file || os.IsPermission(err) != d.permission {
+			t.Errorf("FileExists(%q): got %t, %v", d.path, file, err)
+		}
+		dir, err := DirExists(fs, d.path)
+		if dir != d.dir || os.IsPermission(err) != d.permission {
+			t.Errorf("DirExists(%q): got %t, %v", d.path, dir, err)
+		}
+	}
+}
+
+func TestEnsureDir(t *testing.T) {
+	defer removeAllTestFiles(t)
+	for _, fs := range Fss {
+		dir := testDir(fs)
+		path := filepath.Join(dir, "a", "b")
+
+		var wg sync.WaitGroup
+		errs := make([]error, 10)
+		for i := range errs {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				errs[i] = EnsureDir(fs, path, 0755)
+			}(i)
+		}
+		wg.Wait()
+		for _, err := range errs {
+			if err != nil {
+				t.Errorf("%s: %v", fs.Name(), err)
+			}
+		}
+		if ok, _ := DirExists(fs, path); !ok {
+			t.Errorf("%s: %s not created", fs.Name(), path)
+		}
+		if err := EnsureDir(fs, path, 0755); err != nil {
+			t.Errorf("%s: existing directory: %v", fs.Name(), err)
+		}
+
+		file := filepath.Join(dir, "file")
+		WriteFile(fs, file, nil, 0644)
+		if err := EnsureDir(fs, file, 0755); err == nil {
+			t.Errorf("%s: no error for an existing file", fs.Name())
+		}
+	}
+}
+
 func TestIsDir(t *testing.T) {
 	testFS = new(MemMapFs)
 
@@ -131,6 +198,9 @@ func TestIsEmpty(t *testing.T) {
 			if d.expectedErr.Error() != err.Error() {
 				t.Errorf("Test %d failed with err. Expected %q(%#v) got %q(%#v)", i, d.expectedErr, d.expectedErr, err, err)
 			}
+			if !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("Test %d: %v doesn't match os.ErrNotExist", i, err)
+			}
 		} else {
 			if d.expectedErr != err {
 				t.Errorf("Test %d failed. Expected error %q(%#v) got %q(%#v)", i, d.expectedErr, d.expectedErr, err, err)
@@ -139,6 +209,22 @@ func TestIsEmpty(t *testing.T) {
 	}
 }
 
+func TestIsEmptyReadsOneEntry(t *testing.T) {
+	fs := NewSpyFs(NewMemMapFs())
+	for i := 0; i < 3; i++ {
+		WriteFile(fs, fmt.Sprintf("/dir/file%d", i), nil, 0644)
+	}
+	fs.Reset()
+	if empty, err := IsEmpty(fs, "/dir"); empty || err != nil {
+		t.Fatalf("IsEmpty: %t, %v", empty, err)
+	}
+	for _, op := range fs.Operations() {
+		if op.Op == "readdir" || op.Op == "readdirnames" && op.Args[0] != 1 {
+			t.Errorf("IsEmpty listed the directory: %v", op)
+		}
+	}
+}
+
 func createZeroSizedFileInTempDir() (File, error) {
 	filePrefix := "_path_test_"
 	f, e := TempFile(testFS, "", filePrefix) // dir is os.TempDir()
@@ -377,3 +463,15 @@ func deleteTempDir(d string) {
 		// now what?
 	}
 }
+
+func TestWriteReaderCopyError(t *testing.T) {
+	fs := &MemMapFs{}
+	r := io.MultiReader(strings.NewReader("partial"), iotest.ErrReader(errors.New("read failed")))
+
+	if err := WriteReader(fs, "/dir/file.txt", r); err == nil {
+		t.Fatal("WriteReader did not return the read error")
+	}
+	if _, err := fs.Stat("/dir/file.txt"); !os.IsNotExist(err) {
+		t.Errorf("partial file left behind: %v", err)
+	}
+}
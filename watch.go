@@ -0,0 +1,117 @@
+package afero
+
+import (
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// EventOp describes the kind of change reported by an Event. The values are
+// those of fsnotify.Op.
+type EventOp uint32
+
+const (
+	EventCreate EventOp = 1 << iota
+	EventWrite
+	EventRemove
+	EventRename // reported for the old name, the new name gets EventCreate
+	EventChmod  // also reported for a change of the owner or of the times
+)
+
+func (op EventOp) String() string {
+	var names []string
+	for _, n := range []struct {
+		op   EventOp
+		name string
+	}{
+		{EventCreate, "CREATE"},
+		{EventWrite, "WRITE"},
+		{EventRemove, "REMOVE"},
+		{EventRename, "RENAME"},
+		{EventChmod, "CHMOD"},
+	} {
+		if op&n.op != 0 {
+			names = append(names, n.name)
+		}
+	}
+	return strings.Join(names, "|")
+}
+
+// An Event reports a change of the file Name.
+type Event struct {
+	Name string
+	Op   EventOp
+}
+
+func (e Event) String() string {
+	return e.Op.String() + " " + e.Name
+}
+
+// Watcher is implemented by the file systems which report changes.
+//
+// Watch subscribes to the changes of the file or directory path. For a
+// directory, the changes of its direct entries are reported as well, not
+// those further down. The returned func ends the subscription and closes
+// the channel, it may be called more than once. Events are dropped if the
+// receiver falls more than watchBuffer events behind.
+type Watcher interface {
+	Watch(path string) (<-chan Event, func(), error)
+}
+
+var (
+	_ Watcher = OsFs{}
+	_ Watcher = (*MemMapFs)(nil)
+)
+
+// watchBuffer is the number of events buffered for a subscription.
+const watchBuffer = 128
+
+// watchers is the set of subscriptions of a Watcher implementation. The zero
+// value is ready to use.
+type watchers struct {
+	mu   sync.Mutex
+	subs map[*subscription]struct{}
+}
+
+type subscription struct {
+	path string
+	ch   chan Event
+}
+
+// add subscribes to the changes of the clean path.
+func (w *watchers) add(path string) (<-chan Event, func()) {
+	s := &subscription{path: path, ch: make(chan Event, watchBuffer)}
+	w.mu.Lock()
+	if w.subs == nil {
+		w.subs = make(map[*subscription]struct{})
+	}
+	w.subs[s] = struct{}{}
+	w.mu.Unlock()
+	return s.ch, func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		if _, ok := w.subs[s]; ok {
+			delete(w.subs, s)
+			close(s.ch)
+		}
+	}
+}
+
+// notify sends an event to the subscriptions for name and its directory.
+// It never blocks, so it may be called with locks held.
+func (w *watchers) notify(name string, op EventOp) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.subs) == 0 {
+		return
+	}
+	dir := filepath.Dir(name)
+	for s := range w.subs {
+		if s.path == name || s.path == dir {
+			select {
+			case s.ch <- Event{Name: name, Op: op}:
+			default:
+			}
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package afero
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// nextEvent returns the next event on ch with the given name, skipping
+// others, e.g. those of the files below a watched directory.
+func nextEvent(t *testing.T, ch <-chan Event, name string) Event {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case e, ok := <-ch:
+			if !ok {
+				t.Fatalf("channel closed waiting for an event for %s", name)
+			}
+			if e.Name == name {
+				return e
+			}
+		case <-timeout:
+			t.Fatalf("no event for %s", name)
+		}
+	}
+}
+
+func TestMemMapFsWatch(t *testing.T) {
+	fs := NewMemMapFs()
+	fs.MkdirAll("/dir", 0777)
+	ch, stop, err := fs.(Watcher).Watch("/dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+
+	f, _ := fs.Create("/dir/file")
+	f.WriteString("data")
+	f.Close()
+	fs.Chmod("/dir/file", 0600)
+	fs.Rename("/dir/file", "/dir/renamed")
+	fs.Remove("/dir/renamed")
+	fs.Mkdir("/dir/sub", 0777)
+	WriteFile(fs, "/dir/sub/deep", []byte("not reported"), 0644)
+	WriteFile(fs, "/other", []byte("not reported"), 0644)
+	fs.Chtimes("/dir", time.Now(), time.Now())
+	stop()
+
+	var got []string
+	for e := range ch {
+		got = append(got, e.String())
+	}
+	want := []string{
+		"CREATE /dir/file",
+		"WRITE /dir/file",
+		"CHMOD /dir/file",
+		"RENAME /dir/file",
+		"CREATE /dir/renamed",
+		"REMOVE /dir/renamed",
+		"CREATE /dir/sub",
+		"CHMOD /dir",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("event %d: got %q, want %q", i, got[i], want[i])
+		}
+	}
+
+	// stop may be called again
+	stop()
+
+	if _, _, err := fs.(Watcher).Watch("/missing"); !os.IsNotExist(err) {
+		t.Errorf("Watch of a missing path: got %v", err)
+	}
+}
+
+func TestMemMapFsWatchFile(t *testing.T) {
+	fs := NewMemMapFs()
+	WriteFile(fs, "/file", []byte("a"), 0644)
+	ch, stop, err := fs.(Watcher).Watch("/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+
+	f, _ := fs.OpenFile("/file", os.O_WRONLY|os.O_APPEND, 0)
+	f.WriteString("b")
+	f.Close()
+	if e := nextEvent(t, ch, "/file"); e.Op != EventWrite {
+		t.Errorf("got %v, want a write", e)
+	}
+	fs.Remove("/file")
+	if e := nextEvent(t, ch, "/file"); e.Op != EventRemove {
+		t.Errorf("got %v, want a remove", e)
+	}
+}
+
+func TestOsFsWatch(t *testing.T) {
+	dir, err := TempDir(NewOsFs(), "", "afero-watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ch, stop, err := OsFs{}.Watch(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+
+	name := filepath.Join(dir, "file")
+	WriteFile(OsFs{}, name, []byte("data"), 0644)
+	if e := nextEvent(t, ch, name); e.Op&EventCreate == 0 {
+		t.Errorf("got %v, want a create", e)
+	}
+	os.Remove(name)
+	for e := nextEvent(t, ch, name); e.Op&EventRemove == 0; e = nextEvent(t, ch, name) {
+	}
+
+	stop()
+	for range ch {
+	}
+
+	if _, _, err := (OsFs{}).Watch(filepath.Join(dir, "missing")); !os.IsNotExist(err) {
+		t.Errorf("Watch of a missing path: got %v", err)
+	}
+}
@@ -0,0 +1,49 @@
+// Package yaml reads and writes YAML files on an afero.Fs, like ReadJSON and
+// WriteJSON do for JSON. It is a separate package, so the afero package does
+// not import a YAML library.
+package yaml
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/afero"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// Read decodes the YAML file at path into v, like yaml.Unmarshal. A
+// decoding error is returned as an *os.PathError with Op "decode", so it
+// names the file.
+func Read(fs afero.Fs, path string, v interface{}) error {
+	f, err := fs.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := yamlv3.NewDecoder(f).Decode(v); err != nil {
+		return &os.PathError{Op: "decode", Path: path, Err: err}
+	}
+	return nil
+}
+
+// Write writes v encoded as YAML to the file at path, like afero.WriteFile.
+// If v can't be encoded, an *os.PathError with Op "encode" is returned and
+// the file is not touched.
+func Write(fs afero.Fs, path string, v interface{}, perm os.FileMode) error {
+	data, err := marshal(v)
+	if err != nil {
+		return &os.PathError{Op: "encode", Path: path, Err: err}
+	}
+	return afero.WriteFile(fs, path, data, perm)
+}
+
+// marshal is yaml.Marshal, but returns an error instead of panicking for
+// values it can't encode, e.g. funcs.
+func marshal(v interface{}) (data []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("yaml: %v", r)
+		}
+	}()
+	return yamlv3.Marshal(v)
+}
@@ -0,0 +1,59 @@
+package yaml
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+type config struct {
+	Name  string   `yaml:"name"`
+	Port  int      `yaml:"port"`
+	Hosts []string `yaml:"hosts"`
+}
+
+func TestReadWrite(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	want := config{Name: "afero", Port: 8080, Hosts: []string{"a", "b"}}
+
+	if err := Write(fs, "/config.yaml", want, 0644); err != nil {
+		t.Fatal(err)
+	}
+	var got config
+	if err := Read(fs, "/config.yaml", &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	if err := Read(fs, "/missing.yaml", &got); !os.IsNotExist(err) {
+		t.Errorf("missing file: got %v", err)
+	}
+}
+
+func TestReadDecodeError(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, "/bad.yaml", []byte("port: [not a number"), 0644)
+
+	var cfg config
+	err := Read(fs, "/bad.yaml", &cfg)
+	if perr, ok := err.(*os.PathError); !ok || perr.Op != "decode" || perr.Path != "/bad.yaml" {
+		t.Fatalf("got %#v, want a decode *os.PathError for /bad.yaml", err)
+	}
+}
+
+func TestWriteEncodeError(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, "/config.yaml", []byte("name: x\n"), 0644)
+
+	err := Write(fs, "/config.yaml", map[string]interface{}{"f": func() {}}, 0644)
+	if perr, ok := err.(*os.PathError); !ok || perr.Op != "encode" {
+		t.Fatalf("got %v, want an encode *os.PathError", err)
+	}
+	if data, _ := afero.ReadFile(fs, "/config.yaml"); string(data) != "name: x\n" {
+		t.Errorf("file changed after a failed encode: %q", data)
+	}
+}
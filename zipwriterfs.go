@@ -0,0 +1,261 @@
+package afero
+
+import (
+	"archive/zip"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var errZipWriteOnly = errors.New("zip archive is write-only")
+
+// ZipWriterFs is a write-only Fs creating a zip archive. Every file created
+// on it is appended to the archive as it is written, directories become
+// directory entries. Only one file can be written at a time: creating a
+// file closes the one written before.
+//
+// Files already written can't be read, changed or removed, only Stat works
+// on them. The Fs implements io.Closer, the archive is complete only after
+// calling Close.
+type ZipWriterFs struct {
+	mu     sync.Mutex
+	zw     *zip.Writer
+	files  map[string]*zip.FileHeader
+	cur    *zipWriterFile
+	closed bool
+}
+
+func NewZipWriterFs(w io.Writer) Fs {
+	return &ZipWriterFs{zw: zip.NewWriter(w), files: make(map[string]*zip.FileHeader)}
+}
+
+// zipName returns the name of an archive entry, relative and with forward
+// slashes.
+func zipName(name string) string {
+	return strings.TrimPrefix(tarName(name), "/")
+}
+
+func (fs *ZipWriterFs) Name() string { return "ZipWriterFs" }
+
+// Close finishes the file being written and writes the central directory
+// of the archive. It does not close the underlying writer.
+func (fs *ZipWriterFs) Close() error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.closed {
+		return ErrFileClosed
+	}
+	fs.closeCurrent()
+	fs.closed = true
+	return fs.zw.Close()
+}
+
+// closeCurrent marks the file being written as done, fs.mu must be held.
+func (fs *ZipWriterFs) closeCurrent() {
+	if fs.cur != nil {
+		fs.cur.hdr.UncompressedSize64 = uint64(fs.cur.size)
+		fs.cur.closed = true
+		fs.cur = nil
+	}
+}
+
+// create adds an entry for hdr to the archive, fs.mu must be held.
+func (fs *ZipWriterFs) create(op string, hdr *zip.FileHeader) (io.Writer, error) {
+	if fs.closed {
+		return nil, ErrFileClosed
+	}
+	name := strings.TrimSuffix(hdr.Name, "/")
+	if name == "" {
+		return nil, &os.PathError{Op: op, Path: hdr.Name, Err: os.ErrInvalid}
+	}
+	if _, ok := fs.files[name]; ok {
+		return nil, &os.PathError{Op: op, Path: name, Err: os.ErrExist}
+	}
+	fs.closeCurrent()
+	w, err := fs.zw.CreateHeader(hdr)
+	if err != nil {
+		return nil, err
+	}
+	fs.files[name] = hdr
+	return w, nil
+}
+
+func (fs *ZipWriterFs) Create(name string) (File, error) {
+	return fs.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+// OpenFile creates a new entry for name if flag allows writing, reading
+// isn't supported.
+func (fs *ZipWriterFs) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	if flag&(os.O_WRONLY|syscall.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) == 0 {
+		return nil, &os.PathError{Op: "open", Path: name, Err: errZipWriteOnly}
+	}
+	hdr := &zip.FileHeader{Name: zipName(name), Method: zip.Deflate, Modified: time.Now()}
+	hdr.SetMode(perm)
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	w, err := fs.create("open", hdr)
+	if err != nil {
+		return nil, err
+	}
+	fs.cur = &zipWriterFile{fs: fs, name: name, hdr: hdr, w: w}
+	return fs.cur, nil
+}
+
+func (fs *ZipWriterFs) Open(name string) (File, error) {
+	return nil, &os.PathError{Op: "open", Path: name, Err: errZipWriteOnly}
+}
+
+func (fs *ZipWriterFs) Mkdir(name string, perm os.FileMode) error {
+	hdr := &zip.FileHeader{Name: zipName(name) + "/", Modified: time.Now()}
+	hdr.SetMode(os.ModeDir | perm)
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	_, err := fs.create("mkdir", hdr)
+	return err
+}
+
+func (fs *ZipWriterFs) MkdirAll(name string, perm os.FileMode) error {
+	name = zipName(name)
+	if name == "" {
+		return nil
+	}
+	if fi, err := fs.Stat(name); err == nil {
+		if fi.IsDir() {
+			return nil
+		}
+		return &os.PathError{Op: "mkdir", Path: name, Err: syscall.ENOTDIR}
+	}
+	if err := fs.MkdirAll(path.Dir(name), perm); err != nil {
+		return err
+	}
+	return fs.Mkdir(name, perm)
+}
+
+// Stat returns the FileInfo of an entry written before.
+func (fs *ZipWriterFs) Stat(name string) (os.FileInfo, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	hdr, ok := fs.files[zipName(name)]
+	if !ok {
+		return nil, &os.PathError{Op: "stat", Path: name, Err: os.ErrNotExist}
+	}
+	h := *hdr
+	if fs.cur != nil && fs.cur.hdr == hdr {
+		h.UncompressedSize64 = uint64(fs.cur.size)
+	}
+	return h.FileInfo(), nil
+}
+
+func (fs *ZipWriterFs) Remove(name string) error {
+	return &os.PathError{Op: "remove", Path: name, Err: syscall.EPERM}
+}
+
+func (fs *ZipWriterFs) RemoveAll(name string) error {
+	return &os.PathError{Op: "remove", Path: name, Err: syscall.EPERM}
+}
+
+func (fs *ZipWriterFs) Rename(oldname, newname string) error {
+	return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: syscall.EPERM}
+}
+
+func (fs *ZipWriterFs) Chmod(name string, mode os.FileMode) error {
+	return &os.PathError{Op: "chmod", Path: name, Err: syscall.EPERM}
+}
+
+func (fs *ZipWriterFs) Chtimes(name string, atime, mtime time.Time) error {
+	return &os.PathError{Op: "chtimes", Path: name, Err: syscall.EPERM}
+}
+
+type zipWriterFile struct {
+	fs     *ZipWriterFs
+	name   string
+	hdr    *zip.FileHeader
+	w      io.Writer
+	size   int64
+	closed bool // guarded by fs.mu
+}
+
+func (f *zipWriterFile) Name() string { return f.name }
+
+func (f *zipWriterFile) Write(p []byte) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if f.closed {
+		return 0, ErrFileClosed
+	}
+	n, err := f.w.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *zipWriterFile) WriteString(s string) (int, error) {
+	return f.Write([]byte(s))
+}
+
+func (f *zipWriterFile) Close() error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if f.closed {
+		return ErrFileClosed
+	}
+	f.fs.closeCurrent()
+	return nil
+}
+
+// Seek only reports the current offset, entries are written sequentially.
+func (f *zipWriterFile) Seek(offset int64, whence int) (int64, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if f.closed {
+		return 0, ErrFileClosed
+	}
+	if offset == 0 && whence == io.SeekCurrent {
+		return f.size, nil
+	}
+	return 0, &os.PathError{Op: "seek", Path: f.name, Err: syscall.ESPIPE}
+}
+
+func (f *zipWriterFile) WriteAt(p []byte, off int64) (int, error) {
+	return 0, &os.PathError{Op: "writeat", Path: f.name, Err: syscall.ESPIPE}
+}
+
+func (f *zipWriterFile) Read(p []byte) (int, error) {
+	return 0, &os.PathError{Op: "read", Path: f.name, Err: errZipWriteOnly}
+}
+
+func (f *zipWriterFile) ReadAt(p []byte, off int64) (int, error) {
+	return 0, &os.PathError{Op: "read", Path: f.name, Err: errZipWriteOnly}
+}
+
+func (f *zipWriterFile) Readdir(count int) ([]os.FileInfo, error) {
+	return nil, &os.PathError{Op: "readdir", Path: f.name, Err: syscall.ENOTDIR}
+}
+
+func (f *zipWriterFile) Readdirnames(n int) ([]string, error) {
+	return nil, &os.PathError{Op: "readdir", Path: f.name, Err: syscall.ENOTDIR}
+}
+
+func (f *zipWriterFile) Truncate(size int64) error {
+	return &os.PathError{Op: "truncate", Path: f.name, Err: syscall.EPERM}
+}
+
+func (f *zipWriterFile) Sync() error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if f.closed {
+		return ErrFileClosed
+	}
+	return f.fs.zw.Flush()
+}
+
+func (f *zipWriterFile) Stat() (os.FileInfo, error) {
+	return f.fs.Stat(f.name)
+}
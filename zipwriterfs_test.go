@@ -0,0 +1,99 @@
+package afero
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestZipWriterFs(t *testing.T) {
+	var buf bytes.Buffer
+	fs := NewZipWriterFs(&buf)
+
+	if err := WriteFile(fs, "/z/last.txt", []byte("last"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.MkdirAll("/a/b", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFile(fs, "a/b/c.txt", []byte("nested"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := fs.Create("first.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString("first"); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := fs.Stat("first.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Size() != 5 {
+		t.Errorf("got size %d, want 5", fi.Size())
+	}
+
+	// creating another file finishes the open one
+	g, err := fs.Create("second.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte("more")); err != ErrFileClosed {
+		t.Errorf("expected ErrFileClosed, got %v", err)
+	}
+	g.Close()
+
+	if _, err := fs.Create("first.txt"); !os.IsExist(err) {
+		t.Errorf("expected an exist error, got %v", err)
+	}
+	if _, err := fs.Open("first.txt"); err == nil {
+		t.Error("expected an error reading from the archive")
+	}
+	if err := fs.(io.Closer).Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Create("late.txt"); err != ErrFileClosed {
+		t.Errorf("expected ErrFileClosed, got %v", err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		name, content string
+		mode          os.FileMode
+	}{
+		{"z/last.txt", "last", 0600},
+		{"a/", "", os.ModeDir | 0755},
+		{"a/b/", "", os.ModeDir | 0755},
+		{"a/b/c.txt", "nested", 0644},
+		{"first.txt", "first", 0666},
+		{"second.txt", "", 0666},
+	}
+	if len(zr.File) != len(want) {
+		t.Fatalf("got %d entries, want %d", len(zr.File), len(want))
+	}
+	for i, zf := range zr.File {
+		if zf.Name != want[i].name || zf.Mode() != want[i].mode {
+			t.Errorf("entry %d: got %s %v, want %s %v", i, zf.Name, zf.Mode(), want[i].name, want[i].mode)
+			continue
+		}
+		r, err := zf.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ioutil.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want[i].content {
+			t.Errorf("%s: got %q, want %q", zf.Name, got, want[i].content)
+		}
+	}
+}